@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bufio"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/vaaandark/PixelHub/internal/backup"
+	"github.com/vaaandark/PixelHub/internal/config"
+	"github.com/vaaandark/PixelHub/internal/database"
+	"github.com/vaaandark/PixelHub/internal/handlers"
+	"github.com/vaaandark/PixelHub/internal/storage"
+)
+
+// runCommand 执行管理命令（pixelhub <command> [flags]）
+func runCommand(cfg *config.Config, args []string) error {
+	switch args[0] {
+	case "migrate":
+		return migrate(cfg, args[1:])
+	case "rewrite-urls":
+		return rewriteURLs(cfg, args[1:])
+	case "storage":
+		return storageCommand(cfg, args[1:])
+	case "import":
+		return runImport(cfg, args[1:])
+	case "export":
+		return runExport(cfg, args[1:])
+	case "backup":
+		return runBackup(cfg, args[1:])
+	case "restore":
+		return runRestore(cfg, args[1:])
+	default:
+		return fmt.Errorf("unknown command: %s", args[0])
+	}
+}
+
+// rewriteURLs 批量替换数据库中显式保存的图片 URL 前缀（如更换 CDN 域名后）
+func rewriteURLs(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("rewrite-urls", flag.ExitOnError)
+	from := fs.String("from", "", "old URL prefix, e.g. https://old-cdn.example.com")
+	to := fs.String("to", "", "new URL prefix, e.g. https://cdn.example.com")
+	fs.Parse(args)
+
+	if *from == "" || *to == "" {
+		return fmt.Errorf("both -from and -to are required")
+	}
+
+	db, err := database.InitDB(&cfg.Database)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close()
+
+	n, err := db.RewriteURLPrefix(*from, *to)
+	if err != nil {
+		return fmt.Errorf("failed to rewrite URLs: %w", err)
+	}
+	log.Printf("Rewrote %d image URLs from %s to %s", n, *from, *to)
+	return nil
+}
+
+// migrate 查看或执行数据库迁移（pixelhub migrate status|up）
+func migrate(cfg *config.Config, args []string) error {
+	if len(args) != 1 || (args[0] != "status" && args[0] != "up") {
+		return fmt.Errorf("usage: pixelhub migrate status|up")
+	}
+
+	db, err := database.OpenStore(&cfg.Database)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	if args[0] == "up" {
+		n, err := db.Migrate()
+		if err != nil {
+			return err
+		}
+		log.Printf("Applied %d migrations", n)
+		return nil
+	}
+
+	statuses, err := db.MigrationStatus()
+	if err != nil {
+		return fmt.Errorf("failed to get migration status: %w", err)
+	}
+	for _, s := range statuses {
+		state := "pending"
+		if s.AppliedAt != nil {
+			state = "applied " + s.AppliedAt.Format(time.RFC3339)
+		}
+		fmt.Printf("%4d  %-30s %s\n", s.Version, s.Name, state)
+	}
+	return nil
+}
+
+// runBackup 将数据库快照和图片对象打包为 tar.gz（pixelhub backup -o <file>）
+func runBackup(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("backup", flag.ExitOnError)
+	out := fs.String("o", "", "output archive, e.g. pixelhub-backup.tar.gz")
+	withObjects := fs.Bool("objects", true, "include image objects from the storage provider")
+	fs.Parse(args)
+
+	if *out == "" {
+		return fmt.Errorf("-o is required")
+	}
+
+	db, err := database.OpenStore(&cfg.Database)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	var provider storage.Provider
+	if *withObjects {
+		if provider, err = storage.NewProvider(cfg); err != nil {
+			return fmt.Errorf("failed to initialize storage provider: %w", err)
+		}
+	}
+
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	manifest, err := backup.Write(f, db, provider)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(*out)
+		return err
+	}
+	log.Printf("Backed up database and %d objects to %s", len(manifest.Objects), *out)
+	return nil
+}
+
+// runRestore 校验备份并恢复数据库和图片对象（pixelhub restore -i <file>）
+// 图片会上传到当前配置的存储，因此可以借此迁移到新的存储提供商
+func runRestore(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("restore", flag.ExitOnError)
+	in := fs.String("i", "", "backup archive created by pixelhub backup")
+	force := fs.Bool("force", false, "overwrite the existing database")
+	withObjects := fs.Bool("objects", true, "re-upload image objects to the configured storage provider")
+	fs.Parse(args)
+
+	if *in == "" {
+		return fmt.Errorf("-i is required")
+	}
+	if cfg.Database.Driver != "" && cfg.Database.Driver != "sqlite" {
+		return fmt.Errorf("restore is only supported for SQLite")
+	}
+
+	f, err := os.Open(*in)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	dir, err := os.MkdirTemp("", "pixelhub-restore-")
+	if err != nil {
+		return err
+	}
+	defer os.RemoveAll(dir)
+
+	manifest, err := backup.Extract(f, dir)
+	if err != nil {
+		return err
+	}
+	log.Printf("Verified backup from %s (%d objects)", manifest.CreatedAt.Format(time.RFC3339), len(manifest.Objects))
+
+	if err := backup.RestoreDatabase(dir, manifest, cfg.Database.Path, *force); err != nil {
+		return fmt.Errorf("failed to restore database: %w", err)
+	}
+
+	// 备份可能来自旧版本，恢复后升级表结构
+	db, err := database.InitDB(&cfg.Database)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close()
+	log.Printf("Restored database to %s", cfg.Database.Path)
+
+	if !*withObjects || len(manifest.Objects) == 0 {
+		return nil
+	}
+	provider, err := storage.NewProvider(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage provider: %w", err)
+	}
+	n, err := backup.RestoreObjects(dir, manifest, db, provider)
+	if err != nil {
+		return err
+	}
+	log.Printf("Uploaded %d objects to %s", n, cfg.Storage.Provider)
+	return nil
+}
+
+// runExport 把图片和元数据清单导出为 zip（pixelhub export -o <file> [-tags a,b]），与 GET /api/v1/export 相同
+func runExport(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("export", flag.ExitOnError)
+	out := fs.String("o", "", "output zip file, e.g. brand-assets.zip")
+	tagsParam := fs.String("tags", "", "only export images that have all of these comma-separated tags")
+	fs.Parse(args)
+
+	if *out == "" {
+		return fmt.Errorf("-o is required")
+	}
+	var tags []string
+	for _, tag := range strings.Split(*tagsParam, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+
+	db, err := database.OpenStore(&cfg.Database)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+	provider, err := storage.NewProvider(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage provider: %w", err)
+	}
+	h := handlers.NewHandler(db, provider, nil)
+
+	f, err := os.Create(*out)
+	if err != nil {
+		return err
+	}
+	n, err := h.WriteExport(f, tags, database.PictureFilter{})
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		os.Remove(*out)
+		return err
+	}
+	log.Printf("Exported %d images to %s", n, *out)
+	return nil
+}
+
+// readStateFile 读取进度文件中已完成的条目（每行一个），文件不存在时返回空集合
+// 用于可中断后继续执行的命令（storage migrate、import）
+func readStateFile(path string) (map[string]bool, error) {
+	done := make(map[string]bool)
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return done, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		if line := strings.TrimSpace(scanner.Text()); line != "" {
+			done[line] = true
+		}
+	}
+	return done, scanner.Err()
+}
@@ -0,0 +1,327 @@
+package main
+
+import (
+	"archive/zip"
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"io/fs"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/vaaandark/PixelHub/internal/config"
+	"github.com/vaaandark/PixelHub/internal/database"
+	"github.com/vaaandark/PixelHub/internal/handlers"
+	"github.com/vaaandark/PixelHub/internal/storage"
+)
+
+// importExts 导入时识别为图片的扩展名
+var importExts = map[string]bool{
+	".jpg": true, ".jpeg": true, ".png": true, ".gif": true,
+	".webp": true, ".bmp": true, ".tif": true, ".tiff": true,
+}
+
+// importSource 导入来源（目录或 zip 归档），按相对路径（/ 分隔）索引所有文件
+type importSource struct {
+	files map[string]func() (io.ReadCloser, error)
+	close func() error
+}
+
+// openImportSource 打开目录或 zip 归档，跳过隐藏文件和 macOS 生成的 __MACOSX 目录
+func openImportSource(root string) (*importSource, error) {
+	info, err := os.Stat(root)
+	if err != nil {
+		return nil, err
+	}
+	src := &importSource{files: make(map[string]func() (io.ReadCloser, error))}
+
+	if info.IsDir() {
+		src.close = func() error { return nil }
+		err := filepath.WalkDir(root, func(p string, d fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if p != root && hiddenPath(d.Name()) {
+				if d.IsDir() {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !d.Type().IsRegular() {
+				return nil
+			}
+			rel, err := filepath.Rel(root, p)
+			if err != nil {
+				return err
+			}
+			src.files[filepath.ToSlash(rel)] = func() (io.ReadCloser, error) { return os.Open(p) }
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+		return src, nil
+	}
+
+	if !strings.EqualFold(filepath.Ext(root), ".zip") {
+		return nil, fmt.Errorf("%s is neither a directory nor a .zip archive", root)
+	}
+	zr, err := zip.OpenReader(root)
+	if err != nil {
+		return nil, err
+	}
+	src.close = zr.Close
+	for _, f := range zr.File {
+		if f.FileInfo().IsDir() || hiddenZipPath(f.Name) {
+			continue
+		}
+		f := f
+		src.files[path.Clean(f.Name)] = f.Open
+	}
+	return src, nil
+}
+
+func hiddenPath(name string) bool {
+	return strings.HasPrefix(name, ".") || name == "__MACOSX"
+}
+
+func hiddenZipPath(name string) bool {
+	for _, part := range strings.Split(name, "/") {
+		if hiddenPath(part) {
+			return true
+		}
+	}
+	return false
+}
+
+// images 按路径排序的待导入图片
+func (s *importSource) images() []string {
+	var paths []string
+	for p := range s.files {
+		if importExts[strings.ToLower(path.Ext(p))] {
+			paths = append(paths, p)
+		}
+	}
+	sort.Strings(paths)
+	return paths
+}
+
+func (s *importSource) read(p string) ([]byte, error) {
+	rc, err := s.files[p]()
+	if err != nil {
+		return nil, err
+	}
+	defer rc.Close()
+	return io.ReadAll(rc)
+}
+
+// metadata 合并图片所有 sidecar 中的描述和标签，folderTags 为 true 时目录名也作为标签
+func (s *importSource) metadata(imagePath string, folderTags bool) (string, []string, error) {
+	var description string
+	var tags []string
+	if folderTags {
+		if dir := path.Dir(imagePath); dir != "." {
+			tags = append(tags, strings.Split(dir, "/")...)
+		}
+	}
+
+	for _, p := range sidecarPaths(imagePath) {
+		open, ok := s.files[p]
+		if !ok {
+			continue
+		}
+		rc, err := open()
+		if err != nil {
+			return "", nil, err
+		}
+		var meta *sidecarMeta
+		if path.Ext(p) == ".json" {
+			meta, err = parseJSONSidecar(rc)
+		} else {
+			meta, err = parseXMPSidecar(rc)
+		}
+		rc.Close()
+		if err != nil {
+			return "", nil, fmt.Errorf("invalid sidecar %s: %w", p, err)
+		}
+		if description == "" {
+			description = meta.Description
+		}
+		tags = append(tags, meta.Tags...)
+	}
+	return description, uniqueTags(tags), nil
+}
+
+// uniqueTags 去除空白和重复的标签，保持原有顺序
+func uniqueTags(tags []string) []string {
+	seen := make(map[string]bool, len(tags))
+	result := make([]string, 0, len(tags))
+	for _, tag := range tags {
+		tag = strings.TrimSpace(tag)
+		if tag == "" || seen[tag] {
+			continue
+		}
+		seen[tag] = true
+		result = append(result, tag)
+	}
+	return result
+}
+
+// checkpointKey 检查点文件中的一行：导入来源的绝对路径和图片的相对路径，不同来源中的同名文件互不影响
+func checkpointKey(root, p string) string {
+	return root + "\t" + p
+}
+
+// runImport 导入目录或 zip 归档中的图片（pixelhub import [flags] <dir|zip>）
+// 与上传接口共用同一流程，内容相同的图片只保存一次；已处理的文件记录在检查点文件中，中断后重新执行会跳过
+func runImport(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("import", flag.ExitOnError)
+	workers := fs.Int("workers", 4, "number of concurrent uploads")
+	checkpoint := fs.String("checkpoint", "import.checkpoint", "progress file used to resume an interrupted import (entries are keyed by the absolute source path)")
+	folderTags := fs.Bool("folder-tags", true, "use folder names as tags")
+	fs.Parse(args)
+
+	if fs.NArg() != 1 {
+		return fmt.Errorf("usage: pixelhub import [flags] <dir|zip>")
+	}
+	if *workers < 1 {
+		*workers = 1
+	}
+
+	root, err := filepath.Abs(fs.Arg(0))
+	if err != nil {
+		return err
+	}
+	src, err := openImportSource(root)
+	if err != nil {
+		return fmt.Errorf("failed to open import source: %w", err)
+	}
+	defer src.close()
+
+	db, err := database.InitDB(&cfg.Database)
+	if err != nil {
+		return fmt.Errorf("failed to initialize database: %w", err)
+	}
+	defer db.Close()
+	provider, err := storage.NewProvider(cfg)
+	if err != nil {
+		return fmt.Errorf("failed to initialize storage provider: %w", err)
+	}
+	h := handlers.NewHandler(db, provider, nil)
+
+	done, err := readStateFile(*checkpoint)
+	if err != nil {
+		return fmt.Errorf("failed to read checkpoint: %w", err)
+	}
+	state, err := os.OpenFile(*checkpoint, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+	if err != nil {
+		return err
+	}
+	defer state.Close()
+
+	var pending []string
+	skipped := 0
+	for _, p := range src.images() {
+		if done[checkpointKey(root, p)] {
+			skipped++
+			continue
+		}
+		pending = append(pending, p)
+	}
+	log.Printf("Importing %d images (%d already done) with %d workers", len(pending), skipped, *workers)
+
+	var imported, duplicates, failed int64
+	var stateMu sync.Mutex
+	var stateErr error
+	// 内容相同的文件串行处理，后处理的一份由 ImportImage 按哈希识别为重复
+	var hashLocks sync.Map
+
+	importOne := func(p string) error {
+		content, err := src.read(p)
+		if err != nil {
+			return err
+		}
+		sum := sha256.Sum256(content)
+		lock, _ := hashLocks.LoadOrStore(hex.EncodeToString(sum[:]), &sync.Mutex{})
+		lock.(*sync.Mutex).Lock()
+		defer lock.(*sync.Mutex).Unlock()
+
+		description, tags, err := src.metadata(p, *folderTags)
+		if err != nil {
+			return err
+		}
+		_, duplicate, err := h.ImportImage(path.Base(p), content, description, tags)
+		if err != nil {
+			return err
+		}
+		if duplicate {
+			atomic.AddInt64(&duplicates, 1)
+		} else {
+			atomic.AddInt64(&imported, 1)
+		}
+		return nil
+	}
+
+	jobs := make(chan string)
+	var wg sync.WaitGroup
+	for i := 0; i < *workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for p := range jobs {
+				if err := importOne(p); err != nil {
+					log.Printf("Failed to import %s: %v", p, err)
+					atomic.AddInt64(&failed, 1)
+					continue
+				}
+				stateMu.Lock()
+				if _, err := fmt.Fprintln(state, checkpointKey(root, p)); err != nil && stateErr == nil {
+					stateErr = err
+				}
+				stateMu.Unlock()
+			}
+		}()
+	}
+
+	// 定期输出进度
+	progressDone := make(chan struct{})
+	go func() {
+		ticker := time.NewTicker(5 * time.Second)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ticker.C:
+				processed := atomic.LoadInt64(&imported) + atomic.LoadInt64(&duplicates) + atomic.LoadInt64(&failed)
+				log.Printf("Progress: %d/%d processed (%d imported, %d duplicates, %d failed)",
+					processed, len(pending), atomic.LoadInt64(&imported), atomic.LoadInt64(&duplicates), atomic.LoadInt64(&failed))
+			case <-progressDone:
+				return
+			}
+		}
+	}()
+
+	for _, p := range pending {
+		jobs <- p
+	}
+	close(jobs)
+	wg.Wait()
+	close(progressDone)
+
+	log.Printf("Imported %d images, %d duplicates skipped, %d failed", imported, duplicates, failed)
+	if stateErr != nil {
+		return fmt.Errorf("failed to write checkpoint: %w", stateErr)
+	}
+	if failed > 0 {
+		return fmt.Errorf("%d images failed, re-run the command to retry them", failed)
+	}
+	return nil
+}
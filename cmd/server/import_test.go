@@ -0,0 +1,63 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/vaaandark/PixelHub/internal/config"
+	"github.com/vaaandark/PixelHub/internal/database"
+)
+
+func writeTestPNG(t *testing.T, path string, shade uint8) {
+	t.Helper()
+	img := image.NewRGBA(image.Rect(0, 0, 8, 8))
+	for i := range img.Pix {
+		img.Pix[i] = shade
+	}
+	img.Set(0, 0, color.RGBA{255, 0, 0, 255})
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(path, buf.Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestImportCheckpointKeyedBySource(t *testing.T) {
+	dir := t.TempDir()
+	cfg := &config.Config{
+		Database: config.DatabaseConfig{Path: filepath.Join(dir, "pixelhub.db")},
+		Storage:  config.StorageConfig{Provider: "local", Local: config.LocalConfig{Dir: filepath.Join(dir, "objects")}},
+	}
+	checkpoint := filepath.Join(dir, "import.checkpoint")
+
+	// 两个来源中有相对路径相同、内容不同的文件
+	first, second := filepath.Join(dir, "first"), filepath.Join(dir, "second")
+	writeTestPNG(t, filepath.Join(first, "album", "a.png"), 10)
+	writeTestPNG(t, filepath.Join(second, "album", "a.png"), 200)
+
+	for _, src := range []string{first, second, first} {
+		if err := runImport(cfg, []string{"-checkpoint", checkpoint, src}); err != nil {
+			t.Fatalf("import %s: %v", src, err)
+		}
+	}
+
+	store, err := database.InitDB(&cfg.Database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	pics, total, err := store.ListPictures(database.PictureFilter{}, 1, 10, "date_desc", nil)
+	if err != nil || total != 2 {
+		t.Fatalf("pictures = %+v, %d, %v; want both sources imported", pics, total, err)
+	}
+}
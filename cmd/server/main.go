@@ -1,7 +1,11 @@
 package main
 
 import (
+	"context"
 	"log"
+	"os"
+	"strings"
+	"time"
 
 	"github.com/vaaandark/PixelHub/internal/config"
 	"github.com/vaaandark/PixelHub/internal/database"
@@ -19,8 +23,16 @@ func main() {
 		log.Fatalf("Failed to load config: %v", err)
 	}
 
+	// 管理命令
+	if len(os.Args) > 1 {
+		if err := runCommand(cfg, os.Args[1:]); err != nil {
+			log.Fatalf("%v", err)
+		}
+		return
+	}
+
 	// 初始化数据库
-	db, err := database.InitDB(cfg.Database.Path)
+	db, err := database.InitDB(&cfg.Database)
 	if err != nil {
 		log.Fatalf("Failed to initialize database: %v", err)
 	}
@@ -53,7 +65,7 @@ func main() {
 	r.Use(func(c *gin.Context) {
 		c.Writer.Header().Set("Access-Control-Allow-Origin", "*")
 		c.Writer.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
-		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
+		c.Writer.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-Chunk-SHA256, X-Filename, X-Description, Idempotency-Key, X-Actor, Last-Event-ID")
 		if c.Request.Method == "OPTIONS" {
 			c.AbortWithStatus(204)
 			return
@@ -65,30 +77,56 @@ func main() {
 	r.Static("/static", "./web/static")
 	r.StaticFile("/", "./web/index.html")
 
+	// 本地存储：由服务自身提供图片文件（base_url 没有路径时认为由反向代理或 CDN 提供）
+	// 配置了 signing_key 时文件只能通过签名 URL 访问，必须同时开启私有存储模式
+	if local, ok := storageProvider.(*storage.LocalProvider); ok && local.Signed() && !cfg.Storage.Private {
+		log.Fatalf("storage.local.signing_key requires storage.private = true")
+	}
+	if local, ok := storageProvider.(*storage.LocalProvider); ok && local.RoutePath() != "" {
+		r.GET(local.RoutePath()+"/*key", func(c *gin.Context) {
+			local.ServeFile(c.Writer, c.Request, strings.TrimPrefix(c.Param("key"), "/"))
+		})
+	}
+
 	// 初始化处理器
 	h := handlers.NewHandler(db, storageProvider, tagGenerator)
 
-	// 图床后端 API 路由
-	api := r.Group("/api/v1")
-	{
-		// 图片管理
-		api.POST("/images/upload", h.UploadImage)
-		api.POST("/images/batch-upload", h.BatchUploadImages)
-		api.POST("/images/batch-delete", h.BatchDeleteImages)
-		api.GET("/images", h.ListImages)
-		api.GET("/images/:image_id", h.GetImageDetail)
-		api.PUT("/images/:image_id", h.UpdateImageDescription)
-		api.DELETE("/images/:image_id", h.DeleteImage)
-
-		// 标签管理
-		api.PUT("/images/:image_id/tags", h.UpdateImageTags)
-		api.POST("/images/:image_id/tags/generate", h.GenerateImageTags)
-		api.GET("/tags", h.ListTags)
-
-		// 搜索
-		api.GET("/search/exact", h.SearchExact)
-		api.GET("/search/relevance", h.SearchRelevance)
+	// 私有存储：响应中返回有时效的签名 URL
+	if cfg.Storage.Private {
+		ttl := time.Duration(cfg.Storage.SignedURLTTL) * time.Second
+		if err := h.EnableSignedURLs(ttl); err != nil {
+			log.Fatalf("Failed to enable private storage mode: %v", err)
+		}
+		log.Printf("Private storage mode enabled, image URLs will be signed")
+	}
+
+	// 上传配置（通过 URL 上传的限制和内网允许列表）
+	if err := h.ConfigureUpload(cfg.Upload); err != nil {
+		log.Fatalf("Invalid upload config: %v", err)
+	}
+
+	// 后台补算历史图片的元数据（感知哈希、尺寸、MIME 类型）
+	go h.BackfillImageMetadata(context.Background())
+
+	// 后台清理过期的分片上传临时文件
+	go h.CleanupUploadSessions(context.Background())
+
+	// 幂等键的保留时间，过期的键由后台任务清理
+	h.ConfigureIdempotency(time.Duration(cfg.Server.IdempotencyTTL) * time.Second)
+	go h.CleanupIdempotencyKeys(context.Background())
+
+	// 审计日志保留期清理
+	h.ConfigureAudit(cfg.Server.AuditRetention)
+	go h.CleanupAuditLog(context.Background())
+
+	// Webhook 投递（失败重试、死信队列和投递记录清理）
+	if err := h.ConfigureWebhooks(cfg.Webhook); err != nil {
+		log.Fatalf("Invalid webhook config: %v", err)
 	}
+	go h.RunWebhookDeliveries(context.Background())
+
+	// 注册公开分享页面和 API 路由
+	h.RegisterRoutes(r)
 
 	// 启动服务器
 	addr := cfg.Server.Host + ":" + cfg.Server.Port
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"encoding/xml"
+	"io"
+	"path"
+	"strings"
+)
+
+// sidecarMeta 从 sidecar 文件读取的描述和标签
+type sidecarMeta struct {
+	Description string
+	Tags        []string
+}
+
+// sidecarPaths 图片可能对应的 sidecar 文件路径（photo.jpg.json、photo.json、photo.jpg.xmp、photo.xmp）
+func sidecarPaths(imagePath string) []string {
+	base := strings.TrimSuffix(imagePath, path.Ext(imagePath))
+	return []string{imagePath + ".json", base + ".json", imagePath + ".xmp", base + ".xmp"}
+}
+
+// parseJSONSidecar 读取 JSON sidecar：description 或 caption 作为描述，tags 或 keywords（数组或逗号分隔）作为标签
+func parseJSONSidecar(r io.Reader) (*sidecarMeta, error) {
+	var fields map[string]interface{}
+	if err := json.NewDecoder(r).Decode(&fields); err != nil {
+		return nil, err
+	}
+
+	meta := &sidecarMeta{}
+	for _, key := range []string{"description", "caption"} {
+		if s, ok := fields[key].(string); ok && strings.TrimSpace(s) != "" {
+			meta.Description = strings.TrimSpace(s)
+			break
+		}
+	}
+	for _, key := range []string{"tags", "keywords"} {
+		switch v := fields[key].(type) {
+		case []interface{}:
+			for _, item := range v {
+				if s, ok := item.(string); ok {
+					meta.Tags = append(meta.Tags, s)
+				}
+			}
+		case string:
+			meta.Tags = append(meta.Tags, strings.Split(v, ",")...)
+		}
+	}
+	return meta, nil
+}
+
+// dcNamespace XMP 中 Dublin Core 字段的命名空间
+const dcNamespace = "http://purl.org/dc/elements/1.1/"
+
+// parseXMPSidecar 读取 XMP sidecar：dc:description 作为描述，dc:subject 作为标签
+func parseXMPSidecar(r io.Reader) (*sidecarMeta, error) {
+	meta := &sidecarMeta{}
+	decoder := xml.NewDecoder(r)
+
+	// field 为当前所在的 dc 字段（description 或 subject），inItem 表示位于其中的 rdf:li 内
+	var field string
+	var inItem bool
+	var text strings.Builder
+	for {
+		tok, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := tok.(type) {
+		case xml.StartElement:
+			if t.Name.Space == dcNamespace && (t.Name.Local == "description" || t.Name.Local == "subject") {
+				field = t.Name.Local
+			} else if field != "" && t.Name.Local == "li" {
+				inItem = true
+				text.Reset()
+			}
+		case xml.CharData:
+			if inItem {
+				text.Write(t)
+			}
+		case xml.EndElement:
+			if t.Name.Space == dcNamespace && t.Name.Local == field {
+				field = ""
+			} else if inItem && t.Name.Local == "li" {
+				inItem = false
+				value := strings.TrimSpace(text.String())
+				if field == "subject" {
+					meta.Tags = append(meta.Tags, value)
+				} else if meta.Description == "" {
+					meta.Description = value
+				}
+			}
+		}
+	}
+	return meta, nil
+}
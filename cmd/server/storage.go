@@ -0,0 +1,232 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"time"
+
+	"github.com/vaaandark/PixelHub/internal/config"
+	"github.com/vaaandark/PixelHub/internal/database"
+	"github.com/vaaandark/PixelHub/internal/storage"
+)
+
+// storageCommand 存储管理命令（pixelhub storage migrate）
+func storageCommand(cfg *config.Config, args []string) error {
+	if len(args) == 0 || args[0] != "migrate" {
+		return fmt.Errorf("usage: pixelhub storage migrate -from <provider> -to <provider>")
+	}
+	return migrateStorage(cfg, args[1:])
+}
+
+// migrateStorage 将所有图片（包括历史版本文件）从一个存储提供商复制到另一个，逐个校验 SHA-256 后更新 storage_key
+// 源存储中的文件不会删除；进度记录在 -state 文件中，中断后重新执行会跳过已完成的对象
+func migrateStorage(cfg *config.Config, args []string) error {
+	fs := flag.NewFlagSet("storage migrate", flag.ExitOnError)
+	from := fs.String("from", "", "source storage provider: tencent-cos, local or s3")
+	to := fs.String("to", "", "target storage provider")
+	statePath := fs.String("state", "storage-migrate.state", "progress file used to resume an interrupted migration")
+	rate := fs.Float64("rate", 0, "maximum objects per second (0 = unlimited)")
+	dryRun := fs.Bool("dry-run", false, "list the objects that would be copied without copying them")
+	fs.Parse(args)
+
+	if *from == "" || *to == "" {
+		return fmt.Errorf("both -from and -to are required")
+	}
+	if *from == *to {
+		return fmt.Errorf("-from and -to must be different providers")
+	}
+
+	src, err := storage.NewProviderByName(cfg, *from)
+	if err != nil {
+		return fmt.Errorf("failed to initialize source storage: %w", err)
+	}
+	dst, err := storage.NewProviderByName(cfg, *to)
+	if err != nil {
+		return fmt.Errorf("failed to initialize target storage: %w", err)
+	}
+
+	db, err := database.OpenStore(&cfg.Database)
+	if err != nil {
+		return fmt.Errorf("failed to open database: %w", err)
+	}
+	defer db.Close()
+
+	return migrateObjects(src, dst, db, migrateOptions{
+		from:      *from,
+		to:        *to,
+		statePath: *statePath,
+		rate:      *rate,
+		dryRun:    *dryRun,
+	})
+}
+
+// migrateOptions storage migrate 的参数
+type migrateOptions struct {
+	from, to  string
+	statePath string
+	rate      float64
+	dryRun    bool
+}
+
+// migrationStateKey 进度文件中的一行：源、目标和对象标识，不同方向的迁移互不影响
+func migrationStateKey(from, to, id string) string {
+	return from + "\t" + to + "\t" + id
+}
+
+// migrateObjects 复制所有对象并记录进度，全部成功后删除进度文件
+func migrateObjects(src, dst storage.Provider, db database.Store, opts migrateOptions) error {
+	done, err := readStateFile(opts.statePath)
+	if err != nil {
+		return fmt.Errorf("failed to read state file: %w", err)
+	}
+	objects, err := listMigrationObjects(db)
+	if err != nil {
+		return err
+	}
+
+	var state *os.File
+	if !opts.dryRun {
+		state, err = os.OpenFile(opts.statePath, os.O_WRONLY|os.O_CREATE|os.O_APPEND, 0644)
+		if err != nil {
+			return err
+		}
+		defer state.Close()
+	}
+
+	var throttle <-chan time.Time
+	if opts.rate > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / opts.rate))
+		defer ticker.Stop()
+		throttle = ticker.C
+	}
+
+	copied, skipped, failed := 0, 0, 0
+	for _, obj := range objects {
+		key := migrationStateKey(opts.from, opts.to, obj.id)
+		if done[key] {
+			skipped++
+			continue
+		}
+		if opts.dryRun {
+			fmt.Printf("%s  %s\n", obj.id, obj.storageKey)
+			copied++
+			continue
+		}
+		if throttle != nil {
+			<-throttle
+		}
+
+		if err := copyObject(src, dst, db, obj); err != nil {
+			log.Printf("Failed to migrate %s (%s): %v", obj.id, obj.storageKey, err)
+			failed++
+			continue
+		}
+		if _, err := fmt.Fprintln(state, key); err != nil {
+			return fmt.Errorf("failed to write state file: %w", err)
+		}
+		copied++
+	}
+
+	if opts.dryRun {
+		log.Printf("Dry run: %d objects would be copied from %s to %s, %d already done", copied, opts.from, opts.to, skipped)
+		return nil
+	}
+	log.Printf("Copied %d objects from %s to %s, %d already done, %d failed", copied, opts.from, opts.to, skipped, failed)
+	if failed > 0 {
+		return fmt.Errorf("%d objects failed, re-run the command to retry them", failed)
+	}
+
+	// 迁移已完成，之后再向同一目标迁移（例如切回后再次迁移）需要重新复制
+	state.Close()
+	if err := os.Remove(opts.statePath); err != nil {
+		log.Printf("Failed to remove state file %s: %v", opts.statePath, err)
+	}
+	log.Printf("All objects are in %s; set [storage] provider = %q and restart the server", opts.to, opts.to)
+	return nil
+}
+
+// migrationObject 需要迁移的一个对象：图片的当前文件或历史版本文件
+type migrationObject struct {
+	id          string // 进度文件中的标识：图片 ID，历史版本为 <图片 ID>@v<版本号>
+	pictureID   string
+	version     int // 0 表示当前文件
+	storageKey  string
+	hash        string
+	contentType string
+}
+
+// listMigrationObjects 列出所有图片的当前文件和历史版本文件
+func listMigrationObjects(db database.Store) ([]migrationObject, error) {
+	pics, err := db.ListStoredPictures()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list pictures: %w", err)
+	}
+	versions, err := db.ListStoredVersions()
+	if err != nil {
+		return nil, fmt.Errorf("failed to list picture versions: %w", err)
+	}
+
+	objects := make([]migrationObject, 0, len(pics)+len(versions))
+	for _, pic := range pics {
+		objects = append(objects, migrationObject{id: pic.ID, pictureID: pic.ID, storageKey: pic.StorageKey, hash: pic.Hash, contentType: pic.MIMEType})
+	}
+	for _, v := range versions {
+		objects = append(objects, migrationObject{
+			id:          fmt.Sprintf("%s@v%d", v.PictureID, v.Version),
+			pictureID:   v.PictureID,
+			version:     v.Version,
+			storageKey:  v.StorageKey,
+			hash:        v.Hash,
+			contentType: v.MIMEType,
+		})
+	}
+	return objects, nil
+}
+
+// copyObject 复制单个对象：先写入临时文件并计算哈希，与记录的哈希一致后再按已知长度上传（COS 需要 Content-Length）
+func copyObject(src, dst storage.Provider, db database.Store, obj migrationObject) error {
+	rc, err := src.Get(obj.storageKey)
+	if err != nil {
+		return err
+	}
+	defer rc.Close()
+
+	tmp, err := os.CreateTemp("", "pixelhub-migrate-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hasher := sha256.New()
+	size, err := io.Copy(io.MultiWriter(tmp, hasher), rc)
+	if err != nil {
+		return fmt.Errorf("failed to read object: %w", err)
+	}
+	if hash := hex.EncodeToString(hasher.Sum(nil)); hash != obj.hash {
+		return fmt.Errorf("SHA-256 mismatch: expected %s, got %s", obj.hash, hash)
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	contentType := obj.contentType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	storageKey, _, err := dst.Upload(obj.storageKey, tmp, size, contentType)
+	if err != nil {
+		return err
+	}
+
+	if obj.version > 0 {
+		return db.UpdatePictureVersionStorage(obj.pictureID, obj.version, storageKey)
+	}
+	// 访问地址由 storage_key 和当前存储配置推导，旧存储的绝对地址一并清空
+	return db.UpdatePictureStorage(obj.pictureID, storageKey, "")
+}
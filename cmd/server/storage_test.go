@@ -0,0 +1,98 @@
+package main
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/vaaandark/PixelHub/internal/database"
+	"github.com/vaaandark/PixelHub/internal/fakes"
+)
+
+func seedMigration(t *testing.T, src *fakes.Storage, db *fakes.Store, ids ...string) {
+	t.Helper()
+	for _, id := range ids {
+		data := []byte("content of " + id)
+		sum := sha256.Sum256(data)
+		key, _, err := src.Upload(id+".png", bytes.NewReader(data), int64(len(data)), "image/png")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := db.CreatePicture(&database.Picture{ID: id, StorageKey: key, Hash: hex.EncodeToString(sum[:]), MIMEType: "image/png"}); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestMigrateObjectsResumesPerDirection(t *testing.T) {
+	db := fakes.NewStore()
+	a, b, c := fakes.NewStorage(), fakes.NewStorage(), fakes.NewStorage()
+	seedMigration(t, a, db, "img_1", "img_2")
+	statePath := filepath.Join(t.TempDir(), "storage-migrate.state")
+
+	// A→B 第一次执行时 img_2 读取失败，进度文件只记录 img_1
+	a.Delete("img_2.png")
+	if err := migrateObjects(a, b, db, migrateOptions{from: "a", to: "b", statePath: statePath}); err == nil {
+		t.Fatal("migration with a missing object succeeded")
+	}
+	state, _ := os.ReadFile(statePath)
+	if got := strings.TrimSpace(string(state)); got != migrationStateKey("a", "b", "img_1") {
+		t.Errorf("state = %q", got)
+	}
+
+	// 重新执行时跳过 img_1，只复制 img_2；全部完成后删除进度文件
+	a.Upload("img_2.png", strings.NewReader("content of img_2"), 16, "image/png")
+	b.Delete("img_1.png")
+	if err := migrateObjects(a, b, db, migrateOptions{from: "a", to: "b", statePath: statePath}); err != nil {
+		t.Fatal(err)
+	}
+	if keys := strings.Join(b.Keys(), ","); keys != "img_2.png" {
+		t.Errorf("objects in b = %s, want only the retried object", keys)
+	}
+	if _, err := os.Stat(statePath); !os.IsNotExist(err) {
+		t.Errorf("state file still exists after a complete migration: %v", err)
+	}
+
+	// 之后的 B→C 迁移不受 A→B 进度影响
+	b.Upload("img_1.png", strings.NewReader("content of img_1"), 16, "image/png")
+	os.WriteFile(statePath, []byte(migrationStateKey("a", "b", "img_1")+"\n"+migrationStateKey("a", "b", "img_2")+"\n"), 0644)
+	if err := migrateObjects(b, c, db, migrateOptions{from: "b", to: "c", statePath: statePath}); err != nil {
+		t.Fatal(err)
+	}
+	if keys := strings.Join(c.Keys(), ","); keys != "img_1.png,img_2.png" {
+		t.Errorf("objects in c = %s", keys)
+	}
+}
+
+// 迁移时把对象长度传给目标存储；哈希不一致的对象不会上传
+func TestCopyObjectPassesSize(t *testing.T) {
+	db := fakes.NewStore()
+	src, dst := fakes.NewStorage(), fakes.NewStorage()
+	seedMigration(t, src, db, "img_1")
+
+	obj := migrationObject{id: "img_1", pictureID: "img_1", storageKey: "img_1.png", hash: sha256Hex("content of img_1"), contentType: "image/png"}
+	if err := copyObject(src, dst, db, obj); err != nil {
+		t.Fatal(err)
+	}
+	if size, ok := dst.UploadedSize("img_1.png"); !ok || size != 16 {
+		t.Errorf("size passed to the destination = %d (found %v), want 16", size, ok)
+	}
+
+	obj.hash = strings.Repeat("0", 64)
+	dst.Delete("img_1.png")
+	if err := copyObject(src, dst, db, obj); err == nil || !strings.Contains(err.Error(), "SHA-256 mismatch") {
+		t.Errorf("copy with a wrong hash: %v", err)
+	}
+	if keys := dst.Keys(); len(keys) != 0 {
+		t.Errorf("objects in the destination after a hash mismatch: %v", keys)
+	}
+}
+
+func sha256Hex(s string) string {
+	sum := sha256.Sum256([]byte(s))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,362 @@
+package backup
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/vaaandark/PixelHub/internal/database"
+	"github.com/vaaandark/PixelHub/internal/storage"
+)
+
+// 归档内的固定路径
+const (
+	manifestName  = "manifest.json"
+	databaseName  = "pixelhub.db"
+	objectsPrefix = "objects/"
+)
+
+// FormatVersion 备份格式版本（2 起包含图片的历史版本文件）
+const FormatVersion = 2
+
+// Manifest 备份清单，记录归档中每个文件的大小和 SHA-256
+type Manifest struct {
+	Version   int       `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	Database  *Entry    `json:"database,omitempty"`
+	Objects   []Object  `json:"objects,omitempty"`
+}
+
+// Entry 归档中的一个文件
+type Entry struct {
+	Path   string `json:"path"`
+	Size   int64  `json:"size"`
+	SHA256 string `json:"sha256"`
+}
+
+// Object 对象存储中的一个图片文件
+type Object struct {
+	Entry
+	PictureID   string `json:"picture_id"`
+	Version     int    `json:"version,omitempty"` // 历史版本号，0 表示图片的当前文件
+	StorageKey  string `json:"storage_key"`
+	ContentType string `json:"content_type,omitempty"`
+}
+
+// Write 将数据库快照和（provider 非 nil 时）所有图片对象写入 tar.gz 归档
+// 清单作为最后一个文件写入，恢复时以清单为准校验其余文件
+func Write(w io.Writer, store database.Store, provider storage.Provider) (*Manifest, error) {
+	gz := gzip.NewWriter(w)
+	tw := tar.NewWriter(gz)
+	manifest := &Manifest{Version: FormatVersion, CreatedAt: time.Now().UTC()}
+
+	// 数据库快照先写入临时文件，得到大小后才能写 tar 头
+	tmpDir, err := os.MkdirTemp("", "pixelhub-backup-")
+	if err != nil {
+		return nil, err
+	}
+	defer os.RemoveAll(tmpDir)
+
+	dbPath := filepath.Join(tmpDir, databaseName)
+	if err := store.Backup(dbPath); err != nil {
+		return nil, fmt.Errorf("failed to back up database: %w", err)
+	}
+	dbEntry, err := addFile(tw, databaseName, dbPath)
+	if err != nil {
+		return nil, err
+	}
+	manifest.Database = dbEntry
+
+	if provider != nil {
+		pics, err := store.ListStoredPictures()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list pictures: %w", err)
+		}
+		for _, pic := range pics {
+			obj, err := addObject(tw, provider, Object{PictureID: pic.ID, StorageKey: pic.StorageKey, ContentType: pic.MIMEType}, pic.Hash)
+			if err != nil {
+				return nil, fmt.Errorf("failed to back up object %s: %w", pic.StorageKey, err)
+			}
+			manifest.Objects = append(manifest.Objects, *obj)
+		}
+
+		versions, err := store.ListStoredVersions()
+		if err != nil {
+			return nil, fmt.Errorf("failed to list picture versions: %w", err)
+		}
+		for _, v := range versions {
+			obj, err := addObject(tw, provider, Object{PictureID: v.PictureID, Version: v.Version, StorageKey: v.StorageKey, ContentType: v.MIMEType}, v.Hash)
+			if err != nil {
+				return nil, fmt.Errorf("failed to back up object %s: %w", v.StorageKey, err)
+			}
+			manifest.Objects = append(manifest.Objects, *obj)
+		}
+	}
+
+	data, err := json.MarshalIndent(manifest, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	if err := addBytes(tw, manifestName, data); err != nil {
+		return nil, err
+	}
+
+	if err := tw.Close(); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return manifest, nil
+}
+
+// addObject 从存储读取 obj.StorageKey 并写入归档，recordedHash 为数据库中记录的哈希
+func addObject(tw *tar.Writer, provider storage.Provider, obj Object, recordedHash string) (*Object, error) {
+	rc, err := provider.Get(obj.StorageKey)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(rc)
+	rc.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	sum := sha256.Sum256(data)
+	hash := hex.EncodeToString(sum[:])
+	// 与上传时记录的哈希不一致说明存储中的文件已损坏，仍然备份实际内容，由清单如实记录
+	if hash != recordedHash {
+		log.Printf("Warning: object %s does not match recorded hash of picture %s", obj.StorageKey, obj.PictureID)
+	}
+
+	name := objectsPrefix + obj.StorageKey
+	if err := addBytes(tw, name, data); err != nil {
+		return nil, err
+	}
+	obj.Entry = Entry{Path: name, Size: int64(len(data)), SHA256: hash}
+	return &obj, nil
+}
+
+func addFile(tw *tar.Writer, name, filePath string) (*Entry, error) {
+	f, err := os.Open(filePath)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil {
+		return nil, err
+	}
+
+	if err := tw.WriteHeader(fileHeader(name, info.Size())); err != nil {
+		return nil, err
+	}
+	hasher := sha256.New()
+	if _, err := io.Copy(io.MultiWriter(tw, hasher), f); err != nil {
+		return nil, err
+	}
+	return &Entry{Path: name, Size: info.Size(), SHA256: hex.EncodeToString(hasher.Sum(nil))}, nil
+}
+
+func addBytes(tw *tar.Writer, name string, data []byte) error {
+	if err := tw.WriteHeader(fileHeader(name, int64(len(data)))); err != nil {
+		return err
+	}
+	_, err := tw.Write(data)
+	return err
+}
+
+func fileHeader(name string, size int64) *tar.Header {
+	return &tar.Header{
+		Name:     name,
+		Mode:     0644,
+		Size:     size,
+		ModTime:  time.Now(),
+		Typeflag: tar.TypeReg,
+	}
+}
+
+// Extract 将归档解压到 dir 并按清单校验每个文件的大小和 SHA-256
+// 任何文件缺失或不一致都会返回错误
+func Extract(r io.Reader, dir string) (*Manifest, error) {
+	gz, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, fmt.Errorf("not a PixelHub backup: %w", err)
+	}
+	defer gz.Close()
+	tr := tar.NewReader(gz)
+
+	// 解压时计算实际哈希，清单在归档末尾，读完后统一比对
+	actual := make(map[string]Entry)
+	var manifestData []byte
+	for {
+		hdr, err := tr.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("failed to read archive: %w", err)
+		}
+		if hdr.Typeflag != tar.TypeReg {
+			continue
+		}
+		if hdr.Name == manifestName {
+			if manifestData, err = io.ReadAll(tr); err != nil {
+				return nil, err
+			}
+			continue
+		}
+
+		target, err := safeJoin(dir, hdr.Name)
+		if err != nil {
+			return nil, err
+		}
+		entry, err := extractFile(tr, target)
+		if err != nil {
+			return nil, err
+		}
+		entry.Path = hdr.Name
+		actual[hdr.Name] = *entry
+	}
+
+	if manifestData == nil {
+		return nil, fmt.Errorf("archive has no %s", manifestName)
+	}
+	var manifest Manifest
+	if err := json.Unmarshal(manifestData, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %w", err)
+	}
+	if manifest.Version > FormatVersion {
+		return nil, fmt.Errorf("unsupported backup format version %d", manifest.Version)
+	}
+
+	expected := make([]Entry, 0, len(manifest.Objects)+1)
+	if manifest.Database != nil {
+		expected = append(expected, *manifest.Database)
+	}
+	for _, obj := range manifest.Objects {
+		expected = append(expected, obj.Entry)
+	}
+	var problems []string
+	for _, e := range expected {
+		got, ok := actual[e.Path]
+		switch {
+		case !ok:
+			problems = append(problems, e.Path+": missing")
+		case got.Size != e.Size || got.SHA256 != e.SHA256:
+			problems = append(problems, e.Path+": checksum mismatch")
+		}
+	}
+	if len(problems) > 0 {
+		return nil, fmt.Errorf("backup verification failed: %s", strings.Join(problems, "; "))
+	}
+	return &manifest, nil
+}
+
+func extractFile(r io.Reader, target string) (*Entry, error) {
+	if err := os.MkdirAll(filepath.Dir(target), 0755); err != nil {
+		return nil, err
+	}
+	f, err := os.Create(target)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	hasher := sha256.New()
+	n, err := io.Copy(io.MultiWriter(f, hasher), r)
+	if err != nil {
+		return nil, err
+	}
+	return &Entry{Size: n, SHA256: hex.EncodeToString(hasher.Sum(nil))}, f.Close()
+}
+
+// safeJoin 拒绝解压到 dir 之外的路径（绝对路径或包含 ..）
+func safeJoin(dir, name string) (string, error) {
+	clean := path.Clean(name)
+	if path.IsAbs(clean) || clean == ".." || strings.HasPrefix(clean, "../") {
+		return "", fmt.Errorf("invalid path in archive: %s", name)
+	}
+	return filepath.Join(dir, filepath.FromSlash(clean)), nil
+}
+
+// RestoreDatabase 用解压出的数据库快照替换 dbPath
+// 目标已存在且 force 为 false 时拒绝覆盖；恢复前必须停止服务
+func RestoreDatabase(dir string, manifest *Manifest, dbPath string, force bool) error {
+	if manifest.Database == nil {
+		return fmt.Errorf("backup does not contain a database")
+	}
+	if _, err := os.Stat(dbPath); err == nil && !force {
+		return fmt.Errorf("database %s already exists, use -force to overwrite it", dbPath)
+	}
+	if err := os.MkdirAll(filepath.Dir(dbPath), 0755); err != nil {
+		return err
+	}
+
+	// 旧数据库的 WAL 不属于快照，必须一并删除，否则打开时会被重放
+	for _, suffix := range []string{"", "-wal", "-shm"} {
+		if err := os.Remove(dbPath + suffix); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+	}
+
+	src, err := os.Open(filepath.Join(dir, filepath.FromSlash(manifest.Database.Path)))
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	dst, err := os.OpenFile(dbPath, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(dst, src); err != nil {
+		dst.Close()
+		return err
+	}
+	return dst.Close()
+}
+
+// RestoreObjects 将解压出的图片和历史版本文件重新上传到 provider（可以与备份时的存储不同）
+// 上传后 storage_key 发生变化的图片或历史版本会同步更新数据库，返回上传的对象数量
+func RestoreObjects(dir string, manifest *Manifest, store database.Store, provider storage.Provider) (int, error) {
+	count := 0
+	for _, obj := range manifest.Objects {
+		data, err := os.ReadFile(filepath.Join(dir, filepath.FromSlash(obj.Path)))
+		if err != nil {
+			return count, err
+		}
+		contentType := obj.ContentType
+		if contentType == "" {
+			contentType = "application/octet-stream"
+		}
+
+		storageKey, _, err := provider.Upload(obj.StorageKey, bytes.NewReader(data), int64(len(data)), contentType)
+		if err != nil {
+			return count, fmt.Errorf("failed to upload %s: %w", obj.StorageKey, err)
+		}
+		// 访问地址由新的 storage_key 推导，不保存显式 URL
+		if storageKey != obj.StorageKey {
+			if obj.Version > 0 {
+				err = store.UpdatePictureVersionStorage(obj.PictureID, obj.Version, storageKey)
+			} else {
+				err = store.UpdatePictureStorage(obj.PictureID, storageKey, "")
+			}
+			if err != nil {
+				return count, fmt.Errorf("failed to update picture %s: %w", obj.PictureID, err)
+			}
+		}
+		count++
+	}
+	return count, nil
+}
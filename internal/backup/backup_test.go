@@ -0,0 +1,166 @@
+package backup
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/vaaandark/PixelHub/internal/config"
+	"github.com/vaaandark/PixelHub/internal/database"
+	"github.com/vaaandark/PixelHub/internal/fakes"
+)
+
+// prefixStorage 上传时给 key 加前缀，模拟恢复到 key 规则不同的存储
+type prefixStorage struct {
+	*fakes.Storage
+	prefix string
+}
+
+func (s *prefixStorage) Upload(filename string, content io.Reader, size int64, contentType string) (string, string, error) {
+	return s.Storage.Upload(s.prefix+filename, content, size, contentType)
+}
+
+func hashOf(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+func TestBackupRoundTrip(t *testing.T) {
+	store, err := database.InitDB(&config.DatabaseConfig{Path: filepath.Join(t.TempDir(), "pixelhub.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	provider := fakes.NewStorage()
+
+	content := []byte("picture content")
+	provider.Upload("img_a.png", bytes.NewReader(content), int64(len(content)), "image/png")
+	if err := store.CreatePicture(&database.Picture{ID: "img_a", StorageKey: "img_a.png", Hash: hashOf(content), MIMEType: "image/png"}); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	manifest, err := Write(&buf, store, provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if manifest.Database == nil || len(manifest.Objects) != 1 || manifest.Objects[0].StorageKey != "img_a.png" {
+		t.Fatalf("manifest = %+v", manifest)
+	}
+
+	dir := t.TempDir()
+	extracted, err := Extract(&buf, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// 数据库快照恢复到新路径后包含备份时的图片
+	dbPath := filepath.Join(t.TempDir(), "restored.db")
+	if err := RestoreDatabase(dir, extracted, dbPath, false); err != nil {
+		t.Fatal(err)
+	}
+	if err := RestoreDatabase(dir, extracted, dbPath, false); err == nil {
+		t.Error("RestoreDatabase overwrote an existing database without force")
+	}
+	restored, err := database.InitDB(&config.DatabaseConfig{Path: dbPath})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer restored.Close()
+
+	target := &prefixStorage{Storage: fakes.NewStorage(), prefix: "restored/"}
+	if n, err := RestoreObjects(dir, extracted, restored, target); err != nil || n != 1 {
+		t.Fatalf("RestoreObjects = %d, %v", n, err)
+	}
+
+	// 恢复后 storage_key 改变，数据库指向新存储中的对象
+	pic, err := restored.GetPicture("img_a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pic.StorageKey != "restored/img_a.png" {
+		t.Errorf("storage_key = %s, want restored/img_a.png", pic.StorageKey)
+	}
+	if got, ok := target.Object(pic.StorageKey); !ok || !bytes.Equal(got, content) {
+		t.Errorf("restored object = %q, want %q", got, content)
+	}
+}
+
+func TestBackupIncludesVersions(t *testing.T) {
+	store, err := database.InitDB(&config.DatabaseConfig{Path: filepath.Join(t.TempDir(), "pixelhub.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	provider := fakes.NewStorage()
+
+	v1, v2 := []byte("version one"), []byte("version two")
+	provider.Upload("img_a.v1.abc.png", bytes.NewReader(v1), int64(len(v1)), "image/png")
+	provider.Upload("img_a.png", bytes.NewReader(v2), int64(len(v2)), "image/png")
+	pic := &database.Picture{ID: "img_a", StorageKey: "img_a.png", Hash: hashOf(v1), MIMEType: "image/png"}
+	if err := store.CreatePicture(pic); err != nil {
+		t.Fatal(err)
+	}
+	pic, err = store.GetPicture("img_a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	next := *pic
+	next.Hash = hashOf(v2)
+	next.Version = 2
+	next.RevisedAt = time.Now()
+	archived := &database.PictureVersion{PictureID: "img_a", Version: 1, StorageKey: "img_a.v1.abc.png", Hash: hashOf(v1), MIMEType: "image/png", CreatedAt: pic.RevisedAt, ArchivedAt: time.Now()}
+	if err := store.ReplacePictureFile(archived, &next); err != nil {
+		t.Fatal(err)
+	}
+
+	var buf bytes.Buffer
+	manifest, err := Write(&buf, store, provider)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Objects) != 2 || manifest.Objects[1].Version != 1 || manifest.Objects[1].StorageKey != "img_a.v1.abc.png" {
+		t.Fatalf("manifest objects = %+v", manifest.Objects)
+	}
+
+	dir := t.TempDir()
+	extracted, err := Extract(&buf, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	target := &prefixStorage{Storage: fakes.NewStorage(), prefix: "restored/"}
+	if n, err := RestoreObjects(dir, extracted, store, target); err != nil || n != 2 {
+		t.Fatalf("RestoreObjects = %d, %v", n, err)
+	}
+
+	// 恢复后 storage_key 改变，当前文件和历史版本都指向新存储中的对象
+	pic, err = store.GetPicture("img_a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	version, err := store.GetPictureVersion("img_a", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for key, want := range map[string][]byte{pic.StorageKey: v2, version.StorageKey: v1} {
+		if got, ok := target.Object(key); !ok || !bytes.Equal(got, want) {
+			t.Errorf("restored object %s = %q, want %q", key, got, want)
+		}
+	}
+}
+
+func TestSafeJoin(t *testing.T) {
+	dir := t.TempDir()
+	if got, err := safeJoin(dir, "objects/img_a.png"); err != nil || got != filepath.Join(dir, "objects", "img_a.png") {
+		t.Errorf("safeJoin(objects/img_a.png) = %s, %v", got, err)
+	}
+	for _, name := range []string{"../escape", "/etc/passwd", "objects/../../escape"} {
+		if _, err := safeJoin(dir, name); err == nil {
+			t.Errorf("safeJoin(%q) succeeded", name)
+		}
+	}
+}
@@ -8,21 +8,37 @@ type Config struct {
 	Server   ServerConfig   `toml:"server"`
 	Database DatabaseConfig `toml:"database"`
 	Storage  StorageConfig  `toml:"storage"`
+	Upload   UploadConfig   `toml:"upload"`
+	Webhook  WebhookConfig  `toml:"webhook"`
 	LLM      LLMConfig      `toml:"llm"`
 }
 
 type ServerConfig struct {
-	Host string `toml:"host"`
-	Port string `toml:"port"`
+	Host           string `toml:"host"`
+	Port           string `toml:"port"`
+	IdempotencyTTL int    `toml:"idempotency_ttl"` // Idempotency-Key 及其响应的保留时间（秒），默认 86400
+	AuditRetention int    `toml:"audit_retention"` // 审计日志保留天数，默认 90，-1 表示永久保留
 }
 
 type DatabaseConfig struct {
-	Path string `toml:"path"`
+	Driver       string `toml:"driver"`         // sqlite（默认）或 postgres
+	DSN          string `toml:"dsn"`            // PostgreSQL 连接字符串
+	MaxOpenConns int    `toml:"max_open_conns"` // PostgreSQL 连接池大小，默认 10
+	Path         string `toml:"path"`           // SQLite 数据库文件路径
+	JournalMode  string `toml:"journal_mode"`   // 默认 WAL
+	BusyTimeout  int    `toml:"busy_timeout"`   // 等待锁的时间（毫秒），默认 5000
+	Synchronous  string `toml:"synchronous"`    // 默认 NORMAL
+	CacheSize    int    `toml:"cache_size"`     // 同 PRAGMA cache_size，负数表示 KiB，0 表示使用 SQLite 默认值
+	MaxReadConns int    `toml:"max_read_conns"` // 只读连接池大小，默认 4
 }
 
 type StorageConfig struct {
-	Provider   string           `toml:"provider"`
-	TencentCOS TencentCOSConfig `toml:"tencent_cos"`
+	Provider     string           `toml:"provider"`
+	Private      bool             `toml:"private"`        // 私有存储：返回有时效的签名 URL
+	SignedURLTTL int              `toml:"signed_url_ttl"` // 签名 URL 有效期（秒），默认 3600
+	TencentCOS   TencentCOSConfig `toml:"tencent_cos"`
+	Local        LocalConfig      `toml:"local"`
+	S3           S3Config         `toml:"s3"`
 }
 
 type TencentCOSConfig struct {
@@ -32,6 +48,44 @@ type TencentCOSConfig struct {
 	CDNURL    string `toml:"cdn_url"`
 }
 
+type LocalConfig struct {
+	Dir        string `toml:"dir"`         // 文件保存目录，默认 ./data/images
+	BaseURL    string `toml:"base_url"`    // 访问地址前缀，默认 /files（由服务自身提供文件）
+	SigningKey string `toml:"signing_key"` // 私有存储时签名 URL 使用的 HMAC 密钥，设置后访问文件必须带有效签名
+}
+
+type S3Config struct {
+	Endpoint        string `toml:"endpoint"` // 默认 https://s3.<region>.amazonaws.com，MinIO 等填写服务地址
+	Region          string `toml:"region"`   // 默认 us-east-1
+	Bucket          string `toml:"bucket"`
+	AccessKeyID     string `toml:"access_key_id"`
+	SecretAccessKey string `toml:"secret_access_key"`
+	PathStyle       bool   `toml:"path_style"` // 使用路径风格地址（endpoint/bucket/key），MinIO 需要开启
+	PublicURL       string `toml:"public_url"` // 公开访问地址（如 CDN），为空时使用存储桶地址
+}
+
+type UploadConfig struct {
+	BatchWorkers       int      `toml:"batch_workers"`        // 批量上传时并发处理的文件数，默认 4
+	RawMaxSize         int64    `toml:"raw_max_size"`         // 请求体直接为图片内容的上传大小上限（字节），默认 100 MiB
+	RemoteMaxSize      int64    `toml:"remote_max_size"`      // 通过 URL 上传时的大小上限（字节），默认 20 MiB
+	RemoteTimeout      int      `toml:"remote_timeout"`       // 下载远程图片的超时时间（秒），默认 30
+	RemoteMaxRedirects int      `toml:"remote_max_redirects"` // 最多跟随的重定向次数，默认 3
+	RemoteAllowHosts   []string `toml:"remote_allow_hosts"`   // 允许访问的内网主机名或 CIDR（默认拒绝所有内网地址）
+	ChunkDir           string   `toml:"chunk_dir"`            // 分片上传的临时目录，默认为系统临时目录下的 pixelhub-uploads
+	ChunkSize          int64    `toml:"chunk_size"`           // 分片大小（字节），默认 5 MiB
+	ChunkMaxSize       int64    `toml:"chunk_max_size"`       // 分片上传的文件大小上限（字节），默认 512 MiB
+	ChunkSessionTTL    int      `toml:"chunk_session_ttl"`    // 未完成的分片上传保留时间（秒），默认 86400
+	ChunkMaxSessions   int      `toml:"chunk_max_sessions"`   // 同时未完成的分片上传会话数上限，默认 100
+	ChunkMaxPending    int64    `toml:"chunk_max_pending"`    // 未完成会话声明的文件大小总和上限（字节），默认 8 GiB
+}
+
+type WebhookConfig struct {
+	MaxAttempts       int      `toml:"max_attempts"`       // 每次投递的最多尝试次数，用完后进入死信队列，默认 8
+	Timeout           int      `toml:"timeout"`            // 单次请求的超时时间（秒），默认 10
+	AllowHosts        []string `toml:"allow_hosts"`        // 允许投递的内网主机名或 CIDR（默认拒绝所有内网地址）
+	DeliveryRetention int      `toml:"delivery_retention"` // 已结束的投递记录保留天数，默认 30
+}
+
 type LLMConfig struct {
 	Provider      string `toml:"provider"`
 	APIKey        string `toml:"api_key"`
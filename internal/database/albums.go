@@ -0,0 +1,348 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrImageNotInAlbum 排序时指定的图片不在相册中
+var ErrImageNotInAlbum = errors.New("image is not in album")
+
+// Album 相册（有序的图片集合）
+type Album struct {
+	ID              string    `json:"id"`
+	Name            string    `json:"name"`
+	Description     string    `json:"description"`
+	CoverImageID    string    `json:"cover_image_id,omitempty"` // 显式设置的封面
+	CoverURL        string    `json:"cover_url,omitempty"`      // 封面 URL（未设置封面时使用第一张图片）
+	CoverStorageKey string    `json:"-"`                        // 封面的存储 key（用于生成签名 URL）
+	ImageCount      int       `json:"image_count"`
+	CreatedAt       time.Time `json:"created_at"`
+	UpdatedAt       time.Time `json:"updated_at"`
+}
+
+// AlbumItem 相册中的图片
+type AlbumItem struct {
+	PictureWithTags
+	Position int `json:"position"`
+}
+
+// albumColumns 相册查询字段（别名 a），封面为空时回退到位置最靠前的图片
+const albumColumns = `a.id, a.name, COALESCE(a.description, ''), COALESCE(a.cover_picture_id, ''),
+	COALESCE(
+		(SELECT p.url FROM pictures p WHERE p.id = a.cover_picture_id AND p.deleted = 0),
+		(SELECT p.url FROM album_items ai JOIN pictures p ON p.id = ai.picture_id
+			WHERE ai.album_id = a.id AND p.deleted = 0 ORDER BY ai.position LIMIT 1),
+		''
+	),
+	COALESCE(
+		(SELECT p.storage_key FROM pictures p WHERE p.id = a.cover_picture_id AND p.deleted = 0),
+		(SELECT p.storage_key FROM album_items ai JOIN pictures p ON p.id = ai.picture_id
+			WHERE ai.album_id = a.id AND p.deleted = 0 ORDER BY ai.position LIMIT 1),
+		''
+	),
+	(SELECT COUNT(*) FROM album_items ai JOIN pictures p ON p.id = ai.picture_id
+		WHERE ai.album_id = a.id AND p.deleted = 0),
+	a.created_at, a.updated_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanAlbum(row rowScanner, album *Album) error {
+	return row.Scan(&album.ID, &album.Name, &album.Description, &album.CoverImageID, &album.CoverURL,
+		&album.CoverStorageKey, &album.ImageCount, &album.CreatedAt, &album.UpdatedAt)
+}
+
+// CreateAlbum 创建相册
+func CreateAlbum(db *sql.DB, album *Album) error {
+	var cover interface{}
+	if album.CoverImageID != "" {
+		cover = album.CoverImageID
+	}
+	_, err := db.Exec(
+		"INSERT INTO albums (id, name, description, cover_picture_id) VALUES (?, ?, ?, ?)",
+		album.ID, album.Name, album.Description, cover,
+	)
+	return err
+}
+
+// GetAlbum 获取相册
+func GetAlbum(db *sql.DB, id string) (*Album, error) {
+	var album Album
+	row := db.QueryRow("SELECT "+albumColumns+" FROM albums a WHERE a.id = ?", id)
+	if err := scanAlbum(row, &album); err != nil {
+		return nil, err
+	}
+	return &album, nil
+}
+
+// ListAlbums 列出所有相册（分页，最近更新优先）
+func ListAlbums(db *sql.DB, page, limit int) ([]Album, int, error) {
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM albums").Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * limit
+	rows, err := db.Query(`
+		SELECT `+albumColumns+`
+		FROM albums a
+		ORDER BY a.updated_at DESC, a.id DESC
+		LIMIT ? OFFSET ?
+	`, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	albums := []Album{}
+	for rows.Next() {
+		var album Album
+		if err := scanAlbum(rows, &album); err != nil {
+			return nil, 0, err
+		}
+		albums = append(albums, album)
+	}
+	return albums, total, rows.Err()
+}
+
+// UpdateAlbum 更新相册名称、描述和封面
+func UpdateAlbum(db *sql.DB, album *Album) error {
+	var cover interface{}
+	if album.CoverImageID != "" {
+		cover = album.CoverImageID
+	}
+	_, err := db.Exec(
+		"UPDATE albums SET name = ?, description = ?, cover_picture_id = ?, updated_at = CURRENT_TIMESTAMP WHERE id = ?",
+		album.Name, album.Description, cover, album.ID,
+	)
+	return err
+}
+
+// DeleteAlbum 删除相册（图片本身不受影响）
+func DeleteAlbum(db *sql.DB, id string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("DELETE FROM album_items WHERE album_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("DELETE FROM albums WHERE id = ?", id); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListAlbumItems 按顺序列出相册中的图片（已删除的图片不返回）
+func ListAlbumItems(db *sql.DB, albumID string) ([]AlbumItem, error) {
+	rows, err := db.Query(`
+		SELECT `+pictureColumns+`, ai.position
+		FROM album_items ai
+		JOIN pictures p ON p.id = ai.picture_id
+		WHERE ai.album_id = ? AND p.deleted = 0
+		ORDER BY ai.position, ai.picture_id
+	`, albumID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pics []PictureWithTags
+	var positions []int
+	for rows.Next() {
+		var pic PictureWithTags
+		var position int
+		if err := scanPictureWithTags(rows, &pic, &position); err != nil {
+			return nil, err
+		}
+		pics = append(pics, pic)
+		positions = append(positions, position)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	// 批量获取标签
+	if err := attachTags(db, pics); err != nil {
+		return nil, err
+	}
+
+	items := make([]AlbumItem, len(pics))
+	for i, pic := range pics {
+		items[i] = AlbumItem{PictureWithTags: pic, Position: positions[i]}
+	}
+	return items, nil
+}
+
+// AddAlbumItems 向相册添加图片
+// position < 0 时追加到末尾，否则插入到指定位置（原有图片依次后移）；已在相册中的图片保持原位
+// 返回实际新增的图片 ID
+func AddAlbumItems(db *sql.DB, albumID string, pictureIDs []string, position int) ([]string, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer tx.Rollback()
+
+	// 过滤已在相册中的图片和重复 ID
+	seen := make(map[string]bool, len(pictureIDs))
+	var newIDs []string
+	for _, id := range pictureIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+
+		var exists int
+		err := tx.QueryRow("SELECT COUNT(*) FROM album_items WHERE album_id = ? AND picture_id = ?", albumID, id).Scan(&exists)
+		if err != nil {
+			return nil, err
+		}
+		if exists == 0 {
+			newIDs = append(newIDs, id)
+		}
+	}
+	if len(newIDs) == 0 {
+		return newIDs, tx.Commit()
+	}
+
+	var next int
+	if err := tx.QueryRow("SELECT COALESCE(MAX(position) + 1, 0) FROM album_items WHERE album_id = ?", albumID).Scan(&next); err != nil {
+		return nil, err
+	}
+	if position < 0 || position > next {
+		position = next
+	} else {
+		// 为插入的图片腾出位置
+		if _, err := tx.Exec(
+			"UPDATE album_items SET position = position + ? WHERE album_id = ? AND position >= ?",
+			len(newIDs), albumID, position,
+		); err != nil {
+			return nil, err
+		}
+	}
+
+	for i, id := range newIDs {
+		if _, err := tx.Exec(
+			"INSERT INTO album_items (album_id, picture_id, position) VALUES (?, ?, ?)",
+			albumID, id, position+i,
+		); err != nil {
+			return nil, err
+		}
+	}
+
+	if _, err := tx.Exec("UPDATE albums SET updated_at = CURRENT_TIMESTAMP WHERE id = ?", albumID); err != nil {
+		return nil, err
+	}
+
+	return newIDs, tx.Commit()
+}
+
+// RemoveAlbumItems 从相册移除图片，返回实际移除的数量
+// 如果被移除的图片是相册封面，封面会被清空（回退到第一张图片）
+func RemoveAlbumItems(db *sql.DB, albumID string, pictureIDs []string) (int, error) {
+	if len(pictureIDs) == 0 {
+		return 0, nil
+	}
+
+	tx, err := db.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	args := make([]interface{}, 0, len(pictureIDs)+1)
+	args = append(args, albumID)
+	for _, id := range pictureIDs {
+		args = append(args, id)
+	}
+
+	result, err := tx.Exec(
+		"DELETE FROM album_items WHERE album_id = ? AND picture_id IN ("+placeholders(len(pictureIDs))+")",
+		args...,
+	)
+	if err != nil {
+		return 0, err
+	}
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	if _, err := tx.Exec(
+		"UPDATE albums SET cover_picture_id = NULL WHERE id = ? AND cover_picture_id IN ("+placeholders(len(pictureIDs))+")",
+		args...,
+	); err != nil {
+		return 0, err
+	}
+	if _, err := tx.Exec("UPDATE albums SET updated_at = CURRENT_TIMESTAMP WHERE id = ?", albumID); err != nil {
+		return 0, err
+	}
+
+	return int(removed), tx.Commit()
+}
+
+// ReorderAlbumItems 重新排列相册中的图片
+// pictureIDs 中的图片依次排在最前面，未列出的图片保持原有相对顺序排在其后
+func ReorderAlbumItems(db *sql.DB, albumID string, pictureIDs []string) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	rows, err := tx.Query("SELECT picture_id FROM album_items WHERE album_id = ? ORDER BY position, picture_id", albumID)
+	if err != nil {
+		return err
+	}
+	var current []string
+	inAlbum := make(map[string]bool)
+	for rows.Next() {
+		var id string
+		if err := rows.Scan(&id); err != nil {
+			rows.Close()
+			return err
+		}
+		current = append(current, id)
+		inAlbum[id] = true
+	}
+	if err := rows.Err(); err != nil {
+		rows.Close()
+		return err
+	}
+	rows.Close()
+
+	order := make([]string, 0, len(current))
+	placed := make(map[string]bool, len(current))
+	for _, id := range pictureIDs {
+		if !inAlbum[id] {
+			return ErrImageNotInAlbum
+		}
+		if !placed[id] {
+			placed[id] = true
+			order = append(order, id)
+		}
+	}
+	for _, id := range current {
+		if !placed[id] {
+			order = append(order, id)
+		}
+	}
+
+	for i, id := range order {
+		if _, err := tx.Exec("UPDATE album_items SET position = ? WHERE album_id = ? AND picture_id = ?", i, albumID, id); err != nil {
+			return err
+		}
+	}
+	if _, err := tx.Exec("UPDATE albums SET updated_at = CURRENT_TIMESTAMP WHERE id = ?", albumID); err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,136 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// createAlbumPictures 写入 n 张图片，URL 为 https://cdn.example.com/<id>.png
+func createAlbumPictures(t *testing.T, store Store, n int) []string {
+	t.Helper()
+	ids := make([]string, n)
+	for i := range ids {
+		ids[i] = fmt.Sprintf("img_%02d", i)
+		pic := &Picture{ID: ids[i], URL: "https://cdn.example.com/" + ids[i] + ".png", StorageKey: ids[i] + ".png", Hash: ids[i]}
+		if err := store.CreatePicture(pic); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return ids
+}
+
+func albumOrder(t *testing.T, store Store, albumID string) string {
+	t.Helper()
+	items, err := store.ListAlbumItems(albumID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ids := make([]string, len(items))
+	for i, item := range items {
+		ids[i] = item.ID
+	}
+	return strings.Join(ids, ",")
+}
+
+func TestAlbumItems(t *testing.T) {
+	store := openTestStore(t)
+	ids := createAlbumPictures(t, store, 5)
+	if err := store.CreateAlbum(&Album{ID: "alb_1", Name: "Trip"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 重复 ID 只添加一次，已在相册中的图片保持原位
+	added, err := store.AddAlbumItems("alb_1", []string{ids[0], ids[1], ids[0]}, -1)
+	if err != nil || strings.Join(added, ",") != "img_00,img_01" {
+		t.Fatalf("AddAlbumItems = %v, %v", added, err)
+	}
+	if added, err = store.AddAlbumItems("alb_1", []string{ids[1], ids[2]}, -1); err != nil || strings.Join(added, ",") != "img_02" {
+		t.Fatalf("AddAlbumItems again = %v, %v", added, err)
+	}
+	// 插入到指定位置，后面的图片依次后移
+	if _, err := store.AddAlbumItems("alb_1", []string{ids[3], ids[4]}, 1); err != nil {
+		t.Fatal(err)
+	}
+	if got := albumOrder(t, store, "alb_1"); got != "img_00,img_03,img_04,img_01,img_02" {
+		t.Errorf("order after insert = %s", got)
+	}
+
+	// 列出的图片排在最前，其余保持相对顺序
+	if err := store.ReorderAlbumItems("alb_1", []string{ids[2], ids[1]}); err != nil {
+		t.Fatal(err)
+	}
+	if got := albumOrder(t, store, "alb_1"); got != "img_02,img_01,img_00,img_03,img_04" {
+		t.Errorf("order after reorder = %s", got)
+	}
+	if err := store.ReorderAlbumItems("alb_1", []string{"img_missing"}); !errors.Is(err, ErrImageNotInAlbum) {
+		t.Errorf("reorder with a foreign image err = %v, want ErrImageNotInAlbum", err)
+	}
+
+	removed, err := store.RemoveAlbumItems("alb_1", []string{ids[0], "img_missing"})
+	if err != nil || removed != 1 {
+		t.Errorf("RemoveAlbumItems = %d, %v, want 1", removed, err)
+	}
+	if got := albumOrder(t, store, "alb_1"); got != "img_02,img_01,img_03,img_04" {
+		t.Errorf("order after remove = %s", got)
+	}
+}
+
+func TestAlbumCoverAndCount(t *testing.T) {
+	store := openTestStore(t)
+	ids := createAlbumPictures(t, store, 3)
+	if err := store.CreateAlbum(&Album{ID: "alb_1", Name: "Trip"}); err != nil {
+		t.Fatal(err)
+	}
+
+	// 空相册没有封面
+	album, err := store.GetAlbum("alb_1")
+	if err != nil || album.CoverURL != "" || album.ImageCount != 0 {
+		t.Fatalf("empty album = %+v, %v", album, err)
+	}
+
+	if _, err := store.AddAlbumItems("alb_1", ids, -1); err != nil {
+		t.Fatal(err)
+	}
+	// 未设置封面时使用第一张图片
+	if album, err = store.GetAlbum("alb_1"); err != nil || album.CoverURL != "https://cdn.example.com/img_00.png" || album.ImageCount != 3 {
+		t.Errorf("album = %+v, %v, want first image as cover", album, err)
+	}
+
+	album.CoverImageID = ids[2]
+	album.Description = "summer"
+	if err := store.UpdateAlbum(album); err != nil {
+		t.Fatal(err)
+	}
+	if album, err = store.GetAlbum("alb_1"); err != nil || album.CoverImageID != ids[2] || album.CoverURL != "https://cdn.example.com/img_02.png" || album.Description != "summer" {
+		t.Errorf("album with cover = %+v, %v", album, err)
+	}
+
+	// 删除的图片不计数；移除封面图片后回退到第一张
+	if err := store.DeletePicture(ids[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.RemoveAlbumItems("alb_1", []string{ids[2]}); err != nil {
+		t.Fatal(err)
+	}
+	if album, err = store.GetAlbum("alb_1"); err != nil || album.CoverImageID != "" || album.CoverURL != "https://cdn.example.com/img_01.png" || album.ImageCount != 1 {
+		t.Errorf("album after removing the cover = %+v, %v", album, err)
+	}
+
+	albums, total, err := store.ListAlbums(1, 10)
+	if err != nil || total != 1 || len(albums) != 1 || albums[0].ID != "alb_1" {
+		t.Errorf("ListAlbums = %+v, %d, %v", albums, total, err)
+	}
+	if err := store.DeleteAlbum("alb_1"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.GetAlbum("alb_1"); !errors.Is(err, sql.ErrNoRows) {
+		t.Errorf("deleted album err = %v, want sql.ErrNoRows", err)
+	}
+	// 图片本身不受影响
+	if _, err := store.GetPicture(ids[1]); err != nil {
+		t.Errorf("picture after album delete: %v", err)
+	}
+}
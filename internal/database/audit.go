@@ -0,0 +1,135 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// AuditEntry 审计日志中的一条修改记录（只追加，不修改）
+type AuditEntry struct {
+	ID         int64           `json:"id"`
+	CreatedAt  time.Time       `json:"created_at"`
+	Actor      string          `json:"actor"`
+	Action     string          `json:"action"`      // 例如 image.upload、image.tags.update
+	TargetType string          `json:"target_type"` // image、album、share
+	TargetID   string          `json:"target_id"`
+	Before     json.RawMessage `json:"before,omitempty"` // 修改前的状态（JSON）
+	After      json.RawMessage `json:"after,omitempty"`  // 修改后的状态（JSON）
+	ClientIP   string          `json:"client_ip"`
+}
+
+// AuditFilter 审计日志的过滤条件，零值表示不过滤
+type AuditFilter struct {
+	Actor      string
+	Action     string // 以 . 结尾时按前缀匹配，例如 image. 匹配所有图片操作
+	TargetType string
+	TargetID   string
+	Since      *time.Time // 含
+	Until      *time.Time // 不含
+}
+
+func (f AuditFilter) where() (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+	if f.Actor != "" {
+		conds = append(conds, "actor = ?")
+		args = append(args, f.Actor)
+	}
+	if strings.HasSuffix(f.Action, ".") {
+		conds = append(conds, "substr(action, 1, ?) = ?")
+		args = append(args, len(f.Action), f.Action)
+	} else if f.Action != "" {
+		conds = append(conds, "action = ?")
+		args = append(args, f.Action)
+	}
+	if f.TargetType != "" {
+		conds = append(conds, "target_type = ?")
+		args = append(args, f.TargetType)
+	}
+	if f.TargetID != "" {
+		conds = append(conds, "target_id = ?")
+		args = append(args, f.TargetID)
+	}
+	if f.Since != nil {
+		conds = append(conds, "created_at >= ?")
+		args = append(args, f.Since.UTC().Format(dbTimeFormat))
+	}
+	if f.Until != nil {
+		conds = append(conds, "created_at < ?")
+		args = append(args, f.Until.UTC().Format(dbTimeFormat))
+	}
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " WHERE " + strings.Join(conds, " AND "), args
+}
+
+// CreateAuditEntry 追加一条审计日志
+func CreateAuditEntry(db *sql.DB, e *AuditEntry) error {
+	_, err := db.Exec(
+		`INSERT INTO audit_log (created_at, actor, action, target_type, target_id, before_json, after_json, client_ip)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		e.CreatedAt.UTC().Format(dbTimeFormat), e.Actor, e.Action, e.TargetType, e.TargetID,
+		nullIfEmptyJSON(e.Before), nullIfEmptyJSON(e.After), e.ClientIP,
+	)
+	return err
+}
+
+// ListAuditEntries 按时间从新到旧列出审计日志
+func ListAuditEntries(db *sql.DB, filter AuditFilter, page, limit int) ([]AuditEntry, int, error) {
+	where, args := filter.where()
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM audit_log"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * limit
+	rows, err := db.Query(
+		`SELECT id, created_at, actor, action, target_type, target_id, before_json, after_json, client_ip
+		FROM audit_log`+where+`
+		ORDER BY id DESC
+		LIMIT ? OFFSET ?`,
+		append(args, limit, offset)...,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	entries := []AuditEntry{}
+	for rows.Next() {
+		var e AuditEntry
+		var before, after sql.NullString
+		if err := rows.Scan(&e.ID, &e.CreatedAt, &e.Actor, &e.Action, &e.TargetType, &e.TargetID,
+			&before, &after, &e.ClientIP); err != nil {
+			return nil, 0, err
+		}
+		if before.Valid {
+			e.Before = json.RawMessage(before.String)
+		}
+		if after.Valid {
+			e.After = json.RawMessage(after.String)
+		}
+		entries = append(entries, e)
+	}
+	return entries, total, rows.Err()
+}
+
+// DeleteAuditEntriesBefore 删除 cutoff 之前的审计日志（保留期清理），返回删除的数量
+func DeleteAuditEntriesBefore(db *sql.DB, cutoff time.Time) (int64, error) {
+	result, err := db.Exec("DELETE FROM audit_log WHERE created_at < ?", cutoff.UTC().Format(dbTimeFormat))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+func nullIfEmptyJSON(v json.RawMessage) interface{} {
+	if len(v) == 0 {
+		return nil
+	}
+	return string(v)
+}
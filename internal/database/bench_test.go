@@ -0,0 +1,186 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/vaaandark/PixelHub/internal/config"
+)
+
+// benchRows 基准测试的图片数量，每张图片 3 个标签（共 50 个标签）
+const (
+	benchRows = 100_000
+	benchTags = 50
+	benchPage = 20
+)
+
+// seedBenchStore 创建迁移后的 SQLite 库并在一个事务中写入 benchRows 张图片
+func seedBenchStore(b *testing.B) *sqlStore {
+	b.Helper()
+	store, err := InitDB(&config.DatabaseConfig{Path: filepath.Join(b.TempDir(), "bench.db")})
+	if err != nil {
+		b.Fatal(err)
+	}
+	b.Cleanup(func() { store.Close() })
+	s := store.(*sqlStore)
+
+	tx, err := s.write.Begin()
+	if err != nil {
+		b.Fatal(err)
+	}
+	defer tx.Rollback()
+	for i := 1; i <= benchTags; i++ {
+		if _, err := tx.Exec("INSERT INTO tags (id, tag_name) VALUES (?, ?)", i, fmt.Sprintf("tag%02d", i)); err != nil {
+			b.Fatal(err)
+		}
+	}
+	insertPic, err := tx.Prepare("INSERT INTO pictures (id, url, storage_key, hash, description, upload_date, width, height, mime_type) VALUES (?, '', ?, ?, '', ?, 640, 480, 'image/png')")
+	if err != nil {
+		b.Fatal(err)
+	}
+	insertTag, err := tx.Prepare("INSERT INTO picture_tags (picture_id, tag_id) VALUES (?, ?)")
+	if err != nil {
+		b.Fatal(err)
+	}
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < benchRows; i++ {
+		id := fmt.Sprintf("img_%06d", i)
+		// 每 10 张图片共用同一秒，游标需要依靠 id 区分
+		uploaded := start.Add(time.Duration(i/10) * time.Second).Format(dbTimeFormat)
+		if _, err := insertPic.Exec(id, id+".png", fmt.Sprintf("%064d", i), uploaded); err != nil {
+			b.Fatal(err)
+		}
+		for j := 0; j < 3; j++ {
+			if _, err := insertTag.Exec(id, (i+j*17)%benchTags+1); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	if err := tx.Commit(); err != nil {
+		b.Fatal(err)
+	}
+	return s
+}
+
+// listPicturesPerRow 批量获取标签之前的 ListPictures：先计数，再按 OFFSET 分页并为每张图片单独查询一次标签
+func listPicturesPerRow(db *sql.DB, page, limit int) ([]PictureWithTags, int, error) {
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM pictures p WHERE p.deleted = 0").Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := db.Query(`
+		SELECT `+pictureColumns+`
+		FROM pictures p
+		WHERE p.deleted = 0
+		ORDER BY p.upload_date DESC, p.id DESC
+		LIMIT ? OFFSET ?
+	`, limit, (page-1)*limit)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var results []PictureWithTags
+	for rows.Next() {
+		var pic PictureWithTags
+		if err := scanPictureWithTags(rows, &pic); err != nil {
+			return nil, 0, err
+		}
+		if pic.Tags, err = GetPictureTags(db, pic.ID); err != nil {
+			return nil, 0, err
+		}
+		results = append(results, pic)
+	}
+	return results, total, rows.Err()
+}
+
+func BenchmarkListPicturesTags(b *testing.B) {
+	s := seedBenchStore(b)
+
+	b.Run("per-row", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			pics, _, err := listPicturesPerRow(s.read, 1, benchPage)
+			if err != nil || len(pics) != benchPage {
+				b.Fatalf("listPicturesPerRow = %d, %v", len(pics), err)
+			}
+		}
+	})
+	b.Run("batched", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			pics, _, err := s.ListPictures(PictureFilter{}, 1, benchPage, "date_desc", nil)
+			if err != nil || len(pics) != benchPage {
+				b.Fatalf("ListPictures = %d, %v", len(pics), err)
+			}
+		}
+	})
+}
+
+func BenchmarkListPicturesDeepPage(b *testing.B) {
+	s := seedBenchStore(b)
+	// 第 4000 页附近（跳过 80000 行）
+	page := 4000
+
+	b.Run("offset-per-row", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			pics, _, err := listPicturesPerRow(s.read, page, benchPage)
+			if err != nil || len(pics) != benchPage {
+				b.Fatalf("listPicturesPerRow = %d, %v", len(pics), err)
+			}
+		}
+	})
+	b.Run("offset-batched", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			pics, _, err := s.ListPictures(PictureFilter{}, page, benchPage, "date_desc", nil)
+			if err != nil || len(pics) != benchPage {
+				b.Fatalf("ListPictures = %d, %v", len(pics), err)
+			}
+		}
+	})
+
+	prev, _, err := s.ListPictures(PictureFilter{}, page-1, benchPage, "date_desc", nil)
+	if err != nil || len(prev) == 0 {
+		b.Fatalf("ListPictures = %d, %v", len(prev), err)
+	}
+	cursor := PictureCursor(prev[len(prev)-1], "date_desc")
+	b.Run("cursor-batched", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			pics, _, err := s.ListPictures(PictureFilter{}, 1, benchPage, "date_desc", cursor)
+			if err != nil || len(pics) != benchPage {
+				b.Fatalf("ListPictures = %d, %v", len(pics), err)
+			}
+		}
+	})
+}
+
+// BenchmarkAttachTags 只比较一页图片的标签查询：逐行查询和一次批量查询
+func BenchmarkAttachTags(b *testing.B) {
+	s := seedBenchStore(b)
+	page, _, err := s.ListPictures(PictureFilter{}, 1, 100, "date_desc", nil)
+	if err != nil {
+		b.Fatal(err)
+	}
+
+	b.Run("per-row", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for j := range page {
+				if _, err := GetPictureTags(s.read, page[j].ID); err != nil {
+					b.Fatal(err)
+				}
+			}
+		}
+	})
+	b.Run("batched", func(b *testing.B) {
+		for i := 0; i < b.N; i++ {
+			for j := range page {
+				page[j].Tags = nil
+			}
+			if err := attachTags(s.read, page); err != nil {
+				b.Fatal(err)
+			}
+		}
+	})
+}
@@ -0,0 +1,73 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"time"
+)
+
+// ErrInvalidCursor 游标无法解析或与当前查询不匹配
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor 游标分页的位置，指向上一页的最后一条记录
+// 编码后对客户端不透明，客户端只需原样传回 next_cursor
+type Cursor struct {
+	Sort       string    `json:"s,omitempty"` // 生成游标时的排序方式
+	UploadDate time.Time `json:"d,omitempty"`
+	ID         string    `json:"i,omitempty"`
+	Matched    int       `json:"m,omitempty"` // 相关性搜索的匹配标签数
+	Count      int       `json:"c,omitempty"` // 标签列表的使用次数
+	TagID      int       `json:"t,omitempty"`
+}
+
+// Encode 编码为 URL 安全的字符串
+func (c *Cursor) Encode() string {
+	data, _ := json.Marshal(c)
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+// IsTagCursor 是否为标签列表生成的游标
+func (c *Cursor) IsTagCursor() bool {
+	return c.Sort == tagCursorSort
+}
+
+// DecodeCursor 解析客户端传回的游标
+func DecodeCursor(s string) (*Cursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	var c Cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return &c, nil
+}
+
+// PictureCursor 根据一页图片的最后一条记录生成下一页游标
+func PictureCursor(pic PictureWithTags, sort string) *Cursor {
+	return &Cursor{
+		Sort:       sort,
+		UploadDate: pic.UploadDate,
+		ID:         pic.ID,
+		Matched:    pic.MatchedTagCount,
+	}
+}
+
+// tagCursorSort 标签列表游标的排序方式，与图片列表的游标互不通用
+const tagCursorSort = "tag_count"
+
+// TagCursor 根据一页标签的最后一条记录生成下一页游标
+func TagCursor(tag Tag) *Cursor {
+	return &Cursor{
+		Sort:  tagCursorSort,
+		Count: tag.Count,
+		TagID: tag.ID,
+	}
+}
+
+// dbTime 游标中的时间转换为数据库中的存储格式
+func (c *Cursor) dbTime() string {
+	return c.UploadDate.UTC().Format(dbTimeFormat)
+}
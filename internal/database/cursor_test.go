@@ -0,0 +1,178 @@
+package database
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCursorEncodeDecode(t *testing.T) {
+	c := &Cursor{Sort: "date_desc", UploadDate: time.Date(2024, 5, 6, 7, 8, 9, 0, time.UTC), ID: "img_1", Matched: 2}
+	got, err := DecodeCursor(c.Encode())
+	if err != nil || got.Sort != c.Sort || !got.UploadDate.Equal(c.UploadDate) || got.ID != c.ID || got.Matched != c.Matched {
+		t.Errorf("DecodeCursor(Encode) = %+v, %v, want %+v", got, err, c)
+	}
+	for _, s := range []string{"bogus!", "bm90IGpzb24"} {
+		if _, err := DecodeCursor(s); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("DecodeCursor(%q) err = %v, want ErrInvalidCursor", s, err)
+		}
+	}
+}
+
+func TestListPicturesCursorSameSecond(t *testing.T) {
+	store := openTestStore(t)
+	for i := 0; i < 5; i++ {
+		id := fmt.Sprintf("img_%02d", i)
+		if err := store.CreatePicture(&Picture{ID: id, URL: "u", StorageKey: id + ".png", Hash: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if _, err := store.(*sqlStore).write.Exec("UPDATE pictures SET upload_date = '2024-01-01 00:00:00'"); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, sort := range []string{"date_desc", "date_asc"} {
+		var seen []string
+		var cursor *Cursor
+		for i := 0; i < 5; i++ {
+			pics, total, err := store.ListPictures(PictureFilter{}, 1, 2, sort, cursor)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if total != 5 {
+				t.Fatalf("total = %d, want 5", total)
+			}
+			if len(pics) == 0 {
+				break
+			}
+			seen = append(seen, pictureIDs(pics))
+			cursor = PictureCursor(pics[len(pics)-1], sort)
+		}
+		want := "img_04,img_03,img_02,img_01,img_00"
+		if sort == "date_asc" {
+			want = "img_00,img_01,img_02,img_03,img_04"
+		}
+		if got := strings.Join(seen, ","); got != want {
+			t.Errorf("%s cursor pages = %s, want %s", sort, got, want)
+		}
+	}
+
+	// 游标与排序方式不匹配
+	if _, _, err := store.ListPictures(PictureFilter{}, 1, 2, "date_desc", &Cursor{Sort: "date_asc"}); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("mismatched cursor err = %v, want ErrInvalidCursor", err)
+	}
+}
+
+func TestSearchCursor(t *testing.T) {
+	store := openTestStore(t)
+	// img_00-img_03 都有 sky，偶数的还有 sea
+	for i := 0; i < 4; i++ {
+		id := fmt.Sprintf("img_%02d", i)
+		if err := store.CreatePicture(&Picture{ID: id, URL: "u", StorageKey: id + ".png", Hash: id}); err != nil {
+			t.Fatal(err)
+		}
+		tags := []string{"sky"}
+		if i%2 == 0 {
+			tags = append(tags, "sea")
+		}
+		if err := store.SetPictureTags(id, tags); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var seen []string
+	var cursor *Cursor
+	for i := 0; i < 4; i++ {
+		pics, _, err := store.SearchExact([]string{"sky"}, PictureFilter{}, 1, 3, cursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pics) == 0 {
+			break
+		}
+		seen = append(seen, pictureIDs(pics))
+		cursor = PictureCursor(pics[len(pics)-1], "date_desc")
+	}
+	if got := strings.Join(seen, ","); got != "img_03,img_02,img_01,img_00" {
+		t.Errorf("exact search cursor pages = %s", got)
+	}
+
+	// 相关性搜索按匹配标签数、时间、id 定位
+	seen, cursor = nil, nil
+	for i := 0; i < 4; i++ {
+		pics, _, err := store.SearchRelevance([]string{"sky", "sea"}, PictureFilter{}, 1, 3, cursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(pics) == 0 {
+			break
+		}
+		seen = append(seen, pictureIDs(pics))
+		cursor = PictureCursor(pics[len(pics)-1], "relevance")
+	}
+	if got := strings.Join(seen, ","); got != "img_02,img_00,img_03,img_01" {
+		t.Errorf("relevance search cursor pages = %s", got)
+	}
+	if _, _, err := store.SearchRelevance([]string{"sky"}, PictureFilter{}, 1, 3, &Cursor{Sort: "date_desc"}); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("mismatched relevance cursor err = %v, want ErrInvalidCursor", err)
+	}
+}
+
+func TestListTagsCursor(t *testing.T) {
+	store := openTestStore(t)
+	for i := 0; i < 3; i++ {
+		id := fmt.Sprintf("img_%02d", i)
+		if err := store.CreatePicture(&Picture{ID: id, URL: "u", StorageKey: id + ".png", Hash: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	// 使用次数：a=3, b=2, c=2, d=1；次数相同时按标签 ID 排序
+	for i, tags := range [][]string{{"a", "b", "c", "d"}, {"a", "b", "c"}, {"a"}} {
+		if err := store.SetPictureTags(fmt.Sprintf("img_%02d", i), tags); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var seen []string
+	var cursor *Cursor
+	for i := 0; i < 4; i++ {
+		tags, total, err := store.ListTags(1, 2, cursor)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != 4 {
+			t.Fatalf("total = %d, want 4", total)
+		}
+		if len(tags) == 0 {
+			break
+		}
+		for _, tag := range tags {
+			seen = append(seen, fmt.Sprintf("%s:%d", tag.TagName, tag.Count))
+		}
+		cursor = TagCursor(tags[len(tags)-1])
+	}
+	if got := strings.Join(seen, ","); got != "a:3,b:2,c:2,d:1" {
+		t.Errorf("tag cursor pages = %s", got)
+	}
+
+	// 图片列表的游标不能用于标签列表，反之亦然
+	pics, _, err := store.ListPictures(PictureFilter{}, 1, 1, "date_desc", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := store.ListTags(1, 2, PictureCursor(pics[0], "date_desc")); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("picture cursor on tags err = %v, want ErrInvalidCursor", err)
+	}
+	if _, _, err := store.ListTags(1, 2, &Cursor{Count: 2, TagID: 1}); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("cursor without sort err = %v, want ErrInvalidCursor", err)
+	}
+	tags, _, err := store.ListTags(1, 1, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, err := store.ListPictures(PictureFilter{}, 1, 2, "date_desc", TagCursor(tags[0])); !errors.Is(err, ErrInvalidCursor) {
+		t.Errorf("tag cursor on pictures err = %v, want ErrInvalidCursor", err)
+	}
+}
@@ -2,64 +2,104 @@ package database
 
 import (
 	"database/sql"
+	"fmt"
+	"net/url"
 	"os"
 	"path/filepath"
+	"strconv"
 
 	_ "github.com/mattn/go-sqlite3"
+	"github.com/vaaandark/PixelHub/internal/config"
 )
 
-// InitDB 初始化数据库连接并创建表
-func InitDB(dbPath string) (*sql.DB, error) {
+// 连接参数默认值
+const (
+	defaultJournalMode  = "WAL"
+	defaultBusyTimeout  = 5000 // 毫秒
+	defaultSynchronous  = "NORMAL"
+	defaultMaxReadConns = 4
+)
+
+// DB 读写分离的连接池
+// SQLite 同一时间只允许一个写事务，写连接池限制为单个连接，并发写入在连接池中排队而不是返回 database is locked；
+// 读连接池为只读连接，WAL 模式下可以与写入并发执行
+type DB struct {
+	Write *sql.DB
+	Read  *sql.DB
+}
+
+// Close 关闭读写连接池
+func (db *DB) Close() error {
+	readErr := db.Read.Close()
+	if err := db.Write.Close(); err != nil {
+		return err
+	}
+	return readErr
+}
+
+// OpenDB 打开 SQLite 读写连接池（不执行迁移）
+func OpenDB(cfg *config.DatabaseConfig) (*DB, error) {
 	// 确保数据目录存在
-	dir := filepath.Dir(dbPath)
+	dir := filepath.Dir(cfg.Path)
 	if err := os.MkdirAll(dir, 0755); err != nil {
 		return nil, err
 	}
 
-	db, err := sql.Open("sqlite3", dbPath)
+	write, err := sql.Open("sqlite3", dsn(cfg, false))
 	if err != nil {
 		return nil, err
 	}
+	write.SetMaxOpenConns(1)
+
+	// 先建立写连接，确保 journal_mode 等持久化设置在只读连接打开前生效
+	if err := write.Ping(); err != nil {
+		write.Close()
+		return nil, fmt.Errorf("failed to open database: %w", err)
+	}
 
-	// 创建表
-	if err := createTables(db); err != nil {
-		db.Close()
+	read, err := sql.Open("sqlite3", dsn(cfg, true))
+	if err != nil {
+		write.Close()
 		return nil, err
 	}
+	maxReadConns := cfg.MaxReadConns
+	if maxReadConns <= 0 {
+		maxReadConns = defaultMaxReadConns
+	}
+	read.SetMaxOpenConns(maxReadConns)
 
-	return db, nil
+	return &DB{Write: write, Read: read}, nil
 }
 
-func createTables(db *sql.DB) error {
-	schema := `
-	CREATE TABLE IF NOT EXISTS pictures (
-		id TEXT PRIMARY KEY,
-		url TEXT NOT NULL,
-		storage_key TEXT NOT NULL,
-		hash TEXT NOT NULL,
-		description TEXT,
-		upload_date DATETIME DEFAULT CURRENT_TIMESTAMP,
-		deleted INTEGER DEFAULT 0
-	);
-
-	CREATE TABLE IF NOT EXISTS tags (
-		id INTEGER PRIMARY KEY AUTOINCREMENT,
-		tag_name TEXT UNIQUE NOT NULL
-	);
-
-	CREATE TABLE IF NOT EXISTS picture_tags (
-		picture_id TEXT NOT NULL,
-		tag_id INTEGER NOT NULL,
-		PRIMARY KEY (picture_id, tag_id),
-		FOREIGN KEY (picture_id) REFERENCES pictures(id) ON DELETE CASCADE,
-		FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE
-	);
+// dsn 生成连接字符串，PRAGMA 通过连接参数设置，对连接池中的每个连接都生效
+func dsn(cfg *config.DatabaseConfig, readOnly bool) string {
+	journalMode := cfg.JournalMode
+	if journalMode == "" {
+		journalMode = defaultJournalMode
+	}
+	busyTimeout := cfg.BusyTimeout
+	if busyTimeout == 0 {
+		busyTimeout = defaultBusyTimeout
+	}
+	synchronous := cfg.Synchronous
+	if synchronous == "" {
+		synchronous = defaultSynchronous
+	}
 
-	CREATE INDEX IF NOT EXISTS idx_picture_tags_picture ON picture_tags(picture_id);
-	CREATE INDEX IF NOT EXISTS idx_picture_tags_tag ON picture_tags(tag_id);
-	CREATE INDEX IF NOT EXISTS idx_tags_name ON tags(tag_name);
-	`
+	params := url.Values{}
+	params.Set("_foreign_keys", "on")
+	params.Set("_busy_timeout", strconv.Itoa(busyTimeout))
+	params.Set("_synchronous", synchronous)
+	if cfg.CacheSize != 0 {
+		params.Set("_cache_size", strconv.Itoa(cfg.CacheSize))
+	}
+	if readOnly {
+		params.Set("_query_only", "on")
+	} else {
+		params.Set("_journal_mode", journalMode)
+		// 写事务开始时即获取写锁，避免读事务升级为写事务时死锁
+		params.Set("_txlock", "immediate")
+	}
 
-	_, err := db.Exec(schema)
-	return err
+	return "file:" + cfg.Path + "?" + params.Encode()
 }
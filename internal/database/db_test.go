@@ -0,0 +1,91 @@
+package database
+
+import (
+	"database/sql"
+	"path/filepath"
+	"testing"
+
+	"github.com/vaaandark/PixelHub/internal/config"
+)
+
+func TestOpenDBPragmas(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		cfg         config.DatabaseConfig
+		journalMode string
+		busyTimeout int
+	}{
+		{"defaults", config.DatabaseConfig{}, "wal", defaultBusyTimeout},
+		{"configured", config.DatabaseConfig{JournalMode: "DELETE", BusyTimeout: 1234}, "delete", 1234},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cfg := tc.cfg
+			cfg.Path = filepath.Join(t.TempDir(), "pixelhub.db")
+			db, err := OpenDB(&cfg)
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer db.Close()
+
+			var journalMode string
+			if err := db.Write.QueryRow("PRAGMA journal_mode").Scan(&journalMode); err != nil {
+				t.Fatal(err)
+			}
+			if journalMode != tc.journalMode {
+				t.Errorf("journal_mode = %s, want %s", journalMode, tc.journalMode)
+			}
+
+			// 读写连接都开启外键约束并使用相同的 busy_timeout
+			for name, pool := range map[string]*sql.DB{"write": db.Write, "read": db.Read} {
+				var foreignKeys, busyTimeout int
+				if err := pool.QueryRow("PRAGMA foreign_keys").Scan(&foreignKeys); err != nil {
+					t.Fatal(err)
+				}
+				if err := pool.QueryRow("PRAGMA busy_timeout").Scan(&busyTimeout); err != nil {
+					t.Fatal(err)
+				}
+				if foreignKeys != 1 || busyTimeout != tc.busyTimeout {
+					t.Errorf("%s pool: foreign_keys = %d, busy_timeout = %d; want 1, %d", name, foreignKeys, busyTimeout, tc.busyTimeout)
+				}
+			}
+		})
+	}
+}
+
+func TestReadPoolIsReadOnly(t *testing.T) {
+	s := openTestStore(t).(*sqlStore)
+	if err := CreatePicture(s.read, &Picture{ID: "img_1", StorageKey: "img_1.png", Hash: "h1"}); err == nil {
+		t.Error("write through the read pool succeeded")
+	}
+	if err := CreatePicture(s.write, &Picture{ID: "img_1", StorageKey: "img_1.png", Hash: "h1"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := GetPicture(s.read, "img_1"); err != nil {
+		t.Errorf("read pool does not see committed write: %v", err)
+	}
+}
+
+// 开启外键后，删除图片级联删除其标签关联，且不能写入悬空引用
+func TestForeignKeysCascade(t *testing.T) {
+	store := openTestStore(t)
+	db := store.(*sqlStore).write
+	if err := store.CreatePicture(&Picture{ID: "img_1", StorageKey: "img_1.png", Hash: "h1"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetPictureTags("img_1", []string{"sky"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.Exec("DELETE FROM pictures WHERE id = 'img_1'"); err != nil {
+		t.Fatal(err)
+	}
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM picture_tags").Scan(&n); err != nil {
+		t.Fatal(err)
+	}
+	if n != 0 {
+		t.Errorf("%d picture_tags rows left after deleting the picture, want 0", n)
+	}
+	if _, err := db.Exec("INSERT INTO picture_tags (picture_id, tag_id) VALUES ('missing', 1)"); err == nil {
+		t.Error("insert referencing a missing picture succeeded")
+	}
+}
@@ -0,0 +1,93 @@
+package database
+
+import (
+	"strings"
+	"time"
+)
+
+// PictureFilter 图片列表和搜索共用的过滤条件，零值表示不过滤
+type PictureFilter struct {
+	UploadedAfter  *time.Time // 上传时间下界（含）
+	UploadedBefore *time.Time // 上传时间上界（不含）
+	MinWidth       int
+	MaxWidth       int
+	MinHeight      int
+	MaxHeight      int
+	MIMETypes      []string // 任一匹配即可
+	Untagged       bool     // 只返回没有标签的图片
+	HasDescription *bool    // true: 有描述；false: 无描述
+	TagCount       *int     // 标签数量精确匹配
+}
+
+// sortOrders 允许的排序方式（白名单，禁止直接拼接用户输入）
+var sortOrders = map[string]string{
+	"date_desc": "p.upload_date DESC, p.id DESC",
+	"date_asc":  "p.upload_date ASC, p.id ASC",
+}
+
+// orderByClause 返回排序子句，未知的排序方式回退为最新优先
+func orderByClause(sort string) string {
+	if clause, ok := sortOrders[sort]; ok {
+		return clause
+	}
+	return sortOrders["date_desc"]
+}
+
+// dbTimeFormat 与 SQLite CURRENT_TIMESTAMP 一致的时间格式（UTC）
+const dbTimeFormat = "2006-01-02 15:04:05"
+
+// where 把过滤条件转换为参数化的 SQL 条件（以 AND 连接，别名 p 指向 pictures 表）
+func (f PictureFilter) where() (string, []interface{}) {
+	var conds []string
+	var args []interface{}
+
+	if f.UploadedAfter != nil {
+		conds = append(conds, "p.upload_date >= ?")
+		args = append(args, f.UploadedAfter.UTC().Format(dbTimeFormat))
+	}
+	if f.UploadedBefore != nil {
+		conds = append(conds, "p.upload_date < ?")
+		args = append(args, f.UploadedBefore.UTC().Format(dbTimeFormat))
+	}
+	if f.MinWidth > 0 {
+		conds = append(conds, "p.width >= ?")
+		args = append(args, f.MinWidth)
+	}
+	if f.MaxWidth > 0 {
+		conds = append(conds, "p.width <= ?")
+		args = append(args, f.MaxWidth)
+	}
+	if f.MinHeight > 0 {
+		conds = append(conds, "p.height >= ?")
+		args = append(args, f.MinHeight)
+	}
+	if f.MaxHeight > 0 {
+		conds = append(conds, "p.height <= ?")
+		args = append(args, f.MaxHeight)
+	}
+	if len(f.MIMETypes) > 0 {
+		conds = append(conds, "p.mime_type IN ("+placeholders(len(f.MIMETypes))+")")
+		for _, m := range f.MIMETypes {
+			args = append(args, m)
+		}
+	}
+	if f.Untagged {
+		conds = append(conds, "NOT EXISTS (SELECT 1 FROM picture_tags ptf WHERE ptf.picture_id = p.id)")
+	}
+	if f.HasDescription != nil {
+		if *f.HasDescription {
+			conds = append(conds, "COALESCE(p.description, '') != ''")
+		} else {
+			conds = append(conds, "COALESCE(p.description, '') = ''")
+		}
+	}
+	if f.TagCount != nil {
+		conds = append(conds, "(SELECT COUNT(*) FROM picture_tags ptc WHERE ptc.picture_id = p.id) = ?")
+		args = append(args, *f.TagCount)
+	}
+
+	if len(conds) == 0 {
+		return "", nil
+	}
+	return " AND " + strings.Join(conds, " AND "), args
+}
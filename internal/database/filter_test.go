@@ -0,0 +1,116 @@
+package database
+
+import (
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vaaandark/PixelHub/internal/config"
+)
+
+// openTestStore 在临时目录中创建迁移后的空 SQLite 库
+func openTestStore(t *testing.T) Store {
+	t.Helper()
+	store, err := InitDB(&config.DatabaseConfig{Path: filepath.Join(t.TempDir(), "pixelhub.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store
+}
+
+// seedFilterPictures 写入过滤测试用的图片：
+// img_a 800x600 PNG 有描述、标签 sky；img_b 1920x1080 JPEG 无描述、标签 sky,sea；img_c 400x300 WebP 无标签，上传于 2024-01-01
+func seedFilterPictures(t *testing.T, store Store) {
+	t.Helper()
+	pics := []Picture{
+		{ID: "img_a", URL: "u", StorageKey: "img_a.png", Hash: "ha", Description: "a cat", Width: 800, Height: 600, MIMEType: "image/png"},
+		{ID: "img_b", URL: "u", StorageKey: "img_b.jpg", Hash: "hb", Width: 1920, Height: 1080, MIMEType: "image/jpeg"},
+		{ID: "img_c", URL: "u", StorageKey: "img_c.webp", Hash: "hc", Width: 400, Height: 300, MIMEType: "image/webp"},
+	}
+	for i := range pics {
+		if err := store.CreatePicture(&pics[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := store.SetPictureTags("img_a", []string{"sky"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.SetPictureTags("img_b", []string{"sky", "sea"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.(*sqlStore).write.Exec("UPDATE pictures SET upload_date = '2024-01-01 12:00:00' WHERE id = 'img_c'"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func pictureIDs(pics []PictureWithTags) string {
+	ids := make([]string, len(pics))
+	for i, pic := range pics {
+		ids[i] = pic.ID
+	}
+	return strings.Join(ids, ",")
+}
+
+// sortedIDs 按 ID 排序后的图片列表，过滤结果与排序方式无关
+func sortedIDs(pics []PictureWithTags) string {
+	ids := strings.Split(pictureIDs(pics), ",")
+	sort.Strings(ids)
+	return strings.Join(ids, ",")
+}
+
+func TestListPicturesFilter(t *testing.T) {
+	store := openTestStore(t)
+	seedFilterPictures(t, store)
+
+	yes, no := true, false
+	zero, two := 0, 2
+	cutoff := time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)
+	tests := []struct {
+		name   string
+		filter PictureFilter
+		want   string
+	}{
+		{"none", PictureFilter{}, "img_a,img_b,img_c"},
+		{"uploaded after", PictureFilter{UploadedAfter: &cutoff}, "img_a,img_b"},
+		{"uploaded before", PictureFilter{UploadedBefore: &cutoff}, "img_c"},
+		{"min width", PictureFilter{MinWidth: 800}, "img_a,img_b"},
+		{"max width", PictureFilter{MaxWidth: 800}, "img_a,img_c"},
+		{"height range", PictureFilter{MinHeight: 500, MaxHeight: 700}, "img_a"},
+		{"mime types", PictureFilter{MIMETypes: []string{"image/png", "image/webp"}}, "img_a,img_c"},
+		{"untagged", PictureFilter{Untagged: true}, "img_c"},
+		{"has description", PictureFilter{HasDescription: &yes}, "img_a"},
+		{"no description", PictureFilter{HasDescription: &no}, "img_b,img_c"},
+		{"tag count 0", PictureFilter{TagCount: &zero}, "img_c"},
+		{"tag count 2", PictureFilter{TagCount: &two}, "img_b"},
+		{"combined", PictureFilter{MinWidth: 500, HasDescription: &no}, "img_b"},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			pics, total, err := store.ListPictures(tc.filter, 1, 10, "date_desc", nil)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got := sortedIDs(pics); got != tc.want || total != len(strings.Split(tc.want, ",")) {
+				t.Errorf("ListPictures = %s (total %d), want %s", got, total, tc.want)
+			}
+		})
+	}
+}
+
+func TestSearchFilter(t *testing.T) {
+	store := openTestStore(t)
+	seedFilterPictures(t, store)
+
+	pics, total, err := store.SearchExact([]string{"sky"}, PictureFilter{MIMETypes: []string{"image/jpeg"}}, 1, 10, nil)
+	if err != nil || total != 1 || pictureIDs(pics) != "img_b" {
+		t.Errorf("SearchExact = %s (total %d), %v, want img_b", pictureIDs(pics), total, err)
+	}
+	yes := true
+	pics, total, err = store.SearchRelevance([]string{"sky", "sea"}, PictureFilter{HasDescription: &yes}, 1, 10, nil)
+	if err != nil || total != 1 || pictureIDs(pics) != "img_a" {
+		t.Errorf("SearchRelevance = %s (total %d), %v, want img_a", pictureIDs(pics), total, err)
+	}
+}
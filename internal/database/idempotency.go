@@ -0,0 +1,68 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// IdempotencyKey 幂等键及其对应的请求指纹和响应
+type IdempotencyKey struct {
+	Key         string
+	Fingerprint string // 方法、路径和请求体的哈希
+	StatusCode  int    // 0 表示请求仍在处理
+	ContentType string
+	Body        []byte
+	CreatedAt   time.Time
+	ExpiresAt   time.Time
+}
+
+// CreateIdempotencyKey 记录一个处理中的幂等键，键已存在时返回 false
+func CreateIdempotencyKey(db *sql.DB, k *IdempotencyKey) (bool, error) {
+	result, err := db.Exec(
+		`INSERT INTO idempotency_keys (idempotency_key, fingerprint, created_at, expires_at) VALUES (?, ?, ?, ?)
+		ON CONFLICT (idempotency_key) DO NOTHING`,
+		k.Key, k.Fingerprint, k.CreatedAt.UTC().Format(dbTimeFormat), k.ExpiresAt.UTC().Format(dbTimeFormat),
+	)
+	if err != nil {
+		return false, err
+	}
+	n, err := result.RowsAffected()
+	return n == 1, err
+}
+
+// GetIdempotencyKey 获取幂等键（包括已过期的）
+func GetIdempotencyKey(db *sql.DB, key string) (*IdempotencyKey, error) {
+	var k IdempotencyKey
+	err := db.QueryRow(
+		`SELECT idempotency_key, fingerprint, status_code, content_type, response_body, created_at, expires_at
+		FROM idempotency_keys WHERE idempotency_key = ?`, key,
+	).Scan(&k.Key, &k.Fingerprint, &k.StatusCode, &k.ContentType, &k.Body, &k.CreatedAt, &k.ExpiresAt)
+	if err != nil {
+		return nil, err
+	}
+	return &k, nil
+}
+
+// CompleteIdempotencyKey 保存请求完成后的响应
+func CompleteIdempotencyKey(db *sql.DB, key string, statusCode int, contentType string, body []byte) error {
+	_, err := db.Exec(
+		"UPDATE idempotency_keys SET status_code = ?, content_type = ?, response_body = ? WHERE idempotency_key = ?",
+		statusCode, contentType, body, key,
+	)
+	return err
+}
+
+// DeleteIdempotencyKey 删除幂等键（请求失败后允许客户端用同一个键重试）
+func DeleteIdempotencyKey(db *sql.DB, key string) error {
+	_, err := db.Exec("DELETE FROM idempotency_keys WHERE idempotency_key = ?", key)
+	return err
+}
+
+// DeleteExpiredIdempotencyKeys 删除 now 之前过期的幂等键，返回删除的数量
+func DeleteExpiredIdempotencyKeys(db *sql.DB, now time.Time) (int64, error) {
+	result, err := db.Exec("DELETE FROM idempotency_keys WHERE expires_at <= ?", now.UTC().Format(dbTimeFormat))
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,365 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+)
+
+// migration 一次表结构变更
+// 版本号从 1 开始连续递增，已发布的迁移不能修改，新的变更只能追加新版本
+type migration struct {
+	version int
+	name    string
+	up      func(tx *sql.Tx) error
+}
+
+// sqliteMigrations SQLite 的所有迁移，按版本号排列
+// 迁移系统引入之前的数据库可能已经包含部分变更，因此 1-6 号迁移都是幂等的
+var sqliteMigrations = []migration{
+	{1, "baseline", execSQL(`
+		CREATE TABLE IF NOT EXISTS pictures (
+			id TEXT PRIMARY KEY,
+			url TEXT NOT NULL,
+			storage_key TEXT NOT NULL,
+			hash TEXT NOT NULL,
+			description TEXT,
+			upload_date DATETIME DEFAULT CURRENT_TIMESTAMP,
+			deleted INTEGER DEFAULT 0
+		);
+
+		CREATE TABLE IF NOT EXISTS tags (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			tag_name TEXT UNIQUE NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS picture_tags (
+			picture_id TEXT NOT NULL,
+			tag_id INTEGER NOT NULL,
+			PRIMARY KEY (picture_id, tag_id),
+			FOREIGN KEY (picture_id) REFERENCES pictures(id) ON DELETE CASCADE,
+			FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_picture_tags_picture ON picture_tags(picture_id);
+		CREATE INDEX IF NOT EXISTS idx_picture_tags_tag ON picture_tags(tag_id);
+		CREATE INDEX IF NOT EXISTS idx_tags_name ON tags(tag_name);
+	`)},
+	{2, "picture_metadata", addColumns("pictures", []columnDef{
+		{"phash", "TEXT"},
+		{"width", "INTEGER"},
+		{"height", "INTEGER"},
+		{"mime_type", "TEXT"},
+	})},
+	{3, "pictures_upload_date_index", execSQL(`
+		CREATE INDEX IF NOT EXISTS idx_pictures_upload_date ON pictures(upload_date);
+	`)},
+	{4, "albums", execSQL(`
+		CREATE TABLE IF NOT EXISTS albums (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			description TEXT,
+			cover_picture_id TEXT,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			FOREIGN KEY (cover_picture_id) REFERENCES pictures(id) ON DELETE SET NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS album_items (
+			album_id TEXT NOT NULL,
+			picture_id TEXT NOT NULL,
+			position INTEGER NOT NULL,
+			added_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (album_id, picture_id),
+			FOREIGN KEY (album_id) REFERENCES albums(id) ON DELETE CASCADE,
+			FOREIGN KEY (picture_id) REFERENCES pictures(id) ON DELETE CASCADE
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_album_items_position ON album_items(album_id, position);
+		CREATE INDEX IF NOT EXISTS idx_album_items_picture ON album_items(picture_id);
+	`)},
+	{5, "share_links", execSQL(`
+		CREATE TABLE IF NOT EXISTS share_links (
+			token TEXT PRIMARY KEY,
+			target_type TEXT NOT NULL,
+			target_id TEXT NOT NULL,
+			password_hash TEXT,
+			expires_at DATETIME NOT NULL,
+			view_count INTEGER DEFAULT 0,
+			revoked INTEGER DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+	`)},
+	// 旧版本在 url 中保存了上传时的完整地址，能由 storage_key 推导出的一律清空，改为读取时计算
+	{6, "derive_picture_urls", execSQL(`
+		UPDATE pictures SET url = ''
+		WHERE url != '' AND storage_key != ''
+			AND substr(url, -(length(storage_key) + 1)) = '/' || storage_key;
+	`)},
+	{7, "pictures_hash_index", execSQL(`
+		CREATE INDEX IF NOT EXISTS idx_pictures_hash ON pictures(hash);
+	`)},
+	{8, "picture_source_url", addColumns("pictures", []columnDef{
+		{"source_url", "TEXT"},
+	})},
+	{9, "idempotency_keys", execSQL(`
+		CREATE TABLE IF NOT EXISTS idempotency_keys (
+			idempotency_key TEXT PRIMARY KEY,
+			fingerprint TEXT NOT NULL,
+			status_code INTEGER NOT NULL DEFAULT 0,
+			content_type TEXT NOT NULL DEFAULT '',
+			response_body BLOB,
+			created_at DATETIME NOT NULL,
+			expires_at DATETIME NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys(expires_at);
+	`)},
+	{10, "picture_versions", func(tx *sql.Tx) error {
+		if err := addColumns("pictures", []columnDef{
+			{"version", "INTEGER NOT NULL DEFAULT 1"},
+			{"revised_at", "DATETIME"},
+		})(tx); err != nil {
+			return err
+		}
+		return execSQL(`
+			CREATE TABLE IF NOT EXISTS picture_versions (
+				picture_id TEXT NOT NULL,
+				version INTEGER NOT NULL,
+				storage_key TEXT NOT NULL,
+				hash TEXT NOT NULL,
+				phash TEXT,
+				width INTEGER,
+				height INTEGER,
+				mime_type TEXT,
+				created_at DATETIME NOT NULL,
+				archived_at DATETIME NOT NULL,
+				PRIMARY KEY (picture_id, version),
+				FOREIGN KEY (picture_id) REFERENCES pictures(id) ON DELETE CASCADE
+			);
+		`)(tx)
+	}},
+	{11, "audit_log", execSQL(`
+		CREATE TABLE IF NOT EXISTS audit_log (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			created_at DATETIME NOT NULL,
+			actor TEXT NOT NULL,
+			action TEXT NOT NULL,
+			target_type TEXT NOT NULL,
+			target_id TEXT NOT NULL,
+			before_json TEXT,
+			after_json TEXT,
+			client_ip TEXT NOT NULL DEFAULT ''
+		);
+		CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log(created_at);
+		CREATE INDEX IF NOT EXISTS idx_audit_log_target ON audit_log(target_type, target_id);
+		CREATE TRIGGER IF NOT EXISTS audit_log_append_only BEFORE UPDATE ON audit_log
+		BEGIN
+			SELECT RAISE(ABORT, 'audit_log is append-only');
+		END;
+	`)},
+	{12, "webhooks", execSQL(`
+		CREATE TABLE IF NOT EXISTS webhooks (
+			id TEXT PRIMARY KEY,
+			url TEXT NOT NULL,
+			secret TEXT NOT NULL,
+			events TEXT NOT NULL,
+			description TEXT NOT NULL DEFAULT '',
+			active INTEGER NOT NULL DEFAULT 1,
+			created_at DATETIME NOT NULL,
+			updated_at DATETIME NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			webhook_id TEXT NOT NULL,
+			event_id TEXT NOT NULL,
+			event_type TEXT NOT NULL,
+			payload TEXT NOT NULL,
+			status TEXT NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			next_attempt_at DATETIME NOT NULL,
+			last_status_code INTEGER NOT NULL DEFAULT 0,
+			last_error TEXT NOT NULL DEFAULT '',
+			created_at DATETIME NOT NULL,
+			finished_at DATETIME,
+			FOREIGN KEY (webhook_id) REFERENCES webhooks(id) ON DELETE CASCADE
+		);
+		CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(status, next_attempt_at);
+		CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id, id);
+	`)},
+}
+
+// MigrationStatus 迁移的应用状态
+type MigrationStatus struct {
+	Version   int        `json:"version"`
+	Name      string     `json:"name"`
+	AppliedAt *time.Time `json:"applied_at,omitempty"` // nil 表示尚未应用
+}
+
+// migrate 按版本号顺序执行所有未应用的迁移，每个迁移在独立的事务中执行
+// lockSQL 在每个迁移事务开始后执行，防止多个实例同时迁移（SQLite 的写事务本身互斥，传空字符串）
+// 返回本次应用的迁移数量
+func migrate(db *sql.DB, migrations []migration, lockSQL string) (int, error) {
+	if err := ensureMigrationsTable(db); err != nil {
+		return 0, err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return 0, err
+	}
+
+	count := 0
+	for _, m := range migrations {
+		if _, ok := applied[m.version]; ok {
+			continue
+		}
+		ok, err := applyMigration(db, m, lockSQL)
+		if err != nil {
+			return count, fmt.Errorf("migration %d (%s) failed: %w", m.version, m.name, err)
+		}
+		if ok {
+			count++
+		}
+	}
+	return count, nil
+}
+
+// migrationStatus 列出所有迁移及其应用状态
+func migrationStatus(db *sql.DB, migrations []migration) ([]MigrationStatus, error) {
+	if err := ensureMigrationsTable(db); err != nil {
+		return nil, err
+	}
+	applied, err := appliedMigrations(db)
+	if err != nil {
+		return nil, err
+	}
+
+	statuses := make([]MigrationStatus, len(migrations))
+	for i, m := range migrations {
+		statuses[i] = MigrationStatus{Version: m.version, Name: m.name}
+		if t, ok := applied[m.version]; ok {
+			appliedAt := t
+			statuses[i].AppliedAt = &appliedAt
+		}
+	}
+	return statuses, nil
+}
+
+func ensureMigrationsTable(db *sql.DB) error {
+	_, err := db.Exec(`
+		CREATE TABLE IF NOT EXISTS schema_migrations (
+			version INTEGER PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMP DEFAULT CURRENT_TIMESTAMP
+		)
+	`)
+	return err
+}
+
+// appliedMigrations 已应用的迁移版本及应用时间
+func appliedMigrations(db *sql.DB) (map[int]time.Time, error) {
+	rows, err := db.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var appliedAt time.Time
+		if err := rows.Scan(&version, &appliedAt); err != nil {
+			return nil, err
+		}
+		applied[version] = appliedAt
+	}
+	return applied, rows.Err()
+}
+
+// applyMigration 在事务中执行单个迁移，已被其他实例应用时返回 false
+func applyMigration(db *sql.DB, m migration, lockSQL string) (bool, error) {
+	tx, err := db.Begin()
+	if err != nil {
+		return false, err
+	}
+	defer tx.Rollback()
+
+	if lockSQL != "" {
+		if _, err := tx.Exec(lockSQL); err != nil {
+			return false, err
+		}
+	}
+
+	// 持有锁之后再次确认，其他实例可能已经完成了这个迁移
+	var exists int
+	if err := tx.QueryRow("SELECT COUNT(*) FROM schema_migrations WHERE version = ?", m.version).Scan(&exists); err != nil {
+		return false, err
+	}
+	if exists > 0 {
+		return false, nil
+	}
+
+	if err := m.up(tx); err != nil {
+		return false, err
+	}
+	if _, err := tx.Exec("INSERT INTO schema_migrations (version, name) VALUES (?, ?)", m.version, m.name); err != nil {
+		return false, err
+	}
+	return true, tx.Commit()
+}
+
+// execSQL 执行一段 SQL 语句的迁移
+func execSQL(stmts string) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		_, err := tx.Exec(stmts)
+		return err
+	}
+}
+
+type columnDef struct {
+	name, definition string
+}
+
+// addColumns 为表添加列，已存在的列跳过（兼容迁移系统引入之前升级过的数据库）
+func addColumns(table string, columns []columnDef) func(tx *sql.Tx) error {
+	return func(tx *sql.Tx) error {
+		existing, err := tableColumns(tx, table)
+		if err != nil {
+			return err
+		}
+		for _, col := range columns {
+			if existing[col.name] {
+				continue
+			}
+			if _, err := tx.Exec("ALTER TABLE " + table + " ADD COLUMN " + col.name + " " + col.definition); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+}
+
+// tableColumns 获取表中已有的列名
+func tableColumns(tx *sql.Tx, table string) (map[string]bool, error) {
+	rows, err := tx.Query("PRAGMA table_info(" + table + ")")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	columns := make(map[string]bool)
+	for rows.Next() {
+		var (
+			cid       int
+			name      string
+			colType   string
+			notNull   int
+			dfltValue sql.NullString
+			pk        int
+		)
+		if err := rows.Scan(&cid, &name, &colType, &notNull, &dfltValue, &pk); err != nil {
+			return nil, err
+		}
+		columns[name] = true
+	}
+	return columns, rows.Err()
+}
@@ -0,0 +1,193 @@
+package database
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/vaaandark/PixelHub/internal/config"
+)
+
+// openTestSQLite 打开（不迁移）一个临时 SQLite 库
+func openTestSQLite(t *testing.T) *sqlStore {
+	t.Helper()
+	store, err := OpenStore(&config.DatabaseConfig{Path: filepath.Join(t.TempDir(), "pixelhub.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { store.Close() })
+	return store.(*sqlStore)
+}
+
+// schemaSnapshot 返回库中所有表、索引和触发器的定义
+func schemaSnapshot(t *testing.T, db *sql.DB) string {
+	t.Helper()
+	rows, err := db.Query("SELECT type, name, COALESCE(sql, '') FROM sqlite_master WHERE name NOT LIKE 'sqlite_%' ORDER BY type, name")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rows.Close()
+	var b strings.Builder
+	for rows.Next() {
+		var typ, name, def string
+		if err := rows.Scan(&typ, &name, &def); err != nil {
+			t.Fatal(err)
+		}
+		b.WriteString(typ + " " + name + "\n" + def + "\n")
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatal(err)
+	}
+	return b.String()
+}
+
+// tableColumnNames 返回每张表按名称排序的列
+func tableColumnNames(t *testing.T, db *sql.DB) map[string]string {
+	t.Helper()
+	rows, err := db.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var tables []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatal(err)
+		}
+		tables = append(tables, name)
+	}
+	rows.Close()
+
+	result := make(map[string]string, len(tables))
+	for _, table := range tables {
+		tx, err := db.Begin()
+		if err != nil {
+			t.Fatal(err)
+		}
+		cols, err := tableColumns(tx, table)
+		tx.Rollback()
+		if err != nil {
+			t.Fatal(err)
+		}
+		var names []string
+		for name := range cols {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		result[table] = strings.Join(names, ",")
+	}
+	return result
+}
+
+func TestMigrateFromBaselineSchema(t *testing.T) {
+	fixture, err := os.ReadFile(filepath.Join("testdata", "baseline_schema.sql"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := openTestSQLite(t)
+	if _, err := s.write.Exec(string(fixture)); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := s.Migrate()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != len(sqliteMigrations) {
+		t.Errorf("applied %d migrations, want %d", n, len(sqliteMigrations))
+	}
+	statuses, err := s.MigrationStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, st := range statuses {
+		if st.AppliedAt == nil {
+			t.Errorf("migration %d (%s) not applied", st.Version, st.Name)
+		}
+	}
+
+	// 升级后的表结构与新建的库一致
+	fresh := openTestSQLite(t)
+	if _, err := fresh.Migrate(); err != nil {
+		t.Fatal(err)
+	}
+	want := tableColumnNames(t, fresh.write)
+	for table, cols := range tableColumnNames(t, s.write) {
+		if cols != want[table] {
+			t.Errorf("table %s columns = %s, want %s", table, cols, want[table])
+		}
+		delete(want, table)
+	}
+	for table := range want {
+		t.Errorf("table %s missing after upgrade", table)
+	}
+
+	// 旧数据保留，能由 storage_key 推导的 url 被清空
+	legacy, err := s.GetPicture("img_legacy")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if legacy.URL != "" || legacy.Version != 1 || !legacy.RevisedAt.Equal(legacy.UploadDate) || legacy.Width != 640 || legacy.PHash != "ffff0000ffff0000" {
+		t.Errorf("img_legacy = %+v", legacy)
+	}
+	external, err := s.GetPicture("img_external")
+	if err != nil || external.URL != "https://elsewhere.example.com/original.jpg" {
+		t.Errorf("img_external = %+v, %v", external, err)
+	}
+	if _, err := s.GetPicture("img_deleted"); err != sql.ErrNoRows {
+		t.Errorf("deleted picture err = %v, want sql.ErrNoRows", err)
+	}
+	pics, total, err := s.SearchExact([]string{"sky"}, PictureFilter{}, 1, 10, nil)
+	if err != nil || total != 2 || len(pics) != 2 {
+		t.Errorf("SearchExact(sky) = %d, %v", total, err)
+	}
+	items, err := s.ListAlbumItems("alb_legacy")
+	if err != nil || len(items) != 2 || items[0].ID != "img_legacy" {
+		t.Errorf("album items = %+v, %v", items, err)
+	}
+	share, err := s.GetShareLink("legacy-token")
+	if err != nil || !share.Revoked || share.ViewCount != 3 {
+		t.Errorf("share = %+v, %v", share, err)
+	}
+
+	// 新的列和表可以正常使用
+	if err := s.CreatePicture(&Picture{ID: "img_new", StorageKey: "img_new.png", Hash: "hash-new", SourceURL: "https://example.com/a.png"}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := s.CreateIdempotencyKey(&IdempotencyKey{Key: "k", Fingerprint: "fp"}); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestMigrateRerunIsNoop(t *testing.T) {
+	s := openTestSQLite(t)
+	if n, err := s.Migrate(); err != nil || n != len(sqliteMigrations) {
+		t.Fatalf("first Migrate = %d, %v", n, err)
+	}
+	before := schemaSnapshot(t, s.write)
+	statuses, err := s.MigrationStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < 2; i++ {
+		if n, err := s.Migrate(); err != nil || n != 0 {
+			t.Fatalf("re-run Migrate = %d, %v; want 0", n, err)
+		}
+	}
+	if after := schemaSnapshot(t, s.write); after != before {
+		t.Errorf("schema changed on re-run:\n%s\nwant\n%s", after, before)
+	}
+	again, err := s.MigrationStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i := range again {
+		if !again[i].AppliedAt.Equal(*statuses[i].AppliedAt) {
+			t.Errorf("migration %d re-applied", again[i].Version)
+		}
+	}
+}
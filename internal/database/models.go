@@ -7,12 +7,22 @@ import (
 
 type Picture struct {
 	ID          string    `json:"id"`
-	URL         string    `json:"url"`
+	URL         string    `json:"url"` // 为空时由 storage_key 推导，非空表示显式保存的绝对地址
 	StorageKey  string    `json:"storage_key"`
 	Hash        string    `json:"hash"`
 	Description string    `json:"description"`
 	UploadDate  time.Time `json:"upload_date"`
 	Deleted     bool      `json:"deleted"`
+	PHash       string    `json:"phash,omitempty"` // 感知哈希（十六进制），为空表示无法计算
+	Width       int       `json:"width,omitempty"`
+	Height      int       `json:"height,omitempty"`
+	MIMEType    string    `json:"mime_type,omitempty"`
+	SourceURL   string    `json:"source_url,omitempty"` // 通过 URL 上传时的原始地址
+	Version     int       `json:"version"`              // 当前文件版本，从 1 开始，每次替换文件加 1
+	RevisedAt   time.Time `json:"revised_at"`           // 当前版本的上传时间（未替换过时等于 upload_date）
+
+	// PHashDeferred 创建时 phash 写入 NULL，由启动时的元数据补算任务计算（图片太大，上传时不解码）
+	PHashDeferred bool `json:"-"`
 }
 
 type Tag struct {
@@ -30,8 +40,8 @@ type PictureWithTags struct {
 // CreatePicture 创建新图片记录
 func CreatePicture(db *sql.DB, pic *Picture) error {
 	_, err := db.Exec(
-		"INSERT INTO pictures (id, url, storage_key, hash, description) VALUES (?, ?, ?, ?, ?)",
-		pic.ID, pic.URL, pic.StorageKey, pic.Hash, pic.Description,
+		"INSERT INTO pictures (id, url, storage_key, hash, description, phash, width, height, mime_type, source_url) VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)",
+		pic.ID, pic.URL, pic.StorageKey, pic.Hash, pic.Description, phashValue(pic), nullIfZero(pic.Width), nullIfZero(pic.Height), pic.MIMEType, pic.SourceURL,
 	)
 	return err
 }
@@ -39,43 +49,95 @@ func CreatePicture(db *sql.DB, pic *Picture) error {
 // GetPicture 获取图片详情
 func GetPicture(db *sql.DB, id string) (*Picture, error) {
 	var pic Picture
+	var revisedAt sql.NullTime
 	err := db.QueryRow(
-		"SELECT id, url, storage_key, hash, description, upload_date, deleted FROM pictures WHERE id = ? AND deleted = 0",
+		`SELECT id, url, storage_key, hash, description, upload_date, deleted, COALESCE(phash, ''),
+			COALESCE(width, 0), COALESCE(height, 0), COALESCE(mime_type, ''), COALESCE(source_url, ''),
+			version, revised_at
+		FROM pictures WHERE id = ? AND deleted = 0`,
 		id,
-	).Scan(&pic.ID, &pic.URL, &pic.StorageKey, &pic.Hash, &pic.Description, &pic.UploadDate, &pic.Deleted)
+	).Scan(&pic.ID, &pic.URL, &pic.StorageKey, &pic.Hash, &pic.Description, &pic.UploadDate, &pic.Deleted, &pic.PHash,
+		&pic.Width, &pic.Height, &pic.MIMEType, &pic.SourceURL, &pic.Version, &revisedAt)
 
+	if err != nil {
+		return nil, err
+	}
+	// 从未替换过文件时 revised_at 为空，当前版本即上传时的版本
+	pic.RevisedAt = pic.UploadDate
+	if revisedAt.Valid {
+		pic.RevisedAt = revisedAt.Time
+	}
+	return &pic, nil
+}
+
+// GetPictureByHash 按内容 SHA-256 查找未删除的图片（导入时去重）
+func GetPictureByHash(db *sql.DB, hash string) (*Picture, error) {
+	var pic Picture
+	err := db.QueryRow(
+		"SELECT id, url, storage_key, hash FROM pictures WHERE hash = ? AND deleted = 0 ORDER BY upload_date LIMIT 1",
+		hash,
+	).Scan(&pic.ID, &pic.URL, &pic.StorageKey, &pic.Hash)
 	if err != nil {
 		return nil, err
 	}
 	return &pic, nil
 }
 
+// pictureColumns 列表查询使用的图片字段（别名 p），与 scanPictureWithTags 对应
+const pictureColumns = `p.id, p.url, p.storage_key, p.hash, p.description, p.upload_date,
+	COALESCE(p.width, 0), COALESCE(p.height, 0), COALESCE(p.mime_type, '')`
+
+// scanPictureWithTags 扫描 pictureColumns 对应的字段，extra 为追加在其后的字段
+func scanPictureWithTags(rows *sql.Rows, pic *PictureWithTags, extra ...interface{}) error {
+	dest := []interface{}{
+		&pic.ID, &pic.URL, &pic.StorageKey, &pic.Hash, &pic.Description, &pic.UploadDate,
+		&pic.Width, &pic.Height, &pic.MIMEType,
+	}
+	return rows.Scan(append(dest, extra...)...)
+}
+
 // ListPictures 列出所有图片（分页）
-func ListPictures(db *sql.DB, page, limit int, sort string) ([]PictureWithTags, int, error) {
-	// 确定排序方式
-	orderBy := "p.upload_date DESC" // 默认最新优先
-	if sort == "date_asc" {
-		orderBy = "p.upload_date ASC"
+// cursor 非空时使用游标分页（按 upload_date、id 定位），忽略 page
+func ListPictures(db *sql.DB, filter PictureFilter, page, limit int, sort string, cursor *Cursor) ([]PictureWithTags, int, error) {
+	if _, ok := sortOrders[sort]; !ok {
+		sort = "date_desc"
 	}
+	filterSQL, filterArgs := filter.where()
 
 	// 获取总数
 	var total int
-	err := db.QueryRow("SELECT COUNT(*) FROM pictures WHERE deleted = 0").Scan(&total)
+	err := db.QueryRow("SELECT COUNT(*) FROM pictures p WHERE p.deleted = 0"+filterSQL, filterArgs...).Scan(&total)
 	if err != nil {
 		return nil, 0, err
 	}
 
 	// 获取图片列表
 	offset := (page - 1) * limit
+	cursorSQL := ""
+	args := append([]interface{}{}, filterArgs...)
+	if cursor != nil {
+		if cursor.Sort != sort {
+			return nil, 0, ErrInvalidCursor
+		}
+		if sort == "date_asc" {
+			cursorSQL = " AND (p.upload_date, p.id) > (?, ?)"
+		} else {
+			cursorSQL = " AND (p.upload_date, p.id) < (?, ?)"
+		}
+		args = append(args, cursor.dbTime(), cursor.ID)
+		offset = 0
+	}
+
 	query := `
-		SELECT p.id, p.url, p.storage_key, p.hash, p.description, p.upload_date
+		SELECT ` + pictureColumns + `
 		FROM pictures p
-		WHERE p.deleted = 0
-		ORDER BY ` + orderBy + `
+		WHERE p.deleted = 0` + filterSQL + cursorSQL + `
+		ORDER BY ` + orderByClause(sort) + `
 		LIMIT ? OFFSET ?
 	`
 
-	rows, err := db.Query(query, limit, offset)
+	args = append(args, limit, offset)
+	rows, err := db.Query(query, args...)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -84,27 +146,45 @@ func ListPictures(db *sql.DB, page, limit int, sort string) ([]PictureWithTags,
 	var results []PictureWithTags
 	for rows.Next() {
 		var pic PictureWithTags
-		if err := rows.Scan(&pic.ID, &pic.URL, &pic.StorageKey, &pic.Hash, &pic.Description, &pic.UploadDate); err != nil {
-			return nil, 0, err
-		}
-
-		// 获取标签
-		tags, err := GetPictureTags(db, pic.ID)
-		if err != nil {
+		if err := scanPictureWithTags(rows, &pic); err != nil {
 			return nil, 0, err
 		}
-		pic.Tags = tags
-
 		results = append(results, pic)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	rows.Close()
+
+	// 批量获取标签
+	if err := attachTags(db, results); err != nil {
+		return nil, 0, err
+	}
 
 	return results, total, nil
 }
 
-// DeletePicture 软删除图片
+// DeletePicture 软删除图片，同时将其移出所有相册
 func DeletePicture(db *sql.DB, id string) error {
-	_, err := db.Exec("UPDATE pictures SET deleted = 1 WHERE id = ?", id)
-	return err
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if _, err := tx.Exec("UPDATE pictures SET deleted = 1 WHERE id = ?", id); err != nil {
+		return err
+	}
+
+	// 软删除不会触发外键级联，需要手动维护相册
+	if _, err := tx.Exec("DELETE FROM album_items WHERE picture_id = ?", id); err != nil {
+		return err
+	}
+	if _, err := tx.Exec("UPDATE albums SET cover_picture_id = NULL WHERE cover_picture_id = ?", id); err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 // UpdatePictureDescription 更新图片描述
@@ -119,13 +199,8 @@ func GetOrCreateTag(db *sql.DB, tagName string) (int, error) {
 	err := db.QueryRow("SELECT id FROM tags WHERE tag_name = ?", tagName).Scan(&tagID)
 
 	if err == sql.ErrNoRows {
-		// 标签不存在，创建新标签
-		result, err := db.Exec("INSERT INTO tags (tag_name) VALUES (?)", tagName)
-		if err != nil {
-			return 0, err
-		}
-		id, err := result.LastInsertId()
-		return int(id), err
+		// 标签不存在，创建新标签（RETURNING 在 SQLite 和 PostgreSQL 中都可用）
+		err = db.QueryRow("INSERT INTO tags (tag_name) VALUES (?) RETURNING id", tagName).Scan(&tagID)
 	}
 
 	return tagID, err
@@ -197,12 +272,7 @@ func getOrCreateTagTx(tx *sql.Tx, tagName string) (int, error) {
 	err := tx.QueryRow("SELECT id FROM tags WHERE tag_name = ?", tagName).Scan(&tagID)
 
 	if err == sql.ErrNoRows {
-		result, err := tx.Exec("INSERT INTO tags (tag_name) VALUES (?)", tagName)
-		if err != nil {
-			return 0, err
-		}
-		id, err := result.LastInsertId()
-		return int(id), err
+		err = tx.QueryRow("INSERT INTO tags (tag_name) VALUES (?) RETURNING id", tagName).Scan(&tagID)
 	}
 
 	return tagID, err
@@ -232,8 +302,46 @@ func GetPictureTags(db *sql.DB, pictureID string) ([]string, error) {
 	return tags, nil
 }
 
+// attachTags 用一次查询获取一页图片的标签，避免逐行查询（N+1）
+// 必须在结果集关闭之后调用，避免在 SQLite 上持有读游标时再发起查询
+func attachTags(db *sql.DB, pics []PictureWithTags) error {
+	if len(pics) == 0 {
+		return nil
+	}
+
+	index := make(map[string]int, len(pics))
+	args := make([]interface{}, 0, len(pics))
+	for i, pic := range pics {
+		index[pic.ID] = i
+		args = append(args, pic.ID)
+	}
+
+	rows, err := db.Query(`
+		SELECT pt.picture_id, t.tag_name
+		FROM picture_tags pt
+		JOIN tags t ON t.id = pt.tag_id
+		WHERE pt.picture_id IN (`+placeholders(len(pics))+`)
+	`, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var pictureID, tag string
+		if err := rows.Scan(&pictureID, &tag); err != nil {
+			return err
+		}
+		if i, ok := index[pictureID]; ok {
+			pics[i].Tags = append(pics[i].Tags, tag)
+		}
+	}
+	return rows.Err()
+}
+
 // ListTags 列出所有标签（分页）
-func ListTags(db *sql.DB, page, limit int) ([]Tag, int, error) {
+// cursor 非空时使用游标分页（按使用次数、标签 ID 定位），忽略 page
+func ListTags(db *sql.DB, page, limit int, cursor *Cursor) ([]Tag, int, error) {
 	// 获取总数（只统计有图片关联的标签）
 	var total int
 	err := db.QueryRow(`
@@ -249,16 +357,28 @@ func ListTags(db *sql.DB, page, limit int) ([]Tag, int, error) {
 
 	// 获取标签列表，按使用次数降序排列
 	offset := (page - 1) * limit
+	havingSQL := ""
+	var args []interface{}
+	if cursor != nil {
+		if !cursor.IsTagCursor() {
+			return nil, 0, ErrInvalidCursor
+		}
+		havingSQL = " HAVING COUNT(pt.picture_id) < ? OR (COUNT(pt.picture_id) = ? AND t.id > ?)"
+		args = append(args, cursor.Count, cursor.Count, cursor.TagID)
+		offset = 0
+	}
+	args = append(args, limit, offset)
+
 	rows, err := db.Query(`
 		SELECT t.id, t.tag_name, COUNT(pt.picture_id) as count
 		FROM tags t
 		JOIN picture_tags pt ON t.id = pt.tag_id
 		JOIN pictures p ON pt.picture_id = p.id
 		WHERE p.deleted = 0
-		GROUP BY t.id, t.tag_name
-		ORDER BY count DESC
+		GROUP BY t.id, t.tag_name`+havingSQL+`
+		ORDER BY count DESC, t.id ASC
 		LIMIT ? OFFSET ?
-	`, limit, offset)
+	`, args...)
 	if err != nil {
 		return nil, 0, err
 	}
@@ -272,20 +392,24 @@ func ListTags(db *sql.DB, page, limit int) ([]Tag, int, error) {
 		}
 		tags = append(tags, tag)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
 
 	return tags, total, nil
 }
 
 // SearchExact 精确搜索（AND 逻辑）
-func SearchExact(db *sql.DB, tagNames []string, page, limit int) ([]PictureWithTags, int, error) {
+// cursor 非空时使用游标分页（按 upload_date、id 定位），忽略 page
+func SearchExact(db *sql.DB, tagNames []string, filter PictureFilter, page, limit int, cursor *Cursor) ([]PictureWithTags, int, error) {
 	if len(tagNames) == 0 {
 		return []PictureWithTags{}, 0, nil
 	}
 
-	// 构建查询
-	query := `
-		SELECT p.id, p.url, p.storage_key, p.hash, p.description, p.upload_date
-		FROM pictures p
+	filterSQL, filterArgs := filter.where()
+
+	// 包含所有指定标签，且满足过滤条件
+	where := `
 		WHERE p.deleted = 0 AND p.id IN (
 			SELECT pt.picture_id
 			FROM picture_tags pt
@@ -293,18 +417,36 @@ func SearchExact(db *sql.DB, tagNames []string, page, limit int) ([]PictureWithT
 			WHERE t.tag_name IN (` + placeholders(len(tagNames)) + `)
 			GROUP BY pt.picture_id
 			HAVING COUNT(DISTINCT t.id) = ?
-		)
-		ORDER BY p.upload_date DESC
-		LIMIT ? OFFSET ?
-	`
+		)` + filterSQL
 
-	args := make([]interface{}, 0, len(tagNames)+3)
+	whereArgs := make([]interface{}, 0, len(tagNames)+1+len(filterArgs))
 	for _, tag := range tagNames {
-		args = append(args, tag)
+		whereArgs = append(whereArgs, tag)
+	}
+	whereArgs = append(whereArgs, len(tagNames))
+	whereArgs = append(whereArgs, filterArgs...)
+
+	offset := (page - 1) * limit
+	cursorSQL := ""
+	args := append([]interface{}{}, whereArgs...)
+	if cursor != nil {
+		if cursor.Sort != "date_desc" {
+			return nil, 0, ErrInvalidCursor
+		}
+		cursorSQL = " AND (p.upload_date, p.id) < (?, ?)"
+		args = append(args, cursor.dbTime(), cursor.ID)
+		offset = 0
 	}
-	args = append(args, len(tagNames))
-	args = append(args, limit)
-	args = append(args, (page-1)*limit)
+
+	// 构建查询
+	query := `
+		SELECT ` + pictureColumns + `
+		FROM pictures p` + where + cursorSQL + `
+		ORDER BY p.upload_date DESC, p.id DESC
+		LIMIT ? OFFSET ?
+	`
+
+	args = append(args, limit, offset)
 
 	rows, err := db.Query(query, args...)
 	if err != nil {
@@ -315,39 +457,25 @@ func SearchExact(db *sql.DB, tagNames []string, page, limit int) ([]PictureWithT
 	var results []PictureWithTags
 	for rows.Next() {
 		var pic PictureWithTags
-		if err := rows.Scan(&pic.ID, &pic.URL, &pic.StorageKey, &pic.Hash, &pic.Description, &pic.UploadDate); err != nil {
-			return nil, 0, err
-		}
-
-		// 获取标签
-		tags, err := GetPictureTags(db, pic.ID)
-		if err != nil {
+		if err := scanPictureWithTags(rows, &pic); err != nil {
 			return nil, 0, err
 		}
-		pic.Tags = tags
-
 		results = append(results, pic)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	rows.Close()
 
-	// 获取总数
-	countQuery := `
-		SELECT COUNT(DISTINCT p.id)
-		FROM pictures p
-		JOIN picture_tags pt ON p.id = pt.picture_id
-		JOIN tags t ON pt.tag_id = t.id
-		WHERE p.deleted = 0 AND t.tag_name IN (` + placeholders(len(tagNames)) + `)
-		GROUP BY p.id
-		HAVING COUNT(DISTINCT t.id) = ?
-	`
-	countArgs := make([]interface{}, 0, len(tagNames)+1)
-	for _, tag := range tagNames {
-		countArgs = append(countArgs, tag)
+	// 批量获取标签
+	if err := attachTags(db, results); err != nil {
+		return nil, 0, err
 	}
-	countArgs = append(countArgs, len(tagNames))
 
+	// 获取总数
 	var total int
-	err = db.QueryRow(countQuery, countArgs...).Scan(&total)
-	if err != nil && err != sql.ErrNoRows {
+	err = db.QueryRow("SELECT COUNT(*) FROM pictures p"+where, whereArgs...).Scan(&total)
+	if err != nil {
 		return nil, 0, err
 	}
 
@@ -355,28 +483,47 @@ func SearchExact(db *sql.DB, tagNames []string, page, limit int) ([]PictureWithT
 }
 
 // SearchRelevance 相关性搜索（OR 逻辑，按匹配数排序）
-func SearchRelevance(db *sql.DB, tagNames []string, page, limit int) ([]PictureWithTags, int, error) {
+// cursor 非空时使用游标分页（按匹配数、upload_date、id 定位），忽略 page
+func SearchRelevance(db *sql.DB, tagNames []string, filter PictureFilter, page, limit int, cursor *Cursor) ([]PictureWithTags, int, error) {
 	if len(tagNames) == 0 {
 		return []PictureWithTags{}, 0, nil
 	}
 
-	query := `
-		SELECT p.id, p.url, p.storage_key, p.hash, p.description, p.upload_date, COUNT(DISTINCT pt.tag_id) as matched_count
+	filterSQL, filterArgs := filter.where()
+
+	// 包含任一指定标签，且满足过滤条件
+	from := `
 		FROM pictures p
 		JOIN picture_tags pt ON p.id = pt.picture_id
 		JOIN tags t ON pt.tag_id = t.id
-		WHERE p.deleted = 0 AND t.tag_name IN (` + placeholders(len(tagNames)) + `)
-		GROUP BY p.id
-		ORDER BY matched_count DESC, p.upload_date DESC
-		LIMIT ? OFFSET ?
-	`
+		WHERE p.deleted = 0 AND t.tag_name IN (` + placeholders(len(tagNames)) + `)` + filterSQL
 
-	args := make([]interface{}, 0, len(tagNames)+2)
+	fromArgs := make([]interface{}, 0, len(tagNames)+len(filterArgs))
 	for _, tag := range tagNames {
-		args = append(args, tag)
+		fromArgs = append(fromArgs, tag)
+	}
+	fromArgs = append(fromArgs, filterArgs...)
+
+	offset := (page - 1) * limit
+	havingSQL := ""
+	args := append([]interface{}{}, fromArgs...)
+	if cursor != nil {
+		if cursor.Sort != "relevance" {
+			return nil, 0, ErrInvalidCursor
+		}
+		havingSQL = " HAVING (COUNT(DISTINCT pt.tag_id), p.upload_date, p.id) < (?, ?, ?)"
+		args = append(args, cursor.Matched, cursor.dbTime(), cursor.ID)
+		offset = 0
 	}
-	args = append(args, limit)
-	args = append(args, (page-1)*limit)
+
+	query := `
+		SELECT ` + pictureColumns + `, COUNT(DISTINCT pt.tag_id) as matched_count` + from + `
+		GROUP BY p.id` + havingSQL + `
+		ORDER BY matched_count DESC, p.upload_date DESC, p.id DESC
+		LIMIT ? OFFSET ?
+	`
+
+	args = append(args, limit, offset)
 
 	rows, err := db.Query(query, args...)
 	if err != nil {
@@ -387,42 +534,89 @@ func SearchRelevance(db *sql.DB, tagNames []string, page, limit int) ([]PictureW
 	var results []PictureWithTags
 	for rows.Next() {
 		var pic PictureWithTags
-		if err := rows.Scan(&pic.ID, &pic.URL, &pic.StorageKey, &pic.Hash, &pic.Description, &pic.UploadDate, &pic.MatchedTagCount); err != nil {
+		if err := scanPictureWithTags(rows, &pic, &pic.MatchedTagCount); err != nil {
 			return nil, 0, err
 		}
-
-		// 获取标签
-		tags, err := GetPictureTags(db, pic.ID)
-		if err != nil {
-			return nil, 0, err
-		}
-		pic.Tags = tags
-
 		results = append(results, pic)
 	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	rows.Close()
 
-	// 获取总数
-	countQuery := `
-		SELECT COUNT(DISTINCT p.id)
-		FROM pictures p
-		JOIN picture_tags pt ON p.id = pt.picture_id
-		JOIN tags t ON pt.tag_id = t.id
-		WHERE p.deleted = 0 AND t.tag_name IN (` + placeholders(len(tagNames)) + `)
-	`
-	countArgs := make([]interface{}, 0, len(tagNames))
-	for _, tag := range tagNames {
-		countArgs = append(countArgs, tag)
+	// 批量获取标签
+	if err := attachTags(db, results); err != nil {
+		return nil, 0, err
 	}
 
+	// 获取总数
 	var total int
-	err = db.QueryRow(countQuery, countArgs...).Scan(&total)
-	if err != nil && err != sql.ErrNoRows {
+	err = db.QueryRow("SELECT COUNT(DISTINCT p.id)"+from, fromArgs...).Scan(&total)
+	if err != nil {
 		return nil, 0, err
 	}
 
 	return results, total, nil
 }
 
+// ListStoredPictures 列出所有未删除的图片（备份和存储迁移时遍历对象使用）
+func ListStoredPictures(db *sql.DB) ([]Picture, error) {
+	rows, err := db.Query(`
+		SELECT id, url, storage_key, hash, COALESCE(mime_type, '')
+		FROM pictures
+		WHERE deleted = 0 AND storage_key != ''
+		ORDER BY upload_date, id
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pics []Picture
+	for rows.Next() {
+		var pic Picture
+		if err := rows.Scan(&pic.ID, &pic.URL, &pic.StorageKey, &pic.Hash, &pic.MIMEType); err != nil {
+			return nil, err
+		}
+		pics = append(pics, pic)
+	}
+	return pics, rows.Err()
+}
+
+// UpdatePictureStorage 更新图片的存储位置，url 为空表示由 storage_key 推导
+func UpdatePictureStorage(db *sql.DB, id, storageKey, url string) error {
+	_, err := db.Exec("UPDATE pictures SET storage_key = ?, url = ? WHERE id = ?", storageKey, url, id)
+	return err
+}
+
+// RewriteURLPrefix 将显式保存的图片 URL 中的前缀 from 替换为 to，返回修改的记录数
+func RewriteURLPrefix(db *sql.DB, from, to string) (int64, error) {
+	result, err := db.Exec(
+		"UPDATE pictures SET url = CAST(? AS TEXT) || substr(url, length(CAST(? AS TEXT)) + 1) WHERE substr(url, 1, length(CAST(? AS TEXT))) = ?",
+		to, from, from, from,
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// phashValue 感知哈希留待补算时写入 NULL（空字符串表示已尝试但无法计算，不会再补算）
+func phashValue(pic *Picture) interface{} {
+	if pic.PHashDeferred {
+		return nil
+	}
+	return pic.PHash
+}
+
+// nullIfZero 把 0 转换为 NULL（用于未知的数值字段）
+func nullIfZero(v int) interface{} {
+	if v == 0 {
+		return nil
+	}
+	return v
+}
+
 func placeholders(n int) string {
 	if n == 0 {
 		return ""
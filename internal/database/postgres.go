@@ -0,0 +1,331 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/lib/pq"
+	"github.com/vaaandark/PixelHub/internal/config"
+)
+
+// postgresDriverName 包装了 lib/pq 的驱动：把 ? 占位符改写为 $n，使 SQL 与 SQLite 共用
+const postgresDriverName = "pixelhub-postgres"
+
+// defaultPostgresMaxOpenConns PostgreSQL 连接池默认大小
+const defaultPostgresMaxOpenConns = 10
+
+func init() {
+	sql.Register(postgresDriverName, &rebindDriver{pq.Driver{}})
+}
+
+// openPostgres 打开 PostgreSQL 连接池
+func openPostgres(cfg *config.DatabaseConfig) (*sql.DB, error) {
+	if cfg.DSN == "" {
+		return nil, errors.New("database dsn is required for postgres driver")
+	}
+
+	db, err := sql.Open(postgresDriverName, cfg.DSN)
+	if err != nil {
+		return nil, err
+	}
+	maxOpenConns := cfg.MaxOpenConns
+	if maxOpenConns <= 0 {
+		maxOpenConns = defaultPostgresMaxOpenConns
+	}
+	db.SetMaxOpenConns(maxOpenConns)
+
+	if err := db.Ping(); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to connect to postgres: %w", err)
+	}
+	return db, nil
+}
+
+// postgresMigrationLock 多个实例同时启动时串行执行迁移
+const postgresMigrationLock = "LOCK TABLE schema_migrations IN EXCLUSIVE MODE"
+
+// postgresMigrations PostgreSQL 的所有迁移，按版本号排列
+// 时间字段精确到秒（TIMESTAMP(0)），与 SQLite 的 CURRENT_TIMESTAMP 和游标中的时间格式一致
+var postgresMigrations = []migration{
+	{1, "baseline", execSQL(`
+		CREATE TABLE IF NOT EXISTS pictures (
+			id TEXT PRIMARY KEY,
+			url TEXT NOT NULL DEFAULT '',
+			storage_key TEXT NOT NULL,
+			hash TEXT NOT NULL,
+			description TEXT,
+			upload_date TIMESTAMP(0) DEFAULT CURRENT_TIMESTAMP,
+			deleted INTEGER DEFAULT 0,
+			phash TEXT,
+			width INTEGER,
+			height INTEGER,
+			mime_type TEXT
+		);
+
+		CREATE TABLE IF NOT EXISTS tags (
+			id SERIAL PRIMARY KEY,
+			tag_name TEXT UNIQUE NOT NULL
+		);
+
+		CREATE TABLE IF NOT EXISTS picture_tags (
+			picture_id TEXT NOT NULL REFERENCES pictures(id) ON DELETE CASCADE,
+			tag_id INTEGER NOT NULL REFERENCES tags(id) ON DELETE CASCADE,
+			PRIMARY KEY (picture_id, tag_id)
+		);
+
+		CREATE TABLE IF NOT EXISTS albums (
+			id TEXT PRIMARY KEY,
+			name TEXT NOT NULL,
+			description TEXT,
+			cover_picture_id TEXT REFERENCES pictures(id) ON DELETE SET NULL,
+			created_at TIMESTAMP(0) DEFAULT CURRENT_TIMESTAMP,
+			updated_at TIMESTAMP(0) DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE TABLE IF NOT EXISTS album_items (
+			album_id TEXT NOT NULL REFERENCES albums(id) ON DELETE CASCADE,
+			picture_id TEXT NOT NULL REFERENCES pictures(id) ON DELETE CASCADE,
+			position INTEGER NOT NULL,
+			added_at TIMESTAMP(0) DEFAULT CURRENT_TIMESTAMP,
+			PRIMARY KEY (album_id, picture_id)
+		);
+
+		CREATE TABLE IF NOT EXISTS share_links (
+			token TEXT PRIMARY KEY,
+			target_type TEXT NOT NULL,
+			target_id TEXT NOT NULL,
+			password_hash TEXT,
+			expires_at TIMESTAMP(0) NOT NULL,
+			view_count INTEGER DEFAULT 0,
+			revoked INTEGER DEFAULT 0,
+			created_at TIMESTAMP(0) DEFAULT CURRENT_TIMESTAMP
+		);
+
+		CREATE INDEX IF NOT EXISTS idx_picture_tags_picture ON picture_tags(picture_id);
+		CREATE INDEX IF NOT EXISTS idx_picture_tags_tag ON picture_tags(tag_id);
+		CREATE INDEX IF NOT EXISTS idx_tags_name ON tags(tag_name);
+		CREATE INDEX IF NOT EXISTS idx_pictures_upload_date ON pictures(upload_date);
+		CREATE INDEX IF NOT EXISTS idx_album_items_position ON album_items(album_id, position);
+		CREATE INDEX IF NOT EXISTS idx_album_items_picture ON album_items(picture_id);
+	`)},
+	// search_vector 由触发器维护：描述变化时在 pictures 上更新，标签增删时由 picture_tags 回写
+	{2, "picture_search", execSQL(`
+		ALTER TABLE pictures ADD COLUMN IF NOT EXISTS search_vector tsvector;
+		CREATE INDEX IF NOT EXISTS idx_pictures_search_vector ON pictures USING GIN (search_vector);
+		CREATE OR REPLACE FUNCTION picture_search_vector(pid TEXT, descr TEXT) RETURNS tsvector AS $$
+			SELECT to_tsvector('simple', COALESCE(descr, '') || ' ' || COALESCE((
+				SELECT string_agg(t.tag_name, ' ')
+				FROM picture_tags pt JOIN tags t ON pt.tag_id = t.id
+				WHERE pt.picture_id = pid
+			), ''));
+		$$ LANGUAGE sql STABLE;
+		CREATE OR REPLACE FUNCTION pictures_search_vector_update() RETURNS trigger AS $$
+		BEGIN
+			NEW.search_vector := picture_search_vector(NEW.id, NEW.description);
+			RETURN NEW;
+		END;
+		$$ LANGUAGE plpgsql;
+		DROP TRIGGER IF EXISTS pictures_search_vector ON pictures;
+		CREATE TRIGGER pictures_search_vector BEFORE INSERT OR UPDATE OF description ON pictures
+			FOR EACH ROW EXECUTE FUNCTION pictures_search_vector_update();
+		CREATE OR REPLACE FUNCTION picture_tags_search_vector_update() RETURNS trigger AS $$
+		DECLARE
+			pid TEXT;
+		BEGIN
+			IF TG_OP = 'DELETE' THEN
+				pid := OLD.picture_id;
+			ELSE
+				pid := NEW.picture_id;
+			END IF;
+			UPDATE pictures SET search_vector = picture_search_vector(id, description) WHERE id = pid;
+			RETURN NULL;
+		END;
+		$$ LANGUAGE plpgsql;
+		DROP TRIGGER IF EXISTS picture_tags_search_vector ON picture_tags;
+		CREATE TRIGGER picture_tags_search_vector AFTER INSERT OR DELETE ON picture_tags
+			FOR EACH ROW EXECUTE FUNCTION picture_tags_search_vector_update();
+		UPDATE pictures SET search_vector = picture_search_vector(id, description);
+	`)},
+	{3, "pictures_hash_index", execSQL(`
+		CREATE INDEX IF NOT EXISTS idx_pictures_hash ON pictures(hash);
+	`)},
+	{4, "picture_source_url", execSQL(`
+		ALTER TABLE pictures ADD COLUMN IF NOT EXISTS source_url TEXT;
+	`)},
+	{5, "idempotency_keys", execSQL(`
+		CREATE TABLE IF NOT EXISTS idempotency_keys (
+			idempotency_key TEXT PRIMARY KEY,
+			fingerprint TEXT NOT NULL,
+			status_code INTEGER NOT NULL DEFAULT 0,
+			content_type TEXT NOT NULL DEFAULT '',
+			response_body BYTEA,
+			created_at TIMESTAMP(0) NOT NULL,
+			expires_at TIMESTAMP(0) NOT NULL
+		);
+		CREATE INDEX IF NOT EXISTS idx_idempotency_keys_expires_at ON idempotency_keys(expires_at);
+	`)},
+	{6, "picture_versions", execSQL(`
+		ALTER TABLE pictures ADD COLUMN IF NOT EXISTS version INTEGER NOT NULL DEFAULT 1;
+		ALTER TABLE pictures ADD COLUMN IF NOT EXISTS revised_at TIMESTAMP(0);
+		CREATE TABLE IF NOT EXISTS picture_versions (
+			picture_id TEXT NOT NULL REFERENCES pictures(id) ON DELETE CASCADE,
+			version INTEGER NOT NULL,
+			storage_key TEXT NOT NULL,
+			hash TEXT NOT NULL,
+			phash TEXT,
+			width INTEGER,
+			height INTEGER,
+			mime_type TEXT,
+			created_at TIMESTAMP(0) NOT NULL,
+			archived_at TIMESTAMP(0) NOT NULL,
+			PRIMARY KEY (picture_id, version)
+		);
+	`)},
+	{7, "audit_log", execSQL(`
+		CREATE TABLE IF NOT EXISTS audit_log (
+			id BIGSERIAL PRIMARY KEY,
+			created_at TIMESTAMP(0) NOT NULL,
+			actor TEXT NOT NULL,
+			action TEXT NOT NULL,
+			target_type TEXT NOT NULL,
+			target_id TEXT NOT NULL,
+			before_json TEXT,
+			after_json TEXT,
+			client_ip TEXT NOT NULL DEFAULT ''
+		);
+		CREATE INDEX IF NOT EXISTS idx_audit_log_created_at ON audit_log(created_at);
+		CREATE INDEX IF NOT EXISTS idx_audit_log_target ON audit_log(target_type, target_id);
+		CREATE OR REPLACE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+		BEGIN
+			RAISE EXCEPTION 'audit_log is append-only';
+		END;
+		$$ LANGUAGE plpgsql;
+		DROP TRIGGER IF EXISTS audit_log_append_only ON audit_log;
+		CREATE TRIGGER audit_log_append_only BEFORE UPDATE ON audit_log
+			FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+	`)},
+	{8, "webhooks", execSQL(`
+		CREATE TABLE IF NOT EXISTS webhooks (
+			id TEXT PRIMARY KEY,
+			url TEXT NOT NULL,
+			secret TEXT NOT NULL,
+			events TEXT NOT NULL,
+			description TEXT NOT NULL DEFAULT '',
+			active INTEGER NOT NULL DEFAULT 1,
+			created_at TIMESTAMP(0) NOT NULL,
+			updated_at TIMESTAMP(0) NOT NULL
+		);
+		CREATE TABLE IF NOT EXISTS webhook_deliveries (
+			id BIGSERIAL PRIMARY KEY,
+			webhook_id TEXT NOT NULL REFERENCES webhooks(id) ON DELETE CASCADE,
+			event_id TEXT NOT NULL,
+			event_type TEXT NOT NULL,
+			payload TEXT NOT NULL,
+			status TEXT NOT NULL,
+			attempts INTEGER NOT NULL DEFAULT 0,
+			next_attempt_at TIMESTAMP(0) NOT NULL,
+			last_status_code INTEGER NOT NULL DEFAULT 0,
+			last_error TEXT NOT NULL DEFAULT '',
+			created_at TIMESTAMP(0) NOT NULL,
+			finished_at TIMESTAMP(0)
+		);
+		CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_due ON webhook_deliveries(status, next_attempt_at);
+		CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook ON webhook_deliveries(webhook_id, id);
+	`)},
+}
+
+// rebind 把 ? 占位符依次改写为 $1, $2, ...（跳过单引号字符串中的问号）
+func rebind(query string) string {
+	if !strings.Contains(query, "?") {
+		return query
+	}
+
+	var b strings.Builder
+	b.Grow(len(query) + 8)
+	n := 0
+	inString := false
+	for _, r := range query {
+		switch {
+		case r == '\'':
+			inString = !inString
+			b.WriteRune(r)
+		case r == '?' && !inString:
+			n++
+			b.WriteByte('$')
+			b.WriteString(strconv.Itoa(n))
+		default:
+			b.WriteRune(r)
+		}
+	}
+	return b.String()
+}
+
+// rebindDriver 在 lib/pq 驱动外层改写占位符
+type rebindDriver struct {
+	driver.Driver
+}
+
+func (d *rebindDriver) Open(name string) (driver.Conn, error) {
+	conn, err := d.Driver.Open(name)
+	if err != nil {
+		return nil, err
+	}
+
+	// 时间统一按 UTC 存储，与 SQLite 的 CURRENT_TIMESTAMP 一致
+	if execer, ok := conn.(driver.ExecerContext); ok {
+		if _, err := execer.ExecContext(context.Background(), "SET TIME ZONE 'UTC'", nil); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	return &rebindConn{conn}, nil
+}
+
+// rebindConn 改写经过连接的所有 SQL 的占位符
+type rebindConn struct {
+	driver.Conn
+}
+
+func (c *rebindConn) Prepare(query string) (driver.Stmt, error) {
+	return c.Conn.Prepare(rebind(query))
+}
+
+func (c *rebindConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	if p, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		return p.PrepareContext(ctx, rebind(query))
+	}
+	return c.Conn.Prepare(rebind(query))
+}
+
+func (c *rebindConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	if q, ok := c.Conn.(driver.QueryerContext); ok {
+		return q.QueryContext(ctx, rebind(query), args)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c *rebindConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	if e, ok := c.Conn.(driver.ExecerContext); ok {
+		return e.ExecContext(ctx, rebind(query), args)
+	}
+	return nil, driver.ErrSkip
+}
+
+func (c *rebindConn) BeginTx(ctx context.Context, opts driver.TxOptions) (driver.Tx, error) {
+	if b, ok := c.Conn.(driver.ConnBeginTx); ok {
+		return b.BeginTx(ctx, opts)
+	}
+	return c.Conn.Begin()
+}
+
+func (c *rebindConn) Ping(ctx context.Context) error {
+	if p, ok := c.Conn.(driver.Pinger); ok {
+		return p.Ping(ctx)
+	}
+	return nil
+}
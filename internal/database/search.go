@@ -0,0 +1,115 @@
+package database
+
+import (
+	"database/sql"
+	"strings"
+)
+
+// maxSearchTerms 文本搜索最多使用的词数，超出部分忽略
+const maxSearchTerms = 10
+
+// searchTerms 按空白拆分查询并转为小写，去掉重复的词
+func searchTerms(query string) []string {
+	seen := make(map[string]bool)
+	var terms []string
+	for _, term := range strings.Fields(strings.ToLower(query)) {
+		if seen[term] {
+			continue
+		}
+		seen[term] = true
+		terms = append(terms, term)
+		if len(terms) == maxSearchTerms {
+			break
+		}
+	}
+	return terms
+}
+
+// likeEscaper 转义 LIKE 中的通配符（配合 ESCAPE '\'）
+var likeEscaper = strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`)
+
+// SearchText 在描述和标签名中搜索文本（SQLite）
+// 每个词都需要作为子串出现在描述或任一标签名中（不区分大小写），结果按上传时间降序
+func SearchText(db *sql.DB, query string, filter PictureFilter, page, limit int) ([]PictureWithTags, int, error) {
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return []PictureWithTags{}, 0, nil
+	}
+
+	filterSQL, filterArgs := filter.where()
+
+	var conds []string
+	var whereArgs []interface{}
+	for _, term := range terms {
+		pattern := "%" + likeEscaper.Replace(term) + "%"
+		conds = append(conds, `(LOWER(COALESCE(p.description, '')) LIKE ? ESCAPE '\'
+			OR EXISTS (
+				SELECT 1 FROM picture_tags pts
+				JOIN tags ts ON pts.tag_id = ts.id
+				WHERE pts.picture_id = p.id AND LOWER(ts.tag_name) LIKE ? ESCAPE '\'
+			))`)
+		whereArgs = append(whereArgs, pattern, pattern)
+	}
+	where := " WHERE p.deleted = 0 AND " + strings.Join(conds, " AND ") + filterSQL
+	whereArgs = append(whereArgs, filterArgs...)
+
+	return querySearchText(db, where, whereArgs, "p.upload_date DESC, p.id DESC", nil, page, limit)
+}
+
+// searchTextPostgres 使用 search_vector 全文索引搜索文本（PostgreSQL）
+// 按词匹配（'simple' 配置，不做词干提取和中文分词），结果按 ts_rank 降序
+func searchTextPostgres(db *sql.DB, query string, filter PictureFilter, page, limit int) ([]PictureWithTags, int, error) {
+	terms := searchTerms(query)
+	if len(terms) == 0 {
+		return []PictureWithTags{}, 0, nil
+	}
+	q := strings.Join(terms, " ")
+
+	filterSQL, filterArgs := filter.where()
+	where := " WHERE p.deleted = 0 AND p.search_vector @@ plainto_tsquery('simple', ?)" + filterSQL
+	whereArgs := append([]interface{}{q}, filterArgs...)
+
+	order := "ts_rank(p.search_vector, plainto_tsquery('simple', ?)) DESC, p.upload_date DESC, p.id DESC"
+	return querySearchText(db, where, whereArgs, order, []interface{}{q}, page, limit)
+}
+
+// querySearchText 执行文本搜索的分页查询和计数，orderArgs 为排序子句中的参数
+func querySearchText(db *sql.DB, where string, whereArgs []interface{}, order string, orderArgs []interface{}, page, limit int) ([]PictureWithTags, int, error) {
+	args := append([]interface{}{}, whereArgs...)
+	args = append(args, orderArgs...)
+	args = append(args, limit, (page-1)*limit)
+
+	rows, err := db.Query(`
+		SELECT `+pictureColumns+`
+		FROM pictures p`+where+`
+		ORDER BY `+order+`
+		LIMIT ? OFFSET ?
+	`, args...)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	results := []PictureWithTags{}
+	for rows.Next() {
+		var pic PictureWithTags
+		if err := scanPictureWithTags(rows, &pic); err != nil {
+			return nil, 0, err
+		}
+		results = append(results, pic)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, 0, err
+	}
+	rows.Close()
+
+	if err := attachTags(db, results); err != nil {
+		return nil, 0, err
+	}
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM pictures p"+where, whereArgs...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+	return results, total, nil
+}
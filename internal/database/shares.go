@@ -0,0 +1,106 @@
+package database
+
+import (
+	"database/sql"
+	"time"
+)
+
+// 分享目标类型
+const (
+	ShareTargetImage = "image"
+	ShareTargetAlbum = "album"
+	ShareTargetTags  = "tags" // target_id 为逗号分隔的标签（AND 逻辑）
+)
+
+// ShareLink 公开分享链接
+type ShareLink struct {
+	Token        string    `json:"token"`
+	TargetType   string    `json:"target_type"`
+	TargetID     string    `json:"target_id"`
+	PasswordHash string    `json:"-"`
+	HasPassword  bool      `json:"has_password"`
+	ExpiresAt    time.Time `json:"expires_at"`
+	ViewCount    int       `json:"view_count"`
+	Revoked      bool      `json:"revoked"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+// Expired 分享链接是否已过期
+func (s *ShareLink) Expired(now time.Time) bool {
+	return !now.Before(s.ExpiresAt)
+}
+
+const shareColumns = `token, target_type, target_id, COALESCE(password_hash, ''), expires_at, view_count, revoked, created_at`
+
+func scanShareLink(row rowScanner, s *ShareLink) error {
+	if err := row.Scan(&s.Token, &s.TargetType, &s.TargetID, &s.PasswordHash, &s.ExpiresAt, &s.ViewCount, &s.Revoked, &s.CreatedAt); err != nil {
+		return err
+	}
+	s.HasPassword = s.PasswordHash != ""
+	return nil
+}
+
+// CreateShareLink 创建分享链接
+func CreateShareLink(db *sql.DB, s *ShareLink) error {
+	var passwordHash interface{}
+	if s.PasswordHash != "" {
+		passwordHash = s.PasswordHash
+	}
+	_, err := db.Exec(
+		"INSERT INTO share_links (token, target_type, target_id, password_hash, expires_at) VALUES (?, ?, ?, ?, ?)",
+		s.Token, s.TargetType, s.TargetID, passwordHash, s.ExpiresAt.UTC().Format(dbTimeFormat),
+	)
+	return err
+}
+
+// GetShareLink 获取分享链接（包括已撤销和已过期的）
+func GetShareLink(db *sql.DB, token string) (*ShareLink, error) {
+	var s ShareLink
+	row := db.QueryRow("SELECT "+shareColumns+" FROM share_links WHERE token = ?", token)
+	if err := scanShareLink(row, &s); err != nil {
+		return nil, err
+	}
+	return &s, nil
+}
+
+// ListShareLinks 列出分享链接（分页，最新创建优先）
+func ListShareLinks(db *sql.DB, page, limit int) ([]ShareLink, int, error) {
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM share_links").Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * limit
+	rows, err := db.Query(`
+		SELECT `+shareColumns+`
+		FROM share_links
+		ORDER BY created_at DESC, token
+		LIMIT ? OFFSET ?
+	`, limit, offset)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	links := []ShareLink{}
+	for rows.Next() {
+		var s ShareLink
+		if err := scanShareLink(rows, &s); err != nil {
+			return nil, 0, err
+		}
+		links = append(links, s)
+	}
+	return links, total, rows.Err()
+}
+
+// RevokeShareLink 撤销分享链接
+func RevokeShareLink(db *sql.DB, token string) error {
+	_, err := db.Exec("UPDATE share_links SET revoked = 1 WHERE token = ?", token)
+	return err
+}
+
+// IncrementShareViews 分享页面访问计数加一
+func IncrementShareViews(db *sql.DB, token string) error {
+	_, err := db.Exec("UPDATE share_links SET view_count = view_count + 1 WHERE token = ?", token)
+	return err
+}
@@ -0,0 +1,110 @@
+package database
+
+import (
+	"database/sql"
+)
+
+// PictureHash 图片 ID 与感知哈希
+type PictureHash struct {
+	ID    string
+	PHash string
+}
+
+// ListPictureHashes 列出所有已计算感知哈希的图片
+func ListPictureHashes(db *sql.DB) ([]PictureHash, error) {
+	rows, err := db.Query(`
+		SELECT id, phash
+		FROM pictures
+		WHERE deleted = 0 AND phash IS NOT NULL AND phash != ''
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var hashes []PictureHash
+	for rows.Next() {
+		var h PictureHash
+		if err := rows.Scan(&h.ID, &h.PHash); err != nil {
+			return nil, err
+		}
+		hashes = append(hashes, h)
+	}
+	return hashes, rows.Err()
+}
+
+// ListPicturesMissingMetadata 列出尚未提取元数据的图片（phash 或 mime_type 为 NULL）
+// phash 为空字符串表示已尝试但格式不支持，不会再次返回
+func ListPicturesMissingMetadata(db *sql.DB) ([]Picture, error) {
+	rows, err := db.Query(`
+		SELECT id, url, storage_key, hash, description, upload_date
+		FROM pictures
+		WHERE deleted = 0 AND (phash IS NULL OR mime_type IS NULL)
+		ORDER BY upload_date
+	`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var pics []Picture
+	for rows.Next() {
+		var pic Picture
+		if err := rows.Scan(&pic.ID, &pic.URL, &pic.StorageKey, &pic.Hash, &pic.Description, &pic.UploadDate); err != nil {
+			return nil, err
+		}
+		pics = append(pics, pic)
+	}
+	return pics, rows.Err()
+}
+
+// UpdatePictureMetadata 更新图片的感知哈希、尺寸和 MIME 类型
+func UpdatePictureMetadata(db *sql.DB, pic *Picture) error {
+	_, err := db.Exec(
+		"UPDATE pictures SET phash = ?, width = ?, height = ?, mime_type = ? WHERE id = ?",
+		pic.PHash, nullIfZero(pic.Width), nullIfZero(pic.Height), pic.MIMEType, pic.ID,
+	)
+	return err
+}
+
+// GetPicturesByIDs 批量获取图片及其标签（不保证顺序，不存在或已删除的 ID 会被忽略）
+func GetPicturesByIDs(db *sql.DB, ids []string) ([]PictureWithTags, error) {
+	if len(ids) == 0 {
+		return []PictureWithTags{}, nil
+	}
+
+	args := make([]interface{}, 0, len(ids))
+	for _, id := range ids {
+		args = append(args, id)
+	}
+
+	rows, err := db.Query(`
+		SELECT `+pictureColumns+`
+		FROM pictures p
+		WHERE p.deleted = 0 AND p.id IN (`+placeholders(len(ids))+`)
+	`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []PictureWithTags
+	for rows.Next() {
+		var pic PictureWithTags
+		if err := scanPictureWithTags(rows, &pic); err != nil {
+			return nil, err
+		}
+		results = append(results, pic)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	rows.Close()
+
+	// 批量获取标签
+	if err := attachTags(db, results); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
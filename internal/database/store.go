@@ -0,0 +1,388 @@
+package database
+
+import (
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/vaaandark/PixelHub/internal/config"
+)
+
+// PictureStore 图片及其历史版本
+type PictureStore interface {
+	CreatePicture(pic *Picture) error
+	GetPicture(id string) (*Picture, error)
+	GetPicturesByIDs(ids []string) ([]PictureWithTags, error)
+	GetPictureByHash(hash string) (*Picture, error)
+	ListPictures(filter PictureFilter, page, limit int, sort string, cursor *Cursor) ([]PictureWithTags, int, error)
+	DeletePicture(id string) error
+	UpdatePictureDescription(id string, description string) error
+	UpdatePictureMetadata(pic *Picture) error
+	ListPictureHashes() ([]PictureHash, error)
+	ListPicturesMissingMetadata() ([]Picture, error)
+	RewriteURLPrefix(from, to string) (int64, error)
+	ListStoredPictures() ([]Picture, error)
+	UpdatePictureStorage(id, storageKey, url string) error
+
+	ListPictureVersions(pictureID string) ([]PictureVersion, error)
+	GetPictureVersion(pictureID string, version int) (*PictureVersion, error)
+	ReplacePictureFile(archived *PictureVersion, next *Picture) error
+	ListStoredVersions() ([]PictureVersion, error)
+	UpdatePictureVersionStorage(pictureID string, version int, storageKey string) error
+}
+
+// TagStore 标签和按标签搜索
+type TagStore interface {
+	GetPictureTags(pictureID string) ([]string, error)
+	SetPictureTags(pictureID string, tagNames []string) error
+	AppendPictureTags(pictureID string, tagNames []string) error
+	ListTags(page, limit int, cursor *Cursor) ([]Tag, int, error)
+	SearchExact(tagNames []string, filter PictureFilter, page, limit int, cursor *Cursor) ([]PictureWithTags, int, error)
+	SearchRelevance(tagNames []string, filter PictureFilter, page, limit int, cursor *Cursor) ([]PictureWithTags, int, error)
+	SearchText(query string, filter PictureFilter, page, limit int) ([]PictureWithTags, int, error)
+}
+
+// AlbumStore 相册
+type AlbumStore interface {
+	CreateAlbum(album *Album) error
+	GetAlbum(id string) (*Album, error)
+	ListAlbums(page, limit int) ([]Album, int, error)
+	UpdateAlbum(album *Album) error
+	DeleteAlbum(id string) error
+	ListAlbumItems(albumID string) ([]AlbumItem, error)
+	AddAlbumItems(albumID string, pictureIDs []string, position int) ([]string, error)
+	RemoveAlbumItems(albumID string, pictureIDs []string) (int, error)
+	ReorderAlbumItems(albumID string, pictureIDs []string) error
+}
+
+// ShareStore 分享链接
+type ShareStore interface {
+	CreateShareLink(s *ShareLink) error
+	GetShareLink(token string) (*ShareLink, error)
+	ListShareLinks(page, limit int) ([]ShareLink, int, error)
+	RevokeShareLink(token string) error
+	IncrementShareViews(token string) error
+}
+
+// IdempotencyStore 幂等键
+type IdempotencyStore interface {
+	CreateIdempotencyKey(k *IdempotencyKey) (bool, error)
+	GetIdempotencyKey(key string) (*IdempotencyKey, error)
+	CompleteIdempotencyKey(key string, statusCode int, contentType string, body []byte) error
+	DeleteIdempotencyKey(key string) error
+	DeleteExpiredIdempotencyKeys(now time.Time) (int64, error)
+}
+
+// AuditStore 审计日志
+type AuditStore interface {
+	CreateAuditEntry(e *AuditEntry) error
+	ListAuditEntries(filter AuditFilter, page, limit int) ([]AuditEntry, int, error)
+	DeleteAuditEntriesBefore(cutoff time.Time) (int64, error)
+}
+
+// WebhookStore Webhook 订阅和投递队列
+type WebhookStore interface {
+	CreateWebhook(w *Webhook) error
+	GetWebhook(id string) (*Webhook, error)
+	ListWebhooks(activeOnly bool) ([]Webhook, error)
+	UpdateWebhook(w *Webhook) error
+	DeleteWebhook(id string) error
+	CreateWebhookDeliveries(deliveries []WebhookDelivery) error
+	ClaimWebhookDeliveries(now time.Time, lease time.Duration, limit int) ([]WebhookDelivery, error)
+	UpdateWebhookDelivery(d *WebhookDelivery) error
+	GetWebhookDelivery(webhookID string, id int64) (*WebhookDelivery, error)
+	ListWebhookDeliveries(webhookID, status string, page, limit int) ([]WebhookDelivery, int, error)
+	RetryWebhookDelivery(webhookID string, id int64, now time.Time) error
+	DeleteFinishedWebhookDeliveries(cutoff time.Time) (int64, error)
+}
+
+// Store 数据访问接口，由各部分的接口组成；处理器测试可以使用 internal/fakes 中的内存实现
+// SQLite 和 PostgreSQL 共用同一套 SQL（占位符统一写作 ?），区别只在连接方式和迁移
+type Store interface {
+	PictureStore
+	TagStore
+	AlbumStore
+	ShareStore
+	IdempotencyStore
+	AuditStore
+	WebhookStore
+
+	// 表结构迁移
+	Migrate() (int, error)
+	MigrationStatus() ([]MigrationStatus, error)
+
+	// Backup 将数据库在线备份到 destPath（仅 SQLite）
+	Backup(destPath string) error
+
+	Close() error
+}
+
+// InitDB 根据配置打开数据库并执行所有未应用的迁移
+func InitDB(cfg *config.DatabaseConfig) (Store, error) {
+	store, err := OpenStore(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	// 升级表结构
+	if _, err := store.Migrate(); err != nil {
+		store.Close()
+		return nil, err
+	}
+
+	return store, nil
+}
+
+// OpenStore 根据 [database].driver 打开数据库（不执行迁移）
+func OpenStore(cfg *config.DatabaseConfig) (Store, error) {
+	switch cfg.Driver {
+	case "", "sqlite":
+		db, err := OpenDB(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return &sqlStore{write: db.Write, read: db.Read, migrations: sqliteMigrations, backup: backupSQLite, searchText: SearchText}, nil
+	case "postgres":
+		db, err := openPostgres(cfg)
+		if err != nil {
+			return nil, err
+		}
+		return &sqlStore{write: db, read: db, migrations: postgresMigrations, migrationLock: postgresMigrationLock, searchText: searchTextPostgres}, nil
+	default:
+		return nil, fmt.Errorf("unsupported database driver: %s", cfg.Driver)
+	}
+}
+
+// sqlStore 基于 database/sql 的 Store 实现
+// 读操作使用 read 连接池，写操作使用 write 连接池（PostgreSQL 两者相同）
+type sqlStore struct {
+	write         *sql.DB
+	read          *sql.DB
+	migrations    []migration
+	migrationLock string
+	backup        func(src *sql.DB, destPath string) error // nil 表示不支持在线备份
+	searchText    func(db *sql.DB, query string, filter PictureFilter, page, limit int) ([]PictureWithTags, int, error)
+}
+
+func (s *sqlStore) CreatePicture(pic *Picture) error { return CreatePicture(s.write, pic) }
+
+func (s *sqlStore) GetPicture(id string) (*Picture, error) { return GetPicture(s.read, id) }
+
+func (s *sqlStore) GetPictureByHash(hash string) (*Picture, error) {
+	return GetPictureByHash(s.read, hash)
+}
+
+func (s *sqlStore) GetPicturesByIDs(ids []string) ([]PictureWithTags, error) {
+	return GetPicturesByIDs(s.read, ids)
+}
+
+func (s *sqlStore) ListPictures(filter PictureFilter, page, limit int, sort string, cursor *Cursor) ([]PictureWithTags, int, error) {
+	return ListPictures(s.read, filter, page, limit, sort, cursor)
+}
+
+func (s *sqlStore) DeletePicture(id string) error { return DeletePicture(s.write, id) }
+
+func (s *sqlStore) UpdatePictureDescription(id string, description string) error {
+	return UpdatePictureDescription(s.write, id, description)
+}
+
+func (s *sqlStore) UpdatePictureMetadata(pic *Picture) error {
+	return UpdatePictureMetadata(s.write, pic)
+}
+
+func (s *sqlStore) ListPictureHashes() ([]PictureHash, error) { return ListPictureHashes(s.read) }
+
+func (s *sqlStore) ListPicturesMissingMetadata() ([]Picture, error) {
+	return ListPicturesMissingMetadata(s.read)
+}
+
+func (s *sqlStore) RewriteURLPrefix(from, to string) (int64, error) {
+	return RewriteURLPrefix(s.write, from, to)
+}
+
+func (s *sqlStore) ListStoredPictures() ([]Picture, error) { return ListStoredPictures(s.read) }
+
+func (s *sqlStore) UpdatePictureStorage(id, storageKey, url string) error {
+	return UpdatePictureStorage(s.write, id, storageKey, url)
+}
+
+func (s *sqlStore) ListPictureVersions(pictureID string) ([]PictureVersion, error) {
+	return ListPictureVersions(s.read, pictureID)
+}
+
+func (s *sqlStore) GetPictureVersion(pictureID string, version int) (*PictureVersion, error) {
+	return GetPictureVersion(s.read, pictureID, version)
+}
+
+func (s *sqlStore) ReplacePictureFile(archived *PictureVersion, next *Picture) error {
+	return ReplacePictureFile(s.write, archived, next)
+}
+
+func (s *sqlStore) ListStoredVersions() ([]PictureVersion, error) { return ListStoredVersions(s.read) }
+
+func (s *sqlStore) UpdatePictureVersionStorage(pictureID string, version int, storageKey string) error {
+	return UpdatePictureVersionStorage(s.write, pictureID, version, storageKey)
+}
+
+func (s *sqlStore) GetPictureTags(pictureID string) ([]string, error) {
+	return GetPictureTags(s.read, pictureID)
+}
+
+func (s *sqlStore) SetPictureTags(pictureID string, tagNames []string) error {
+	return SetPictureTags(s.write, pictureID, tagNames)
+}
+
+func (s *sqlStore) AppendPictureTags(pictureID string, tagNames []string) error {
+	return AppendPictureTags(s.write, pictureID, tagNames)
+}
+
+func (s *sqlStore) ListTags(page, limit int, cursor *Cursor) ([]Tag, int, error) {
+	return ListTags(s.read, page, limit, cursor)
+}
+
+func (s *sqlStore) SearchExact(tagNames []string, filter PictureFilter, page, limit int, cursor *Cursor) ([]PictureWithTags, int, error) {
+	return SearchExact(s.read, tagNames, filter, page, limit, cursor)
+}
+
+func (s *sqlStore) SearchRelevance(tagNames []string, filter PictureFilter, page, limit int, cursor *Cursor) ([]PictureWithTags, int, error) {
+	return SearchRelevance(s.read, tagNames, filter, page, limit, cursor)
+}
+
+func (s *sqlStore) SearchText(query string, filter PictureFilter, page, limit int) ([]PictureWithTags, int, error) {
+	return s.searchText(s.read, query, filter, page, limit)
+}
+
+func (s *sqlStore) CreateAlbum(album *Album) error { return CreateAlbum(s.write, album) }
+
+func (s *sqlStore) GetAlbum(id string) (*Album, error) { return GetAlbum(s.read, id) }
+
+func (s *sqlStore) ListAlbums(page, limit int) ([]Album, int, error) {
+	return ListAlbums(s.read, page, limit)
+}
+
+func (s *sqlStore) UpdateAlbum(album *Album) error { return UpdateAlbum(s.write, album) }
+
+func (s *sqlStore) DeleteAlbum(id string) error { return DeleteAlbum(s.write, id) }
+
+func (s *sqlStore) ListAlbumItems(albumID string) ([]AlbumItem, error) {
+	return ListAlbumItems(s.read, albumID)
+}
+
+func (s *sqlStore) AddAlbumItems(albumID string, pictureIDs []string, position int) ([]string, error) {
+	return AddAlbumItems(s.write, albumID, pictureIDs, position)
+}
+
+func (s *sqlStore) RemoveAlbumItems(albumID string, pictureIDs []string) (int, error) {
+	return RemoveAlbumItems(s.write, albumID, pictureIDs)
+}
+
+func (s *sqlStore) ReorderAlbumItems(albumID string, pictureIDs []string) error {
+	return ReorderAlbumItems(s.write, albumID, pictureIDs)
+}
+
+func (s *sqlStore) CreateShareLink(link *ShareLink) error { return CreateShareLink(s.write, link) }
+
+func (s *sqlStore) GetShareLink(token string) (*ShareLink, error) { return GetShareLink(s.read, token) }
+
+func (s *sqlStore) ListShareLinks(page, limit int) ([]ShareLink, int, error) {
+	return ListShareLinks(s.read, page, limit)
+}
+
+func (s *sqlStore) RevokeShareLink(token string) error { return RevokeShareLink(s.write, token) }
+
+func (s *sqlStore) IncrementShareViews(token string) error {
+	return IncrementShareViews(s.write, token)
+}
+
+func (s *sqlStore) CreateIdempotencyKey(k *IdempotencyKey) (bool, error) {
+	return CreateIdempotencyKey(s.write, k)
+}
+
+// GetIdempotencyKey 使用写连接读取，紧接着插入冲突之后查询时不会读到旧数据
+func (s *sqlStore) GetIdempotencyKey(key string) (*IdempotencyKey, error) {
+	return GetIdempotencyKey(s.write, key)
+}
+
+func (s *sqlStore) CompleteIdempotencyKey(key string, statusCode int, contentType string, body []byte) error {
+	return CompleteIdempotencyKey(s.write, key, statusCode, contentType, body)
+}
+
+func (s *sqlStore) DeleteIdempotencyKey(key string) error { return DeleteIdempotencyKey(s.write, key) }
+
+func (s *sqlStore) DeleteExpiredIdempotencyKeys(now time.Time) (int64, error) {
+	return DeleteExpiredIdempotencyKeys(s.write, now)
+}
+
+func (s *sqlStore) CreateAuditEntry(e *AuditEntry) error { return CreateAuditEntry(s.write, e) }
+
+func (s *sqlStore) ListAuditEntries(filter AuditFilter, page, limit int) ([]AuditEntry, int, error) {
+	return ListAuditEntries(s.read, filter, page, limit)
+}
+
+func (s *sqlStore) DeleteAuditEntriesBefore(cutoff time.Time) (int64, error) {
+	return DeleteAuditEntriesBefore(s.write, cutoff)
+}
+
+func (s *sqlStore) CreateWebhook(w *Webhook) error { return CreateWebhook(s.write, w) }
+
+func (s *sqlStore) GetWebhook(id string) (*Webhook, error) { return GetWebhook(s.read, id) }
+
+func (s *sqlStore) ListWebhooks(activeOnly bool) ([]Webhook, error) {
+	return ListWebhooks(s.read, activeOnly)
+}
+
+func (s *sqlStore) UpdateWebhook(w *Webhook) error { return UpdateWebhook(s.write, w) }
+
+func (s *sqlStore) DeleteWebhook(id string) error { return DeleteWebhook(s.write, id) }
+
+func (s *sqlStore) CreateWebhookDeliveries(deliveries []WebhookDelivery) error {
+	return CreateWebhookDeliveries(s.write, deliveries)
+}
+
+// ClaimWebhookDeliveries 使用写连接，领取时读到的状态必须是最新的
+func (s *sqlStore) ClaimWebhookDeliveries(now time.Time, lease time.Duration, limit int) ([]WebhookDelivery, error) {
+	return ClaimWebhookDeliveries(s.write, now, lease, limit)
+}
+
+func (s *sqlStore) UpdateWebhookDelivery(d *WebhookDelivery) error {
+	return UpdateWebhookDelivery(s.write, d)
+}
+
+func (s *sqlStore) GetWebhookDelivery(webhookID string, id int64) (*WebhookDelivery, error) {
+	return GetWebhookDelivery(s.read, webhookID, id)
+}
+
+func (s *sqlStore) ListWebhookDeliveries(webhookID, status string, page, limit int) ([]WebhookDelivery, int, error) {
+	return ListWebhookDeliveries(s.read, webhookID, status, page, limit)
+}
+
+func (s *sqlStore) RetryWebhookDelivery(webhookID string, id int64, now time.Time) error {
+	return RetryWebhookDelivery(s.write, webhookID, id, now)
+}
+
+func (s *sqlStore) DeleteFinishedWebhookDeliveries(cutoff time.Time) (int64, error) {
+	return DeleteFinishedWebhookDeliveries(s.write, cutoff)
+}
+
+func (s *sqlStore) Migrate() (int, error) { return migrate(s.write, s.migrations, s.migrationLock) }
+
+func (s *sqlStore) MigrationStatus() ([]MigrationStatus, error) {
+	return migrationStatus(s.write, s.migrations)
+}
+
+func (s *sqlStore) Backup(destPath string) error {
+	if s.backup == nil {
+		return fmt.Errorf("online backup is only supported for SQLite, use pg_dump for PostgreSQL")
+	}
+	return s.backup(s.read, destPath)
+}
+
+func (s *sqlStore) Close() error {
+	if s.read != s.write {
+		if err := s.read.Close(); err != nil {
+			s.write.Close()
+			return err
+		}
+	}
+	return s.write.Close()
+}
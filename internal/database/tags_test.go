@@ -0,0 +1,58 @@
+package database
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// 列表和搜索结果中每张图片的标签与单独查询的结果一致
+func TestResultsCarryTags(t *testing.T) {
+	store := openTestStore(t)
+	tagsByID := map[string][]string{}
+	for i := 0; i < 6; i++ {
+		id := fmt.Sprintf("img_%02d", i)
+		if err := store.CreatePicture(&Picture{ID: id, URL: "u", StorageKey: id + ".png", Hash: id}); err != nil {
+			t.Fatal(err)
+		}
+		var tags []string
+		for j := 0; j < i%3; j++ {
+			tags = append(tags, fmt.Sprintf("tag%d", (i+j)%4))
+		}
+		if i%2 == 0 {
+			tags = append(tags, "even")
+		}
+		if err := store.SetPictureTags(id, tags); err != nil {
+			t.Fatal(err)
+		}
+		stored, err := store.GetPictureTags(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tagsByID[id] = stored
+	}
+
+	check := func(name string, pics []PictureWithTags, err error) {
+		t.Helper()
+		if err != nil {
+			t.Fatalf("%s: %v", name, err)
+		}
+		if len(pics) == 0 {
+			t.Fatalf("%s returned no pictures", name)
+		}
+		for _, pic := range pics {
+			if got, want := strings.Join(pic.Tags, ","), strings.Join(tagsByID[pic.ID], ","); got != want {
+				t.Errorf("%s: %s tags = %q, want %q", name, pic.ID, got, want)
+			}
+		}
+	}
+
+	pics, _, err := store.ListPictures(PictureFilter{}, 1, 10, "date_desc", nil)
+	check("ListPictures", pics, err)
+	pics, _, err = store.SearchExact([]string{"even"}, PictureFilter{}, 1, 10, nil)
+	check("SearchExact", pics, err)
+	pics, _, err = store.SearchRelevance([]string{"even", "tag1"}, PictureFilter{}, 1, 10, nil)
+	check("SearchRelevance", pics, err)
+	pics, err = store.GetPicturesByIDs([]string{"img_01", "img_03", "img_04"})
+	check("GetPicturesByIDs", pics, err)
+}
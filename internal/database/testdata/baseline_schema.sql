@@ -0,0 +1,82 @@
+-- 迁移系统引入之前 createTables 创建的表结构（含当时的补列和索引）以及一些旧数据
+CREATE TABLE IF NOT EXISTS pictures (
+	id TEXT PRIMARY KEY,
+	url TEXT NOT NULL DEFAULT '',
+	storage_key TEXT NOT NULL,
+	hash TEXT NOT NULL,
+	description TEXT,
+	upload_date DATETIME DEFAULT CURRENT_TIMESTAMP,
+	deleted INTEGER DEFAULT 0,
+	phash TEXT,
+	width INTEGER,
+	height INTEGER,
+	mime_type TEXT
+);
+
+CREATE TABLE IF NOT EXISTS tags (
+	id INTEGER PRIMARY KEY AUTOINCREMENT,
+	tag_name TEXT UNIQUE NOT NULL
+);
+
+CREATE TABLE IF NOT EXISTS picture_tags (
+	picture_id TEXT NOT NULL,
+	tag_id INTEGER NOT NULL,
+	PRIMARY KEY (picture_id, tag_id),
+	FOREIGN KEY (picture_id) REFERENCES pictures(id) ON DELETE CASCADE,
+	FOREIGN KEY (tag_id) REFERENCES tags(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS albums (
+	id TEXT PRIMARY KEY,
+	name TEXT NOT NULL,
+	description TEXT,
+	cover_picture_id TEXT,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	updated_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	FOREIGN KEY (cover_picture_id) REFERENCES pictures(id) ON DELETE SET NULL
+);
+
+CREATE TABLE IF NOT EXISTS album_items (
+	album_id TEXT NOT NULL,
+	picture_id TEXT NOT NULL,
+	position INTEGER NOT NULL,
+	added_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+	PRIMARY KEY (album_id, picture_id),
+	FOREIGN KEY (album_id) REFERENCES albums(id) ON DELETE CASCADE,
+	FOREIGN KEY (picture_id) REFERENCES pictures(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS share_links (
+	token TEXT PRIMARY KEY,
+	target_type TEXT NOT NULL,
+	target_id TEXT NOT NULL,
+	password_hash TEXT,
+	expires_at DATETIME NOT NULL,
+	view_count INTEGER DEFAULT 0,
+	revoked INTEGER DEFAULT 0,
+	created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_picture_tags_picture ON picture_tags(picture_id);
+CREATE INDEX IF NOT EXISTS idx_picture_tags_tag ON picture_tags(tag_id);
+CREATE INDEX IF NOT EXISTS idx_tags_name ON tags(tag_name);
+CREATE INDEX IF NOT EXISTS idx_album_items_position ON album_items(album_id, position);
+CREATE INDEX IF NOT EXISTS idx_album_items_picture ON album_items(picture_id);
+CREATE INDEX IF NOT EXISTS idx_pictures_upload_date ON pictures(upload_date);
+
+INSERT INTO pictures (id, url, storage_key, hash, description, upload_date, deleted, phash, width, height, mime_type) VALUES
+	('img_legacy', 'https://cdn.example.com/img_legacy.png', 'img_legacy.png', 'hash-legacy', 'legacy url', '2024-01-01 08:00:00', 0, 'ffff0000ffff0000', 640, 480, 'image/png'),
+	('img_external', 'https://elsewhere.example.com/original.jpg', 'img_external.jpg', 'hash-external', '', '2024-01-02 08:00:00', 0, NULL, NULL, NULL, NULL),
+	('img_deleted', '', 'img_deleted.png', 'hash-deleted', '', '2024-01-03 08:00:00', 1, '', 10, 10, 'image/png');
+
+INSERT INTO tags (id, tag_name) VALUES (1, 'sky'), (2, 'sea');
+INSERT INTO picture_tags (picture_id, tag_id) VALUES ('img_legacy', 1), ('img_legacy', 2), ('img_external', 1);
+
+INSERT INTO albums (id, name, description, cover_picture_id, created_at, updated_at) VALUES
+	('alb_legacy', 'Legacy', '', 'img_external', '2024-01-04 08:00:00', '2024-01-04 08:00:00');
+INSERT INTO album_items (album_id, picture_id, position, added_at) VALUES
+	('alb_legacy', 'img_legacy', 0, '2024-01-04 08:00:00'),
+	('alb_legacy', 'img_external', 1, '2024-01-04 08:00:00');
+
+INSERT INTO share_links (token, target_type, target_id, password_hash, expires_at, view_count, revoked, created_at) VALUES
+	('legacy-token', 'album', 'alb_legacy', NULL, '2030-01-01 00:00:00', 3, 1, '2024-01-05 08:00:00');
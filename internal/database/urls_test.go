@@ -0,0 +1,41 @@
+package database
+
+import "testing"
+
+func TestRewriteURLPrefix(t *testing.T) {
+	store := openTestStore(t)
+	pics := []Picture{
+		{ID: "img_1", URL: "https://old.example.com/a/1", StorageKey: "1.png", Hash: "h1"},
+		{ID: "img_2", URL: "https://old.example.com/b/2", StorageKey: "2.png", Hash: "h2"},
+		{ID: "img_3", URL: "https://other.example.com/https://old.example.com/3", StorageKey: "3.png", Hash: "h3"},
+		{ID: "img_4", StorageKey: "4.png", Hash: "h4"},
+	}
+	for i := range pics {
+		if err := store.CreatePicture(&pics[i]); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	n, err := store.RewriteURLPrefix("https://old.example.com", "https://new.example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != 2 {
+		t.Errorf("rewrote %d URLs, want 2", n)
+	}
+	want := map[string]string{
+		"img_1": "https://new.example.com/a/1",
+		"img_2": "https://new.example.com/b/2",
+		"img_3": "https://other.example.com/https://old.example.com/3",
+		"img_4": "",
+	}
+	for id, url := range want {
+		pic, err := store.GetPicture(id)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if pic.URL != url {
+			t.Errorf("%s url = %q, want %q", id, pic.URL, url)
+		}
+	}
+}
@@ -0,0 +1,134 @@
+package database
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+// ErrVersionConflict 替换文件时图片的当前版本已被其他请求修改
+var ErrVersionConflict = errors.New("picture version changed concurrently")
+
+// PictureVersion 图片被替换前的历史版本，文件以 storage_key 单独保存
+type PictureVersion struct {
+	PictureID  string    `json:"picture_id"`
+	Version    int       `json:"version"`
+	StorageKey string    `json:"storage_key"`
+	Hash       string    `json:"hash"`
+	PHash      string    `json:"phash,omitempty"`
+	Width      int       `json:"width,omitempty"`
+	Height     int       `json:"height,omitempty"`
+	MIMEType   string    `json:"mime_type,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`  // 成为当前版本的时间
+	ArchivedAt time.Time `json:"archived_at"` // 被替换的时间
+}
+
+// ListPictureVersions 列出图片的历史版本（不含当前版本），按版本号从新到旧
+func ListPictureVersions(db *sql.DB, pictureID string) ([]PictureVersion, error) {
+	rows, err := db.Query(
+		`SELECT picture_id, version, storage_key, hash, COALESCE(phash, ''), COALESCE(width, 0), COALESCE(height, 0),
+			COALESCE(mime_type, ''), created_at, archived_at
+		FROM picture_versions WHERE picture_id = ? ORDER BY version DESC`,
+		pictureID,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	versions := []PictureVersion{}
+	for rows.Next() {
+		var v PictureVersion
+		if err := rows.Scan(&v.PictureID, &v.Version, &v.StorageKey, &v.Hash, &v.PHash, &v.Width, &v.Height,
+			&v.MIMEType, &v.CreatedAt, &v.ArchivedAt); err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+// GetPictureVersion 获取图片的某个历史版本
+func GetPictureVersion(db *sql.DB, pictureID string, version int) (*PictureVersion, error) {
+	var v PictureVersion
+	err := db.QueryRow(
+		`SELECT picture_id, version, storage_key, hash, COALESCE(phash, ''), COALESCE(width, 0), COALESCE(height, 0),
+			COALESCE(mime_type, ''), created_at, archived_at
+		FROM picture_versions WHERE picture_id = ? AND version = ?`,
+		pictureID, version,
+	).Scan(&v.PictureID, &v.Version, &v.StorageKey, &v.Hash, &v.PHash, &v.Width, &v.Height,
+		&v.MIMEType, &v.CreatedAt, &v.ArchivedAt)
+	if err != nil {
+		return nil, err
+	}
+	return &v, nil
+}
+
+// ReplacePictureFile 把当前版本记录为历史版本 archived，并将图片的文件信息更新为 next
+// next.Version 必须是 archived.Version + 1；当前版本已不是 archived.Version 时返回 ErrVersionConflict
+func ReplacePictureFile(db *sql.DB, archived *PictureVersion, next *Picture) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(
+		`UPDATE pictures SET storage_key = ?, url = '', hash = ?, phash = ?, width = ?, height = ?, mime_type = ?,
+			version = ?, revised_at = ?
+		WHERE id = ? AND version = ? AND deleted = 0`,
+		next.StorageKey, next.Hash, phashValue(next), nullIfZero(next.Width), nullIfZero(next.Height), next.MIMEType,
+		next.Version, next.RevisedAt.UTC().Format(dbTimeFormat), next.ID, archived.Version,
+	)
+	if err != nil {
+		return err
+	}
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrVersionConflict
+	}
+
+	if _, err := tx.Exec(
+		`INSERT INTO picture_versions (picture_id, version, storage_key, hash, phash, width, height, mime_type, created_at, archived_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?)`,
+		archived.PictureID, archived.Version, archived.StorageKey, archived.Hash, archived.PHash,
+		nullIfZero(archived.Width), nullIfZero(archived.Height), archived.MIMEType,
+		archived.CreatedAt.UTC().Format(dbTimeFormat), archived.ArchivedAt.UTC().Format(dbTimeFormat),
+	); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// ListStoredVersions 列出未删除图片的所有历史版本文件（备份和存储迁移使用），按图片和版本排序
+func ListStoredVersions(db *sql.DB) ([]PictureVersion, error) {
+	rows, err := db.Query(
+		`SELECT v.picture_id, v.version, v.storage_key, v.hash, COALESCE(v.mime_type, '')
+		FROM picture_versions v JOIN pictures p ON p.id = v.picture_id
+		WHERE p.deleted = 0 AND v.storage_key != ''
+		ORDER BY v.picture_id, v.version`,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []PictureVersion
+	for rows.Next() {
+		var v PictureVersion
+		if err := rows.Scan(&v.PictureID, &v.Version, &v.StorageKey, &v.Hash, &v.MIMEType); err != nil {
+			return nil, err
+		}
+		versions = append(versions, v)
+	}
+	return versions, rows.Err()
+}
+
+// UpdatePictureVersionStorage 更新历史版本文件的存储位置
+func UpdatePictureVersionStorage(db *sql.DB, pictureID string, version int, storageKey string) error {
+	_, err := db.Exec("UPDATE picture_versions SET storage_key = ? WHERE picture_id = ? AND version = ?", storageKey, pictureID, version)
+	return err
+}
@@ -0,0 +1,303 @@
+package database
+
+import (
+	"database/sql"
+	"encoding/json"
+	"strings"
+	"time"
+)
+
+// 投递状态
+const (
+	DeliveryPending   = "pending"   // 等待投递或等待重试
+	DeliverySucceeded = "succeeded" // 接收端返回 2xx
+	DeliveryDead      = "dead"      // 重试次数用完（死信队列），可以手动重新投递
+)
+
+// Webhook 事件订阅
+type Webhook struct {
+	ID          string    `json:"id"`
+	URL         string    `json:"url"`
+	Secret      string    `json:"-"`      // 签名密钥，只在创建时返回
+	Events      []string  `json:"events"` // 订阅的事件，支持 * 和以 . 结尾的前缀
+	Description string    `json:"description"`
+	Active      bool      `json:"active"`
+	CreatedAt   time.Time `json:"created_at"`
+	UpdatedAt   time.Time `json:"updated_at"`
+}
+
+// Matches 事件是否在订阅范围内
+func (w *Webhook) Matches(eventType string) bool {
+	return MatchEvent(w.Events, eventType)
+}
+
+// MatchEvent 事件是否匹配任一模式：* 匹配所有事件，以 . 结尾的模式按前缀匹配，其他按名称精确匹配
+func MatchEvent(patterns []string, eventType string) bool {
+	for _, pattern := range patterns {
+		if pattern == "*" || pattern == eventType ||
+			(strings.HasSuffix(pattern, ".") && strings.HasPrefix(eventType, pattern)) {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookDelivery 一次事件投递及其重试状态
+type WebhookDelivery struct {
+	ID             int64           `json:"id"`
+	WebhookID      string          `json:"webhook_id"`
+	EventID        string          `json:"event_id"`
+	EventType      string          `json:"event_type"`
+	Payload        json.RawMessage `json:"payload"`
+	Status         string          `json:"status"`
+	Attempts       int             `json:"attempts"`
+	NextAttemptAt  time.Time       `json:"next_attempt_at"`
+	LastStatusCode int             `json:"last_status_code,omitempty"`
+	LastError      string          `json:"last_error,omitempty"`
+	CreatedAt      time.Time       `json:"created_at"`
+	FinishedAt     *time.Time      `json:"finished_at,omitempty"`
+}
+
+const webhookColumns = `id, url, secret, events, description, active, created_at, updated_at`
+
+func scanWebhook(row rowScanner, w *Webhook) error {
+	var events string
+	if err := row.Scan(&w.ID, &w.URL, &w.Secret, &events, &w.Description, &w.Active, &w.CreatedAt, &w.UpdatedAt); err != nil {
+		return err
+	}
+	w.Events = strings.Split(events, ",")
+	return nil
+}
+
+// CreateWebhook 创建订阅
+func CreateWebhook(db *sql.DB, w *Webhook) error {
+	now := time.Now().UTC().Truncate(time.Second)
+	w.CreatedAt, w.UpdatedAt = now, now
+	_, err := db.Exec(
+		`INSERT INTO webhooks (id, url, secret, events, description, active, created_at, updated_at)
+		VALUES (?, ?, ?, ?, ?, ?, ?, ?)`,
+		w.ID, w.URL, w.Secret, strings.Join(w.Events, ","), w.Description, boolToInt(w.Active),
+		now.Format(dbTimeFormat), now.Format(dbTimeFormat),
+	)
+	return err
+}
+
+// GetWebhook 获取订阅
+func GetWebhook(db *sql.DB, id string) (*Webhook, error) {
+	var w Webhook
+	if err := scanWebhook(db.QueryRow("SELECT "+webhookColumns+" FROM webhooks WHERE id = ?", id), &w); err != nil {
+		return nil, err
+	}
+	return &w, nil
+}
+
+// ListWebhooks 列出所有订阅（最新创建优先），activeOnly 时只返回启用的订阅
+func ListWebhooks(db *sql.DB, activeOnly bool) ([]Webhook, error) {
+	query := "SELECT " + webhookColumns + " FROM webhooks"
+	if activeOnly {
+		query += " WHERE active = 1"
+	}
+	rows, err := db.Query(query + " ORDER BY created_at DESC, id")
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	webhooks := []Webhook{}
+	for rows.Next() {
+		var w Webhook
+		if err := scanWebhook(rows, &w); err != nil {
+			return nil, err
+		}
+		webhooks = append(webhooks, w)
+	}
+	return webhooks, rows.Err()
+}
+
+// UpdateWebhook 更新订阅的地址、密钥、事件、描述和启用状态
+func UpdateWebhook(db *sql.DB, w *Webhook) error {
+	w.UpdatedAt = time.Now().UTC().Truncate(time.Second)
+	_, err := db.Exec(
+		"UPDATE webhooks SET url = ?, secret = ?, events = ?, description = ?, active = ?, updated_at = ? WHERE id = ?",
+		w.URL, w.Secret, strings.Join(w.Events, ","), w.Description, boolToInt(w.Active), w.UpdatedAt.Format(dbTimeFormat), w.ID,
+	)
+	return err
+}
+
+// DeleteWebhook 删除订阅及其投递记录
+func DeleteWebhook(db *sql.DB, id string) error {
+	_, err := db.Exec("DELETE FROM webhooks WHERE id = ?", id)
+	return err
+}
+
+// CreateWebhookDeliveries 添加待投递的事件
+func CreateWebhookDeliveries(db *sql.DB, deliveries []WebhookDelivery) error {
+	tx, err := db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, d := range deliveries {
+		if _, err := tx.Exec(
+			`INSERT INTO webhook_deliveries (webhook_id, event_id, event_type, payload, status, next_attempt_at, created_at)
+			VALUES (?, ?, ?, ?, ?, ?, ?)`,
+			d.WebhookID, d.EventID, d.EventType, string(d.Payload), DeliveryPending,
+			d.NextAttemptAt.UTC().Format(dbTimeFormat), d.CreatedAt.UTC().Format(dbTimeFormat),
+		); err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+const deliveryColumns = `id, webhook_id, event_id, event_type, payload, status, attempts, next_attempt_at,
+	last_status_code, last_error, created_at, finished_at`
+
+func scanWebhookDelivery(row rowScanner, d *WebhookDelivery) error {
+	var payload string
+	var finishedAt sql.NullTime
+	if err := row.Scan(&d.ID, &d.WebhookID, &d.EventID, &d.EventType, &payload, &d.Status, &d.Attempts, &d.NextAttemptAt,
+		&d.LastStatusCode, &d.LastError, &d.CreatedAt, &finishedAt); err != nil {
+		return err
+	}
+	d.Payload = json.RawMessage(payload)
+	if finishedAt.Valid {
+		d.FinishedAt = &finishedAt.Time
+	}
+	return nil
+}
+
+// ClaimWebhookDeliveries 领取最多 limit 个到期的投递，领取后 lease 时间内不会被再次领取
+// 多个实例同时运行时，每个投递只会被一个实例领取
+func ClaimWebhookDeliveries(db *sql.DB, now time.Time, lease time.Duration, limit int) ([]WebhookDelivery, error) {
+	rows, err := db.Query(
+		`SELECT `+deliveryColumns+` FROM webhook_deliveries
+		WHERE status = ? AND next_attempt_at <= ?
+		ORDER BY next_attempt_at, id
+		LIMIT ?`,
+		DeliveryPending, now.UTC().Format(dbTimeFormat), limit,
+	)
+	if err != nil {
+		return nil, err
+	}
+	var due []WebhookDelivery
+	for rows.Next() {
+		var d WebhookDelivery
+		if err := scanWebhookDelivery(rows, &d); err != nil {
+			rows.Close()
+			return nil, err
+		}
+		due = append(due, d)
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	leaseUntil := now.Add(lease).UTC().Format(dbTimeFormat)
+	claimed := due[:0]
+	for _, d := range due {
+		result, err := db.Exec(
+			"UPDATE webhook_deliveries SET next_attempt_at = ? WHERE id = ? AND status = ? AND next_attempt_at = ?",
+			leaseUntil, d.ID, DeliveryPending, d.NextAttemptAt.UTC().Format(dbTimeFormat),
+		)
+		if err != nil {
+			return nil, err
+		}
+		if n, err := result.RowsAffected(); err == nil && n == 1 {
+			claimed = append(claimed, d)
+		}
+	}
+	return claimed, nil
+}
+
+// UpdateWebhookDelivery 保存一次投递尝试的结果
+func UpdateWebhookDelivery(db *sql.DB, d *WebhookDelivery) error {
+	var finishedAt interface{}
+	if d.FinishedAt != nil {
+		finishedAt = d.FinishedAt.UTC().Format(dbTimeFormat)
+	}
+	_, err := db.Exec(
+		`UPDATE webhook_deliveries SET status = ?, attempts = ?, next_attempt_at = ?, last_status_code = ?, last_error = ?,
+			finished_at = ?
+		WHERE id = ?`,
+		d.Status, d.Attempts, d.NextAttemptAt.UTC().Format(dbTimeFormat), d.LastStatusCode, d.LastError, finishedAt, d.ID,
+	)
+	return err
+}
+
+// GetWebhookDelivery 获取订阅的一次投递
+func GetWebhookDelivery(db *sql.DB, webhookID string, id int64) (*WebhookDelivery, error) {
+	var d WebhookDelivery
+	row := db.QueryRow("SELECT "+deliveryColumns+" FROM webhook_deliveries WHERE id = ? AND webhook_id = ?", id, webhookID)
+	if err := scanWebhookDelivery(row, &d); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+// ListWebhookDeliveries 列出订阅的投递记录（最新优先），status 为空时不过滤
+func ListWebhookDeliveries(db *sql.DB, webhookID, status string, page, limit int) ([]WebhookDelivery, int, error) {
+	where := " WHERE webhook_id = ?"
+	args := []interface{}{webhookID}
+	if status != "" {
+		where += " AND status = ?"
+		args = append(args, status)
+	}
+
+	var total int
+	if err := db.QueryRow("SELECT COUNT(*) FROM webhook_deliveries"+where, args...).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	offset := (page - 1) * limit
+	rows, err := db.Query(
+		"SELECT "+deliveryColumns+" FROM webhook_deliveries"+where+" ORDER BY id DESC LIMIT ? OFFSET ?",
+		append(args, limit, offset)...,
+	)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	deliveries := []WebhookDelivery{}
+	for rows.Next() {
+		var d WebhookDelivery
+		if err := scanWebhookDelivery(rows, &d); err != nil {
+			return nil, 0, err
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, total, rows.Err()
+}
+
+// RetryWebhookDelivery 把投递重新放回队列（尝试次数清零），通常用于死信队列中的投递
+func RetryWebhookDelivery(db *sql.DB, webhookID string, id int64, now time.Time) error {
+	_, err := db.Exec(
+		`UPDATE webhook_deliveries SET status = ?, attempts = 0, next_attempt_at = ?, finished_at = NULL
+		WHERE id = ? AND webhook_id = ?`,
+		DeliveryPending, now.UTC().Format(dbTimeFormat), id, webhookID,
+	)
+	return err
+}
+
+// DeleteFinishedWebhookDeliveries 删除 cutoff 之前已结束（成功或进入死信队列）的投递记录
+func DeleteFinishedWebhookDeliveries(db *sql.DB, cutoff time.Time) (int64, error) {
+	result, err := db.Exec(
+		"DELETE FROM webhook_deliveries WHERE status != ? AND finished_at < ?",
+		DeliveryPending, cutoff.UTC().Format(dbTimeFormat),
+	)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// boolToInt 布尔列以 0/1 整数保存，与 SQLite 和 PostgreSQL 的表结构一致
+func boolToInt(b bool) int {
+	if b {
+		return 1
+	}
+	return 0
+}
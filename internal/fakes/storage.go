@@ -0,0 +1,126 @@
+package fakes
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/vaaandark/PixelHub/internal/storage"
+)
+
+// Storage 内存中的 storage.Provider 实现，同时实现 storage.URLSigner
+type Storage struct {
+	mu sync.Mutex
+
+	// BaseURL 访问地址前缀
+	BaseURL string
+	// UploadErr、GetErr、DeleteErr 非 nil 时对应操作返回该错误
+	UploadErr error
+	GetErr    error
+	DeleteErr error
+
+	objects      map[string][]byte
+	contentTypes map[string]string
+	sizes        map[string]int64
+}
+
+var (
+	_ storage.Provider  = (*Storage)(nil)
+	_ storage.URLSigner = (*Storage)(nil)
+)
+
+// NewStorage 创建空的内存存储
+func NewStorage() *Storage {
+	return &Storage{
+		BaseURL:      "https://storage.test/",
+		objects:      make(map[string][]byte),
+		contentTypes: make(map[string]string),
+		sizes:        make(map[string]int64),
+	}
+}
+
+// Upload 保存内容，size 不是 -1 时必须与实际长度一致（真实存储据此设置 Content-Length）
+func (s *Storage) Upload(filename string, content io.Reader, size int64, contentType string) (string, string, error) {
+	data, err := io.ReadAll(content)
+	if err != nil {
+		return "", "", err
+	}
+	if size != -1 && size != int64(len(data)) {
+		return "", "", fmt.Errorf("upload %s: declared size %d, got %d bytes", filename, size, len(data))
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.UploadErr != nil {
+		return "", "", s.UploadErr
+	}
+	s.objects[filename] = data
+	s.contentTypes[filename] = contentType
+	s.sizes[filename] = size
+	return filename, s.BaseURL + filename, nil
+}
+
+func (s *Storage) Get(storageKey string) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.GetErr != nil {
+		return nil, s.GetErr
+	}
+	data, ok := s.objects[storageKey]
+	if !ok {
+		return nil, fmt.Errorf("object %s: %w", storageKey, os.ErrNotExist)
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *Storage) Delete(storageKey string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.DeleteErr != nil {
+		return s.DeleteErr
+	}
+	delete(s.objects, storageKey)
+	delete(s.contentTypes, storageKey)
+	delete(s.sizes, storageKey)
+	return nil
+}
+
+func (s *Storage) GetURL(storageKey string) string {
+	return s.BaseURL + storageKey
+}
+
+// SignedURL 返回带过期时间的地址，不做真正的签名
+func (s *Storage) SignedURL(storageKey string, ttl time.Duration) (string, error) {
+	return fmt.Sprintf("%s%s?expires=%d", s.BaseURL, storageKey, time.Now().Add(ttl).Unix()), nil
+}
+
+// Object 返回保存的文件内容
+func (s *Storage) Object(storageKey string) ([]byte, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	data, ok := s.objects[storageKey]
+	return data, ok
+}
+
+// UploadedSize 返回上传时传入的内容长度
+func (s *Storage) UploadedSize(storageKey string) (int64, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	size, ok := s.sizes[storageKey]
+	return size, ok
+}
+
+// Keys 按字典序返回所有存储 key
+func (s *Storage) Keys() []string {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	keys := make([]string, 0, len(s.objects))
+	for key := range s.objects {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
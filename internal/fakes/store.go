@@ -0,0 +1,1427 @@
+// Package fakes 提供 database.Store、storage.Provider 和 llm.TagGenerator 的内存实现，
+// 处理器测试不需要真实的数据库、对象存储和 LLM 服务
+package fakes
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/vaaandark/PixelHub/internal/database"
+)
+
+// ErrUnsupported 内存实现不支持的操作
+var ErrUnsupported = errors.New("not supported by the in-memory store")
+
+// Store 内存中的 database.Store 实现，语义与 SQL 实现一致（时间精确到秒，不存在时返回 sql.ErrNoRows）
+type Store struct {
+	mu sync.Mutex
+
+	// Now 当前时间，测试可以替换
+	Now func() time.Time
+	// Err 非 nil 时所有方法都返回该错误，用于模拟数据库故障
+	Err error
+
+	pictures    map[string]*database.Picture
+	tagIDs      map[string]int
+	tagNames    map[int]string
+	nextTagID   int
+	pictureTags map[string][]int
+	versions    map[string][]database.PictureVersion
+
+	albums     map[string]*database.Album
+	albumItems map[string]map[string]int // album → picture → position
+
+	shares      map[string]*database.ShareLink
+	idempotency map[string]*database.IdempotencyKey
+
+	audit       []database.AuditEntry
+	nextAuditID int64
+
+	webhooks       map[string]*database.Webhook
+	deliveries     []*database.WebhookDelivery
+	nextDeliveryID int64
+}
+
+var _ database.Store = (*Store)(nil)
+
+// NewStore 创建空的内存数据库
+func NewStore() *Store {
+	return &Store{
+		Now:         time.Now,
+		pictures:    make(map[string]*database.Picture),
+		tagIDs:      make(map[string]int),
+		tagNames:    make(map[int]string),
+		pictureTags: make(map[string][]int),
+		versions:    make(map[string][]database.PictureVersion),
+		albums:      make(map[string]*database.Album),
+		albumItems:  make(map[string]map[string]int),
+		shares:      make(map[string]*database.ShareLink),
+		idempotency: make(map[string]*database.IdempotencyKey),
+		webhooks:    make(map[string]*database.Webhook),
+	}
+}
+
+// now 与数据库中保存的精度一致（UTC，精确到秒）
+func (s *Store) now() time.Time {
+	return s.Now().UTC().Truncate(time.Second)
+}
+
+func dbTime(t time.Time) time.Time {
+	return t.UTC().Truncate(time.Second)
+}
+
+func (s *Store) lock() error {
+	s.mu.Lock()
+	if s.Err != nil {
+		err := s.Err
+		s.mu.Unlock()
+		return err
+	}
+	return nil
+}
+
+// ---- 图片 ----
+
+func (s *Store) CreatePicture(pic *database.Picture) error {
+	if err := s.lock(); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+	if _, ok := s.pictures[pic.ID]; ok {
+		return fmt.Errorf("UNIQUE constraint failed: pictures.id")
+	}
+	stored := *pic
+	stored.UploadDate = s.now()
+	stored.RevisedAt = stored.UploadDate
+	stored.Deleted = false
+	stored.Version = 1
+	s.pictures[pic.ID] = &stored
+	return nil
+}
+
+// livePicture 未删除的图片（调用时持有锁）
+func (s *Store) livePicture(id string) (*database.Picture, bool) {
+	pic, ok := s.pictures[id]
+	if !ok || pic.Deleted {
+		return nil, false
+	}
+	return pic, true
+}
+
+func (s *Store) GetPicture(id string) (*database.Picture, error) {
+	if err := s.lock(); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+	pic, ok := s.livePicture(id)
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	result := *pic
+	return &result, nil
+}
+
+func (s *Store) GetPictureByHash(hash string) (*database.Picture, error) {
+	if err := s.lock(); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+	var found *database.Picture
+	for _, pic := range s.sortedPictures(false) {
+		if pic.Hash == hash {
+			found = pic
+			break
+		}
+	}
+	if found == nil {
+		return nil, sql.ErrNoRows
+	}
+	result := *found
+	return &result, nil
+}
+
+// sortedPictures 未删除的图片，按上传时间和 ID 排序（调用时持有锁）
+func (s *Store) sortedPictures(desc bool) []*database.Picture {
+	pics := make([]*database.Picture, 0, len(s.pictures))
+	for _, pic := range s.pictures {
+		if !pic.Deleted {
+			pics = append(pics, pic)
+		}
+	}
+	sort.Slice(pics, func(i, j int) bool {
+		less := pictureLess(pics[i], pics[j])
+		if desc {
+			return pictureLess(pics[j], pics[i])
+		}
+		return less
+	})
+	return pics
+}
+
+func pictureLess(a, b *database.Picture) bool {
+	if !a.UploadDate.Equal(b.UploadDate) {
+		return a.UploadDate.Before(b.UploadDate)
+	}
+	return a.ID < b.ID
+}
+
+// withTags 图片及其标签（调用时持有锁）
+func (s *Store) withTags(pic *database.Picture) database.PictureWithTags {
+	result := database.PictureWithTags{Picture: *pic}
+	for _, id := range s.pictureTags[pic.ID] {
+		result.Tags = append(result.Tags, s.tagNames[id])
+	}
+	return result
+}
+
+// matches 图片是否满足过滤条件（调用时持有锁）
+func (s *Store) matches(pic *database.Picture, f database.PictureFilter) bool {
+	if f.UploadedAfter != nil && pic.UploadDate.Before(dbTime(*f.UploadedAfter)) {
+		return false
+	}
+	if f.UploadedBefore != nil && !pic.UploadDate.Before(dbTime(*f.UploadedBefore)) {
+		return false
+	}
+	// 未知尺寸在数据库中为 NULL，不满足任何尺寸条件
+	if f.MinWidth > 0 && (pic.Width == 0 || pic.Width < f.MinWidth) {
+		return false
+	}
+	if f.MaxWidth > 0 && (pic.Width == 0 || pic.Width > f.MaxWidth) {
+		return false
+	}
+	if f.MinHeight > 0 && (pic.Height == 0 || pic.Height < f.MinHeight) {
+		return false
+	}
+	if f.MaxHeight > 0 && (pic.Height == 0 || pic.Height > f.MaxHeight) {
+		return false
+	}
+	if len(f.MIMETypes) > 0 && !contains(f.MIMETypes, pic.MIMEType) {
+		return false
+	}
+	tagCount := len(s.pictureTags[pic.ID])
+	if f.Untagged && tagCount > 0 {
+		return false
+	}
+	if f.HasDescription != nil && *f.HasDescription != (pic.Description != "") {
+		return false
+	}
+	if f.TagCount != nil && tagCount != *f.TagCount {
+		return false
+	}
+	return true
+}
+
+func contains(list []string, v string) bool {
+	for _, item := range list {
+		if item == v {
+			return true
+		}
+	}
+	return false
+}
+
+// page 按 page/limit 截取，cursor 非空时 skip 已经过滤掉游标之前的记录，从头截取
+func page[T any](items []T, page, limit int, fromStart bool) []T {
+	offset := (page - 1) * limit
+	if fromStart || offset < 0 {
+		offset = 0
+	}
+	if offset >= len(items) {
+		return nil
+	}
+	end := offset + limit
+	if end > len(items) {
+		end = len(items)
+	}
+	return items[offset:end]
+}
+
+func (s *Store) ListPictures(filter database.PictureFilter, pageNum, limit int, sortOrder string, cursor *database.Cursor) ([]database.PictureWithTags, int, error) {
+	if err := s.lock(); err != nil {
+		return nil, 0, err
+	}
+	defer s.mu.Unlock()
+	if sortOrder != "date_asc" && sortOrder != "date_desc" {
+		sortOrder = "date_desc"
+	}
+	if cursor != nil && cursor.Sort != sortOrder {
+		return nil, 0, database.ErrInvalidCursor
+	}
+
+	var all []*database.Picture
+	for _, pic := range s.sortedPictures(sortOrder == "date_desc") {
+		if s.matches(pic, filter) {
+			all = append(all, pic)
+		}
+	}
+	var after []*database.Picture
+	for _, pic := range all {
+		if cursor != nil {
+			pos := &database.Picture{UploadDate: dbTime(cursor.UploadDate), ID: cursor.ID}
+			if sortOrder == "date_asc" && !pictureLess(pos, pic) {
+				continue
+			}
+			if sortOrder == "date_desc" && !pictureLess(pic, pos) {
+				continue
+			}
+		}
+		after = append(after, pic)
+	}
+
+	var results []database.PictureWithTags
+	for _, pic := range page(after, pageNum, limit, cursor != nil) {
+		results = append(results, s.withTags(pic))
+	}
+	return results, len(all), nil
+}
+
+func (s *Store) GetPicturesByIDs(ids []string) ([]database.PictureWithTags, error) {
+	if err := s.lock(); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+	results := []database.PictureWithTags{}
+	seen := make(map[string]bool)
+	for _, id := range ids {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if pic, ok := s.livePicture(id); ok {
+			results = append(results, s.withTags(pic))
+		}
+	}
+	return results, nil
+}
+
+func (s *Store) DeletePicture(id string) error {
+	if err := s.lock(); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+	if pic, ok := s.pictures[id]; ok {
+		pic.Deleted = true
+	}
+	for albumID, items := range s.albumItems {
+		delete(items, id)
+		if album := s.albums[albumID]; album != nil && album.CoverImageID == id {
+			album.CoverImageID = ""
+		}
+	}
+	return nil
+}
+
+func (s *Store) UpdatePictureDescription(id string, description string) error {
+	if err := s.lock(); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+	if pic, ok := s.livePicture(id); ok {
+		pic.Description = description
+	}
+	return nil
+}
+
+func (s *Store) UpdatePictureMetadata(pic *database.Picture) error {
+	if err := s.lock(); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+	if stored, ok := s.pictures[pic.ID]; ok {
+		stored.PHash, stored.Width, stored.Height, stored.MIMEType = pic.PHash, pic.Width, pic.Height, pic.MIMEType
+		stored.PHashDeferred = false
+	}
+	return nil
+}
+
+func (s *Store) ListPictureHashes() ([]database.PictureHash, error) {
+	if err := s.lock(); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+	var hashes []database.PictureHash
+	for _, pic := range s.sortedPictures(false) {
+		if pic.PHash != "" {
+			hashes = append(hashes, database.PictureHash{ID: pic.ID, PHash: pic.PHash})
+		}
+	}
+	return hashes, nil
+}
+
+// ListPicturesMissingMetadata 内存实现中用空的 MIME 类型和 PHashDeferred 表示数据库中的 NULL（尚未提取元数据）
+func (s *Store) ListPicturesMissingMetadata() ([]database.Picture, error) {
+	if err := s.lock(); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+	var pics []database.Picture
+	for _, pic := range s.sortedPictures(false) {
+		if pic.MIMEType == "" || pic.PHashDeferred {
+			pics = append(pics, *pic)
+		}
+	}
+	return pics, nil
+}
+
+func (s *Store) RewriteURLPrefix(from, to string) (int64, error) {
+	if err := s.lock(); err != nil {
+		return 0, err
+	}
+	defer s.mu.Unlock()
+	var n int64
+	for _, pic := range s.pictures {
+		if strings.HasPrefix(pic.URL, from) {
+			pic.URL = to + strings.TrimPrefix(pic.URL, from)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *Store) ListStoredPictures() ([]database.Picture, error) {
+	if err := s.lock(); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+	var pics []database.Picture
+	for _, pic := range s.sortedPictures(false) {
+		if pic.StorageKey != "" {
+			pics = append(pics, *pic)
+		}
+	}
+	return pics, nil
+}
+
+func (s *Store) UpdatePictureStorage(id, storageKey, url string) error {
+	if err := s.lock(); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+	if pic, ok := s.pictures[id]; ok {
+		pic.StorageKey, pic.URL = storageKey, url
+	}
+	return nil
+}
+
+// ---- 图片版本 ----
+
+func (s *Store) ListPictureVersions(pictureID string) ([]database.PictureVersion, error) {
+	if err := s.lock(); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+	versions := append([]database.PictureVersion{}, s.versions[pictureID]...)
+	sort.Slice(versions, func(i, j int) bool { return versions[i].Version > versions[j].Version })
+	return versions, nil
+}
+
+func (s *Store) GetPictureVersion(pictureID string, version int) (*database.PictureVersion, error) {
+	if err := s.lock(); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+	for _, v := range s.versions[pictureID] {
+		if v.Version == version {
+			result := v
+			return &result, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *Store) ReplacePictureFile(archived *database.PictureVersion, next *database.Picture) error {
+	if err := s.lock(); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+	pic, ok := s.livePicture(next.ID)
+	if !ok || pic.Version != archived.Version {
+		return database.ErrVersionConflict
+	}
+	for _, v := range s.versions[archived.PictureID] {
+		if v.Version == archived.Version {
+			return fmt.Errorf("UNIQUE constraint failed: picture_versions.picture_id, picture_versions.version")
+		}
+	}
+
+	pic.StorageKey, pic.URL, pic.Hash, pic.PHash = next.StorageKey, "", next.Hash, next.PHash
+	pic.Width, pic.Height, pic.MIMEType = next.Width, next.Height, next.MIMEType
+	pic.Version, pic.RevisedAt = next.Version, dbTime(next.RevisedAt)
+	pic.PHashDeferred = next.PHashDeferred
+
+	v := *archived
+	v.CreatedAt, v.ArchivedAt = dbTime(v.CreatedAt), dbTime(v.ArchivedAt)
+	s.versions[archived.PictureID] = append(s.versions[archived.PictureID], v)
+	return nil
+}
+
+func (s *Store) ListStoredVersions() ([]database.PictureVersion, error) {
+	if err := s.lock(); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+	var versions []database.PictureVersion
+	for pictureID, list := range s.versions {
+		if _, ok := s.livePicture(pictureID); !ok {
+			continue
+		}
+		for _, v := range list {
+			if v.StorageKey != "" {
+				versions = append(versions, v)
+			}
+		}
+	}
+	sort.Slice(versions, func(i, j int) bool {
+		if versions[i].PictureID != versions[j].PictureID {
+			return versions[i].PictureID < versions[j].PictureID
+		}
+		return versions[i].Version < versions[j].Version
+	})
+	return versions, nil
+}
+
+func (s *Store) UpdatePictureVersionStorage(pictureID string, version int, storageKey string) error {
+	if err := s.lock(); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+	for i := range s.versions[pictureID] {
+		if s.versions[pictureID][i].Version == version {
+			s.versions[pictureID][i].StorageKey = storageKey
+		}
+	}
+	return nil
+}
+
+// ---- 标签和搜索 ----
+
+func (s *Store) GetPictureTags(pictureID string) ([]string, error) {
+	if err := s.lock(); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+	var tags []string
+	for _, id := range s.pictureTags[pictureID] {
+		tags = append(tags, s.tagNames[id])
+	}
+	return tags, nil
+}
+
+// tagID 获取或创建标签（调用时持有锁）
+func (s *Store) tagID(name string) int {
+	if id, ok := s.tagIDs[name]; ok {
+		return id
+	}
+	s.nextTagID++
+	s.tagIDs[name] = s.nextTagID
+	s.tagNames[s.nextTagID] = name
+	return s.nextTagID
+}
+
+func (s *Store) SetPictureTags(pictureID string, tagNames []string) error {
+	if err := s.lock(); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+	var ids []int
+	seen := make(map[int]bool)
+	for _, name := range tagNames {
+		id := s.tagID(name)
+		if seen[id] {
+			return fmt.Errorf("UNIQUE constraint failed: picture_tags.picture_id, picture_tags.tag_id")
+		}
+		seen[id] = true
+		ids = append(ids, id)
+	}
+	s.pictureTags[pictureID] = ids
+	return nil
+}
+
+func (s *Store) AppendPictureTags(pictureID string, tagNames []string) error {
+	if err := s.lock(); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+	ids := s.pictureTags[pictureID]
+	for _, name := range tagNames {
+		id := s.tagID(name)
+		exists := false
+		for _, existing := range ids {
+			if existing == id {
+				exists = true
+				break
+			}
+		}
+		if !exists {
+			ids = append(ids, id)
+		}
+	}
+	s.pictureTags[pictureID] = ids
+	return nil
+}
+
+func (s *Store) ListTags(pageNum, limit int, cursor *database.Cursor) ([]database.Tag, int, error) {
+	if err := s.lock(); err != nil {
+		return nil, 0, err
+	}
+	defer s.mu.Unlock()
+	if cursor != nil && !cursor.IsTagCursor() {
+		return nil, 0, database.ErrInvalidCursor
+	}
+	counts := make(map[int]int)
+	for pictureID, ids := range s.pictureTags {
+		if _, ok := s.livePicture(pictureID); !ok {
+			continue
+		}
+		for _, id := range ids {
+			counts[id]++
+		}
+	}
+	all := make([]database.Tag, 0, len(counts))
+	for id, count := range counts {
+		all = append(all, database.Tag{ID: id, TagName: s.tagNames[id], Count: count})
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].Count != all[j].Count {
+			return all[i].Count > all[j].Count
+		}
+		return all[i].ID < all[j].ID
+	})
+
+	var after []database.Tag
+	for _, tag := range all {
+		if cursor != nil && !(tag.Count < cursor.Count || (tag.Count == cursor.Count && tag.ID > cursor.TagID)) {
+			continue
+		}
+		after = append(after, tag)
+	}
+	return page(after, pageNum, limit, cursor != nil), len(all), nil
+}
+
+// matchedTags 图片标签中属于 tagNames 的数量（调用时持有锁）
+func (s *Store) matchedTags(pictureID string, tagNames []string) int {
+	n := 0
+	for _, id := range s.pictureTags[pictureID] {
+		if contains(tagNames, s.tagNames[id]) {
+			n++
+		}
+	}
+	return n
+}
+
+func (s *Store) SearchExact(tagNames []string, filter database.PictureFilter, pageNum, limit int, cursor *database.Cursor) ([]database.PictureWithTags, int, error) {
+	if len(tagNames) == 0 {
+		return []database.PictureWithTags{}, 0, nil
+	}
+	if err := s.lock(); err != nil {
+		return nil, 0, err
+	}
+	defer s.mu.Unlock()
+	if cursor != nil && cursor.Sort != "date_desc" {
+		return nil, 0, database.ErrInvalidCursor
+	}
+
+	var all []*database.Picture
+	for _, pic := range s.sortedPictures(true) {
+		// 与 SQL 一致：匹配的不同标签数必须等于请求的标签数
+		if s.matchedTags(pic.ID, tagNames) == len(tagNames) && s.matches(pic, filter) {
+			all = append(all, pic)
+		}
+	}
+	var after []*database.Picture
+	for _, pic := range all {
+		if cursor != nil && !pictureLess(pic, &database.Picture{UploadDate: dbTime(cursor.UploadDate), ID: cursor.ID}) {
+			continue
+		}
+		after = append(after, pic)
+	}
+
+	var results []database.PictureWithTags
+	for _, pic := range page(after, pageNum, limit, cursor != nil) {
+		results = append(results, s.withTags(pic))
+	}
+	return results, len(all), nil
+}
+
+func (s *Store) SearchRelevance(tagNames []string, filter database.PictureFilter, pageNum, limit int, cursor *database.Cursor) ([]database.PictureWithTags, int, error) {
+	if len(tagNames) == 0 {
+		return []database.PictureWithTags{}, 0, nil
+	}
+	if err := s.lock(); err != nil {
+		return nil, 0, err
+	}
+	defer s.mu.Unlock()
+	if cursor != nil && cursor.Sort != "relevance" {
+		return nil, 0, database.ErrInvalidCursor
+	}
+
+	var all []database.PictureWithTags
+	for _, pic := range s.sortedPictures(true) {
+		matched := s.matchedTags(pic.ID, tagNames)
+		if matched > 0 && s.matches(pic, filter) {
+			result := s.withTags(pic)
+			result.MatchedTagCount = matched
+			all = append(all, result)
+		}
+	}
+	// 匹配数降序，其次上传时间和 ID 降序（sortedPictures 已按后两者排序）
+	sort.SliceStable(all, func(i, j int) bool { return all[i].MatchedTagCount > all[j].MatchedTagCount })
+
+	var after []database.PictureWithTags
+	for _, pic := range all {
+		if cursor != nil {
+			pos := &database.Picture{UploadDate: dbTime(cursor.UploadDate), ID: cursor.ID}
+			if pic.MatchedTagCount > cursor.Matched ||
+				(pic.MatchedTagCount == cursor.Matched && !pictureLess(&pic.Picture, pos)) {
+				continue
+			}
+		}
+		after = append(after, pic)
+	}
+	return page(after, pageNum, limit, cursor != nil), len(all), nil
+}
+
+// SearchText 与 SQLite 实现一致：每个词都作为子串出现在描述或任一标签名中
+func (s *Store) SearchText(query string, filter database.PictureFilter, pageNum, limit int) ([]database.PictureWithTags, int, error) {
+	terms := strings.Fields(strings.ToLower(query))
+	if len(terms) == 0 {
+		return []database.PictureWithTags{}, 0, nil
+	}
+	if err := s.lock(); err != nil {
+		return nil, 0, err
+	}
+	defer s.mu.Unlock()
+
+	all := []database.PictureWithTags{}
+	for _, pic := range s.sortedPictures(true) {
+		if !s.matches(pic, filter) {
+			continue
+		}
+		result := s.withTags(pic)
+		text := strings.ToLower(pic.Description + "\n" + strings.Join(result.Tags, "\n"))
+		found := true
+		for _, term := range terms {
+			if !strings.Contains(text, term) {
+				found = false
+				break
+			}
+		}
+		if found {
+			all = append(all, result)
+		}
+	}
+	return page(all, pageNum, limit, false), len(all), nil
+}
+
+// ---- 相册 ----
+
+func (s *Store) CreateAlbum(album *database.Album) error {
+	if err := s.lock(); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+	if _, ok := s.albums[album.ID]; ok {
+		return fmt.Errorf("UNIQUE constraint failed: albums.id")
+	}
+	now := s.now()
+	s.albums[album.ID] = &database.Album{
+		ID:           album.ID,
+		Name:         album.Name,
+		Description:  album.Description,
+		CoverImageID: album.CoverImageID,
+		CreatedAt:    now,
+		UpdatedAt:    now,
+	}
+	s.albumItems[album.ID] = make(map[string]int)
+	return nil
+}
+
+// orderedItems 相册中未删除的图片，按位置排序（调用时持有锁）
+func (s *Store) orderedItems(albumID string) []string {
+	var ids []string
+	for id := range s.albumItems[albumID] {
+		if _, ok := s.livePicture(id); ok {
+			ids = append(ids, id)
+		}
+	}
+	items := s.albumItems[albumID]
+	sort.Slice(ids, func(i, j int) bool {
+		if items[ids[i]] != items[ids[j]] {
+			return items[ids[i]] < items[ids[j]]
+		}
+		return ids[i] < ids[j]
+	})
+	return ids
+}
+
+// album 计算封面和图片数量后的相册（调用时持有锁）
+func (s *Store) album(stored *database.Album) database.Album {
+	album := *stored
+	album.CoverURL, album.CoverStorageKey = "", ""
+	ids := s.orderedItems(album.ID)
+	album.ImageCount = len(ids)
+	if pic, ok := s.livePicture(album.CoverImageID); ok {
+		album.CoverURL, album.CoverStorageKey = pic.URL, pic.StorageKey
+	} else if len(ids) > 0 {
+		pic := s.pictures[ids[0]]
+		album.CoverURL, album.CoverStorageKey = pic.URL, pic.StorageKey
+	}
+	return album
+}
+
+func (s *Store) GetAlbum(id string) (*database.Album, error) {
+	if err := s.lock(); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+	stored, ok := s.albums[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	album := s.album(stored)
+	return &album, nil
+}
+
+func (s *Store) ListAlbums(pageNum, limit int) ([]database.Album, int, error) {
+	if err := s.lock(); err != nil {
+		return nil, 0, err
+	}
+	defer s.mu.Unlock()
+	all := make([]database.Album, 0, len(s.albums))
+	for _, stored := range s.albums {
+		all = append(all, s.album(stored))
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if !all[i].UpdatedAt.Equal(all[j].UpdatedAt) {
+			return all[i].UpdatedAt.After(all[j].UpdatedAt)
+		}
+		return all[i].ID > all[j].ID
+	})
+	albums := page(all, pageNum, limit, false)
+	if albums == nil {
+		albums = []database.Album{}
+	}
+	return albums, len(all), nil
+}
+
+func (s *Store) UpdateAlbum(album *database.Album) error {
+	if err := s.lock(); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+	if stored, ok := s.albums[album.ID]; ok {
+		stored.Name, stored.Description, stored.CoverImageID = album.Name, album.Description, album.CoverImageID
+		stored.UpdatedAt = s.now()
+	}
+	return nil
+}
+
+func (s *Store) DeleteAlbum(id string) error {
+	if err := s.lock(); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+	delete(s.albums, id)
+	delete(s.albumItems, id)
+	return nil
+}
+
+func (s *Store) ListAlbumItems(albumID string) ([]database.AlbumItem, error) {
+	if err := s.lock(); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+	var items []database.AlbumItem
+	for _, id := range s.orderedItems(albumID) {
+		items = append(items, database.AlbumItem{
+			PictureWithTags: s.withTags(s.pictures[id]),
+			Position:        s.albumItems[albumID][id],
+		})
+	}
+	if items == nil {
+		items = []database.AlbumItem{}
+	}
+	return items, nil
+}
+
+func (s *Store) AddAlbumItems(albumID string, pictureIDs []string, position int) ([]string, error) {
+	if err := s.lock(); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+	items, ok := s.albumItems[albumID]
+	if !ok {
+		return nil, fmt.Errorf("FOREIGN KEY constraint failed")
+	}
+
+	seen := make(map[string]bool)
+	var newIDs []string
+	for _, id := range pictureIDs {
+		if seen[id] {
+			continue
+		}
+		seen[id] = true
+		if _, exists := items[id]; !exists {
+			if _, ok := s.pictures[id]; !ok {
+				return nil, fmt.Errorf("FOREIGN KEY constraint failed")
+			}
+			newIDs = append(newIDs, id)
+		}
+	}
+	if len(newIDs) == 0 {
+		return newIDs, nil
+	}
+
+	next := 0
+	for _, pos := range items {
+		if pos+1 > next {
+			next = pos + 1
+		}
+	}
+	if position < 0 || position > next {
+		position = next
+	} else {
+		for id, pos := range items {
+			if pos >= position {
+				items[id] = pos + len(newIDs)
+			}
+		}
+	}
+	for i, id := range newIDs {
+		items[id] = position + i
+	}
+	s.albums[albumID].UpdatedAt = s.now()
+	return newIDs, nil
+}
+
+func (s *Store) RemoveAlbumItems(albumID string, pictureIDs []string) (int, error) {
+	if len(pictureIDs) == 0 {
+		return 0, nil
+	}
+	if err := s.lock(); err != nil {
+		return 0, err
+	}
+	defer s.mu.Unlock()
+	removed := 0
+	for _, id := range pictureIDs {
+		if _, ok := s.albumItems[albumID][id]; ok {
+			delete(s.albumItems[albumID], id)
+			removed++
+		}
+	}
+	if album, ok := s.albums[albumID]; ok {
+		if contains(pictureIDs, album.CoverImageID) {
+			album.CoverImageID = ""
+		}
+		album.UpdatedAt = s.now()
+	}
+	return removed, nil
+}
+
+func (s *Store) ReorderAlbumItems(albumID string, pictureIDs []string) error {
+	if err := s.lock(); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+	items := s.albumItems[albumID]
+	current := make([]string, 0, len(items))
+	for id := range items {
+		current = append(current, id)
+	}
+	sort.Slice(current, func(i, j int) bool {
+		if items[current[i]] != items[current[j]] {
+			return items[current[i]] < items[current[j]]
+		}
+		return current[i] < current[j]
+	})
+
+	order := make([]string, 0, len(current))
+	placed := make(map[string]bool)
+	for _, id := range pictureIDs {
+		if _, ok := items[id]; !ok {
+			return database.ErrImageNotInAlbum
+		}
+		if !placed[id] {
+			placed[id] = true
+			order = append(order, id)
+		}
+	}
+	for _, id := range current {
+		if !placed[id] {
+			order = append(order, id)
+		}
+	}
+	for i, id := range order {
+		items[id] = i
+	}
+	if album, ok := s.albums[albumID]; ok {
+		album.UpdatedAt = s.now()
+	}
+	return nil
+}
+
+// ---- 分享链接 ----
+
+func (s *Store) CreateShareLink(link *database.ShareLink) error {
+	if err := s.lock(); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+	if _, ok := s.shares[link.Token]; ok {
+		return fmt.Errorf("UNIQUE constraint failed: share_links.token")
+	}
+	stored := *link
+	stored.ExpiresAt = dbTime(link.ExpiresAt)
+	stored.HasPassword = link.PasswordHash != ""
+	stored.ViewCount, stored.Revoked = 0, false
+	stored.CreatedAt = s.now()
+	s.shares[link.Token] = &stored
+	return nil
+}
+
+func (s *Store) GetShareLink(token string) (*database.ShareLink, error) {
+	if err := s.lock(); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+	link, ok := s.shares[token]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	result := *link
+	return &result, nil
+}
+
+func (s *Store) ListShareLinks(pageNum, limit int) ([]database.ShareLink, int, error) {
+	if err := s.lock(); err != nil {
+		return nil, 0, err
+	}
+	defer s.mu.Unlock()
+	all := make([]database.ShareLink, 0, len(s.shares))
+	for _, link := range s.shares {
+		all = append(all, *link)
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if !all[i].CreatedAt.Equal(all[j].CreatedAt) {
+			return all[i].CreatedAt.After(all[j].CreatedAt)
+		}
+		return all[i].Token < all[j].Token
+	})
+	links := page(all, pageNum, limit, false)
+	if links == nil {
+		links = []database.ShareLink{}
+	}
+	return links, len(all), nil
+}
+
+func (s *Store) RevokeShareLink(token string) error {
+	if err := s.lock(); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+	if link, ok := s.shares[token]; ok {
+		link.Revoked = true
+	}
+	return nil
+}
+
+func (s *Store) IncrementShareViews(token string) error {
+	if err := s.lock(); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+	if link, ok := s.shares[token]; ok {
+		link.ViewCount++
+	}
+	return nil
+}
+
+// ---- 幂等键 ----
+
+func (s *Store) CreateIdempotencyKey(k *database.IdempotencyKey) (bool, error) {
+	if err := s.lock(); err != nil {
+		return false, err
+	}
+	defer s.mu.Unlock()
+	if _, ok := s.idempotency[k.Key]; ok {
+		return false, nil
+	}
+	stored := *k
+	stored.StatusCode, stored.ContentType, stored.Body = 0, "", nil
+	stored.CreatedAt, stored.ExpiresAt = dbTime(k.CreatedAt), dbTime(k.ExpiresAt)
+	s.idempotency[k.Key] = &stored
+	return true, nil
+}
+
+func (s *Store) GetIdempotencyKey(key string) (*database.IdempotencyKey, error) {
+	if err := s.lock(); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+	k, ok := s.idempotency[key]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	result := *k
+	result.Body = append([]byte(nil), k.Body...)
+	return &result, nil
+}
+
+func (s *Store) CompleteIdempotencyKey(key string, statusCode int, contentType string, body []byte) error {
+	if err := s.lock(); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+	if k, ok := s.idempotency[key]; ok {
+		k.StatusCode, k.ContentType, k.Body = statusCode, contentType, append([]byte(nil), body...)
+	}
+	return nil
+}
+
+func (s *Store) DeleteIdempotencyKey(key string) error {
+	if err := s.lock(); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+	delete(s.idempotency, key)
+	return nil
+}
+
+func (s *Store) DeleteExpiredIdempotencyKeys(now time.Time) (int64, error) {
+	if err := s.lock(); err != nil {
+		return 0, err
+	}
+	defer s.mu.Unlock()
+	var n int64
+	for key, k := range s.idempotency {
+		if !k.ExpiresAt.After(dbTime(now)) {
+			delete(s.idempotency, key)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// ---- 审计日志 ----
+
+func (s *Store) CreateAuditEntry(e *database.AuditEntry) error {
+	if err := s.lock(); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+	s.nextAuditID++
+	stored := *e
+	stored.ID = s.nextAuditID
+	stored.CreatedAt = dbTime(e.CreatedAt)
+	s.audit = append(s.audit, stored)
+	return nil
+}
+
+func auditMatches(e database.AuditEntry, f database.AuditFilter) bool {
+	if f.Actor != "" && e.Actor != f.Actor {
+		return false
+	}
+	if strings.HasSuffix(f.Action, ".") {
+		if !strings.HasPrefix(e.Action, f.Action) {
+			return false
+		}
+	} else if f.Action != "" && e.Action != f.Action {
+		return false
+	}
+	if f.TargetType != "" && e.TargetType != f.TargetType {
+		return false
+	}
+	if f.TargetID != "" && e.TargetID != f.TargetID {
+		return false
+	}
+	if f.Since != nil && e.CreatedAt.Before(dbTime(*f.Since)) {
+		return false
+	}
+	if f.Until != nil && !e.CreatedAt.Before(dbTime(*f.Until)) {
+		return false
+	}
+	return true
+}
+
+func (s *Store) ListAuditEntries(filter database.AuditFilter, pageNum, limit int) ([]database.AuditEntry, int, error) {
+	if err := s.lock(); err != nil {
+		return nil, 0, err
+	}
+	defer s.mu.Unlock()
+	var all []database.AuditEntry
+	for i := len(s.audit) - 1; i >= 0; i-- {
+		if auditMatches(s.audit[i], filter) {
+			all = append(all, s.audit[i])
+		}
+	}
+	entries := page(all, pageNum, limit, false)
+	if entries == nil {
+		entries = []database.AuditEntry{}
+	}
+	return entries, len(all), nil
+}
+
+func (s *Store) DeleteAuditEntriesBefore(cutoff time.Time) (int64, error) {
+	if err := s.lock(); err != nil {
+		return 0, err
+	}
+	defer s.mu.Unlock()
+	kept := s.audit[:0]
+	for _, e := range s.audit {
+		if !e.CreatedAt.Before(dbTime(cutoff)) {
+			kept = append(kept, e)
+		}
+	}
+	n := int64(len(s.audit) - len(kept))
+	s.audit = kept
+	return n, nil
+}
+
+// AuditEntries 按写入顺序返回所有审计日志（测试断言使用）
+func (s *Store) AuditEntries() []database.AuditEntry {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]database.AuditEntry{}, s.audit...)
+}
+
+// ---- Webhook ----
+
+func (s *Store) CreateWebhook(w *database.Webhook) error {
+	if err := s.lock(); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+	if _, ok := s.webhooks[w.ID]; ok {
+		return fmt.Errorf("UNIQUE constraint failed: webhooks.id")
+	}
+	now := s.now()
+	w.CreatedAt, w.UpdatedAt = now, now
+	stored := *w
+	stored.Events = append([]string{}, w.Events...)
+	s.webhooks[w.ID] = &stored
+	return nil
+}
+
+func (s *Store) GetWebhook(id string) (*database.Webhook, error) {
+	if err := s.lock(); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+	w, ok := s.webhooks[id]
+	if !ok {
+		return nil, sql.ErrNoRows
+	}
+	result := *w
+	result.Events = append([]string{}, w.Events...)
+	return &result, nil
+}
+
+func (s *Store) ListWebhooks(activeOnly bool) ([]database.Webhook, error) {
+	if err := s.lock(); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+	webhooks := []database.Webhook{}
+	for _, w := range s.webhooks {
+		if !activeOnly || w.Active {
+			result := *w
+			result.Events = append([]string{}, w.Events...)
+			webhooks = append(webhooks, result)
+		}
+	}
+	sort.Slice(webhooks, func(i, j int) bool {
+		if !webhooks[i].CreatedAt.Equal(webhooks[j].CreatedAt) {
+			return webhooks[i].CreatedAt.After(webhooks[j].CreatedAt)
+		}
+		return webhooks[i].ID < webhooks[j].ID
+	})
+	return webhooks, nil
+}
+
+func (s *Store) UpdateWebhook(w *database.Webhook) error {
+	if err := s.lock(); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+	w.UpdatedAt = s.now()
+	if stored, ok := s.webhooks[w.ID]; ok {
+		stored.URL, stored.Secret, stored.Description, stored.Active = w.URL, w.Secret, w.Description, w.Active
+		stored.Events = append([]string{}, w.Events...)
+		stored.UpdatedAt = w.UpdatedAt
+	}
+	return nil
+}
+
+func (s *Store) DeleteWebhook(id string) error {
+	if err := s.lock(); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+	delete(s.webhooks, id)
+	kept := s.deliveries[:0]
+	for _, d := range s.deliveries {
+		if d.WebhookID != id {
+			kept = append(kept, d)
+		}
+	}
+	s.deliveries = kept
+	return nil
+}
+
+func (s *Store) CreateWebhookDeliveries(deliveries []database.WebhookDelivery) error {
+	if err := s.lock(); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+	for _, d := range deliveries {
+		if _, ok := s.webhooks[d.WebhookID]; !ok {
+			return fmt.Errorf("FOREIGN KEY constraint failed")
+		}
+	}
+	for _, d := range deliveries {
+		s.nextDeliveryID++
+		stored := d
+		stored.ID = s.nextDeliveryID
+		stored.Status = database.DeliveryPending
+		stored.Attempts, stored.LastStatusCode, stored.LastError, stored.FinishedAt = 0, 0, "", nil
+		stored.NextAttemptAt, stored.CreatedAt = dbTime(d.NextAttemptAt), dbTime(d.CreatedAt)
+		s.deliveries = append(s.deliveries, &stored)
+	}
+	return nil
+}
+
+func copyDelivery(d *database.WebhookDelivery) database.WebhookDelivery {
+	result := *d
+	if d.FinishedAt != nil {
+		finished := *d.FinishedAt
+		result.FinishedAt = &finished
+	}
+	return result
+}
+
+func (s *Store) ClaimWebhookDeliveries(now time.Time, lease time.Duration, limit int) ([]database.WebhookDelivery, error) {
+	if err := s.lock(); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+	var due []*database.WebhookDelivery
+	for _, d := range s.deliveries {
+		if d.Status == database.DeliveryPending && !d.NextAttemptAt.After(dbTime(now)) {
+			due = append(due, d)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool {
+		if !due[i].NextAttemptAt.Equal(due[j].NextAttemptAt) {
+			return due[i].NextAttemptAt.Before(due[j].NextAttemptAt)
+		}
+		return due[i].ID < due[j].ID
+	})
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	claimed := make([]database.WebhookDelivery, 0, len(due))
+	for _, d := range due {
+		claimed = append(claimed, copyDelivery(d))
+		d.NextAttemptAt = dbTime(now.Add(lease))
+	}
+	return claimed, nil
+}
+
+func (s *Store) UpdateWebhookDelivery(d *database.WebhookDelivery) error {
+	if err := s.lock(); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+	for _, stored := range s.deliveries {
+		if stored.ID == d.ID {
+			stored.Status, stored.Attempts = d.Status, d.Attempts
+			stored.NextAttemptAt = dbTime(d.NextAttemptAt)
+			stored.LastStatusCode, stored.LastError = d.LastStatusCode, d.LastError
+			stored.FinishedAt = nil
+			if d.FinishedAt != nil {
+				finished := dbTime(*d.FinishedAt)
+				stored.FinishedAt = &finished
+			}
+		}
+	}
+	return nil
+}
+
+func (s *Store) GetWebhookDelivery(webhookID string, id int64) (*database.WebhookDelivery, error) {
+	if err := s.lock(); err != nil {
+		return nil, err
+	}
+	defer s.mu.Unlock()
+	for _, d := range s.deliveries {
+		if d.ID == id && d.WebhookID == webhookID {
+			result := copyDelivery(d)
+			return &result, nil
+		}
+	}
+	return nil, sql.ErrNoRows
+}
+
+func (s *Store) ListWebhookDeliveries(webhookID, status string, pageNum, limit int) ([]database.WebhookDelivery, int, error) {
+	if err := s.lock(); err != nil {
+		return nil, 0, err
+	}
+	defer s.mu.Unlock()
+	var all []database.WebhookDelivery
+	for i := len(s.deliveries) - 1; i >= 0; i-- {
+		d := s.deliveries[i]
+		if d.WebhookID == webhookID && (status == "" || d.Status == status) {
+			all = append(all, copyDelivery(d))
+		}
+	}
+	deliveries := page(all, pageNum, limit, false)
+	if deliveries == nil {
+		deliveries = []database.WebhookDelivery{}
+	}
+	return deliveries, len(all), nil
+}
+
+func (s *Store) RetryWebhookDelivery(webhookID string, id int64, now time.Time) error {
+	if err := s.lock(); err != nil {
+		return err
+	}
+	defer s.mu.Unlock()
+	for _, d := range s.deliveries {
+		if d.ID == id && d.WebhookID == webhookID {
+			d.Status, d.Attempts, d.NextAttemptAt, d.FinishedAt = database.DeliveryPending, 0, dbTime(now), nil
+		}
+	}
+	return nil
+}
+
+func (s *Store) DeleteFinishedWebhookDeliveries(cutoff time.Time) (int64, error) {
+	if err := s.lock(); err != nil {
+		return 0, err
+	}
+	defer s.mu.Unlock()
+	kept := s.deliveries[:0]
+	for _, d := range s.deliveries {
+		if d.Status == database.DeliveryPending || d.FinishedAt == nil || !d.FinishedAt.Before(dbTime(cutoff)) {
+			kept = append(kept, d)
+		}
+	}
+	n := int64(len(s.deliveries) - len(kept))
+	s.deliveries = kept
+	return n, nil
+}
+
+// ---- 迁移和备份 ----
+
+// Migrate 内存实现没有表结构，不需要迁移
+func (s *Store) Migrate() (int, error) { return 0, nil }
+
+func (s *Store) MigrationStatus() ([]database.MigrationStatus, error) { return nil, nil }
+
+func (s *Store) Backup(destPath string) error { return ErrUnsupported }
+
+func (s *Store) Close() error { return nil }
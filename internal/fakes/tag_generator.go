@@ -0,0 +1,47 @@
+package fakes
+
+import (
+	"context"
+	"sync"
+
+	"github.com/vaaandark/PixelHub/internal/llm"
+)
+
+// TagGenerator 返回固定结果的 llm.TagGenerator 实现，并记录每次调用
+type TagGenerator struct {
+	mu sync.Mutex
+
+	// Result 每次调用返回的分析结果
+	Result llm.ImageAnalysisResult
+	// Err 非 nil 时返回该错误
+	Err error
+
+	calls []TagGeneratorCall
+}
+
+// TagGeneratorCall 一次 GenerateImageInfo 调用的参数
+type TagGeneratorCall struct {
+	ImageURL string
+	Prompt   string
+}
+
+var _ llm.TagGenerator = (*TagGenerator)(nil)
+
+func (g *TagGenerator) GenerateImageInfo(ctx context.Context, imageURL string, prompt string) (*llm.ImageAnalysisResult, error) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	g.calls = append(g.calls, TagGeneratorCall{ImageURL: imageURL, Prompt: prompt})
+	if g.Err != nil {
+		return nil, g.Err
+	}
+	result := g.Result
+	result.Tags = append([]string{}, g.Result.Tags...)
+	return &result, nil
+}
+
+// Calls 返回所有调用的参数
+func (g *TagGenerator) Calls() []TagGeneratorCall {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	return append([]TagGeneratorCall{}, g.calls...)
+}
@@ -0,0 +1,508 @@
+package handlers
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/vaaandark/PixelHub/internal/database"
+)
+
+// getAlbumOrAbort 获取相册，不存在或出错时直接写入响应并返回 nil
+func (h *Handler) getAlbumOrAbort(c *gin.Context, albumID string) *database.Album {
+	album, err := h.store.GetAlbum(albumID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, Response{
+				Code:    404,
+				Message: "Album not found",
+			})
+			return nil
+		}
+		c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: "Failed to get album",
+		})
+		return nil
+	}
+	return album
+}
+
+// checkCoverImage 检查封面图片是否存在，不存在时写入响应并返回 false
+func (h *Handler) checkCoverImage(c *gin.Context, imageID string) bool {
+	if imageID == "" {
+		return true
+	}
+	if _, err := h.store.GetPicture(imageID); err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusBadRequest, Response{
+				Code:    400,
+				Message: "Cover image not found",
+			})
+			return false
+		}
+		c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: "Failed to get cover image",
+		})
+		return false
+	}
+	return true
+}
+
+// CreateAlbum 创建相册
+func (h *Handler) CreateAlbum(c *gin.Context) {
+	var req struct {
+		Name         string   `json:"name" binding:"required"`
+		Description  string   `json:"description"`
+		CoverImageID string   `json:"cover_image_id"`
+		ImageIDs     []string `json:"image_ids"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "Invalid request",
+		})
+		return
+	}
+
+	req.Name = strings.TrimSpace(req.Name)
+	if req.Name == "" {
+		c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "Album name is required",
+		})
+		return
+	}
+
+	if !h.checkCoverImage(c, req.CoverImageID) {
+		return
+	}
+
+	album := &database.Album{
+		ID:           "alb_" + uuid.New().String(),
+		Name:         req.Name,
+		Description:  req.Description,
+		CoverImageID: req.CoverImageID,
+	}
+	if err := h.store.CreateAlbum(album); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: fmt.Sprintf("Failed to create album: %v", err),
+		})
+		return
+	}
+	h.audit(c, auditAlbumCreate, "album", album.ID, nil, map[string]interface{}{
+		"name":           album.Name,
+		"description":    album.Description,
+		"cover_image_id": album.CoverImageID,
+		"image_ids":      req.ImageIDs,
+	})
+
+	// 可选：创建时直接添加图片
+	var results []AlbumItemResult
+	if len(req.ImageIDs) > 0 {
+		var err error
+		results, err = h.addAlbumItems(album.ID, req.ImageIDs, -1)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, Response{
+				Code:    500,
+				Message: fmt.Sprintf("Failed to add images to album: %v", err),
+			})
+			return
+		}
+	}
+
+	created, err := h.store.GetAlbum(album.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: "Failed to get album",
+		})
+		return
+	}
+
+	h.resolveAlbumCover(created)
+
+	data := map[string]interface{}{
+		"album": created,
+	}
+	if results != nil {
+		data["results"] = results
+	}
+
+	c.JSON(http.StatusCreated, Response{
+		Code:    201,
+		Message: "Album created successfully",
+		Data:    data,
+	})
+}
+
+// ListAlbums 列出所有相册
+func (h *Handler) ListAlbums(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	albums, total, err := h.store.ListAlbums(page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: "Failed to list albums",
+		})
+		return
+	}
+
+	for i := range albums {
+		h.resolveAlbumCover(&albums[i])
+	}
+
+	c.JSON(http.StatusOK, Response{
+		Code:    200,
+		Message: "Success",
+		Data: map[string]interface{}{
+			"total":        total,
+			"current_page": page,
+			"albums":       albums,
+		},
+	})
+}
+
+// GetAlbumDetail 获取相册详情（包含按顺序排列的图片）
+func (h *Handler) GetAlbumDetail(c *gin.Context) {
+	album := h.getAlbumOrAbort(c, c.Param("album_id"))
+	if album == nil {
+		return
+	}
+
+	items, err := h.store.ListAlbumItems(album.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: "Failed to list album images",
+		})
+		return
+	}
+	if items == nil {
+		items = []database.AlbumItem{}
+	}
+	h.resolveAlbumCover(album)
+	for i := range items {
+		items[i].URL = h.pictureURL(&items[i].Picture)
+	}
+
+	c.JSON(http.StatusOK, Response{
+		Code:    200,
+		Message: "Success",
+		Data: map[string]interface{}{
+			"album":  album,
+			"images": items,
+		},
+	})
+}
+
+// UpdateAlbum 更新相册名称、描述或封面
+func (h *Handler) UpdateAlbum(c *gin.Context) {
+	var req struct {
+		Name         *string `json:"name"`
+		Description  *string `json:"description"`
+		CoverImageID *string `json:"cover_image_id"` // 空字符串表示清除封面
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "Invalid request",
+		})
+		return
+	}
+
+	album := h.getAlbumOrAbort(c, c.Param("album_id"))
+	if album == nil {
+		return
+	}
+	before := albumAuditState(album)
+
+	if req.Name != nil {
+		name := strings.TrimSpace(*req.Name)
+		if name == "" {
+			c.JSON(http.StatusBadRequest, Response{
+				Code:    400,
+				Message: "Album name cannot be empty",
+			})
+			return
+		}
+		album.Name = name
+	}
+	if req.Description != nil {
+		album.Description = *req.Description
+	}
+	if req.CoverImageID != nil {
+		if !h.checkCoverImage(c, *req.CoverImageID) {
+			return
+		}
+		album.CoverImageID = *req.CoverImageID
+	}
+
+	if err := h.store.UpdateAlbum(album); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: fmt.Sprintf("Failed to update album: %v", err),
+		})
+		return
+	}
+	h.audit(c, auditAlbumUpdate, "album", album.ID, before, albumAuditState(album))
+
+	c.JSON(http.StatusOK, Response{
+		Code:    200,
+		Message: "Album updated successfully",
+	})
+}
+
+// albumAuditState 相册在审计日志中记录的状态
+func albumAuditState(album *database.Album) map[string]interface{} {
+	return map[string]interface{}{
+		"name":           album.Name,
+		"description":    album.Description,
+		"cover_image_id": album.CoverImageID,
+	}
+}
+
+// DeleteAlbum 删除相册（不会删除相册中的图片）
+func (h *Handler) DeleteAlbum(c *gin.Context) {
+	album := h.getAlbumOrAbort(c, c.Param("album_id"))
+	if album == nil {
+		return
+	}
+
+	if err := h.store.DeleteAlbum(album.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: "Failed to delete album",
+		})
+		return
+	}
+	h.audit(c, auditAlbumDelete, "album", album.ID, albumAuditState(album), nil)
+
+	c.JSON(http.StatusOK, Response{
+		Code:    200,
+		Message: "Album deleted successfully",
+	})
+}
+
+// AlbumItemResult 相册批量操作中单张图片的结果
+type AlbumItemResult struct {
+	ImageID string `json:"image_id"`
+	Status  string `json:"status"`
+	Error   string `json:"error,omitempty"`
+}
+
+// addAlbumItems 校验图片后批量加入相册，返回每张图片的结果
+func (h *Handler) addAlbumItems(albumID string, imageIDs []string, position int) ([]AlbumItemResult, error) {
+	results := make([]AlbumItemResult, 0, len(imageIDs))
+	valid := make([]string, 0, len(imageIDs))
+	for _, imageID := range imageIDs {
+		if _, err := h.store.GetPicture(imageID); err != nil {
+			if err != sql.ErrNoRows {
+				return nil, err
+			}
+			results = append(results, AlbumItemResult{ImageID: imageID, Status: "failed", Error: "Image not found"})
+			continue
+		}
+		valid = append(valid, imageID)
+	}
+
+	added, err := h.store.AddAlbumItems(albumID, valid, position)
+	if err != nil {
+		return nil, err
+	}
+	addedSet := make(map[string]bool, len(added))
+	for _, id := range added {
+		addedSet[id] = true
+	}
+
+	reported := make(map[string]bool, len(valid))
+	for _, imageID := range valid {
+		if reported[imageID] {
+			continue
+		}
+		reported[imageID] = true
+		if addedSet[imageID] {
+			results = append(results, AlbumItemResult{ImageID: imageID, Status: "success"})
+		} else {
+			results = append(results, AlbumItemResult{ImageID: imageID, Status: "skipped", Error: "Image already in album"})
+		}
+	}
+	return results, nil
+}
+
+// AddAlbumImages 批量向相册添加图片
+func (h *Handler) AddAlbumImages(c *gin.Context) {
+	var req struct {
+		ImageIDs []string `json:"image_ids" binding:"required"`
+		Position *int     `json:"position"` // 插入位置（从 0 开始），不传则追加到末尾
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.ImageIDs) == 0 {
+		c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "No image IDs provided",
+		})
+		return
+	}
+
+	album := h.getAlbumOrAbort(c, c.Param("album_id"))
+	if album == nil {
+		return
+	}
+
+	position := -1
+	if req.Position != nil {
+		if *req.Position < 0 {
+			c.JSON(http.StatusBadRequest, Response{
+				Code:    400,
+				Message: "Position must be non-negative",
+			})
+			return
+		}
+		position = *req.Position
+	}
+
+	results, err := h.addAlbumItems(album.ID, req.ImageIDs, position)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: fmt.Sprintf("Failed to add images to album: %v", err),
+		})
+		return
+	}
+
+	var added []string
+	for _, r := range results {
+		if r.Status == "success" {
+			added = append(added, r.ImageID)
+		}
+	}
+	if len(added) > 0 {
+		h.audit(c, auditAlbumAddItems, "album", album.ID, nil, map[string]interface{}{
+			"image_ids": added,
+			"position":  position,
+		})
+	}
+	successCount := len(added)
+
+	c.JSON(http.StatusOK, Response{
+		Code:    200,
+		Message: "Images added to album",
+		Data: map[string]interface{}{
+			"total":   len(req.ImageIDs),
+			"success": successCount,
+			"results": results,
+		},
+	})
+}
+
+// RemoveAlbumImages 批量从相册移除图片
+func (h *Handler) RemoveAlbumImages(c *gin.Context) {
+	var req struct {
+		ImageIDs []string `json:"image_ids" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.ImageIDs) == 0 {
+		c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "No image IDs provided",
+		})
+		return
+	}
+
+	album := h.getAlbumOrAbort(c, c.Param("album_id"))
+	if album == nil {
+		return
+	}
+
+	removed, err := h.store.RemoveAlbumItems(album.ID, req.ImageIDs)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: fmt.Sprintf("Failed to remove images from album: %v", err),
+		})
+		return
+	}
+	if removed > 0 {
+		h.audit(c, auditAlbumRemoveItems, "album", album.ID, map[string]interface{}{"image_ids": req.ImageIDs},
+			map[string]interface{}{"removed": removed})
+	}
+
+	c.JSON(http.StatusOK, Response{
+		Code:    200,
+		Message: "Images removed from album",
+		Data: map[string]interface{}{
+			"total":   len(req.ImageIDs),
+			"removed": removed,
+		},
+	})
+}
+
+// ReorderAlbumImages 调整相册中图片的顺序
+func (h *Handler) ReorderAlbumImages(c *gin.Context) {
+	var req struct {
+		ImageIDs []string `json:"image_ids" binding:"required"`
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil || len(req.ImageIDs) == 0 {
+		c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "No image IDs provided",
+		})
+		return
+	}
+
+	album := h.getAlbumOrAbort(c, c.Param("album_id"))
+	if album == nil {
+		return
+	}
+
+	var oldOrder []string
+	if items, err := h.store.ListAlbumItems(album.ID); err == nil {
+		for _, item := range items {
+			oldOrder = append(oldOrder, item.ID)
+		}
+	}
+
+	if err := h.store.ReorderAlbumItems(album.ID, req.ImageIDs); err != nil {
+		if errors.Is(err, database.ErrImageNotInAlbum) {
+			c.JSON(http.StatusBadRequest, Response{
+				Code:    400,
+				Message: "Some images are not in this album",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: fmt.Sprintf("Failed to reorder album: %v", err),
+		})
+		return
+	}
+
+	h.audit(c, auditAlbumReorder, "album", album.ID,
+		map[string]interface{}{"image_ids": oldOrder},
+		map[string]interface{}{"image_ids": req.ImageIDs})
+
+	c.JSON(http.StatusOK, Response{
+		Code:    200,
+		Message: "Album reordered successfully",
+	})
+}
@@ -0,0 +1,188 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vaaandark/PixelHub/internal/database"
+)
+
+// 审计日志记录的操作
+const (
+	auditImageUpload      = "image.upload"
+	auditImageDelete      = "image.delete"
+	auditImageTags        = "image.tags.update"
+	auditImageDescription = "image.description.update"
+	auditImageGenerate    = "image.tags.generate"
+	auditImageReplace     = "image.file.replace"
+	auditImageRollback    = "image.file.rollback"
+	auditAlbumCreate      = "album.create"
+	auditAlbumUpdate      = "album.update"
+	auditAlbumDelete      = "album.delete"
+	auditAlbumAddItems    = "album.images.add"
+	auditAlbumRemoveItems = "album.images.remove"
+	auditAlbumReorder     = "album.images.reorder"
+	auditShareCreate      = "share.create"
+	auditShareRevoke      = "share.revoke"
+	auditWebhookCreate    = "webhook.create"
+	auditWebhookUpdate    = "webhook.update"
+	auditWebhookDelete    = "webhook.delete"
+)
+
+const (
+	// defaultAuditRetentionDays 审计日志默认保留天数
+	defaultAuditRetentionDays = 90
+	// maxActorLength X-Actor 头的最大长度，超出部分截断
+	maxActorLength = 100
+	// anonymousActor 请求没有 X-Actor 头时记录的操作者
+	anonymousActor = "anonymous"
+)
+
+// ConfigureAudit 设置审计日志的保留天数，0 使用默认的 90 天，负数表示永久保留
+func (h *Handler) ConfigureAudit(retentionDays int) {
+	if retentionDays == 0 {
+		retentionDays = defaultAuditRetentionDays
+	}
+	if retentionDays < 0 {
+		h.auditRetention = 0
+		return
+	}
+	h.auditRetention = time.Duration(retentionDays) * 24 * time.Hour
+}
+
+// auditActor 操作者取自 X-Actor 头（API 没有鉴权，由客户端自行声明）
+func auditActor(c *gin.Context) string {
+	actor := strings.TrimSpace(c.GetHeader("X-Actor"))
+	if actor == "" {
+		return anonymousActor
+	}
+	if len(actor) > maxActorLength {
+		actor = actor[:maxActorLength]
+	}
+	return actor
+}
+
+// audit 追加一条审计日志并发布对应的事件（事件流和 Webhook），before/after 为修改前后的状态（nil 表示没有）
+// 修改已经生效，写日志或投递失败只记录警告，不影响响应
+func (h *Handler) audit(c *gin.Context, action, targetType, targetID string, before, after interface{}) {
+	entry := &database.AuditEntry{
+		CreatedAt:  time.Now(),
+		Actor:      auditActor(c),
+		Action:     action,
+		TargetType: targetType,
+		TargetID:   targetID,
+		ClientIP:   c.ClientIP(),
+	}
+	var err error
+	if before != nil {
+		if entry.Before, err = json.Marshal(before); err != nil {
+			log.Printf("Warning: Failed to encode audit state for %s %s: %v", action, targetID, err)
+		}
+	}
+	if after != nil {
+		if entry.After, err = json.Marshal(after); err != nil {
+			log.Printf("Warning: Failed to encode audit state for %s %s: %v", action, targetID, err)
+		}
+	}
+	if err := h.store.CreateAuditEntry(entry); err != nil {
+		log.Printf("Warning: Failed to write audit log for %s %s: %v", action, targetID, err)
+	}
+	h.publishEvent(eventFromAudit(entry))
+}
+
+// imageAuditState 图片在审计日志中记录的状态
+func imageAuditState(pic *database.Picture, tags []string) map[string]interface{} {
+	state := map[string]interface{}{
+		"storage_key": pic.StorageKey,
+		"hash":        pic.Hash,
+		"description": pic.Description,
+	}
+	if tags != nil {
+		state["tags"] = tags
+	}
+	if pic.Version > 0 {
+		state["version"] = pic.Version
+	}
+	if pic.SourceURL != "" {
+		state["source_url"] = pic.SourceURL
+	}
+	return state
+}
+
+// ListAuditLog 查询审计日志（从新到旧）
+// GET /api/v1/audit?actor=&action=&target_type=&target_id=&since=&until=&page=&limit=
+func (h *Handler) ListAuditLog(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 200 {
+		limit = 50
+	}
+
+	filter := database.AuditFilter{
+		Actor:      c.Query("actor"),
+		Action:     c.Query("action"),
+		TargetType: c.Query("target_type"),
+		TargetID:   c.Query("target_id"),
+	}
+	var err error
+	if filter.Since, err = parseTimeParam(c, "since"); err == nil {
+		filter.Until, err = parseTimeParam(c, "until")
+	}
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	entries, total, err := h.store.ListAuditEntries(filter, page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: "Failed to list audit log",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{
+		Code:    200,
+		Message: "Success",
+		Data: map[string]interface{}{
+			"total":        total,
+			"current_page": page,
+			"entries":      entries,
+		},
+	})
+}
+
+// CleanupAuditLog 每天删除超过保留期的审计日志（在后台运行）
+func (h *Handler) CleanupAuditLog(ctx context.Context) {
+	if h.auditRetention <= 0 {
+		return
+	}
+	ticker := time.NewTicker(24 * time.Hour)
+	defer ticker.Stop()
+	for {
+		if n, err := h.store.DeleteAuditEntriesBefore(time.Now().Add(-h.auditRetention)); err != nil {
+			log.Printf("Warning: Failed to clean up audit log: %v", err)
+		} else if n > 0 {
+			log.Printf("Removed %d audit log entries older than %s", n, h.auditRetention)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestAuditRecordsActorAndState(t *testing.T) {
+	e := newTestEnv(t, false)
+	body := jsonBody(map[string]interface{}{"tags": []string{"sea"}, "mode": "set"})
+	body.headers = map[string]string{"X-Actor": "alice"}
+	if code, resp := e.do(http.MethodPut, "/api/v1/images/{image}/tags", body); code != http.StatusOK {
+		t.Fatalf("update tags = %d %s", code, resp)
+	}
+	// 没有 X-Actor 头时记为 anonymous；失败的请求不记录
+	e.do(http.MethodPut, "/api/v1/images/{image}", jsonBody(map[string]string{"description": "changed"}))
+	e.do(http.MethodPut, "/api/v1/images/img_missing/tags", jsonBody(map[string]interface{}{"tags": []string{"sea"}}))
+
+	entries := e.store.AuditEntries()
+	if len(entries) != 2 {
+		t.Fatalf("audit entries = %+v, want 2", entries)
+	}
+	tags := entries[0]
+	if tags.Actor != "alice" || tags.Action != auditImageTags || tags.TargetType != "image" || tags.TargetID != "img_fixture" {
+		t.Errorf("tags entry = %+v", tags)
+	}
+	var before, after struct {
+		Tags []string `json:"tags"`
+	}
+	if err := json.Unmarshal(tags.Before, &before); err != nil {
+		t.Fatal(err)
+	}
+	if err := json.Unmarshal(tags.After, &after); err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(before.Tags, []string{"sky", "blue"}) || !reflect.DeepEqual(after.Tags, []string{"sea"}) {
+		t.Errorf("tags before %v after %v", before.Tags, after.Tags)
+	}
+	if desc := entries[1]; desc.Actor != anonymousActor || desc.Action != auditImageDescription {
+		t.Errorf("description entry = %+v", desc)
+	}
+
+	code, resp := e.do(http.MethodGet, "/api/v1/audit?actor=alice", nil)
+	if code != http.StatusOK || jsonField(t, resp, "data", "total") != float64(1) {
+		t.Errorf("audit?actor=alice = %d %s", code, resp)
+	}
+	if code, resp := e.do(http.MethodGet, "/api/v1/audit?since=yesterday", nil); code != http.StatusBadRequest {
+		t.Errorf("audit with an invalid since = %d %s, want 400", code, resp)
+	}
+}
+
+func TestConfigureAudit(t *testing.T) {
+	e := newTestEnv(t, false)
+	for _, tc := range []struct {
+		days int
+		want time.Duration
+	}{
+		{0, defaultAuditRetentionDays * 24 * time.Hour},
+		{7, 7 * 24 * time.Hour},
+		{-1, 0},
+	} {
+		e.h.ConfigureAudit(tc.days)
+		if e.h.auditRetention != tc.want {
+			t.Errorf("ConfigureAudit(%d) retention = %s, want %s", tc.days, e.h.auditRetention, tc.want)
+		}
+	}
+}
@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"mime/multipart"
+	"net/http"
+	"reflect"
+	"testing"
+)
+
+// batchResult 批量上传响应中单个文件的结果
+type batchResult struct {
+	Filename    string   `json:"filename"`
+	Status      string   `json:"status"`
+	ImageID     string   `json:"image_id"`
+	Description string   `json:"description"`
+	Tags        []string `json:"tags"`
+	TagError    string   `json:"tag_error"`
+}
+
+// batchUpload 按顺序上传 n 个文件，返回与文件一一对应的结果
+func batchUpload(t *testing.T, e *testEnv, n int, fields map[string]string) []batchResult {
+	t.Helper()
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for k, v := range fields {
+		mw.WriteField(k, v)
+	}
+	for i := 0; i < n; i++ {
+		fw, err := mw.CreateFormFile("files", fmt.Sprintf("f%d.png", i))
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(testPNG(100 + i))
+	}
+	mw.Close()
+
+	code, body := e.do(http.MethodPost, "/api/v1/images/batch-upload", &requestBody{content: buf.Bytes(), contentType: mw.FormDataContentType()})
+	if code != http.StatusOK {
+		t.Fatalf("batch upload = %d %s", code, body)
+	}
+	var resp struct {
+		Data struct {
+			Results []batchResult `json:"results"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(body), &resp); err != nil {
+		t.Fatal(err)
+	}
+	if len(resp.Data.Results) != n {
+		t.Fatalf("results = %d, want %d", len(resp.Data.Results), n)
+	}
+	return resp.Data.Results
+}
+
+// 并发处理时结果顺序与文件顺序一致，每个文件使用 manifest 中对应的描述和标签
+func TestBatchUploadManifestMetadata(t *testing.T) {
+	e := newTestEnv(t, true)
+	const n = 8
+	manifest := make([]batchFileMeta, n)
+	for i := range manifest {
+		// 倒序写 manifest，按 filename 对应
+		j := n - 1 - i
+		manifest[i] = batchFileMeta{Filename: fmt.Sprintf("f%d.png", j), Tags: []string{fmt.Sprintf("tag%d", j)}}
+		if j%2 == 0 {
+			manifest[i].Description = fmt.Sprintf("desc %d", j)
+		}
+	}
+	data, _ := json.Marshal(manifest)
+
+	results := batchUpload(t, e, n, map[string]string{"manifest": string(data), "auto_tag": "true"})
+	for i, result := range results {
+		if result.Filename != fmt.Sprintf("f%d.png", i) || result.Status != "success" {
+			t.Fatalf("result %d = %+v", i, result)
+		}
+		// 没有描述的文件使用生成的描述；标签为 manifest 标签加生成的标签
+		wantDesc := "a generated description"
+		if i%2 == 0 {
+			wantDesc = fmt.Sprintf("desc %d", i)
+		}
+		wantTags := []string{fmt.Sprintf("tag%d", i), "sky", "sea"}
+		if result.Description != wantDesc || !reflect.DeepEqual(result.Tags, wantTags) {
+			t.Errorf("result %d = %+v, want description %q tags %v", i, result, wantDesc, wantTags)
+		}
+		pic, err := e.store.GetPicture(result.ImageID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		tags, _ := e.store.GetPictureTags(result.ImageID)
+		if pic.Description != wantDesc || len(tags) != len(wantTags) {
+			t.Errorf("stored %s: description %q tags %v", result.ImageID, pic.Description, tags)
+		}
+	}
+	if calls := len(e.tagger.Calls()); calls != n {
+		t.Errorf("tagger calls = %d, want %d", calls, n)
+	}
+}
+
+// 自动打标签失败时图片仍上传成功，manifest 中的标签照常保存
+func TestBatchUploadAutoTagError(t *testing.T) {
+	e := newTestEnv(t, true)
+	e.tagger.Err = errors.New("llm unavailable")
+
+	results := batchUpload(t, e, 2, map[string]string{"manifest": `[{"tags":["first"]},{"tags":["second"]}]`, "auto_tag": "true"})
+	for i, result := range results {
+		if result.Status != "success" || result.TagError == "" {
+			t.Errorf("result %d = %+v, want success with tag_error", i, result)
+		}
+		tags, _ := e.store.GetPictureTags(result.ImageID)
+		if len(tags) != 1 {
+			t.Errorf("tags of %s = %v", result.ImageID, tags)
+		}
+	}
+}
@@ -0,0 +1,287 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/vaaandark/PixelHub/internal/database"
+)
+
+const (
+	// eventBufferSize 事件总线保留的最近事件数，断线重连时只能从这些事件中续传
+	eventBufferSize = 1000
+	// eventSubscriberBuffer 每个订阅者的待发送事件数，写满（客户端太慢）时断开连接，由客户端重连续传
+	eventSubscriberBuffer = 64
+	// eventHeartbeatInterval 没有事件时发送注释行的间隔，防止代理关闭空闲连接
+	eventHeartbeatInterval = 25 * time.Second
+	// eventRetryMillis 建议客户端断线后的重连间隔
+	eventRetryMillis = 3000
+)
+
+// libraryEventTypes 写操作产生的事件（与审计日志的 action 相同），Webhook 和事件流共用
+var libraryEventTypes = map[string]bool{
+	auditImageUpload:      true,
+	auditImageDelete:      true,
+	auditImageTags:        true,
+	auditImageDescription: true,
+	auditImageGenerate:    true,
+	auditImageReplace:     true,
+	auditImageRollback:    true,
+	auditAlbumCreate:      true,
+	auditAlbumUpdate:      true,
+	auditAlbumDelete:      true,
+	auditAlbumAddItems:    true,
+	auditAlbumRemoveItems: true,
+	auditAlbumReorder:     true,
+	auditShareCreate:      true,
+	auditShareRevoke:      true,
+	auditWebhookCreate:    true,
+	auditWebhookUpdate:    true,
+	auditWebhookDelete:    true,
+}
+
+// libraryEvent 图库的一次修改，推送给事件流和 Webhook
+type libraryEvent struct {
+	ID         string          `json:"id"`
+	Type       string          `json:"type"`
+	CreatedAt  time.Time       `json:"created_at"`
+	Actor      string          `json:"actor"`
+	TargetType string          `json:"target_type,omitempty"`
+	TargetID   string          `json:"target_id,omitempty"`
+	Before     json.RawMessage `json:"before,omitempty"`
+	After      json.RawMessage `json:"after,omitempty"`
+}
+
+// eventFromAudit 审计日志记录对应的事件
+func eventFromAudit(entry *database.AuditEntry) *libraryEvent {
+	return &libraryEvent{
+		ID:         "evt_" + uuid.New().String(),
+		Type:       entry.Action,
+		CreatedAt:  entry.CreatedAt.UTC().Truncate(time.Second),
+		Actor:      entry.Actor,
+		TargetType: entry.TargetType,
+		TargetID:   entry.TargetID,
+		Before:     entry.Before,
+		After:      entry.After,
+	}
+}
+
+// publishEvent 把写操作产生的事件推送给事件流订阅者和 Webhook
+func (h *Handler) publishEvent(event *libraryEvent) {
+	h.events.publish(event)
+	if err := h.enqueueWebhookEvent(event, nil); err != nil {
+		log.Printf("Warning: Failed to queue webhooks for %s %s: %v", event.Type, event.TargetID, err)
+	}
+}
+
+// bufferedEvent 事件总线中的事件，seq 在进程内递增
+type bufferedEvent struct {
+	seq   uint64
+	event *libraryEvent
+	data  []byte
+}
+
+// eventSubscriber 事件流的一个连接
+type eventSubscriber struct {
+	ch    chan bufferedEvent
+	match func(*libraryEvent) bool
+}
+
+// eventBus 进程内的事件总线：保存最近的事件（环形缓冲区）并推送给订阅者
+// 事件 ID 为 "<epoch>-<seq>"，epoch 每次启动不同，重启后旧 ID 视为无法续传
+type eventBus struct {
+	mu    sync.Mutex
+	epoch string
+	seq   uint64
+	ring  []bufferedEvent
+	next  int // ring 中下一个写入位置
+	full  bool
+	subs  map[*eventSubscriber]struct{}
+}
+
+func newEventBus(size int) *eventBus {
+	return &eventBus{
+		epoch: strconv.FormatInt(time.Now().UnixNano(), 36),
+		ring:  make([]bufferedEvent, size),
+		subs:  make(map[*eventSubscriber]struct{}),
+	}
+}
+
+// eventID 事件流中的事件 ID
+func (b *eventBus) eventID(seq uint64) string {
+	return fmt.Sprintf("%s-%d", b.epoch, seq)
+}
+
+// parseEventID 解析客户端的 Last-Event-ID，不是本次启动产生的 ID 时返回 false
+func (b *eventBus) parseEventID(id string) (uint64, bool) {
+	epoch, seq, ok := strings.Cut(id, "-")
+	if !ok || epoch != b.epoch {
+		return 0, false
+	}
+	n, err := strconv.ParseUint(seq, 10, 64)
+	if err != nil || n > b.seq {
+		return 0, false
+	}
+	return n, true
+}
+
+// publish 追加事件并推送给匹配的订阅者，不会阻塞：订阅者的缓冲区已满时断开该订阅者
+func (b *eventBus) publish(event *libraryEvent) {
+	data, err := json.Marshal(event)
+	if err != nil {
+		log.Printf("Warning: Failed to encode event %s: %v", event.Type, err)
+		return
+	}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	b.seq++
+	e := bufferedEvent{seq: b.seq, event: event, data: data}
+	b.ring[b.next] = e
+	b.next = (b.next + 1) % len(b.ring)
+	if b.next == 0 {
+		b.full = true
+	}
+
+	for sub := range b.subs {
+		if !sub.match(event) {
+			continue
+		}
+		select {
+		case sub.ch <- e:
+		default:
+			delete(b.subs, sub)
+			close(sub.ch)
+		}
+	}
+}
+
+// buffered 按顺序返回缓冲区中的事件（调用时持有锁）
+func (b *eventBus) buffered() []bufferedEvent {
+	if !b.full {
+		return b.ring[:b.next]
+	}
+	return append(append([]bufferedEvent{}, b.ring[b.next:]...), b.ring[:b.next]...)
+}
+
+// subscribe 注册订阅者。resume 为 true 时返回 after 之后缓冲区中匹配的事件；
+// 这些事件已经被挤出缓冲区（或 ID 无效）时 complete 为 false，客户端需要重新加载数据
+func (b *eventBus) subscribe(match func(*libraryEvent) bool, lastEventID string) (sub *eventSubscriber, backlog []bufferedEvent, complete bool, latest uint64) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	sub = &eventSubscriber{ch: make(chan bufferedEvent, eventSubscriberBuffer), match: match}
+	b.subs[sub] = struct{}{}
+	if lastEventID == "" {
+		return sub, nil, true, b.seq
+	}
+
+	after, ok := b.parseEventID(lastEventID)
+	if !ok {
+		return sub, nil, false, b.seq
+	}
+	events := b.buffered()
+	if len(events) > 0 && events[0].seq > after+1 {
+		return sub, nil, false, b.seq
+	}
+	for _, e := range events {
+		if e.seq > after && match(e.event) {
+			backlog = append(backlog, e)
+		}
+	}
+	return sub, backlog, true, b.seq
+}
+
+// unsubscribe 移除订阅者（已因缓冲区写满被移除时不做任何事）
+func (b *eventBus) unsubscribe(sub *eventSubscriber) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subs[sub]; ok {
+		delete(b.subs, sub)
+		close(sub.ch)
+	}
+}
+
+// StreamEvents 以 Server-Sent Events 推送图库的修改，支持按事件类型和目标过滤，断线后用 Last-Event-ID 续传
+// GET /api/v1/events?types=&target_type=&target_id=&last_event_id=
+func (h *Handler) StreamEvents(c *gin.Context) {
+	var patterns []string
+	if types := c.Query("types"); types != "" {
+		var err error
+		if patterns, err = normalizeEventPatterns(strings.Split(types, ",")); err != nil {
+			c.JSON(http.StatusBadRequest, Response{
+				Code:    400,
+				Message: fmt.Sprintf("Invalid types: %v", err),
+			})
+			return
+		}
+	}
+	targetType := c.Query("target_type")
+	targetID := c.Query("target_id")
+	match := func(e *libraryEvent) bool {
+		return (patterns == nil || database.MatchEvent(patterns, e.Type)) &&
+			(targetType == "" || e.TargetType == targetType) &&
+			(targetID == "" || e.TargetID == targetID)
+	}
+
+	// 浏览器重连时通过 Last-Event-ID 头续传；首次连接无法设置请求头，可以用查询参数
+	lastEventID := c.GetHeader("Last-Event-ID")
+	if lastEventID == "" {
+		lastEventID = c.Query("last_event_id")
+	}
+
+	sub, backlog, complete, latest := h.events.subscribe(match, lastEventID)
+	defer h.events.unsubscribe(sub)
+
+	w := c.Writer
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(w, "retry: %d\n\n", eventRetryMillis)
+	if !complete {
+		// 无法续传：通知客户端重新加载，并给出新的续传位置
+		fmt.Fprintf(w, "id: %s\nevent: resync\ndata: {}\n\n", h.events.eventID(latest))
+	}
+	for _, e := range backlog {
+		writeSSEEvent(w, h.events.eventID(e.seq), e.data)
+	}
+	w.Flush()
+
+	heartbeat := time.NewTicker(eventHeartbeatInterval)
+	defer heartbeat.Stop()
+	ctx := c.Request.Context()
+	for {
+		select {
+		case e, ok := <-sub.ch:
+			if !ok {
+				return // 客户端跟不上，断开后由客户端重连续传
+			}
+			if _, err := writeSSEEvent(w, h.events.eventID(e.seq), e.data); err != nil {
+				return
+			}
+		case <-heartbeat.C:
+			if _, err := fmt.Fprint(w, ": keepalive\n\n"); err != nil {
+				return
+			}
+		case <-ctx.Done():
+			return
+		}
+		w.Flush()
+	}
+}
+
+// writeSSEEvent 写入一个事件（JSON 不含换行，一行 data 即可）
+func writeSSEEvent(w gin.ResponseWriter, id string, data []byte) (int, error) {
+	return fmt.Fprintf(w, "id: %s\ndata: %s\n\n", id, data)
+}
@@ -0,0 +1,91 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+	"testing"
+	"time"
+)
+
+// stream 请求事件流，在短时间后断开并返回收到的内容
+func (e *testEnv) stream(path string, headers map[string]string) string {
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	var body *requestBody
+	if headers != nil {
+		body = &requestBody{headers: headers}
+	}
+	w := e.request(ctx, http.MethodGet, path, body)
+	if w.Code != http.StatusOK {
+		e.t.Fatalf("GET %s = %d: %s", path, w.Code, w.Body.String())
+	}
+	return w.Body.String()
+}
+
+func TestStreamEventsResume(t *testing.T) {
+	e := newTestEnv(t, false)
+	start := e.h.events.eventID(0)
+	if code, resp := e.do(http.MethodPut, "/api/v1/images/{image}/tags", jsonBody(map[string]interface{}{"tags": []string{"sea"}})); code != http.StatusOK {
+		t.Fatalf("update tags = %d %s", code, resp)
+	}
+
+	out := e.stream("/api/v1/events?last_event_id="+start, nil)
+	if !strings.Contains(out, "id: "+e.h.events.eventID(1)+"\n") || !strings.Contains(out, `"type":"image.tags.update"`) {
+		t.Errorf("resumed stream missing the tags event:\n%s", out)
+	}
+	if strings.Contains(out, "event: resync") {
+		t.Errorf("resumed stream asked for a resync:\n%s", out)
+	}
+
+	// Last-Event-ID 头优先于查询参数；已经看到最新事件时没有积压
+	out = e.stream("/api/v1/events?last_event_id="+start, map[string]string{"Last-Event-ID": e.h.events.eventID(1)})
+	if strings.Contains(out, "data: {\"id\"") {
+		t.Errorf("stream after the latest event replayed events:\n%s", out)
+	}
+
+	// 过滤条件同样作用于积压的事件
+	out = e.stream("/api/v1/events?types=album.&last_event_id="+start, nil)
+	if strings.Contains(out, auditImageTags) {
+		t.Errorf("album stream replayed an image event:\n%s", out)
+	}
+
+	// 其他进程（重启前）的 ID 无法续传
+	out = e.stream("/api/v1/events", map[string]string{"Last-Event-ID": "stale-1"})
+	if !strings.Contains(out, "event: resync") || !strings.Contains(out, "id: "+e.h.events.eventID(1)+"\n") {
+		t.Errorf("stale Last-Event-ID did not resync to the latest event:\n%s", out)
+	}
+}
+
+func TestEventBusOverflow(t *testing.T) {
+	b := newEventBus(2)
+	all := func(*libraryEvent) bool { return true }
+	for _, typ := range []string{auditImageUpload, auditImageTags, auditImageDelete} {
+		b.publish(&libraryEvent{Type: typ})
+	}
+
+	// 第 1 个事件已被挤出缓冲区，从 0 续传会丢事件
+	sub, backlog, complete, latest := b.subscribe(all, b.eventID(0))
+	if complete || backlog != nil || latest != 3 {
+		t.Errorf("subscribe(0) = %v %v %d, want incomplete at 3", backlog, complete, latest)
+	}
+	b.unsubscribe(sub)
+
+	sub, backlog, complete, _ = b.subscribe(all, b.eventID(1))
+	if !complete || len(backlog) != 2 || backlog[0].event.Type != auditImageTags || backlog[1].event.Type != auditImageDelete {
+		t.Errorf("subscribe(1) = %+v %v, want tags and delete", backlog, complete)
+	}
+
+	// 订阅者的缓冲区写满时被断开，而不是阻塞发布者
+	for i := 0; i <= eventSubscriberBuffer; i++ {
+		b.publish(&libraryEvent{Type: auditImageTags})
+	}
+	n := 0
+	for range sub.ch {
+		n++
+	}
+	if n != eventSubscriberBuffer {
+		t.Errorf("slow subscriber received %d events before being dropped, want %d", n, eventSubscriberBuffer)
+	}
+	b.unsubscribe(sub)
+}
@@ -0,0 +1,254 @@
+package handlers
+
+import (
+	"archive/zip"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vaaandark/PixelHub/internal/database"
+)
+
+// exportPageSize 导出时每次从数据库读取的图片数量
+const exportPageSize = 100
+
+// exportRecord 导出清单中的一张图片
+type exportRecord struct {
+	ID          string    `json:"id"`
+	File        string    `json:"file,omitempty"` // 归档内的路径，读取原图失败时为空
+	Hash        string    `json:"hash"`
+	Description string    `json:"description"`
+	Tags        []string  `json:"tags"`
+	UploadDate  time.Time `json:"upload_date"`
+	Width       int       `json:"width,omitempty"`
+	Height      int       `json:"height,omitempty"`
+	MIMEType    string    `json:"mime_type,omitempty"`
+	Error       string    `json:"error,omitempty"`
+	// Versions 被替换前的历史版本（从新到旧）
+	Versions []exportVersion `json:"versions,omitempty"`
+}
+
+// exportVersion 导出清单中图片的一个历史版本
+type exportVersion struct {
+	Version    int       `json:"version"`
+	File       string    `json:"file,omitempty"`
+	Hash       string    `json:"hash"`
+	Width      int       `json:"width,omitempty"`
+	Height     int       `json:"height,omitempty"`
+	MIMEType   string    `json:"mime_type,omitempty"`
+	CreatedAt  time.Time `json:"created_at"`
+	ArchivedAt time.Time `json:"archived_at"`
+	Error      string    `json:"error,omitempty"`
+}
+
+// ExportImages 导出图片
+// GET /api/v1/export?tags=a,b&format=zip，支持与列表接口相同的过滤参数
+func (h *Handler) ExportImages(c *gin.Context) {
+	if format := c.DefaultQuery("format", "zip"); format != "zip" {
+		c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "Unsupported export format",
+		})
+		return
+	}
+
+	filter, err := parsePictureFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	filename := "pixelhub-export-" + time.Now().UTC().Format("20060102-150405") + ".zip"
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", `attachment; filename="`+filename+`"`)
+	c.Status(http.StatusOK)
+
+	// 响应头已经发出，出错时只能中断连接，客户端会得到不完整的归档
+	if _, err := h.WriteExport(c.Writer, parseTagList(c.Query("tags")), filter); err != nil {
+		log.Printf("Export failed: %v", err)
+		c.Abort()
+	}
+}
+
+// parseTagList 解析逗号分隔的标签列表，忽略空白项
+func parseTagList(s string) []string {
+	var tags []string
+	for _, tag := range strings.Split(s, ",") {
+		if tag = strings.TrimSpace(tag); tag != "" {
+			tags = append(tags, tag)
+		}
+	}
+	return tags
+}
+
+// WriteExport 将包含全部 tags（为空表示不限）且满足 filter 的图片写成 zip 流，返回导出的图片数量
+// 原图位于 images/ 下，末尾附带 manifest.json 和 manifest.csv；逐页查询、逐个读取原图，不在内存中缓存归档
+func (h *Handler) WriteExport(w io.Writer, tags []string, filter database.PictureFilter) (int, error) {
+	zw := zip.NewWriter(w)
+	var records []exportRecord
+
+	var cursor *database.Cursor
+	for {
+		var pics []database.PictureWithTags
+		var err error
+		if len(tags) > 0 {
+			pics, _, err = h.store.SearchExact(tags, filter, 1, exportPageSize, cursor)
+		} else {
+			pics, _, err = h.store.ListPictures(filter, 1, exportPageSize, "date_desc", cursor)
+		}
+		if err != nil {
+			return len(records), fmt.Errorf("failed to query images: %w", err)
+		}
+
+		for _, pic := range pics {
+			record, err := h.exportPicture(zw, pic)
+			if err != nil {
+				return len(records), err
+			}
+			records = append(records, record)
+		}
+
+		if len(pics) < exportPageSize {
+			break
+		}
+		cursor = database.PictureCursor(pics[len(pics)-1], "date_desc")
+	}
+
+	if err := writeExportManifests(zw, tags, records); err != nil {
+		return len(records), err
+	}
+	return len(records), zw.Close()
+}
+
+// exportPicture 把一张原图及其历史版本写入归档；存储中读取失败时只在清单中记录错误，不中断导出
+func (h *Handler) exportPicture(zw *zip.Writer, pic database.PictureWithTags) (exportRecord, error) {
+	record := exportRecord{
+		ID:          pic.ID,
+		Hash:        pic.Hash,
+		Description: pic.Description,
+		Tags:        pic.Tags,
+		UploadDate:  pic.UploadDate,
+		Width:       pic.Width,
+		Height:      pic.Height,
+		MIMEType:    pic.MIMEType,
+	}
+	if record.Tags == nil {
+		record.Tags = []string{}
+	}
+
+	name := "images/" + pic.ID + path.Ext(pic.StorageKey)
+	if err := h.exportFile(zw, pic.StorageKey, name, pic.UploadDate); err != nil {
+		if !isExportReadError(err) {
+			return record, fmt.Errorf("failed to export %s: %w", pic.ID, err)
+		}
+		record.Error = err.Error()
+	} else {
+		record.File = name
+	}
+
+	versions, err := h.store.ListPictureVersions(pic.ID)
+	if err != nil {
+		return record, fmt.Errorf("failed to list versions of %s: %w", pic.ID, err)
+	}
+	for _, v := range versions {
+		ev := exportVersion{
+			Version:    v.Version,
+			Hash:       v.Hash,
+			Width:      v.Width,
+			Height:     v.Height,
+			MIMEType:   v.MIMEType,
+			CreatedAt:  v.CreatedAt,
+			ArchivedAt: v.ArchivedAt,
+		}
+		name := fmt.Sprintf("images/%s.v%d%s", pic.ID, v.Version, path.Ext(v.StorageKey))
+		if err := h.exportFile(zw, v.StorageKey, name, v.CreatedAt); err != nil {
+			if !isExportReadError(err) {
+				return record, fmt.Errorf("failed to export %s version %d: %w", pic.ID, v.Version, err)
+			}
+			ev.Error = err.Error()
+		} else {
+			ev.File = name
+		}
+		record.Versions = append(record.Versions, ev)
+	}
+	return record, nil
+}
+
+// exportReadError 从存储读取文件失败，只记录在清单中，不中断导出
+type exportReadError struct{ err error }
+
+func (e *exportReadError) Error() string { return e.err.Error() }
+
+func isExportReadError(err error) bool {
+	_, ok := err.(*exportReadError)
+	return ok
+}
+
+// exportFile 把存储中的一个文件写入归档的 name；读取存储失败时返回 *exportReadError
+func (h *Handler) exportFile(zw *zip.Writer, storageKey, name string, modified time.Time) error {
+	rc, err := h.storage.Get(storageKey)
+	if err != nil {
+		log.Printf("Warning: failed to read %s for export: %v", storageKey, err)
+		return &exportReadError{err}
+	}
+	defer rc.Close()
+
+	// 图片本身已经压缩，直接存储
+	fw, err := zw.CreateHeader(&zip.FileHeader{Name: name, Method: zip.Store, Modified: modified})
+	if err != nil {
+		return err
+	}
+	_, err = io.Copy(fw, rc)
+	return err
+}
+
+func writeExportManifests(zw *zip.Writer, tags []string, records []exportRecord) error {
+	if tags == nil {
+		tags = []string{}
+	}
+	if records == nil {
+		records = []exportRecord{}
+	}
+
+	now := time.Now().UTC()
+	fw, err := zw.CreateHeader(&zip.FileHeader{Name: "manifest.json", Method: zip.Deflate, Modified: now})
+	if err != nil {
+		return err
+	}
+	encoder := json.NewEncoder(fw)
+	encoder.SetIndent("", "  ")
+	if err := encoder.Encode(map[string]interface{}{
+		"exported_at": now,
+		"tags":        tags,
+		"count":       len(records),
+		"images":      records,
+	}); err != nil {
+		return err
+	}
+
+	fw, err = zw.CreateHeader(&zip.FileHeader{Name: "manifest.csv", Method: zip.Deflate, Modified: now})
+	if err != nil {
+		return err
+	}
+	cw := csv.NewWriter(fw)
+	cw.Write([]string{"id", "file", "hash", "description", "tags", "upload_date", "width", "height", "mime_type", "error"})
+	for _, r := range records {
+		cw.Write([]string{
+			r.ID, r.File, r.Hash, r.Description, strings.Join(r.Tags, ";"), r.UploadDate.UTC().Format(time.RFC3339),
+			strconv.Itoa(r.Width), strconv.Itoa(r.Height), r.MIMEType, r.Error,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"path"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/vaaandark/PixelHub/internal/database"
+)
+
+// exportArchive 解析后的导出归档
+type exportArchive struct {
+	files    map[string][]byte
+	manifest []exportRecord
+	csv      [][]string
+}
+
+func readExport(t *testing.T, data []byte) exportArchive {
+	t.Helper()
+	zr, err := zip.NewReader(bytes.NewReader(data), int64(len(data)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	a := exportArchive{files: make(map[string][]byte)}
+	for _, f := range zr.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		content, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, dup := a.files[f.Name]; dup {
+			t.Errorf("archive has %s twice", f.Name)
+		}
+		a.files[f.Name] = content
+	}
+
+	var manifest struct {
+		Count  int            `json:"count"`
+		Images []exportRecord `json:"images"`
+	}
+	if err := json.Unmarshal(a.files["manifest.json"], &manifest); err != nil {
+		t.Fatalf("manifest.json: %v", err)
+	}
+	if manifest.Count != len(manifest.Images) {
+		t.Errorf("manifest count = %d, images = %d", manifest.Count, len(manifest.Images))
+	}
+	a.manifest = manifest.Images
+	if a.csv, err = csv.NewReader(bytes.NewReader(a.files["manifest.csv"])).ReadAll(); err != nil {
+		t.Fatalf("manifest.csv: %v", err)
+	}
+	return a
+}
+
+// seedExportPictures 写入 n 张图片：i%3==0 带 sky 标签，偶数为 JPEG、奇数为 PNG
+// 上传时间相同，分页只能依靠游标中的 ID 区分
+func seedExportPictures(t *testing.T, e *testEnv, n int) map[string][]byte {
+	t.Helper()
+	contents := make(map[string][]byte)
+	for i := 0; i < n; i++ {
+		id := fmt.Sprintf("img_export_%03d", i)
+		mimeType, ext := "image/png", ".png"
+		if i%2 == 0 {
+			mimeType, ext = "image/jpeg", ".jpg"
+		}
+		content := []byte(fmt.Sprintf("content of %s", id))
+		key, _, err := e.storage.Upload(id+ext, bytes.NewReader(content), int64(len(content)), mimeType)
+		if err != nil {
+			t.Fatal(err)
+		}
+		must(t, e.store.CreatePicture(&database.Picture{ID: id, StorageKey: key, Hash: sha256Hex(content), Description: "export " + id, MIMEType: mimeType}))
+		tags := []string{fmt.Sprintf("group-%d", i%4)}
+		if i%3 == 0 {
+			tags = append(tags, "sky")
+		}
+		must(t, e.store.SetPictureTags(id, tags))
+		contents[id] = content
+	}
+	return contents
+}
+
+func TestWriteExportArchiveContents(t *testing.T) {
+	e := newTestEnv(t, false)
+	// 超过两页，覆盖游标翻页
+	contents := seedExportPictures(t, e, 2*exportPageSize+30)
+	fixture, _ := e.storage.Object("img_fixture.png")
+	contents["img_fixture"] = fixture
+
+	tests := []struct {
+		name   string
+		tags   []string
+		filter database.PictureFilter
+		want   func(id string) bool
+	}{
+		{name: "all", want: func(string) bool { return true }},
+		{name: "tag", tags: []string{"sky"}, want: func(id string) bool { return id == "img_fixture" || exportIndex(id)%3 == 0 }},
+		{name: "filter", filter: database.PictureFilter{MIMETypes: []string{"image/jpeg"}}, want: func(id string) bool { return id != "img_fixture" && exportIndex(id)%2 == 0 }},
+		{name: "tag and filter", tags: []string{"sky", "group-2"}, filter: database.PictureFilter{MIMETypes: []string{"image/jpeg"}}, want: func(id string) bool {
+			i := exportIndex(id)
+			return id != "img_fixture" && i%3 == 0 && i%4 == 2
+		}},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			var want []string
+			for id := range contents {
+				if tc.want(id) {
+					want = append(want, id)
+				}
+			}
+			sort.Strings(want)
+
+			var buf bytes.Buffer
+			n, err := e.h.WriteExport(&buf, tc.tags, tc.filter)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if n != len(want) {
+				t.Errorf("exported %d images, want %d", n, len(want))
+			}
+			a := readExport(t, buf.Bytes())
+
+			// 清单中的图片恰好是满足条件的集合，且不重复
+			var got []string
+			for _, r := range a.manifest {
+				got = append(got, r.ID)
+				pic, err := e.store.GetPicture(r.ID)
+				if err != nil {
+					t.Fatal(err)
+				}
+				tags, _ := e.store.GetPictureTags(r.ID)
+				sort.Strings(tags)
+				recordTags := append([]string{}, r.Tags...)
+				sort.Strings(recordTags)
+				if r.File != "images/"+r.ID+path.Ext(pic.StorageKey) || r.Hash != pic.Hash || r.Description != pic.Description || strings.Join(recordTags, ",") != strings.Join(tags, ",") {
+					t.Errorf("record %+v does not match picture %+v with tags %v", r, pic, tags)
+				}
+				if !bytes.Equal(a.files[r.File], contents[r.ID]) {
+					t.Errorf("%s in archive does not match the stored object", r.File)
+				}
+			}
+			sort.Strings(got)
+			if strings.Join(got, ",") != strings.Join(want, ",") {
+				t.Errorf("manifest ids = %v, want %v", got, want)
+			}
+			// 归档中只有这些图片和两份清单
+			if len(a.files) != len(want)+2 {
+				t.Errorf("archive has %d files, want %d images and 2 manifests", len(a.files), len(want))
+			}
+
+			if len(a.csv) != len(want)+1 || strings.Join(a.csv[0][:2], ",") != "id,file" {
+				t.Fatalf("manifest.csv has %d rows, want a header and %d rows", len(a.csv), len(want))
+			}
+			for i, row := range a.csv[1:] {
+				r := a.manifest[i]
+				if row[0] != r.ID || row[1] != r.File || row[2] != r.Hash || row[4] != strings.Join(r.Tags, ";") {
+					t.Errorf("csv row %v does not match manifest record %+v", row, r)
+				}
+			}
+		})
+	}
+}
+
+// exportIndex seedExportPictures 中图片的序号
+func exportIndex(id string) int {
+	var i int
+	fmt.Sscanf(id, "img_export_%d", &i)
+	return i
+}
+
+// 读取原图失败时只在清单中记录错误，其余图片照常导出
+func TestWriteExportRecordsMissingFiles(t *testing.T) {
+	e := newTestEnv(t, false)
+	must(t, e.store.CreatePicture(&database.Picture{ID: "img_lost", StorageKey: "img_lost.png", Hash: "lost"}))
+
+	var buf bytes.Buffer
+	n, err := e.h.WriteExport(&buf, nil, database.PictureFilter{})
+	if err != nil || n != 2 {
+		t.Fatalf("WriteExport = %d, %v", n, err)
+	}
+	a := readExport(t, buf.Bytes())
+	for _, r := range a.manifest {
+		switch r.ID {
+		case "img_lost":
+			if r.File != "" || r.Error == "" {
+				t.Errorf("missing file record = %+v, want an error and no file", r)
+			}
+		case "img_fixture":
+			if r.File == "" || a.files[r.File] == nil {
+				t.Errorf("fixture record = %+v, want its file in the archive", r)
+			}
+		}
+	}
+	if _, ok := a.files["images/img_lost.png"]; ok {
+		t.Error("archive contains an entry for the missing file")
+	}
+}
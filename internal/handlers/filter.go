@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vaaandark/PixelHub/internal/database"
+)
+
+// parsePictureFilter 从查询参数解析图片过滤条件（列表和搜索接口共用）
+func parsePictureFilter(c *gin.Context) (database.PictureFilter, error) {
+	var f database.PictureFilter
+	var err error
+
+	if f.UploadedAfter, err = parseTimeParam(c, "uploaded_after"); err != nil {
+		return f, err
+	}
+	if f.UploadedBefore, err = parseTimeParam(c, "uploaded_before"); err != nil {
+		return f, err
+	}
+
+	for _, p := range []struct {
+		name string
+		dest *int
+	}{
+		{"min_width", &f.MinWidth},
+		{"max_width", &f.MaxWidth},
+		{"min_height", &f.MinHeight},
+		{"max_height", &f.MaxHeight},
+	} {
+		v := c.Query(p.name)
+		if v == "" {
+			continue
+		}
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return f, fmt.Errorf("invalid %s parameter", p.name)
+		}
+		*p.dest = n
+	}
+
+	if v := c.Query("mime_type"); v != "" {
+		for _, m := range strings.Split(v, ",") {
+			if m = strings.TrimSpace(m); m != "" {
+				f.MIMETypes = append(f.MIMETypes, m)
+			}
+		}
+	}
+
+	if v := c.Query("untagged"); v != "" {
+		untagged, err := strconv.ParseBool(v)
+		if err != nil {
+			return f, errors.New("invalid untagged parameter")
+		}
+		f.Untagged = untagged
+	}
+
+	if v := c.Query("has_description"); v != "" {
+		hasDescription, err := strconv.ParseBool(v)
+		if err != nil {
+			return f, errors.New("invalid has_description parameter")
+		}
+		f.HasDescription = &hasDescription
+	}
+
+	if v := c.Query("tag_count"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			return f, errors.New("invalid tag_count parameter")
+		}
+		f.TagCount = &n
+	}
+
+	return f, nil
+}
+
+// parseTimeParam 解析时间参数，支持 RFC 3339 和 YYYY-MM-DD 两种格式
+func parseTimeParam(c *gin.Context, name string) (*time.Time, error) {
+	v := c.Query(name)
+	if v == "" {
+		return nil, nil
+	}
+	for _, layout := range []string{time.RFC3339, "2006-01-02"} {
+		if t, err := time.Parse(layout, v); err == nil {
+			return &t, nil
+		}
+	}
+	return nil, fmt.Errorf("invalid %s parameter, expected RFC 3339 or YYYY-MM-DD", name)
+}
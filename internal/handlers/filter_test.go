@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// queryContext 只带查询参数的请求上下文
+func queryContext(query string) *gin.Context {
+	c, _ := gin.CreateTestContext(httptest.NewRecorder())
+	c.Request = httptest.NewRequest("GET", "/api/v1/images?"+query, nil)
+	return c
+}
+
+func TestParsePictureFilter(t *testing.T) {
+	f, err := parsePictureFilter(queryContext("uploaded_after=2024-01-01&uploaded_before=2024-02-01T08:00:00%2B08:00" +
+		"&min_width=100&max_width=2000&min_height=50&max_height=1000&mime_type=image/png,+image/jpeg,&untagged=true&has_description=false&tag_count=0"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if f.UploadedAfter == nil || !f.UploadedAfter.Equal(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("UploadedAfter = %v", f.UploadedAfter)
+	}
+	if f.UploadedBefore == nil || !f.UploadedBefore.Equal(time.Date(2024, 2, 1, 0, 0, 0, 0, time.UTC)) {
+		t.Errorf("UploadedBefore = %v", f.UploadedBefore)
+	}
+	if f.MinWidth != 100 || f.MaxWidth != 2000 || f.MinHeight != 50 || f.MaxHeight != 1000 {
+		t.Errorf("size = %d-%d x %d-%d", f.MinWidth, f.MaxWidth, f.MinHeight, f.MaxHeight)
+	}
+	if len(f.MIMETypes) != 2 || f.MIMETypes[0] != "image/png" || f.MIMETypes[1] != "image/jpeg" {
+		t.Errorf("MIMETypes = %q", f.MIMETypes)
+	}
+	if !f.Untagged || f.HasDescription == nil || *f.HasDescription || f.TagCount == nil || *f.TagCount != 0 {
+		t.Errorf("filter = %+v", f)
+	}
+
+	// 未指定的条件保持零值
+	if f, err := parsePictureFilter(queryContext("")); err != nil || f.UploadedAfter != nil || f.HasDescription != nil || f.TagCount != nil || f.MIMETypes != nil {
+		t.Errorf("empty filter = %+v, %v", f, err)
+	}
+}
+
+func TestParsePictureFilterErrors(t *testing.T) {
+	tests := map[string]string{
+		"min_width=-1":             "invalid min_width parameter",
+		"max_height=abc":           "invalid max_height parameter",
+		"untagged=maybe":           "invalid untagged parameter",
+		"has_description=2":        "invalid has_description parameter",
+		"tag_count=-3":             "invalid tag_count parameter",
+		"uploaded_after=yesterday": "invalid uploaded_after parameter, expected RFC 3339 or YYYY-MM-DD",
+	}
+	for query, want := range tests {
+		if _, err := parsePictureFilter(queryContext(query)); err == nil || err.Error() != want {
+			t.Errorf("parsePictureFilter(%q) err = %v, want %q", query, err, want)
+		}
+	}
+}
@@ -1,35 +1,101 @@
 package handlers
 
 import (
+	"bytes"
+	"context"
 	"crypto/sha256"
 	"database/sql"
 	"encoding/hex"
+	"encoding/json"
+	"errors"
 	"fmt"
 	"io"
+	"log"
 	"mime/multipart"
 	"net/http"
+	"net/url"
 	"path/filepath"
 	"strconv"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/gin-gonic/gin"
 	"github.com/google/uuid"
+	"github.com/vaaandark/PixelHub/internal/config"
 	"github.com/vaaandark/PixelHub/internal/database"
+	"github.com/vaaandark/PixelHub/internal/imagemeta"
 	"github.com/vaaandark/PixelHub/internal/llm"
 	"github.com/vaaandark/PixelHub/internal/storage"
 )
 
+const (
+	// defaultBatchWorkers 批量上传默认并发处理的文件数
+	defaultBatchWorkers = 4
+	// defaultRawMaxSize 请求体直接为图片内容的上传默认大小上限
+	defaultRawMaxSize = 100 << 20
+	// defaultHashMaxPixels 上传时计算感知哈希的像素数上限（约 100 MB 解码内存），更大的图片由启动时的补算任务计算
+	defaultHashMaxPixels = 25_000_000
+	// defaultBackfillMaxPixels 后台补算感知哈希的像素数上限（约 400 MB 解码内存）
+	defaultBackfillMaxPixels = 100_000_000
+)
+
 type Handler struct {
-	db           *sql.DB
+	store        database.Store
 	storage      storage.Provider
 	tagGenerator llm.TagGenerator
+
+	// 私有存储模式下用于生成签名 URL，为 nil 时直接返回存储的 URL
+	urlSigner    storage.URLSigner
+	signedURLTTL time.Duration
+
+	// 通过 URL 上传时下载远程图片
+	fetcher *remoteFetcher
+	// 可续传分片上传的临时文件
+	chunks *chunkStore
+	// 批量上传时并发处理的文件数
+	batchWorkers int
+	// 请求体直接为图片内容的上传大小上限
+	rawMaxSize int64
+	// 上传时和后台补算时计算感知哈希的像素数上限
+	hashMaxPixels  int
+	backfillPixels int
+	// 幂等键的保留时间
+	idempotencyTTL time.Duration
+	// 审计日志的保留时间，0 表示永久保留
+	auditRetention time.Duration
+	// Webhook 事件投递
+	webhooks *webhookDispatcher
+	// 事件流（GET /events）的进程内事件总线
+	events *eventBus
+	// 分享链接密码错误次数
+	sharePasswords *failureLimiter
+
+	// replacing 正在替换文件的图片 ID，同一张图片同时只允许一个替换
+	replaceMu sync.Mutex
+	replacing map[string]bool
 }
 
-func NewHandler(db *sql.DB, storageProvider storage.Provider, tagGenerator llm.TagGenerator) *Handler {
+func NewHandler(store database.Store, storageProvider storage.Provider, tagGenerator llm.TagGenerator) *Handler {
+	// 默认配置（零值）不会解析失败
+	fetcher, _ := newRemoteFetcher(config.UploadConfig{})
+	webhooks, _ := newWebhookDispatcher(config.WebhookConfig{})
 	return &Handler{
-		db:           db,
-		storage:      storageProvider,
-		tagGenerator: tagGenerator,
+		store:          store,
+		storage:        storageProvider,
+		tagGenerator:   tagGenerator,
+		fetcher:        fetcher,
+		chunks:         newChunkStore(config.UploadConfig{}),
+		batchWorkers:   defaultBatchWorkers,
+		rawMaxSize:     defaultRawMaxSize,
+		hashMaxPixels:  defaultHashMaxPixels,
+		backfillPixels: defaultBackfillMaxPixels,
+		idempotencyTTL: defaultIdempotencyTTL,
+		auditRetention: defaultAuditRetentionDays * 24 * time.Hour,
+		webhooks:       webhooks,
+		events:         newEventBus(eventBufferSize),
+		sharePasswords: newFailureLimiter(sharePasswordWindow),
+		replacing:      make(map[string]bool),
 	}
 }
 
@@ -41,7 +107,7 @@ type Response struct {
 }
 
 // uploadSingleImage 上传单个图片的核心逻辑（辅助函数）
-func (h *Handler) uploadSingleImage(file *multipart.FileHeader, description string) (map[string]interface{}, error) {
+func (h *Handler) uploadSingleImage(file *multipart.FileHeader, description string) (*database.Picture, error) {
 	// 打开文件
 	src, err := file.Open()
 	if err != nil {
@@ -49,60 +115,95 @@ func (h *Handler) uploadSingleImage(file *multipart.FileHeader, description stri
 	}
 	defer src.Close()
 
-	// 计算文件哈希
-	hasher := sha256.New()
 	fileContent, err := io.ReadAll(src)
 	if err != nil {
 		return nil, fmt.Errorf("failed to read file: %v", err)
 	}
-	hasher.Write(fileContent)
-	hash := hex.EncodeToString(hasher.Sum(nil))
+
+	return h.saveImage(file.Filename, fileContent, file.Header.Get("Content-Type"), description, "")
+}
+
+// saveImage 计算哈希和元数据、上传到存储并写入数据库（上传接口和导入命令共用）
+// sourceURL 为通过 URL 上传时的原始地址，其他情况为空
+func (h *Handler) saveImage(filename string, fileContent []byte, contentType, description, sourceURL string) (*database.Picture, error) {
+	return h.saveImageFrom(filename, bytes.NewReader(fileContent), contentType, description, sourceURL, "")
+}
+
+// saveImageFrom 与 saveImage 相同，但从 content 流式读取（分片上传合并后的临时文件），上传到存储的同时计算 SHA-256
+// wantHash 非空时校验内容的 SHA-256，不一致时删除已上传的文件并返回 errFileChecksum
+func (h *Handler) saveImageFrom(filename string, content io.ReadSeeker, contentType, description, sourceURL, wantHash string) (*database.Picture, error) {
+	// 提取尺寸、MIME 类型和感知哈希（用于过滤和相似图片查找）
+	// 超大图片不在请求中解码，感知哈希留空（NULL）由后台补算，避免分片上传的大文件占用大量内存
+	meta := imagemeta.ExtractLimit(content, h.hashMaxPixels)
+	size, err := content.Seek(0, io.SeekEnd)
+	if err == nil {
+		_, err = content.Seek(0, io.SeekStart)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read image content: %v", err)
+	}
 
 	// 生成唯一 ID（使用 UUID）
 	imageID := "img_" + uuid.New().String()
 
 	// 生成存储 key
-	ext := filepath.Ext(file.Filename)
+	ext := filepath.Ext(filename)
 	storageKey := imageID + ext
 
 	// 上传到存储
-	contentType := file.Header.Get("Content-Type")
+	if contentType == "" {
+		contentType = meta.MIMEType
+	}
 	if contentType == "" {
 		contentType = "application/octet-stream"
 	}
 
-	// 重新创建 reader
-	reader := strings.NewReader(string(fileContent))
-	storageKey, url, err := h.storage.Upload(storageKey, reader, contentType)
+	// 访问地址在读取时由 storage_key 推导，不保存上传时的 URL
+	// 内容长度单独传给存储提供商（COS 据此设置 Content-Length）
+	hasher := sha256.New()
+	storageKey, _, err = h.storage.Upload(storageKey, io.TeeReader(content, hasher), size, contentType)
 	if err != nil {
 		return nil, fmt.Errorf("failed to upload to storage: %v", err)
 	}
+	hash := hex.EncodeToString(hasher.Sum(nil))
+	if wantHash != "" && !strings.EqualFold(hash, wantHash) {
+		h.storage.Delete(storageKey)
+		return nil, errFileChecksum
+	}
 
 	// 保存到数据库
 	pic := &database.Picture{
-		ID:          imageID,
-		URL:         url,
-		StorageKey:  storageKey,
-		Hash:        hash,
-		Description: description,
+		ID:            imageID,
+		StorageKey:    storageKey,
+		Hash:          hash,
+		Description:   description,
+		PHash:         meta.PHash,
+		PHashDeferred: meta.PHashSkipped,
+		Width:         meta.Width,
+		Height:        meta.Height,
+		MIMEType:      meta.MIMEType,
+		SourceURL:     sourceURL,
+		Version:       1,
 	}
 
-	if err := database.CreatePicture(h.db, pic); err != nil {
+	if err := h.store.CreatePicture(pic); err != nil {
 		// 如果数据库保存失败，尝试删除已上传的文件
 		h.storage.Delete(storageKey)
 		return nil, fmt.Errorf("failed to save to database: %v", err)
 	}
 
-	return map[string]interface{}{
-		"image_id":    imageID,
-		"url":         url,
-		"hash":        hash,
-		"description": description,
-	}, nil
+	return pic, nil
 }
 
 // UploadImage 上传图片
+// 支持 multipart 表单（file 字段），也支持请求体直接为图片内容（文件名放在 X-Filename 头中），
+// 后者便于浏览器用 XHR 逐个上传并显示每个文件的进度
 func (h *Handler) UploadImage(c *gin.Context) {
+	if c.ContentType() != "multipart/form-data" {
+		h.uploadRawImage(c)
+		return
+	}
+
 	file, err := c.FormFile("file")
 	if err != nil {
 		c.JSON(http.StatusBadRequest, Response{
@@ -115,7 +216,7 @@ func (h *Handler) UploadImage(c *gin.Context) {
 	// 获取可选的描述信息
 	description := c.PostForm("description")
 
-	result, err := h.uploadSingleImage(file, description)
+	pic, err := h.uploadSingleImage(file, description)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, Response{
 			Code:    500,
@@ -123,15 +224,190 @@ func (h *Handler) UploadImage(c *gin.Context) {
 		})
 		return
 	}
+	h.audit(c, auditImageUpload, "image", pic.ID, nil, imageAuditState(pic, nil))
 
 	c.JSON(http.StatusCreated, Response{
 		Code:    201,
 		Message: "Upload successful",
-		Data:    result,
+		Data: map[string]interface{}{
+			"image_id":    pic.ID,
+			"url":         h.pictureURL(pic),
+			"hash":        pic.Hash,
+			"description": description,
+			"filename":    file.Filename,
+			"size":        file.Size,
+		},
+	})
+}
+
+// uploadRawImage 请求体为图片内容的上传
+// X-Filename 和 X-Description 为 URL 编码（encodeURIComponent）后的文件名和描述，描述也可以通过 description 查询参数传递
+func (h *Handler) uploadRawImage(c *gin.Context) {
+	filename, err := url.PathUnescape(c.GetHeader("X-Filename"))
+	if err != nil || filename == "" {
+		c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "X-Filename header is required for raw uploads",
+		})
+		return
+	}
+	description := c.Query("description")
+	if header := c.GetHeader("X-Description"); header != "" {
+		if description, err = url.PathUnescape(header); err != nil {
+			c.JSON(http.StatusBadRequest, Response{
+				Code:    400,
+				Message: "Invalid X-Description header",
+			})
+			return
+		}
+	}
+
+	content, err := io.ReadAll(http.MaxBytesReader(c.Writer, c.Request.Body, h.rawMaxSize))
+	if err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			c.JSON(http.StatusRequestEntityTooLarge, Response{
+				Code:    413,
+				Message: fmt.Sprintf("File exceeds %d bytes", h.rawMaxSize),
+			})
+			return
+		}
+		c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: fmt.Sprintf("Failed to read request body: %v", err),
+		})
+		return
+	}
+	if len(content) == 0 {
+		c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "No file uploaded",
+		})
+		return
+	}
+
+	// application/octet-stream 等非图片类型交给 saveImage 按内容识别
+	contentType := c.ContentType()
+	if !isRasterImageType(contentType) {
+		contentType = ""
+	}
+	pic, err := h.saveImage(filepath.Base(filename), content, contentType, description, "")
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: err.Error(),
+		})
+		return
+	}
+	h.audit(c, auditImageUpload, "image", pic.ID, nil, imageAuditState(pic, nil))
+
+	c.JSON(http.StatusCreated, Response{
+		Code:    201,
+		Message: "Upload successful",
+		Data: map[string]interface{}{
+			"image_id":    pic.ID,
+			"url":         h.pictureURL(pic),
+			"hash":        pic.Hash,
+			"description": pic.Description,
+			"filename":    filepath.Base(filename),
+			"size":        len(content),
+		},
 	})
 }
 
+// batchFileMeta 批量上传时单个文件的描述和标签
+type batchFileMeta struct {
+	Filename    string   `json:"filename"`
+	Description string   `json:"description"`
+	Tags        []string `json:"tags"`
+}
+
+// parseBatchMetadata 读取每个文件的描述和标签，返回与 files 一一对应的列表
+// 两种方式二选一：按顺序对应文件的 descriptions[] / tags[] 表单字段（标签逗号分隔），
+// 或 manifest 字段/文件中的 JSON 数组（按 filename 对应，没有 filename 的条目按顺序对应）
+func parseBatchMetadata(form *multipart.Form, files []*multipart.FileHeader) ([]batchFileMeta, error) {
+	metas := make([]batchFileMeta, len(files))
+	descriptions := formValues(form, "descriptions")
+	tagLists := formValues(form, "tags")
+	manifest, err := readBatchManifest(form)
+	if err != nil {
+		return nil, err
+	}
+	if manifest != nil && (descriptions != nil || tagLists != nil) {
+		return nil, fmt.Errorf("use either manifest or descriptions[]/tags[], not both")
+	}
+
+	if descriptions != nil && len(descriptions) != len(files) {
+		return nil, fmt.Errorf("descriptions[] must have one entry per file")
+	}
+	if tagLists != nil && len(tagLists) != len(files) {
+		return nil, fmt.Errorf("tags[] must have one entry per file")
+	}
+	for i := range files {
+		if descriptions != nil {
+			metas[i].Description = descriptions[i]
+		}
+		if tagLists != nil {
+			metas[i].Tags = parseTagList(tagLists[i])
+		}
+	}
+
+	if manifest != nil {
+		byName := make(map[string]batchFileMeta)
+		for i, entry := range manifest {
+			if entry.Filename != "" {
+				byName[entry.Filename] = entry
+			} else if i < len(files) {
+				metas[i] = entry
+			}
+		}
+		for i, file := range files {
+			if entry, ok := byName[file.Filename]; ok {
+				metas[i] = entry
+			}
+		}
+	}
+	return metas, nil
+}
+
+// formValues 读取 name[] 或 name 表单字段，都不存在时返回 nil
+func formValues(form *multipart.Form, name string) []string {
+	if values, ok := form.Value[name+"[]"]; ok {
+		return values
+	}
+	if values, ok := form.Value[name]; ok {
+		return values
+	}
+	return nil
+}
+
+// readBatchManifest 读取 manifest 表单字段或同名文件，不存在时返回 nil
+func readBatchManifest(form *multipart.Form) ([]batchFileMeta, error) {
+	var data []byte
+	if values := form.Value["manifest"]; len(values) > 0 {
+		data = []byte(values[0])
+	} else if files := form.File["manifest"]; len(files) > 0 {
+		f, err := files[0].Open()
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		if data, err = io.ReadAll(f); err != nil {
+			return nil, err
+		}
+	} else {
+		return nil, nil
+	}
+
+	manifest := []batchFileMeta{}
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return nil, fmt.Errorf("invalid manifest: %v", err)
+	}
+	return manifest, nil
+}
+
 // BatchUploadImages 批量上传图片
+// 文件由 [upload].batch_workers 个 worker 并发处理，结果按文件顺序返回
 func (h *Handler) BatchUploadImages(c *gin.Context) {
 	// 获取 multipart form
 	form, err := c.MultipartForm()
@@ -153,41 +429,111 @@ func (h *Handler) BatchUploadImages(c *gin.Context) {
 		return
 	}
 
+	metas, err := parseBatchMetadata(form, files)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	// auto_tag：上传后调用 LLM 生成标签（描述为空时同时使用生成的描述）
+	autoTag, _ := strconv.ParseBool(c.PostForm("auto_tag"))
+	if autoTag && h.tagGenerator == nil {
+		c.JSON(http.StatusServiceUnavailable, Response{
+			Code:    503,
+			Message: "LLM service not configured",
+		})
+		return
+	}
+
 	// 批量上传结果
 	type UploadResult struct {
-		Filename string `json:"filename"`
-		Status   string `json:"status"`
-		ImageID  string `json:"image_id,omitempty"`
-		URL      string `json:"url,omitempty"`
-		Hash     string `json:"hash,omitempty"`
-		Error    string `json:"error,omitempty"`
+		Filename    string   `json:"filename"`
+		Status      string   `json:"status"`
+		ImageID     string   `json:"image_id,omitempty"`
+		URL         string   `json:"url,omitempty"`
+		Hash        string   `json:"hash,omitempty"`
+		Description string   `json:"description,omitempty"`
+		Tags        []string `json:"tags,omitempty"`
+		TagError    string   `json:"tag_error,omitempty"` // 自动打标签失败的原因（图片已上传成功）
+		Error       string   `json:"error,omitempty"`
 	}
 
-	results := make([]UploadResult, 0, len(files))
-	successCount := 0
-	failedCount := 0
+	results := make([]UploadResult, len(files))
+	ctx := c.Request.Context()
 
-	// 逐个处理文件
-	for _, file := range files {
+	uploadOne := func(i int) {
+		file, meta := files[i], metas[i]
 		result := UploadResult{
 			Filename: file.Filename,
 		}
+		defer func() { results[i] = result }()
 
-		// 上传文件（不带 description）
-		data, err := h.uploadSingleImage(file, "")
+		pic, err := h.uploadSingleImage(file, meta.Description)
 		if err != nil {
 			result.Status = "failed"
 			result.Error = err.Error()
-			failedCount++
-		} else {
-			result.Status = "success"
-			result.ImageID = data["image_id"].(string)
-			result.URL = data["url"].(string)
-			result.Hash = data["hash"].(string)
-			successCount++
+			return
+		}
+		result.Status = "success"
+		result.ImageID = pic.ID
+		result.URL = h.pictureURL(pic)
+		result.Hash = pic.Hash
+		result.Description = meta.Description
+		defer func() {
+			pic.Description = result.Description
+			h.audit(c, auditImageUpload, "image", pic.ID, nil, imageAuditState(pic, result.Tags))
+		}()
+
+		tags := meta.Tags
+		if autoTag {
+			generated, err := h.generateImageInfo(ctx, pic, "")
+			if err != nil {
+				result.TagError = err.Error()
+			} else {
+				tags = append(tags, generated.Tags...)
+				if result.Description == "" && generated.Description != "" {
+					if err := h.store.UpdatePictureDescription(result.ImageID, generated.Description); err != nil {
+						result.TagError = err.Error()
+					} else {
+						result.Description = generated.Description
+					}
+				}
+			}
+		}
+		if len(tags) > 0 {
+			if err := h.store.AppendPictureTags(result.ImageID, tags); err != nil {
+				result.TagError = err.Error()
+				return
+			}
+			result.Tags = tags
 		}
+	}
 
-		results = append(results, result)
+	jobs := make(chan int)
+	var wg sync.WaitGroup
+	for w := 0; w < h.batchWorkers && w < len(files); w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for i := range jobs {
+				uploadOne(i)
+			}
+		}()
+	}
+	for i := range files {
+		jobs <- i
+	}
+	close(jobs)
+	wg.Wait()
+
+	successCount := 0
+	for _, result := range results {
+		if result.Status == "success" {
+			successCount++
+		}
 	}
 
 	c.JSON(http.StatusOK, Response{
@@ -196,7 +542,7 @@ func (h *Handler) BatchUploadImages(c *gin.Context) {
 		Data: map[string]interface{}{
 			"total":   len(files),
 			"success": successCount,
-			"failed":  failedCount,
+			"failed":  len(files) - successCount,
 			"results": results,
 		},
 	})
@@ -207,7 +553,7 @@ func (h *Handler) DeleteImage(c *gin.Context) {
 	imageID := c.Param("image_id")
 
 	// 获取图片信息
-	pic, err := database.GetPicture(h.db, imageID)
+	pic, err := h.store.GetPicture(imageID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, Response{
@@ -223,20 +569,24 @@ func (h *Handler) DeleteImage(c *gin.Context) {
 		return
 	}
 
+	tags, _ := h.store.GetPictureTags(imageID)
+
 	// 软删除数据库记录
-	if err := database.DeletePicture(h.db, imageID); err != nil {
+	if err := h.store.DeletePicture(imageID); err != nil {
 		c.JSON(http.StatusInternalServerError, Response{
 			Code:    500,
 			Message: "Failed to delete image",
 		})
 		return
 	}
+	h.audit(c, auditImageDelete, "image", imageID, imageAuditState(pic, tags), nil)
 
 	// 从存储删除文件（可选，根据需求决定是否立即删除）
 	if err := h.storage.Delete(pic.StorageKey); err != nil {
 		// 记录错误但不返回失败，因为数据库已经标记为删除
-		fmt.Printf("Warning: Failed to delete file from storage: %v\n", err)
+		log.Printf("Warning: Failed to delete file %s from storage: %v", pic.StorageKey, err)
 	}
+	h.deleteVersionFiles(imageID)
 
 	c.JSON(http.StatusOK, Response{
 		Code:    200,
@@ -285,7 +635,7 @@ func (h *Handler) BatchDeleteImages(c *gin.Context) {
 		}
 
 		// 获取图片信息
-		pic, err := database.GetPicture(h.db, imageID)
+		pic, err := h.store.GetPicture(imageID)
 		if err != nil {
 			result.Status = "failed"
 			result.Error = "Image not found"
@@ -294,17 +644,23 @@ func (h *Handler) BatchDeleteImages(c *gin.Context) {
 			continue
 		}
 
+		tags, _ := h.store.GetPictureTags(imageID)
+
 		// 删除图片（软删除）
-		if err := database.DeletePicture(h.db, imageID); err != nil {
+		if err := h.store.DeletePicture(imageID); err != nil {
 			result.Status = "failed"
 			result.Error = fmt.Sprintf("Failed to delete from database: %v", err)
 			failedCount++
 			results = append(results, result)
 			continue
 		}
+		h.audit(c, auditImageDelete, "image", imageID, imageAuditState(pic, tags), nil)
 
-		// 从存储删除文件（不需要等待结果）
-		go h.storage.Delete(pic.StorageKey)
+		// 从存储删除文件和历史版本（不需要等待结果）
+		go func(pic *database.Picture) {
+			h.storage.Delete(pic.StorageKey)
+			h.deleteVersionFiles(pic.ID)
+		}(pic)
 
 		result.Status = "success"
 		successCount++
@@ -341,8 +697,33 @@ func (h *Handler) ListImages(c *gin.Context) {
 		sort = "date_desc"
 	}
 
-	images, total, err := database.ListPictures(h.db, page, limit, sort)
+	filter, err := parsePictureFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	cursor, err := parseCursor(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "Invalid cursor",
+		})
+		return
+	}
+
+	images, total, err := h.store.ListPictures(filter, page, limit, sort, cursor)
 	if err != nil {
+		if errors.Is(err, database.ErrInvalidCursor) {
+			c.JSON(http.StatusBadRequest, Response{
+				Code:    400,
+				Message: "Invalid cursor",
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, Response{
 			Code:    500,
 			Message: "Failed to list images",
@@ -350,6 +731,8 @@ func (h *Handler) ListImages(c *gin.Context) {
 		return
 	}
 
+	h.resolvePictureURLs(images)
+
 	c.JSON(http.StatusOK, Response{
 		Code:    200,
 		Message: "Success",
@@ -357,6 +740,7 @@ func (h *Handler) ListImages(c *gin.Context) {
 			"total":        total,
 			"current_page": page,
 			"images":       images,
+			"next_cursor":  nextPictureCursor(images, limit, sort),
 		},
 	})
 }
@@ -365,7 +749,7 @@ func (h *Handler) ListImages(c *gin.Context) {
 func (h *Handler) GetImageDetail(c *gin.Context) {
 	imageID := c.Param("image_id")
 
-	pic, err := database.GetPicture(h.db, imageID)
+	pic, err := h.store.GetPicture(imageID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, Response{
@@ -382,7 +766,7 @@ func (h *Handler) GetImageDetail(c *gin.Context) {
 	}
 
 	// 获取标签
-	tags, err := database.GetPictureTags(h.db, imageID)
+	tags, err := h.store.GetPictureTags(imageID)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, Response{
 			Code:    500,
@@ -396,11 +780,14 @@ func (h *Handler) GetImageDetail(c *gin.Context) {
 		Message: "Success",
 		Data: map[string]interface{}{
 			"image_id":    pic.ID,
-			"url":         pic.URL,
+			"url":         h.pictureURL(pic),
 			"hash":        pic.Hash,
 			"description": pic.Description,
 			"upload_date": pic.UploadDate,
 			"tags":        tags,
+			"source_url":  pic.SourceURL,
+			"version":     pic.Version,
+			"revised_at":  pic.RevisedAt,
 		},
 	})
 }
@@ -428,7 +815,7 @@ func (h *Handler) UpdateImageTags(c *gin.Context) {
 	}
 
 	// 检查图片是否存在
-	_, err := database.GetPicture(h.db, imageID)
+	_, err := h.store.GetPicture(imageID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, Response{
@@ -444,11 +831,21 @@ func (h *Handler) UpdateImageTags(c *gin.Context) {
 		return
 	}
 
+	// 修改前的标签（用于审计日志）
+	oldTags, err := h.store.GetPictureTags(imageID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: "Failed to get tags",
+		})
+		return
+	}
+
 	// 更新标签
 	if req.Mode == "append" {
-		err = database.AppendPictureTags(h.db, imageID, req.Tags)
+		err = h.store.AppendPictureTags(imageID, req.Tags)
 	} else {
-		err = database.SetPictureTags(h.db, imageID, req.Tags)
+		err = h.store.SetPictureTags(imageID, req.Tags)
 	}
 
 	if err != nil {
@@ -459,12 +856,29 @@ func (h *Handler) UpdateImageTags(c *gin.Context) {
 		return
 	}
 
+	newTags, err := h.store.GetPictureTags(imageID)
+	if err != nil {
+		newTags = req.Tags
+	}
+	h.audit(c, auditImageTags, "image", imageID,
+		map[string]interface{}{"tags": oldTags},
+		map[string]interface{}{"tags": newTags, "mode": req.Mode})
+
 	c.JSON(http.StatusOK, Response{
 		Code:    200,
 		Message: "Tags updated successfully",
 	})
 }
 
+// generateImageInfo 调用 LLM 为图片生成描述和标签
+func (h *Handler) generateImageInfo(ctx context.Context, pic *database.Picture, prompt string) (*llm.ImageAnalysisResult, error) {
+	imageURL, err := h.llmImageURL(pic)
+	if err != nil {
+		return nil, err
+	}
+	return h.tagGenerator.GenerateImageInfo(ctx, imageURL, prompt)
+}
+
 // GenerateImageTags AI 生成图片标签
 func (h *Handler) GenerateImageTags(c *gin.Context) {
 	imageID := c.Param("image_id")
@@ -491,7 +905,7 @@ func (h *Handler) GenerateImageTags(c *gin.Context) {
 	}
 
 	// 检查图片是否存在
-	pic, err := database.GetPicture(h.db, imageID)
+	pic, err := h.store.GetPicture(imageID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, Response{
@@ -508,8 +922,22 @@ func (h *Handler) GenerateImageTags(c *gin.Context) {
 	}
 
 	// 调用 LLM 生成描述和标签
-	ctx := c.Request.Context()
-	result, err := h.tagGenerator.GenerateImageInfo(ctx, pic.URL, req.Prompt)
+	imageURL, err := h.llmImageURL(pic)
+	if err != nil {
+		if errors.Is(err, errImageTooLargeForLLM) {
+			c.JSON(http.StatusUnprocessableEntity, Response{
+				Code:    422,
+				Message: err.Error(),
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: "Failed to read image",
+		})
+		return
+	}
+	result, err := h.tagGenerator.GenerateImageInfo(c.Request.Context(), imageURL, req.Prompt)
 	if err != nil {
 		c.JSON(http.StatusServiceUnavailable, Response{
 			Code:    503,
@@ -518,6 +946,12 @@ func (h *Handler) GenerateImageTags(c *gin.Context) {
 		return
 	}
 
+	h.audit(c, auditImageGenerate, "image", imageID, nil, map[string]interface{}{
+		"prompt":                req.Prompt,
+		"generated_description": result.Description,
+		"generated_tags":        result.Tags,
+	})
+
 	c.JSON(http.StatusOK, Response{
 		Code:    200,
 		Message: "Image info generated successfully",
@@ -545,7 +979,7 @@ func (h *Handler) UpdateImageDescription(c *gin.Context) {
 	}
 
 	// 检查图片是否存在
-	_, err := database.GetPicture(h.db, imageID)
+	pic, err := h.store.GetPicture(imageID)
 	if err != nil {
 		if err == sql.ErrNoRows {
 			c.JSON(http.StatusNotFound, Response{
@@ -562,7 +996,7 @@ func (h *Handler) UpdateImageDescription(c *gin.Context) {
 	}
 
 	// 更新描述
-	err = database.UpdatePictureDescription(h.db, imageID, req.Description)
+	err = h.store.UpdatePictureDescription(imageID, req.Description)
 	if err != nil {
 		c.JSON(http.StatusInternalServerError, Response{
 			Code:    500,
@@ -571,6 +1005,10 @@ func (h *Handler) UpdateImageDescription(c *gin.Context) {
 		return
 	}
 
+	h.audit(c, auditImageDescription, "image", imageID,
+		map[string]interface{}{"description": pic.Description},
+		map[string]interface{}{"description": req.Description})
+
 	c.JSON(http.StatusOK, Response{
 		Code:    200,
 		Message: "Description updated successfully",
@@ -589,8 +1027,24 @@ func (h *Handler) ListTags(c *gin.Context) {
 		limit = 1000
 	}
 
-	tags, total, err := database.ListTags(h.db, page, limit)
+	cursor, err := parseCursor(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "Invalid cursor",
+		})
+		return
+	}
+
+	tags, total, err := h.store.ListTags(page, limit, cursor)
 	if err != nil {
+		if errors.Is(err, database.ErrInvalidCursor) {
+			c.JSON(http.StatusBadRequest, Response{
+				Code:    400,
+				Message: "Invalid cursor",
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, Response{
 			Code:    500,
 			Message: "Failed to list tags",
@@ -614,6 +1068,7 @@ func (h *Handler) ListTags(c *gin.Context) {
 			"total":        total,
 			"current_page": page,
 			"tags":         tagList,
+			"next_cursor":  nextTagCursor(tags, limit),
 		},
 	})
 }
@@ -640,8 +1095,33 @@ func (h *Handler) SearchExact(c *gin.Context) {
 		limit = 20
 	}
 
-	results, total, err := database.SearchExact(h.db, tags, page, limit)
+	filter, err := parsePictureFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	cursor, err := parseCursor(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "Invalid cursor",
+		})
+		return
+	}
+
+	results, total, err := h.store.SearchExact(tags, filter, page, limit, cursor)
 	if err != nil {
+		if errors.Is(err, database.ErrInvalidCursor) {
+			c.JSON(http.StatusBadRequest, Response{
+				Code:    400,
+				Message: "Invalid cursor",
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, Response{
 			Code:    500,
 			Message: "Search failed",
@@ -649,6 +1129,8 @@ func (h *Handler) SearchExact(c *gin.Context) {
 		return
 	}
 
+	h.resolvePictureURLs(results)
+
 	c.JSON(http.StatusOK, Response{
 		Code:    200,
 		Message: "Success",
@@ -656,6 +1138,7 @@ func (h *Handler) SearchExact(c *gin.Context) {
 			"total":        total,
 			"current_page": page,
 			"results":      results,
+			"next_cursor":  nextPictureCursor(results, limit, "date_desc"),
 		},
 	})
 }
@@ -682,8 +1165,33 @@ func (h *Handler) SearchRelevance(c *gin.Context) {
 		limit = 20
 	}
 
-	results, total, err := database.SearchRelevance(h.db, tags, page, limit)
+	filter, err := parsePictureFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	cursor, err := parseCursor(c)
 	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "Invalid cursor",
+		})
+		return
+	}
+
+	results, total, err := h.store.SearchRelevance(tags, filter, page, limit, cursor)
+	if err != nil {
+		if errors.Is(err, database.ErrInvalidCursor) {
+			c.JSON(http.StatusBadRequest, Response{
+				Code:    400,
+				Message: "Invalid cursor",
+			})
+			return
+		}
 		c.JSON(http.StatusInternalServerError, Response{
 			Code:    500,
 			Message: "Search failed",
@@ -691,6 +1199,61 @@ func (h *Handler) SearchRelevance(c *gin.Context) {
 		return
 	}
 
+	h.resolvePictureURLs(results)
+
+	c.JSON(http.StatusOK, Response{
+		Code:    200,
+		Message: "Success",
+		Data: map[string]interface{}{
+			"total":        total,
+			"current_page": page,
+			"results":      results,
+			"next_cursor":  nextPictureCursor(results, limit, "relevance"),
+		},
+	})
+}
+
+// SearchText 在描述和标签名中搜索文本（偏移分页）
+func (h *Handler) SearchText(c *gin.Context) {
+	query := strings.TrimSpace(c.Query("q"))
+	if query == "" {
+		c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "Query parameter q is required",
+		})
+		return
+	}
+
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	filter, err := parsePictureFilter(c)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	results, total, err := h.store.SearchText(query, filter, page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: "Search failed",
+		})
+		return
+	}
+
+	h.resolvePictureURLs(results)
+
 	c.JSON(http.StatusOK, Response{
 		Code:    200,
 		Message: "Success",
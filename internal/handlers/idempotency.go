@@ -0,0 +1,284 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vaaandark/PixelHub/internal/database"
+)
+
+const (
+	// defaultIdempotencyTTL 幂等键默认保留时间
+	defaultIdempotencyTTL = 24 * time.Hour
+	// idempotencyLockTimeout 处理中的幂等键超过这个时间仍未完成，视为服务中断遗留，允许重新处理
+	idempotencyLockTimeout  = 5 * time.Minute
+	maxIdempotencyKeyLength = 255
+	// idempotencySpoolMemory 请求体不超过这个大小时缓存在内存中，超过后写入临时文件
+	idempotencySpoolMemory = 1 << 20
+)
+
+// idempotencyWriter 在写出响应的同时保存一份副本
+type idempotencyWriter struct {
+	gin.ResponseWriter
+	body bytes.Buffer
+}
+
+func (w *idempotencyWriter) Write(b []byte) (int, error) {
+	w.body.Write(b)
+	return w.ResponseWriter.Write(b)
+}
+
+func (w *idempotencyWriter) WriteString(s string) (int, error) {
+	w.body.WriteString(s)
+	return w.ResponseWriter.WriteString(s)
+}
+
+// ConfigureIdempotency 设置幂等键的保留时间，ttl <= 0 时使用默认的 24 小时
+func (h *Handler) ConfigureIdempotency(ttl time.Duration) {
+	if ttl <= 0 {
+		ttl = defaultIdempotencyTTL
+	}
+	h.idempotencyTTL = ttl
+}
+
+// spooledBody 计算指纹时缓存的请求体，处理器之后再从头读取
+type spooledBody struct {
+	mem  bytes.Buffer
+	file *os.File
+}
+
+func (s *spooledBody) Write(p []byte) (int, error) {
+	if s.file == nil && s.mem.Len()+len(p) <= idempotencySpoolMemory {
+		return s.mem.Write(p)
+	}
+	if s.file == nil {
+		f, err := os.CreateTemp("", "pixelhub-idempotency-*")
+		if err != nil {
+			return 0, err
+		}
+		s.file = f
+		if _, err := f.Write(s.mem.Bytes()); err != nil {
+			return 0, err
+		}
+		s.mem.Reset()
+	}
+	return s.file.Write(p)
+}
+
+// reader 从头读取缓存的请求体
+func (s *spooledBody) reader() (io.Reader, error) {
+	if s.file == nil {
+		return bytes.NewReader(s.mem.Bytes()), nil
+	}
+	if _, err := s.file.Seek(0, io.SeekStart); err != nil {
+		return nil, err
+	}
+	return s.file, nil
+}
+
+// Close 删除临时文件
+func (s *spooledBody) Close() error {
+	if s.file == nil {
+		return nil
+	}
+	s.file.Close()
+	return os.Remove(s.file.Name())
+}
+
+// patternStripper 去掉写入内容中的 pattern 后转发给 w，跨两次写入的 pattern 同样会去掉，结果与 bytes.ReplaceAll 相同
+type patternStripper struct {
+	w       io.Writer
+	pattern []byte
+	pending []byte
+}
+
+func (s *patternStripper) Write(p []byte) (int, error) {
+	s.pending = append(s.pending, p...)
+	for {
+		i := bytes.Index(s.pending, s.pattern)
+		if i < 0 {
+			break
+		}
+		if _, err := s.w.Write(s.pending[:i]); err != nil {
+			return 0, err
+		}
+		s.pending = s.pending[i+len(s.pattern):]
+	}
+	// 末尾可能是 pattern 的前半部分，留到下一次写入
+	if n := len(s.pending) - (len(s.pattern) - 1); n > 0 {
+		if _, err := s.w.Write(s.pending[:n]); err != nil {
+			return 0, err
+		}
+		s.pending = append(s.pending[:0], s.pending[n:]...)
+	}
+	return len(p), nil
+}
+
+// flush 写出剩余的内容
+func (s *patternStripper) flush() error {
+	_, err := s.w.Write(s.pending)
+	s.pending = nil
+	return err
+}
+
+// requestFingerprint 读取请求体并同时写入 spool，返回方法、路径（含查询参数）和请求体的 SHA-256
+// multipart 请求体中的 boundary 每次重试都可能不同，计算前去掉
+func requestFingerprint(c *gin.Context, spool io.Writer) (string, error) {
+	hasher := sha256.New()
+	io.WriteString(hasher, c.Request.Method+" "+c.Request.URL.RequestURI()+"\n")
+
+	body := io.TeeReader(c.Request.Body, spool)
+	if _, params, err := mime.ParseMediaType(c.GetHeader("Content-Type")); err == nil && params["boundary"] != "" {
+		stripper := &patternStripper{w: hasher, pattern: []byte(params["boundary"])}
+		if _, err := io.Copy(stripper, body); err != nil {
+			return "", err
+		}
+		if err := stripper.flush(); err != nil {
+			return "", err
+		}
+	} else if _, err := io.Copy(hasher, body); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(hasher.Sum(nil)), nil
+}
+
+// Idempotency 处理 POST/PUT/DELETE 请求的 Idempotency-Key 头
+// 第一次请求正常处理并保存响应；之后带相同键和相同请求的重试直接返回保存的响应（带 Idempotent-Replayed 头），
+// 请求内容不同时返回 422，第一次请求仍在处理时返回 409。5xx 响应不保存，客户端可以用同一个键重试
+func (h *Handler) Idempotency(c *gin.Context) {
+	key := c.GetHeader("Idempotency-Key")
+	method := c.Request.Method
+	if key == "" || (method != http.MethodPost && method != http.MethodPut && method != http.MethodDelete) {
+		c.Next()
+		return
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		c.AbortWithStatusJSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "Idempotency-Key is too long",
+		})
+		return
+	}
+
+	// 请求体边读取边计算哈希，同时缓存下来（较大时写入临时文件）交给处理器
+	spool := &spooledBody{}
+	defer spool.Close()
+	fingerprint, err := requestFingerprint(c, spool)
+	if err != nil {
+		c.AbortWithStatusJSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "Failed to read request body",
+		})
+		return
+	}
+	body, err := spool.reader()
+	if err != nil {
+		log.Printf("Failed to rewind spooled request body: %v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: "Failed to process Idempotency-Key",
+		})
+		return
+	}
+	c.Request.Body = io.NopCloser(body)
+
+	now := time.Now()
+	record := &database.IdempotencyKey{
+		Key:         key,
+		Fingerprint: fingerprint,
+		CreatedAt:   now,
+		ExpiresAt:   now.Add(h.idempotencyTTL),
+	}
+	created, err := h.store.CreateIdempotencyKey(record)
+	if err == nil && !created {
+		var existing *database.IdempotencyKey
+		existing, err = h.store.GetIdempotencyKey(key)
+		switch {
+		case err == sql.ErrNoRows:
+			// 刚好被删除（过期清理或前一个请求失败），重新占用
+			created, err = h.store.CreateIdempotencyKey(record)
+		case err != nil:
+		case !now.Before(existing.ExpiresAt),
+			existing.StatusCode == 0 && now.Sub(existing.CreatedAt) > idempotencyLockTimeout:
+			// 已过期或处理中断的键视为不存在
+			if err = h.store.DeleteIdempotencyKey(key); err == nil {
+				created, err = h.store.CreateIdempotencyKey(record)
+			}
+		case existing.Fingerprint != fingerprint:
+			c.AbortWithStatusJSON(http.StatusUnprocessableEntity, Response{
+				Code:    422,
+				Message: "Idempotency-Key was already used for a different request",
+			})
+			return
+		case existing.StatusCode == 0:
+			c.AbortWithStatusJSON(http.StatusConflict, Response{
+				Code:    409,
+				Message: "A request with this Idempotency-Key is still being processed",
+			})
+			return
+		default:
+			c.Header("Idempotent-Replayed", "true")
+			c.Data(existing.StatusCode, existing.ContentType, existing.Body)
+			c.Abort()
+			return
+		}
+	}
+	if err != nil {
+		log.Printf("Failed to reserve idempotency key: %v", err)
+		c.AbortWithStatusJSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: "Failed to process Idempotency-Key",
+		})
+		return
+	}
+	if !created {
+		// 另一个重试请求同时重新占用了这个键
+		c.AbortWithStatusJSON(http.StatusConflict, Response{
+			Code:    409,
+			Message: "A request with this Idempotency-Key is still being processed",
+		})
+		return
+	}
+
+	writer := &idempotencyWriter{ResponseWriter: c.Writer}
+	c.Writer = writer
+	c.Next()
+
+	status := writer.Status()
+	if status >= http.StatusInternalServerError {
+		err = h.store.DeleteIdempotencyKey(key)
+	} else {
+		err = h.store.CompleteIdempotencyKey(key, status, writer.Header().Get("Content-Type"), writer.body.Bytes())
+	}
+	if err != nil {
+		log.Printf("Warning: Failed to save idempotency key %q: %v", key, err)
+	}
+}
+
+// CleanupIdempotencyKeys 定期删除过期的幂等键（在后台运行）
+func (h *Handler) CleanupIdempotencyKeys(ctx context.Context) {
+	ticker := time.NewTicker(time.Hour)
+	defer ticker.Stop()
+	for {
+		if n, err := h.store.DeleteExpiredIdempotencyKeys(time.Now()); err != nil {
+			log.Printf("Warning: Failed to clean up idempotency keys: %v", err)
+		} else if n > 0 {
+			log.Printf("Removed %d expired idempotency keys", n)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
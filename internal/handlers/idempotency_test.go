@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/iotest"
+
+	"github.com/gin-gonic/gin"
+)
+
+func TestPatternStripperMatchesReplaceAll(t *testing.T) {
+	cases := []struct{ input, pattern string }{
+		{"--abc\r\nbody--abc--", "abc"},
+		{"abcabcab", "abc"},
+		{"aaaa", "aa"},
+		{"no match here", "xyz"},
+		{"ab", "abc"},
+		{"", "abc"},
+	}
+	for _, tc := range cases {
+		// 逐字节写入，覆盖 pattern 跨两次写入的情况
+		var got bytes.Buffer
+		s := &patternStripper{w: &got, pattern: []byte(tc.pattern)}
+		if _, err := io.Copy(s, iotest.OneByteReader(strings.NewReader(tc.input))); err != nil {
+			t.Fatal(err)
+		}
+		if err := s.flush(); err != nil {
+			t.Fatal(err)
+		}
+		if want := strings.ReplaceAll(tc.input, tc.pattern, ""); got.String() != want {
+			t.Errorf("strip(%q, %q) = %q, want %q", tc.input, tc.pattern, got.String(), want)
+		}
+	}
+}
+
+func TestIdempotencyLargeBody(t *testing.T) {
+	// 超过内存缓存上限的请求体写入临时文件，处理器仍能读到完整内容
+	body := bytes.Repeat([]byte("0123456789abcdef"), idempotencySpoolMemory/16+1000)
+	e := newTestEnv(t, false)
+	var received int
+	r := gin.New()
+	r.POST("/echo", e.h.Idempotency, func(c *gin.Context) {
+		data, _ := io.ReadAll(c.Request.Body)
+		received = len(data)
+		if !bytes.Equal(data, body) {
+			c.Status(http.StatusBadRequest)
+			return
+		}
+		c.Status(http.StatusCreated)
+	})
+
+	send := func(content []byte) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodPost, "/echo", bytes.NewReader(content))
+		req.Header.Set("Idempotency-Key", "large-body")
+		w := httptest.NewRecorder()
+		r.ServeHTTP(w, req)
+		return w
+	}
+	if w := send(body); w.Code != http.StatusCreated {
+		t.Fatalf("first request = %d, handler read %d of %d bytes", w.Code, received, len(body))
+	}
+	if w := send(body); w.Code != http.StatusCreated || w.Header().Get("Idempotent-Replayed") != "true" {
+		t.Errorf("retry = %d, replayed %q", w.Code, w.Header().Get("Idempotent-Replayed"))
+	}
+	changed := append([]byte(nil), body...)
+	changed[len(changed)-1] = 'x'
+	if w := send(changed); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("different body = %d, want 422", w.Code)
+	}
+}
+
+func TestIdempotencyReplaysUpload(t *testing.T) {
+	e := newTestEnv(t, false)
+	before := len(e.storage.Keys())
+	upload := func(key string) (int, string, string) {
+		// 每次重新生成 multipart 请求体，boundary 不同但内容相同
+		body := multipartBody("file", map[string][]byte{"a.png": testPNG(7)}, map[string]string{"description": "retry"})
+		body.headers = map[string]string{"Idempotency-Key": key}
+		w := e.request(context.Background(), http.MethodPost, "/api/v1/images/upload", body)
+		return w.Code, w.Body.String(), w.Header().Get("Idempotent-Replayed")
+	}
+
+	code, first, _ := upload("upload-1")
+	if code != http.StatusCreated {
+		t.Fatalf("first upload = %d %s", code, first)
+	}
+	code, retry, replayed := upload("upload-1")
+	if code != http.StatusCreated || retry != first || replayed != "true" {
+		t.Errorf("retry = %d %s (replayed %q), want the first response", code, retry, replayed)
+	}
+	if n := len(e.storage.Keys()) - before; n != 1 {
+		t.Errorf("stored objects = %d, want 1", n)
+	}
+
+	// 不同的键正常处理
+	if code, body, replayed := upload("upload-2"); code != http.StatusCreated || replayed != "" || body == first {
+		t.Errorf("upload with a new key = %d %s (replayed %q)", code, body, replayed)
+	}
+}
@@ -0,0 +1,39 @@
+package handlers
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"mime"
+	"path/filepath"
+)
+
+// ImportImage 导入一张本地图片（pixelhub import 使用），与上传接口共用同一流程
+// 已存在内容相同（SHA-256 一致）的图片时不再上传，只把 tags 合并到已有图片上，返回其 ID 且 duplicate 为 true。
+// 合并是幂等的，因此保存图片后添加标签失败时重新导入即可补齐标签
+func (h *Handler) ImportImage(filename string, content []byte, description string, tags []string) (imageID string, duplicate bool, err error) {
+	sum := sha256.Sum256(content)
+	existing, err := h.store.GetPictureByHash(hex.EncodeToString(sum[:]))
+	if err == nil {
+		if len(tags) > 0 {
+			if err := h.store.AppendPictureTags(existing.ID, tags); err != nil {
+				return existing.ID, true, err
+			}
+		}
+		return existing.ID, true, nil
+	}
+	if err != sql.ErrNoRows {
+		return "", false, err
+	}
+
+	pic, err := h.saveImage(filename, content, mime.TypeByExtension(filepath.Ext(filename)), description, "")
+	if err != nil {
+		return "", false, err
+	}
+	if len(tags) > 0 {
+		if err := h.store.AppendPictureTags(pic.ID, tags); err != nil {
+			return pic.ID, false, err
+		}
+	}
+	return pic.ID, false, nil
+}
@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"errors"
+	"sort"
+	"strings"
+	"testing"
+
+	"github.com/vaaandark/PixelHub/internal/fakes"
+)
+
+// tagFailStore 第一次添加标签时失败，模拟图片已保存但标签未写入
+type tagFailStore struct {
+	*fakes.Store
+	failed bool
+}
+
+func (s *tagFailStore) AppendPictureTags(pictureID string, tagNames []string) error {
+	if !s.failed {
+		s.failed = true
+		return errors.New("database is locked")
+	}
+	return s.Store.AppendPictureTags(pictureID, tagNames)
+}
+
+func TestImportImageRetryAppliesTags(t *testing.T) {
+	store := &tagFailStore{Store: fakes.NewStore()}
+	h := NewHandler(store, fakes.NewStorage(), nil)
+	content := testPNG(5)
+
+	id, duplicate, err := h.ImportImage("a.png", content, "beach", []string{"holiday", "sea"})
+	if err == nil || duplicate || id == "" {
+		t.Fatalf("first import = %q, %v, %v; want a tag error after saving", id, duplicate, err)
+	}
+
+	// 重新导入时按哈希识别为重复，并补齐 sidecar 中的标签
+	for i := 0; i < 2; i++ {
+		again, duplicate, err := h.ImportImage("a.png", content, "beach", []string{"holiday", "sea"})
+		if err != nil || !duplicate || again != id {
+			t.Fatalf("re-import #%d = %q, %v, %v", i, again, duplicate, err)
+		}
+	}
+	tags, err := store.GetPictureTags(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(tags)
+	if got := strings.Join(tags, ","); got != "holiday,sea" {
+		t.Errorf("tags = %s, want holiday,sea", got)
+	}
+}
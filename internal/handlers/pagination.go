@@ -0,0 +1,31 @@
+package handlers
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/vaaandark/PixelHub/internal/database"
+)
+
+// parseCursor 解析 cursor 查询参数，未提供时返回 nil（使用 page 分页）
+func parseCursor(c *gin.Context) (*database.Cursor, error) {
+	v := c.Query("cursor")
+	if v == "" {
+		return nil, nil
+	}
+	return database.DecodeCursor(v)
+}
+
+// nextPictureCursor 生成下一页游标，不足一页时说明已到末尾，返回空字符串
+func nextPictureCursor(pics []database.PictureWithTags, limit int, sort string) string {
+	if len(pics) < limit || len(pics) == 0 {
+		return ""
+	}
+	return database.PictureCursor(pics[len(pics)-1], sort).Encode()
+}
+
+// nextTagCursor 生成标签列表的下一页游标
+func nextTagCursor(tags []database.Tag, limit int) string {
+	if len(tags) < limit || len(tags) == 0 {
+		return ""
+	}
+	return database.TagCursor(tags[len(tags)-1]).Encode()
+}
@@ -0,0 +1,34 @@
+package handlers
+
+import (
+	"testing"
+
+	"github.com/vaaandark/PixelHub/internal/database"
+)
+
+func TestNextCursor(t *testing.T) {
+	pics := []database.PictureWithTags{{Picture: database.Picture{ID: "img_1"}}, {Picture: database.Picture{ID: "img_2"}}}
+	if got := nextPictureCursor(pics, 3, "date_desc"); got != "" {
+		t.Errorf("cursor for a short page = %q, want none", got)
+	}
+	c, err := database.DecodeCursor(nextPictureCursor(pics, 2, "date_asc"))
+	if err != nil || c.ID != "img_2" || c.Sort != "date_asc" {
+		t.Errorf("next picture cursor = %+v, %v", c, err)
+	}
+
+	tags := []database.Tag{{ID: 1, Count: 5}, {ID: 7, Count: 3}}
+	if got := nextTagCursor(tags, 5); got != "" {
+		t.Errorf("tag cursor for a short page = %q, want none", got)
+	}
+	c, err = database.DecodeCursor(nextTagCursor(tags, 2))
+	if err != nil || c.TagID != 7 || c.Count != 3 || !c.IsTagCursor() {
+		t.Errorf("next tag cursor = %+v, %v", c, err)
+	}
+
+	if c, err := parseCursor(queryContext("")); c != nil || err != nil {
+		t.Errorf("parseCursor without cursor = %+v, %v", c, err)
+	}
+	if _, err := parseCursor(queryContext("cursor=bogus!")); err == nil {
+		t.Error("parseCursor accepted a malformed cursor")
+	}
+}
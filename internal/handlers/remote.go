@@ -0,0 +1,327 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net"
+	"net/http"
+	"net/url"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vaaandark/PixelHub/internal/config"
+)
+
+// 通过 URL 上传的默认限制
+const (
+	defaultRemoteMaxSize      = 20 << 20
+	defaultRemoteTimeout      = 30 * time.Second
+	defaultRemoteMaxRedirects = 3
+)
+
+// errBlockedAddress 目标地址属于内网或保留地址段且不在允许列表中
+var errBlockedAddress = errors.New("address is not allowed")
+
+// blockedNets net.IP 自带方法未覆盖的保留地址段
+var blockedNets = mustParseCIDRs(
+	"0.0.0.0/8",     // 本网络
+	"100.64.0.0/10", // 运营商级 NAT
+	"192.0.0.0/24",  // IETF 协议分配
+	"198.18.0.0/15", // 基准测试
+	"240.0.0.0/4",   // 保留
+)
+
+// extByMIME 远程图片的扩展名（决定 storage_key 的后缀）
+var extByMIME = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+	"image/webp": ".webp",
+	"image/bmp":  ".bmp",
+}
+
+// addressGuard 拒绝连接内网和保留地址（防止 SSRF），允许列表中的主机和网段除外
+// 检查在建立连接时针对实际解析出的 IP 进行，重定向和 DNS 重绑定同样受限
+type addressGuard struct {
+	allowHosts map[string]bool
+	allowNets  []*net.IPNet
+}
+
+// remoteFetcher 下载远程图片，默认拒绝连接内网和保留地址
+type remoteFetcher struct {
+	client  *http.Client
+	maxSize int64
+}
+
+// remoteImage 下载得到的图片
+type remoteImage struct {
+	data        []byte
+	contentType string
+	filename    string
+}
+
+// remoteFetchError 下载失败，status 为返回给客户端的状态码
+type remoteFetchError struct {
+	status  int
+	message string
+}
+
+func (e *remoteFetchError) Error() string { return e.message }
+
+// newAddressGuard 解析允许列表，条目可以是 CIDR、IP 或主机名
+func newAddressGuard(entries []string) (*addressGuard, error) {
+	g := &addressGuard{allowHosts: make(map[string]bool)}
+	for _, entry := range entries {
+		entry = strings.ToLower(strings.TrimSpace(entry))
+		if strings.Contains(entry, "/") {
+			_, ipNet, err := net.ParseCIDR(entry)
+			if err != nil {
+				return nil, fmt.Errorf("invalid allow list entry %q: %w", entry, err)
+			}
+			g.allowNets = append(g.allowNets, ipNet)
+		} else if ip := net.ParseIP(entry); ip != nil {
+			g.allowNets = append(g.allowNets, &net.IPNet{IP: ip, Mask: net.CIDRMask(len(ip)*8, len(ip)*8)})
+		} else if entry != "" {
+			g.allowHosts[entry] = true
+		}
+	}
+	return g, nil
+}
+
+// transport 只连接允许的地址的 HTTP Transport
+func (g *addressGuard) transport(responseHeaderTimeout time.Duration) *http.Transport {
+	dialer := &net.Dialer{Timeout: 10 * time.Second}
+	return &http.Transport{
+		// 不使用环境变量中的代理，否则连接检查针对的是代理地址
+		Proxy: nil,
+		DialContext: func(ctx context.Context, network, addr string) (net.Conn, error) {
+			host, _, err := net.SplitHostPort(addr)
+			if err != nil {
+				return nil, err
+			}
+			if g.allowHosts[strings.ToLower(host)] {
+				return dialer.DialContext(ctx, network, addr)
+			}
+			d := *dialer
+			d.Control = func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if ip := net.ParseIP(host); ip == nil || !g.ipAllowed(ip) {
+					return errBlockedAddress
+				}
+				return nil
+			}
+			return d.DialContext(ctx, network, addr)
+		},
+		TLSHandshakeTimeout:   10 * time.Second,
+		ResponseHeaderTimeout: responseHeaderTimeout,
+	}
+}
+
+func newRemoteFetcher(cfg config.UploadConfig) (*remoteFetcher, error) {
+	f := &remoteFetcher{maxSize: cfg.RemoteMaxSize}
+	if f.maxSize <= 0 {
+		f.maxSize = defaultRemoteMaxSize
+	}
+	timeout := time.Duration(cfg.RemoteTimeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultRemoteTimeout
+	}
+	maxRedirects := cfg.RemoteMaxRedirects
+	if maxRedirects <= 0 {
+		maxRedirects = defaultRemoteMaxRedirects
+	}
+
+	guard, err := newAddressGuard(cfg.RemoteAllowHosts)
+	if err != nil {
+		return nil, fmt.Errorf("remote_allow_hosts: %w", err)
+	}
+
+	f.client = &http.Client{
+		Transport: guard.transport(timeout),
+		Timeout:   timeout,
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) > maxRedirects {
+				return fmt.Errorf("stopped after %d redirects", maxRedirects)
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("redirect to unsupported scheme %q", req.URL.Scheme)
+			}
+			return nil
+		},
+	}
+	return f, nil
+}
+
+// ipAllowed 公网地址或允许列表中的地址
+func (g *addressGuard) ipAllowed(ip net.IP) bool {
+	for _, n := range g.allowNets {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	if ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, n := range blockedNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// fetch 下载远程图片，校验大小和内容类型（声明的 Content-Type 和实际内容都必须是图片）
+func (f *remoteFetcher) fetch(ctx context.Context, rawURL string) (*remoteImage, error) {
+	u, err := url.Parse(rawURL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, &remoteFetchError{http.StatusBadRequest, "URL must be an absolute http or https URL"}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u.String(), nil)
+	if err != nil {
+		return nil, &remoteFetchError{http.StatusBadRequest, "Invalid URL"}
+	}
+	req.Header.Set("Accept", "image/*")
+	req.Header.Set("User-Agent", "PixelHub")
+
+	resp, err := f.client.Do(req)
+	if err != nil {
+		var netErr net.Error
+		switch {
+		case errors.Is(err, errBlockedAddress):
+			return nil, &remoteFetchError{http.StatusForbidden, "URL resolves to a private or reserved address"}
+		case errors.As(err, &netErr) && netErr.Timeout():
+			return nil, &remoteFetchError{http.StatusGatewayTimeout, "Timed out fetching remote image"}
+		default:
+			return nil, &remoteFetchError{http.StatusBadGateway, fmt.Sprintf("Failed to fetch remote image: %v", err)}
+		}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, &remoteFetchError{http.StatusBadGateway, fmt.Sprintf("Remote server returned status %d", resp.StatusCode)}
+	}
+	declared, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+	if !isRasterImageType(declared) {
+		return nil, &remoteFetchError{http.StatusUnsupportedMediaType, fmt.Sprintf("Remote content type %q is not a supported image type", declared)}
+	}
+	if resp.ContentLength > f.maxSize {
+		return nil, &remoteFetchError{http.StatusRequestEntityTooLarge, fmt.Sprintf("Remote image exceeds %d bytes", f.maxSize)}
+	}
+
+	data, err := io.ReadAll(io.LimitReader(resp.Body, f.maxSize+1))
+	if err != nil {
+		var netErr net.Error
+		if errors.As(err, &netErr) && netErr.Timeout() {
+			return nil, &remoteFetchError{http.StatusGatewayTimeout, "Timed out fetching remote image"}
+		}
+		return nil, &remoteFetchError{http.StatusBadGateway, fmt.Sprintf("Failed to read remote image: %v", err)}
+	}
+	if int64(len(data)) > f.maxSize {
+		return nil, &remoteFetchError{http.StatusRequestEntityTooLarge, fmt.Sprintf("Remote image exceeds %d bytes", f.maxSize)}
+	}
+
+	// 以实际内容为准，防止把 HTML 等内容伪装成图片
+	sniffed := http.DetectContentType(data)
+	ext, ok := extByMIME[sniffed]
+	if !ok {
+		return nil, &remoteFetchError{http.StatusUnsupportedMediaType, "Remote content is not a supported image"}
+	}
+	return &remoteImage{data: data, contentType: sniffed, filename: "remote" + ext}, nil
+}
+
+// isRasterImageType 是否为可接受的图片类型（SVG 可以包含脚本，不接受）
+func isRasterImageType(mediaType string) bool {
+	return strings.HasPrefix(mediaType, "image/") && mediaType != "image/svg+xml"
+}
+
+func mustParseCIDRs(cidrs ...string) []*net.IPNet {
+	nets := make([]*net.IPNet, len(cidrs))
+	for i, cidr := range cidrs {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets[i] = n
+	}
+	return nets
+}
+
+// ConfigureUpload 应用 [upload] 配置（批量上传的并发数、直接上传的大小上限、通过 URL 上传的限制和内网允许列表、分片上传的临时目录和限制）
+func (h *Handler) ConfigureUpload(cfg config.UploadConfig) error {
+	fetcher, err := newRemoteFetcher(cfg)
+	if err != nil {
+		return err
+	}
+	h.fetcher = fetcher
+	h.chunks = newChunkStore(cfg)
+	h.batchWorkers = cfg.BatchWorkers
+	if h.batchWorkers <= 0 {
+		h.batchWorkers = defaultBatchWorkers
+	}
+	h.rawMaxSize = cfg.RawMaxSize
+	if h.rawMaxSize <= 0 {
+		h.rawMaxSize = defaultRawMaxSize
+	}
+	return nil
+}
+
+// UploadImageFromURL 通过 URL 上传图片：服务端下载远程图片后按普通上传流程保存
+// POST /api/v1/images/upload-url
+func (h *Handler) UploadImageFromURL(c *gin.Context) {
+	var req struct {
+		URL         string `json:"url" binding:"required"`
+		Description string `json:"description"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "Invalid request",
+		})
+		return
+	}
+
+	img, err := h.fetcher.fetch(c.Request.Context(), req.URL)
+	if err != nil {
+		var fetchErr *remoteFetchError
+		if !errors.As(err, &fetchErr) {
+			fetchErr = &remoteFetchError{http.StatusBadGateway, err.Error()}
+		}
+		c.JSON(fetchErr.status, Response{
+			Code:    fetchErr.status,
+			Message: fetchErr.message,
+		})
+		return
+	}
+
+	pic, err := h.saveImage(img.filename, img.data, img.contentType, req.Description, req.URL)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: err.Error(),
+		})
+		return
+	}
+	h.audit(c, auditImageUpload, "image", pic.ID, nil, imageAuditState(pic, nil))
+
+	c.JSON(http.StatusCreated, Response{
+		Code:    201,
+		Message: "Upload successful",
+		Data: map[string]interface{}{
+			"image_id":    pic.ID,
+			"url":         h.pictureURL(pic),
+			"hash":        pic.Hash,
+			"description": pic.Description,
+			"source_url":  pic.SourceURL,
+		},
+	})
+}
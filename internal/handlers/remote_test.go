@@ -0,0 +1,149 @@
+package handlers
+
+import (
+	"bytes"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/vaaandark/PixelHub/internal/config"
+)
+
+// remoteServer 通过 URL 上传测试用的远程服务，按路径返回不同的响应
+func remoteServer(t *testing.T) *httptest.Server {
+	t.Helper()
+	png := testPNG(4)
+	mux := http.NewServeMux()
+	mux.HandleFunc("/image.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(png)
+	})
+	mux.HandleFunc("/page.html", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/html")
+		w.Write([]byte("<html><body>not an image</body></html>"))
+	})
+	// 声明为图片，实际内容是 HTML
+	mux.HandleFunc("/fake.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write([]byte("<html><body>not an image</body></html>"))
+	})
+	mux.HandleFunc("/image.svg", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/svg+xml")
+		w.Write([]byte(`<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`))
+	})
+	mux.HandleFunc("/big.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(append(append([]byte{}, png...), make([]byte, 4096)...))
+	})
+	// 不声明 Content-Length，只能在读取时发现超限
+	mux.HandleFunc("/big-chunked.png", func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(png)
+		w.(http.Flusher).Flush()
+		w.Write(make([]byte, 4096))
+	})
+	srv := httptest.NewServer(mux)
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+// uploadURL 通过 URL 上传，返回状态码和响应
+func uploadURL(e *testEnv, rawURL string) (int, string) {
+	return e.do(http.MethodPost, "/api/v1/images/upload-url", jsonBody(map[string]string{"url": rawURL}))
+}
+
+func TestUploadFromURLBlocksPrivateAddresses(t *testing.T) {
+	e := newTestEnv(t, false)
+	srv := remoteServer(t)
+	// 不在允许列表中时，回环和内网地址都拒绝
+	must(t, e.h.ConfigureUpload(config.UploadConfig{ChunkDir: t.TempDir()}))
+	before := len(e.storage.Keys())
+
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(srv.URL, "http://"))
+	for _, target := range []string{
+		srv.URL + "/image.png",
+		"http://localhost:" + port + "/image.png",
+		"http://[::1]:" + port + "/image.png",
+		"http://10.0.0.1/image.png",
+		"http://169.254.169.254/latest/meta-data/",
+		"http://100.64.0.1/image.png",
+	} {
+		if code, body := uploadURL(e, target); code != http.StatusForbidden {
+			t.Errorf("upload from %s = %d %s, want 403", target, code, body)
+		}
+	}
+	if keys := e.storage.Keys(); len(keys) != before {
+		t.Errorf("storage objects = %v, want nothing stored", keys)
+	}
+
+	// 加入允许列表后可以下载
+	must(t, e.h.ConfigureUpload(config.UploadConfig{ChunkDir: t.TempDir(), RemoteAllowHosts: []string{"127.0.0.0/8"}}))
+	if code, body := uploadURL(e, srv.URL+"/image.png"); code != http.StatusCreated {
+		t.Errorf("upload from allow-listed address = %d %s, want 201", code, body)
+	}
+}
+
+func TestUploadFromURLBlocksRedirectToPrivateAddress(t *testing.T) {
+	e := newTestEnv(t, false)
+	target := remoteServer(t)
+	// 允许列表只包含主机名 localhost，重定向到 127.0.0.1 时按实际 IP 检查
+	redirector := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL+"/image.png", http.StatusFound)
+	}))
+	t.Cleanup(redirector.Close)
+	must(t, e.h.ConfigureUpload(config.UploadConfig{ChunkDir: t.TempDir(), RemoteAllowHosts: []string{"localhost"}}))
+
+	_, port, _ := net.SplitHostPort(strings.TrimPrefix(redirector.URL, "http://"))
+	if code, body := uploadURL(e, "http://localhost:"+port+"/"); code != http.StatusForbidden {
+		t.Errorf("redirect to a private address = %d %s, want 403", code, body)
+	}
+	_, port, _ = net.SplitHostPort(strings.TrimPrefix(target.URL, "http://"))
+	if code, body := uploadURL(e, "http://localhost:"+port+"/image.png"); code != http.StatusCreated {
+		t.Errorf("upload from allow-listed host = %d %s, want 201", code, body)
+	}
+}
+
+func TestUploadFromURLRejectsNonImages(t *testing.T) {
+	e := newTestEnv(t, false)
+	srv := remoteServer(t)
+	for _, path := range []string{"/page.html", "/fake.png", "/image.svg"} {
+		if code, body := uploadURL(e, srv.URL+path); code != http.StatusUnsupportedMediaType {
+			t.Errorf("upload from %s = %d %s, want 415", path, code, body)
+		}
+	}
+	for _, target := range []string{"ftp://127.0.0.1/image.png", "/image.png", "file:///etc/passwd"} {
+		if code, body := uploadURL(e, target); code != http.StatusBadRequest {
+			t.Errorf("upload from %s = %d %s, want 400", target, code, body)
+		}
+	}
+}
+
+func TestUploadFromURLTooLarge(t *testing.T) {
+	e := newTestEnv(t, false)
+	srv := remoteServer(t)
+	must(t, e.h.ConfigureUpload(config.UploadConfig{ChunkDir: t.TempDir(), RemoteAllowHosts: []string{"127.0.0.1"}, RemoteMaxSize: 2048}))
+	before := len(e.storage.Keys())
+
+	for _, path := range []string{"/big.png", "/big-chunked.png"} {
+		if code, body := uploadURL(e, srv.URL+path); code != http.StatusRequestEntityTooLarge {
+			t.Errorf("upload from %s = %d %s, want 413", path, code, body)
+		}
+	}
+	if keys := e.storage.Keys(); len(keys) != before {
+		t.Errorf("storage objects = %v, want nothing stored", keys)
+	}
+
+	code, body := uploadURL(e, srv.URL+"/image.png")
+	if code != http.StatusCreated {
+		t.Fatalf("upload under the limit = %d %s, want 201", code, body)
+	}
+	pic, err := e.store.GetPicture(jsonField(t, body, "data", "image_id").(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored, _ := e.storage.Object(pic.StorageKey); !bytes.Equal(stored, testPNG(4)) || pic.SourceURL != srv.URL+"/image.png" {
+		t.Errorf("picture = %+v, want the remote image with its source URL", pic)
+	}
+}
@@ -0,0 +1,648 @@
+package handlers
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/vaaandark/PixelHub/internal/config"
+)
+
+// 分片上传的默认限制
+const (
+	defaultChunkSize       = 5 << 20
+	defaultChunkMaxSize    = 512 << 20
+	defaultChunkSessionTTL = 24 * time.Hour
+	defaultChunkSessions   = 100
+	defaultChunkPending    = 8 << 30
+	minChunkSize           = 256 << 10
+)
+
+var (
+	errUploadNotFound   = errors.New("upload session not found or expired")
+	errUploadIncomplete = errors.New("upload is incomplete")
+	errUploadCompleting = errors.New("upload is already being completed")
+	errChunkIndex       = errors.New("chunk index out of range")
+	errChunkSize        = errors.New("chunk size does not match")
+	errChunkChecksum    = errors.New("chunk checksum mismatch")
+	errFileChecksum     = errors.New("file checksum mismatch")
+	errUploadCapacity   = errors.New("too many pending uploads, try again later")
+)
+
+// uploadSession 一次分片上传，保存在临时目录下的 session.json 中，服务重启后仍可继续
+type uploadSession struct {
+	ID          string         `json:"id"`
+	Filename    string         `json:"filename"`
+	ContentType string         `json:"content_type,omitempty"`
+	Description string         `json:"description,omitempty"`
+	Size        int64          `json:"size"`
+	ChunkSize   int64          `json:"chunk_size"`
+	SHA256      string         `json:"sha256,omitempty"` // 整个文件的校验和（可选），完成时校验
+	Chunks      map[int]string `json:"chunks"`           // 已接收分片的 SHA-256
+	CreatedAt   time.Time      `json:"created_at"`
+	UpdatedAt   time.Time      `json:"updated_at"`
+}
+
+func (s *uploadSession) totalChunks() int {
+	return int((s.Size + s.ChunkSize - 1) / s.ChunkSize)
+}
+
+// chunkLength 第 index 个分片的长度，只有最后一个分片可以小于 ChunkSize
+func (s *uploadSession) chunkLength(index int) int64 {
+	if index == s.totalChunks()-1 {
+		return s.Size - int64(index)*s.ChunkSize
+	}
+	return s.ChunkSize
+}
+
+func (s *uploadSession) receivedChunks() []int {
+	received := make([]int, 0, len(s.Chunks))
+	for i := range s.Chunks {
+		received = append(received, i)
+	}
+	sort.Ints(received)
+	return received
+}
+
+func (s *uploadSession) missingChunks() []int {
+	missing := []int{}
+	for i := 0; i < s.totalChunks(); i++ {
+		if _, ok := s.Chunks[i]; !ok {
+			missing = append(missing, i)
+		}
+	}
+	return missing
+}
+
+// chunkStore 管理分片上传的临时文件：每个会话一个目录，分片按偏移写入同一个 data 文件
+type chunkStore struct {
+	dir       string
+	chunkSize int64
+	maxSize   int64
+	ttl       time.Duration
+	// 未完成会话的数量和声明大小总和上限，data 文件按声明大小预分配，防止耗尽磁盘
+	maxSessions int
+	maxPending  int64
+
+	// mu 保护 session.json 的读改写和 completing
+	mu         sync.Mutex
+	completing map[string]bool
+}
+
+func newChunkStore(cfg config.UploadConfig) *chunkStore {
+	s := &chunkStore{
+		dir:         cfg.ChunkDir,
+		chunkSize:   cfg.ChunkSize,
+		maxSize:     cfg.ChunkMaxSize,
+		ttl:         time.Duration(cfg.ChunkSessionTTL) * time.Second,
+		maxSessions: cfg.ChunkMaxSessions,
+		maxPending:  cfg.ChunkMaxPending,
+		completing:  make(map[string]bool),
+	}
+	if s.dir == "" {
+		s.dir = filepath.Join(os.TempDir(), "pixelhub-uploads")
+	}
+	if s.chunkSize <= 0 {
+		s.chunkSize = defaultChunkSize
+	}
+	if s.chunkSize < minChunkSize {
+		s.chunkSize = minChunkSize
+	}
+	if s.maxSize <= 0 {
+		s.maxSize = defaultChunkMaxSize
+	}
+	if s.ttl <= 0 {
+		s.ttl = defaultChunkSessionTTL
+	}
+	if s.maxSessions <= 0 {
+		s.maxSessions = defaultChunkSessions
+	}
+	if s.maxPending <= 0 {
+		s.maxPending = defaultChunkPending
+	}
+	return s
+}
+
+// sessionDir 会话目录，ID 必须是本服务生成的格式，防止路径穿越
+func (s *chunkStore) sessionDir(id string) (string, error) {
+	if _, err := uuid.Parse(strings.TrimPrefix(id, "upl_")); err != nil || !strings.HasPrefix(id, "upl_") {
+		return "", errUploadNotFound
+	}
+	return filepath.Join(s.dir, id), nil
+}
+
+func (s *chunkStore) expiresAt(sess *uploadSession) time.Time {
+	return sess.UpdatedAt.Add(s.ttl)
+}
+
+// pending 统计未过期会话的数量和声明大小总和（调用时持有锁）
+func (s *chunkStore) pending() (int, int64, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, 0, nil
+		}
+		return 0, 0, err
+	}
+	count, size := 0, int64(0)
+	for _, entry := range entries {
+		if !entry.IsDir() {
+			continue
+		}
+		sess, err := s.load(entry.Name())
+		if err != nil {
+			continue
+		}
+		count++
+		size += sess.Size
+	}
+	return count, size, nil
+}
+
+// create 创建会话目录和预分配大小的 data 文件，未完成的会话达到上限时返回 errUploadCapacity
+func (s *chunkStore) create(sess *uploadSession) error {
+	dir, err := s.sessionDir(sess.ID)
+	if err != nil {
+		return err
+	}
+	// 持有锁，避免 cleanup 把还没有 session.json 的目录当作残留删除，也让并发创建看到彼此占用的额度
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	count, size, err := s.pending()
+	if err != nil {
+		return err
+	}
+	if count >= s.maxSessions || size+sess.Size > s.maxPending {
+		return errUploadCapacity
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return err
+	}
+	f, err := os.OpenFile(filepath.Join(dir, "data"), os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0600)
+	if err != nil {
+		return err
+	}
+	err = f.Truncate(sess.Size)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = s.save(sess)
+	}
+	if err != nil {
+		os.RemoveAll(dir)
+	}
+	return err
+}
+
+// load 读取会话，不存在或已过期时返回 errUploadNotFound
+func (s *chunkStore) load(id string) (*uploadSession, error) {
+	dir, err := s.sessionDir(id)
+	if err != nil {
+		return nil, err
+	}
+	data, err := os.ReadFile(filepath.Join(dir, "session.json"))
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return nil, errUploadNotFound
+		}
+		return nil, err
+	}
+	var sess uploadSession
+	if err := json.Unmarshal(data, &sess); err != nil {
+		return nil, err
+	}
+	if sess.Chunks == nil {
+		sess.Chunks = make(map[int]string)
+	}
+	if time.Now().After(s.expiresAt(&sess)) {
+		return nil, errUploadNotFound
+	}
+	return &sess, nil
+}
+
+// save 先写临时文件再重命名，避免中断时留下不完整的 session.json
+func (s *chunkStore) save(sess *uploadSession) error {
+	dir, err := s.sessionDir(sess.ID)
+	if err != nil {
+		return err
+	}
+	data, err := json.Marshal(sess)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(dir, "session.json.tmp")
+	if err := os.WriteFile(tmp, data, 0600); err != nil {
+		return err
+	}
+	return os.Rename(tmp, filepath.Join(dir, "session.json"))
+}
+
+// writeChunk 校验分片长度和 SHA-256 后写入对应偏移，同一分片可以重复上传
+func (s *chunkStore) writeChunk(id string, index int, body io.Reader, checksum string) (*uploadSession, error) {
+	s.mu.Lock()
+	sess, err := s.load(id)
+	if err == nil && s.completing[id] {
+		err = errUploadCompleting
+	}
+	s.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+	if index < 0 || index >= sess.totalChunks() {
+		return nil, errChunkIndex
+	}
+
+	// 分片不超过 chunk_size，校验通过前不写入 data 文件
+	expected := sess.chunkLength(index)
+	data, err := io.ReadAll(io.LimitReader(body, expected+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) != expected {
+		return nil, fmt.Errorf("%w: expected %d bytes, got %d", errChunkSize, expected, len(data))
+	}
+	sum := sha256.Sum256(data)
+	actual := hex.EncodeToString(sum[:])
+	if !strings.EqualFold(actual, checksum) {
+		return nil, errChunkChecksum
+	}
+
+	// 持有锁写入，完成上传正在读取 data 文件时不能改写其中的内容
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.completing[id] {
+		return nil, errUploadCompleting
+	}
+	// 重新读取会话，合并并发上传的其他分片
+	sess, err = s.load(id)
+	if err != nil {
+		return nil, err
+	}
+	dir, _ := s.sessionDir(id)
+	f, err := os.OpenFile(filepath.Join(dir, "data"), os.O_WRONLY, 0600)
+	if err != nil {
+		return nil, err
+	}
+	_, err = f.WriteAt(data, int64(index)*sess.ChunkSize)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return nil, err
+	}
+	sess.Chunks[index] = actual
+	sess.UpdatedAt = time.Now()
+	if err := s.save(sess); err != nil {
+		return nil, err
+	}
+	return sess, nil
+}
+
+// beginComplete 确认所有分片都已接收并标记会话正在完成，防止并发请求重复保存
+func (s *chunkStore) beginComplete(id string) (*uploadSession, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	sess, err := s.load(id)
+	if err != nil {
+		return nil, err
+	}
+	if len(sess.missingChunks()) > 0 {
+		return sess, errUploadIncomplete
+	}
+	if s.completing[id] {
+		return nil, errUploadCompleting
+	}
+	s.completing[id] = true
+	return sess, nil
+}
+
+func (s *chunkStore) endComplete(id string) {
+	s.mu.Lock()
+	delete(s.completing, id)
+	s.mu.Unlock()
+}
+
+// openData 打开合并后的文件
+func (s *chunkStore) openData(sess *uploadSession) (*os.File, error) {
+	dir, err := s.sessionDir(sess.ID)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(filepath.Join(dir, "data"))
+}
+
+func (s *chunkStore) remove(id string) error {
+	dir, err := s.sessionDir(id)
+	if err != nil {
+		return err
+	}
+	return os.RemoveAll(dir)
+}
+
+// cleanup 删除过期会话的临时文件，返回删除的会话数
+func (s *chunkStore) cleanup() (int, error) {
+	entries, err := os.ReadDir(s.dir)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return 0, nil
+		}
+		return 0, err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	removed := 0
+	for _, entry := range entries {
+		if !entry.IsDir() || s.completing[entry.Name()] {
+			continue
+		}
+		if _, err := s.load(entry.Name()); !errors.Is(err, errUploadNotFound) {
+			continue
+		}
+		// 目录名不是会话 ID 的不处理，避免误删 chunk_dir 中的其他文件
+		dir, err := s.sessionDir(entry.Name())
+		if err != nil {
+			continue
+		}
+		if err := os.RemoveAll(dir); err != nil {
+			log.Printf("Warning: Failed to remove expired upload %s: %v", entry.Name(), err)
+			continue
+		}
+		removed++
+	}
+	return removed, nil
+}
+
+// CleanupUploadSessions 定期清理过期的分片上传（在后台运行）
+func (h *Handler) CleanupUploadSessions(ctx context.Context) {
+	interval := h.chunks.ttl / 4
+	if interval > time.Hour {
+		interval = time.Hour
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		if n, err := h.chunks.cleanup(); err != nil {
+			log.Printf("Warning: Failed to clean up upload sessions: %v", err)
+		} else if n > 0 {
+			log.Printf("Removed %d expired upload sessions", n)
+		}
+		select {
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// uploadStatus 会话状态，所有分片上传接口返回同样的结构，客户端据此决定续传哪些分片
+func (h *Handler) uploadStatus(sess *uploadSession) map[string]interface{} {
+	return map[string]interface{}{
+		"upload_id":       sess.ID,
+		"filename":        sess.Filename,
+		"size":            sess.Size,
+		"chunk_size":      sess.ChunkSize,
+		"total_chunks":    sess.totalChunks(),
+		"received_chunks": sess.receivedChunks(),
+		"missing_chunks":  sess.missingChunks(),
+		"expires_at":      h.chunks.expiresAt(sess),
+	}
+}
+
+// uploadErrorStatus 分片上传错误对应的状态码
+func uploadErrorStatus(err error) int {
+	switch {
+	case errors.Is(err, errUploadNotFound):
+		return http.StatusNotFound
+	case errors.Is(err, errChunkIndex), errors.Is(err, errChunkSize):
+		return http.StatusBadRequest
+	case errors.Is(err, errChunkChecksum), errors.Is(err, errFileChecksum):
+		return http.StatusUnprocessableEntity
+	case errors.Is(err, errUploadIncomplete), errors.Is(err, errUploadCompleting):
+		return http.StatusConflict
+	case errors.Is(err, errUploadCapacity):
+		return http.StatusServiceUnavailable
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// CreateUpload 创建分片上传会话
+// POST /api/v1/uploads
+func (h *Handler) CreateUpload(c *gin.Context) {
+	var req struct {
+		Filename    string `json:"filename" binding:"required"`
+		Size        int64  `json:"size" binding:"required"`
+		SHA256      string `json:"sha256"`
+		ContentType string `json:"content_type"`
+		Description string `json:"description"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil || req.Size <= 0 {
+		c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "Invalid request",
+		})
+		return
+	}
+	if req.Size > h.chunks.maxSize {
+		c.JSON(http.StatusRequestEntityTooLarge, Response{
+			Code:    413,
+			Message: fmt.Sprintf("File exceeds %d bytes", h.chunks.maxSize),
+		})
+		return
+	}
+
+	now := time.Now()
+	sess := &uploadSession{
+		ID:          "upl_" + uuid.New().String(),
+		Filename:    filepath.Base(req.Filename),
+		ContentType: req.ContentType,
+		Description: req.Description,
+		Size:        req.Size,
+		ChunkSize:   h.chunks.chunkSize,
+		SHA256:      strings.ToLower(req.SHA256),
+		Chunks:      make(map[int]string),
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+	if err := h.chunks.create(sess); err != nil {
+		if errors.Is(err, errUploadCapacity) {
+			c.JSON(http.StatusServiceUnavailable, Response{
+				Code:    503,
+				Message: err.Error(),
+			})
+			return
+		}
+		log.Printf("Failed to create upload session: %v", err)
+		c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: "Failed to create upload session",
+		})
+		return
+	}
+
+	c.JSON(http.StatusCreated, Response{
+		Code:    201,
+		Message: "Upload session created",
+		Data:    h.uploadStatus(sess),
+	})
+}
+
+// GetUpload 查询分片上传进度
+// GET /api/v1/uploads/:upload_id
+func (h *Handler) GetUpload(c *gin.Context) {
+	h.chunks.mu.Lock()
+	sess, err := h.chunks.load(c.Param("upload_id"))
+	h.chunks.mu.Unlock()
+	if err != nil {
+		status := uploadErrorStatus(err)
+		c.JSON(status, Response{
+			Code:    status,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{
+		Code:    200,
+		Message: "Success",
+		Data:    h.uploadStatus(sess),
+	})
+}
+
+// UploadChunk 上传一个分片，请求体为分片的原始内容，X-Chunk-SHA256 为其十六进制 SHA-256
+// PUT /api/v1/uploads/:upload_id/chunks/:index
+func (h *Handler) UploadChunk(c *gin.Context) {
+	index, err := strconv.Atoi(c.Param("index"))
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "Invalid chunk index",
+		})
+		return
+	}
+	checksum := c.GetHeader("X-Chunk-SHA256")
+	if checksum == "" {
+		c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "X-Chunk-SHA256 header is required",
+		})
+		return
+	}
+
+	sess, err := h.chunks.writeChunk(c.Param("upload_id"), index, c.Request.Body, checksum)
+	if err != nil {
+		status := uploadErrorStatus(err)
+		c.JSON(status, Response{
+			Code:    status,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{
+		Code:    200,
+		Message: "Chunk received",
+		Data:    h.uploadStatus(sess),
+	})
+}
+
+// CompleteUpload 所有分片上传完成后合并文件，按普通上传流程保存图片并删除临时文件
+// POST /api/v1/uploads/:upload_id/complete
+func (h *Handler) CompleteUpload(c *gin.Context) {
+	id := c.Param("upload_id")
+	sess, err := h.chunks.beginComplete(id)
+	if err != nil {
+		status := uploadErrorStatus(err)
+		resp := Response{
+			Code:    status,
+			Message: err.Error(),
+		}
+		if errors.Is(err, errUploadIncomplete) {
+			resp.Data = h.uploadStatus(sess)
+		}
+		c.JSON(status, resp)
+		return
+	}
+	defer h.chunks.endComplete(id)
+
+	data, err := h.chunks.openData(sess)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: fmt.Sprintf("Failed to open uploaded file: %v", err),
+		})
+		return
+	}
+	defer data.Close()
+
+	// 从临时文件流式写入存储，同时校验整体 SHA-256（创建会话时提供了才校验）
+	pic, err := h.saveImageFrom(sess.Filename, data, sess.ContentType, sess.Description, "", sess.SHA256)
+	if err != nil {
+		status := uploadErrorStatus(err)
+		c.JSON(status, Response{
+			Code:    status,
+			Message: err.Error(),
+		})
+		return
+	}
+	h.audit(c, auditImageUpload, "image", pic.ID, nil, imageAuditState(pic, nil))
+	if err := h.chunks.remove(id); err != nil {
+		log.Printf("Warning: Failed to remove upload session %s: %v", id, err)
+	}
+
+	c.JSON(http.StatusCreated, Response{
+		Code:    201,
+		Message: "Upload successful",
+		Data: map[string]interface{}{
+			"image_id":    pic.ID,
+			"url":         h.pictureURL(pic),
+			"hash":        pic.Hash,
+			"description": pic.Description,
+		},
+	})
+}
+
+// AbortUpload 放弃分片上传并删除临时文件
+// DELETE /api/v1/uploads/:upload_id
+func (h *Handler) AbortUpload(c *gin.Context) {
+	id := c.Param("upload_id")
+	h.chunks.mu.Lock()
+	_, err := h.chunks.load(id)
+	if err == nil && h.chunks.completing[id] {
+		err = errUploadCompleting
+	}
+	if err == nil {
+		err = h.chunks.remove(id)
+	}
+	h.chunks.mu.Unlock()
+	if err != nil {
+		status := uploadErrorStatus(err)
+		c.JSON(status, Response{
+			Code:    status,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{
+		Code:    200,
+		Message: "Upload aborted",
+	})
+}
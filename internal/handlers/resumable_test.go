@@ -0,0 +1,174 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/vaaandark/PixelHub/internal/config"
+	"github.com/vaaandark/PixelHub/internal/database"
+	"github.com/vaaandark/PixelHub/internal/imagemeta"
+)
+
+// startChunkedUpload 创建只有一个分片的上传会话并上传分片
+func startChunkedUpload(e *testEnv, data []byte, sha string) string {
+	e.t.Helper()
+	code, body := e.do(http.MethodPost, "/api/v1/uploads", jsonBody(map[string]interface{}{"filename": "chunked.png", "size": len(data), "sha256": sha}))
+	if code != http.StatusCreated {
+		e.t.Fatalf("create upload session: %d %s", code, body)
+	}
+	id := jsonField(e.t, body, "data", "upload_id").(string)
+	chunk := &requestBody{content: data, contentType: "application/octet-stream", headers: map[string]string{"X-Chunk-SHA256": sha256Hex(data)}}
+	if code, body := e.do(http.MethodPut, "/api/v1/uploads/"+id+"/chunks/0", chunk); code != http.StatusOK {
+		e.t.Fatalf("upload chunk: %d %s", code, body)
+	}
+	return id
+}
+
+func TestCompleteUploadStreamsFile(t *testing.T) {
+	e := newTestEnv(t, false)
+	data := testPNG(7)
+
+	id := startChunkedUpload(e, data, sha256Hex(data))
+	code, body := e.do(http.MethodPost, "/api/v1/uploads/"+id+"/complete", nil)
+	if code != http.StatusCreated {
+		t.Fatalf("complete = %d %s", code, body)
+	}
+	imageID := jsonField(t, body, "data", "image_id").(string)
+	if hash := jsonField(t, body, "data", "hash"); hash != sha256Hex(data) {
+		t.Errorf("hash = %v, want %s", hash, sha256Hex(data))
+	}
+	pic, err := e.store.GetPicture(imageID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stored, ok := e.storage.Object(pic.StorageKey); !ok || !bytes.Equal(stored, data) {
+		t.Errorf("stored object differs from the uploaded file (%d bytes, found %v)", len(stored), ok)
+	}
+	// 从临时文件流式上传时仍把内容长度传给存储（COS 据此设置 Content-Length）
+	if size, _ := e.storage.UploadedSize(pic.StorageKey); size != int64(len(data)) {
+		t.Errorf("size passed to storage = %d, want %d", size, len(data))
+	}
+	if meta := imagemeta.Extract(data); pic.PHash != meta.PHash || pic.Width != meta.Width || pic.MIMEType != meta.MIMEType {
+		t.Errorf("metadata = %s %dx%d %s, want %s %dx%d %s", pic.PHash, pic.Width, pic.Height, pic.MIMEType, meta.PHash, meta.Width, meta.Height, meta.MIMEType)
+	}
+}
+
+func TestCompleteUploadChecksumMismatch(t *testing.T) {
+	e := newTestEnv(t, false)
+	data := testPNG(7)
+	before := len(e.storage.Keys())
+
+	id := startChunkedUpload(e, data, strings.Repeat("0", 64))
+	code, body := e.do(http.MethodPost, "/api/v1/uploads/"+id+"/complete", nil)
+	if code != http.StatusUnprocessableEntity {
+		t.Fatalf("complete with wrong checksum = %d %s, want 422", code, body)
+	}
+	// 校验失败时删除已经写入存储的文件，不创建图片
+	if keys := e.storage.Keys(); len(keys) != before {
+		t.Errorf("storage objects = %v, want the uploaded file removed", keys)
+	}
+	if _, total, err := e.store.ListPictures(database.PictureFilter{}, 1, 1, "date_desc", nil); err != nil || total != 1 {
+		t.Errorf("pictures = %d (%v), want only the fixture", total, err)
+	}
+}
+
+func TestCreateUploadLimitsPendingSessions(t *testing.T) {
+	e := newTestEnv(t, false)
+	must(t, e.h.ConfigureUpload(config.UploadConfig{ChunkDir: t.TempDir(), ChunkMaxSessions: 2, ChunkMaxPending: 3 << 20}))
+
+	create := func(size int) (int, string) {
+		return e.do(http.MethodPost, "/api/v1/uploads", jsonBody(map[string]interface{}{"filename": "big.png", "size": size}))
+	}
+	code, body := create(1 << 20)
+	if code != http.StatusCreated {
+		t.Fatalf("create first session = %d %s", code, body)
+	}
+	first := jsonField(t, body, "data", "upload_id").(string)
+
+	// 声明大小总和超过上限
+	if code, body := create(3 << 20); code != http.StatusServiceUnavailable {
+		t.Errorf("create over the pending size limit = %d %s, want 503", code, body)
+	}
+	if code, body := create(1 << 20); code != http.StatusCreated {
+		t.Fatalf("create second session = %d %s", code, body)
+	}
+	// 会话数达到上限
+	if code, body := create(1); code != http.StatusServiceUnavailable {
+		t.Errorf("create over the session limit = %d %s, want 503", code, body)
+	}
+
+	// 放弃一个会话后释放额度
+	if code, body := e.do(http.MethodDelete, "/api/v1/uploads/"+first, nil); code != http.StatusOK {
+		t.Fatalf("abort = %d %s", code, body)
+	}
+	if code, body := create(1); code != http.StatusCreated {
+		t.Errorf("create after abort = %d %s, want 201", code, body)
+	}
+}
+
+// 超过像素上限的图片完成上传时不解码整张图片，感知哈希留给后台补算
+func TestCompleteUploadDefersLargeImageHash(t *testing.T) {
+	e := newTestEnv(t, false)
+	e.h.hashMaxPixels = 100
+	data := testPNG(7)
+
+	id := startChunkedUpload(e, data, sha256Hex(data))
+	code, body := e.do(http.MethodPost, "/api/v1/uploads/"+id+"/complete", nil)
+	if code != http.StatusCreated {
+		t.Fatalf("complete = %d %s", code, body)
+	}
+	imageID := jsonField(t, body, "data", "image_id").(string)
+	pic, err := e.store.GetPicture(imageID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pic.PHash != "" || !pic.PHashDeferred || pic.Width != 32 || pic.Height != 24 {
+		t.Errorf("metadata = %q deferred=%v %dx%d, want no phash, deferred, 32x24", pic.PHash, pic.PHashDeferred, pic.Width, pic.Height)
+	}
+
+	e.h.BackfillImageMetadata(context.Background())
+	pic, err = e.store.GetPicture(imageID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := imagemeta.Extract(data).PHash; pic.PHash != want || pic.PHashDeferred {
+		t.Errorf("phash after backfill = %q deferred=%v, want %q", pic.PHash, pic.PHashDeferred, want)
+	}
+}
+
+// 完成上传正在读取 data 文件时，重新上传分片返回 409 且不改写文件
+func TestUploadChunkDuringCompletion(t *testing.T) {
+	e := newTestEnv(t, false)
+	data := testPNG(7)
+	id := startChunkedUpload(e, data, sha256Hex(data))
+
+	if _, err := e.h.chunks.beginComplete(id); err != nil {
+		t.Fatal(err)
+	}
+	other := bytes.Repeat([]byte{0xff}, len(data))
+	chunk := &requestBody{content: other, contentType: "application/octet-stream", headers: map[string]string{"X-Chunk-SHA256": sha256Hex(other)}}
+	if code, body := e.do(http.MethodPut, "/api/v1/uploads/"+id+"/chunks/0", chunk); code != http.StatusConflict {
+		t.Errorf("chunk upload during completion = %d %s, want 409", code, body)
+	}
+	sess, err := e.h.chunks.load(id)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f, err := e.h.chunks.openData(sess)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+	if got, _ := io.ReadAll(f); !bytes.Equal(got, data) {
+		t.Error("data file was rewritten during completion")
+	}
+
+	e.h.chunks.endComplete(id)
+	if code, body := e.do(http.MethodPut, "/api/v1/uploads/"+id+"/chunks/0", chunk); code != http.StatusOK {
+		t.Errorf("chunk upload after completion ended = %d %s, want 200", code, body)
+	}
+}
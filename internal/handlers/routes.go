@@ -0,0 +1,79 @@
+package handlers
+
+import "github.com/gin-gonic/gin"
+
+// RegisterRoutes 注册公开分享页面和 /api/v1 下的所有路由
+// 路由表集中在这里，服务入口和 httptest 可以使用同一套路由
+func (h *Handler) RegisterRoutes(r gin.IRouter) {
+	// 公开分享页面（无需访问 API）
+	r.GET("/s/:token", h.ServeShare)
+	r.POST("/s/:token", h.UnlockShare)
+	r.GET("/s/:token/images/:image_id", h.ServeSharedImage)
+
+	// 图床后端 API 路由，POST/PUT/DELETE 支持 Idempotency-Key
+	api := r.Group("/api/v1", h.Idempotency)
+	{
+		// 图片管理
+		api.POST("/images/upload", h.UploadImage)
+		api.POST("/images/upload-url", h.UploadImageFromURL)
+		api.POST("/images/batch-upload", h.BatchUploadImages)
+		api.POST("/uploads", h.CreateUpload)
+		api.GET("/uploads/:upload_id", h.GetUpload)
+		api.PUT("/uploads/:upload_id/chunks/:index", h.UploadChunk)
+		api.POST("/uploads/:upload_id/complete", h.CompleteUpload)
+		api.DELETE("/uploads/:upload_id", h.AbortUpload)
+		api.POST("/images/batch-delete", h.BatchDeleteImages)
+		api.GET("/images", h.ListImages)
+		api.GET("/images/duplicates", h.ListDuplicateImages)
+		api.GET("/images/:image_id", h.GetImageDetail)
+		api.PUT("/images/:image_id", h.UpdateImageDescription)
+		api.DELETE("/images/:image_id", h.DeleteImage)
+		api.GET("/images/:image_id/similar", h.FindSimilarImages)
+		api.PUT("/images/:image_id/file", h.ReplaceImageFile)
+		api.GET("/images/:image_id/versions", h.ListImageVersions)
+		api.POST("/images/:image_id/versions/:version/rollback", h.RollbackImageVersion)
+
+		// 标签管理
+		api.PUT("/images/:image_id/tags", h.UpdateImageTags)
+		api.POST("/images/:image_id/tags/generate", h.GenerateImageTags)
+		api.GET("/tags", h.ListTags)
+
+		// 搜索
+		api.GET("/search/exact", h.SearchExact)
+		api.GET("/search/relevance", h.SearchRelevance)
+		api.GET("/search/text", h.SearchText)
+
+		// 导出
+		api.GET("/export", h.ExportImages)
+
+		// 相册
+		api.POST("/albums", h.CreateAlbum)
+		api.GET("/albums", h.ListAlbums)
+		api.GET("/albums/:album_id", h.GetAlbumDetail)
+		api.PUT("/albums/:album_id", h.UpdateAlbum)
+		api.DELETE("/albums/:album_id", h.DeleteAlbum)
+		api.POST("/albums/:album_id/images", h.AddAlbumImages)
+		api.POST("/albums/:album_id/images/batch-remove", h.RemoveAlbumImages)
+		api.PUT("/albums/:album_id/images/order", h.ReorderAlbumImages)
+
+		// 分享链接
+		api.POST("/shares", h.CreateShareLink)
+		api.GET("/shares", h.ListShareLinks)
+		api.GET("/shares/:token", h.GetShareLinkDetail)
+		api.POST("/shares/:token/revoke", h.RevokeShareLink)
+
+		// 审计日志和事件流
+		api.GET("/audit", h.ListAuditLog)
+		api.GET("/events", h.StreamEvents)
+
+		// Webhook
+		api.POST("/webhooks", h.CreateWebhook)
+		api.GET("/webhooks", h.ListWebhooks)
+		api.GET("/webhooks/:webhook_id", h.GetWebhookDetail)
+		api.PUT("/webhooks/:webhook_id", h.UpdateWebhook)
+		api.DELETE("/webhooks/:webhook_id", h.DeleteWebhook)
+		api.POST("/webhooks/:webhook_id/ping", h.PingWebhook)
+		api.GET("/webhooks/:webhook_id/deliveries", h.ListWebhookDeliveries)
+		api.POST("/webhooks/:webhook_id/deliveries/:delivery_id/redeliver", h.RedeliverWebhook)
+	}
+}
@@ -0,0 +1,557 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vaaandark/PixelHub/internal/config"
+	"github.com/vaaandark/PixelHub/internal/database"
+	"github.com/vaaandark/PixelHub/internal/fakes"
+	"github.com/vaaandark/PixelHub/internal/imagemeta"
+	"github.com/vaaandark/PixelHub/internal/llm"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func init() {
+	gin.SetMode(gin.TestMode)
+}
+
+// testPNG 生成内容由 seed 决定的 PNG 图片
+func testPNG(seed int) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 32, 24))
+	for y := 0; y < 24; y++ {
+		for x := 0; x < 32; x++ {
+			img.Set(x, y, color.RGBA{uint8(x * seed), uint8(y * 7), uint8(seed * 40), 255})
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		panic(err)
+	}
+	return buf.Bytes()
+}
+
+func sha256Hex(data []byte) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// testEnv 使用内存实现的处理器和路由
+type testEnv struct {
+	t       *testing.T
+	h       *Handler
+	router  *gin.Engine
+	store   *fakes.Store
+	storage *fakes.Storage
+	tagger  *fakes.TagGenerator
+	// remote 通过 URL 上传时下载的远程图片服务
+	remote *httptest.Server
+	// ids 路径中占位符（如 {image}）对应的测试数据 ID
+	ids map[string]string
+}
+
+// newTestEnv 创建测试环境；withTagger 为 false 时不配置 LLM 服务
+func newTestEnv(t *testing.T, withTagger bool) *testEnv {
+	t.Helper()
+	e := &testEnv{
+		t:       t,
+		store:   fakes.NewStore(),
+		storage: fakes.NewStorage(),
+		tagger:  &fakes.TagGenerator{Result: llm.ImageAnalysisResult{Description: "a generated description", Tags: []string{"sky", "sea"}}},
+		ids:     make(map[string]string),
+	}
+	var tagger llm.TagGenerator
+	if withTagger {
+		tagger = e.tagger
+	}
+	e.h = NewHandler(e.store, e.storage, tagger)
+
+	remotePNG := testPNG(9)
+	e.remote = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/remote.png" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Write(remotePNG)
+	}))
+	t.Cleanup(e.remote.Close)
+
+	if err := e.h.ConfigureUpload(config.UploadConfig{
+		RemoteAllowHosts: []string{"127.0.0.1"},
+		ChunkDir:         t.TempDir(),
+	}); err != nil {
+		t.Fatalf("ConfigureUpload: %v", err)
+	}
+
+	e.router = gin.New()
+	e.h.RegisterRoutes(e.router)
+	e.seed()
+	return e
+}
+
+// seed 写入各路由共用的测试数据
+func (e *testEnv) seed() {
+	t := e.t
+	t.Helper()
+
+	content := testPNG(1)
+	key, _, err := e.storage.Upload("img_fixture.png", bytes.NewReader(content), int64(len(content)), "image/png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	meta := imagemeta.Extract(content)
+	pic := &database.Picture{ID: "img_fixture", StorageKey: key, Hash: sha256Hex(content), Description: "fixture", PHash: meta.PHash, Width: meta.Width, Height: meta.Height, MIMEType: meta.MIMEType}
+	must(t, e.store.CreatePicture(pic))
+	must(t, e.store.SetPictureTags(pic.ID, []string{"sky", "blue"}))
+	e.ids["image"] = pic.ID
+	// 两种列表的游标互不通用
+	e.ids["tag_cursor"] = database.TagCursor(database.Tag{ID: 1, TagName: "sky", Count: 1}).Encode()
+	e.ids["picture_cursor"] = database.PictureCursor(database.PictureWithTags{Picture: *pic}, "date_desc").Encode()
+
+	must(t, e.store.CreateAlbum(&database.Album{ID: "alb_fixture", Name: "Fixture"}))
+	if _, err := e.store.AddAlbumItems("alb_fixture", []string{pic.ID}, -1); err != nil {
+		t.Fatal(err)
+	}
+	e.ids["album"] = "alb_fixture"
+
+	must(t, e.store.CreateShareLink(&database.ShareLink{Token: "share-fixture-token", TargetType: database.ShareTargetImage, TargetID: pic.ID, ExpiresAt: time.Now().Add(time.Hour)}))
+	e.ids["share"] = "share-fixture-token"
+	hash, err := bcrypt.GenerateFromPassword([]byte("secret"), bcrypt.MinCost)
+	if err != nil {
+		t.Fatal(err)
+	}
+	must(t, e.store.CreateShareLink(&database.ShareLink{Token: "locked-fixture-token", TargetType: database.ShareTargetImage, TargetID: pic.ID, PasswordHash: string(hash), ExpiresAt: time.Now().Add(time.Hour)}))
+	e.ids["locked"] = "locked-fixture-token"
+
+	hook := &database.Webhook{ID: "whk_fixture", URL: "https://hooks.example.com/pixelhub", Secret: "s3cret", Events: []string{"*"}, Active: true}
+	must(t, e.store.CreateWebhook(hook))
+	e.ids["webhook"] = hook.ID
+	now := time.Now()
+	must(t, e.store.CreateWebhookDeliveries([]database.WebhookDelivery{{
+		WebhookID: hook.ID, EventID: "evt_fixture", EventType: auditImageUpload, Payload: []byte(`{}`), NextAttemptAt: now, CreatedAt: now,
+	}}))
+	deliveries, _, err := e.store.ListWebhookDeliveries(hook.ID, "", 1, 10)
+	if err != nil || len(deliveries) != 1 {
+		t.Fatalf("seed delivery: %v", err)
+	}
+	// 已结束的投递才能重新投递
+	d := deliveries[0]
+	d.Status = database.DeliveryDead
+	d.Attempts = 1
+	d.FinishedAt = &now
+	must(t, e.store.UpdateWebhookDelivery(&d))
+	e.ids["delivery"] = fmt.Sprint(d.ID)
+
+	upload := testPNG(5)
+	code, body := e.do(http.MethodPost, "/api/v1/uploads", jsonBody(map[string]interface{}{"filename": "chunked.png", "size": len(upload), "sha256": sha256Hex(upload)}))
+	if code != http.StatusCreated {
+		t.Fatalf("create upload session: %d %s", code, body)
+	}
+	e.ids["upload"] = jsonField(t, body, "data", "upload_id").(string)
+	e.ids["upload_data"] = string(upload)
+
+	e.ids["remote"] = e.remote.URL + "/remote.png"
+}
+
+func must(t *testing.T, err error) {
+	t.Helper()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
+
+// expand 替换路径中的占位符
+func (e *testEnv) expand(s string) string {
+	for k, v := range e.ids {
+		s = strings.ReplaceAll(s, "{"+k+"}", v)
+	}
+	return s
+}
+
+// requestBody 请求体和 Content-Type
+type requestBody struct {
+	content     []byte
+	contentType string
+	headers     map[string]string
+}
+
+func jsonBody(v interface{}) *requestBody {
+	data, err := json.Marshal(v)
+	if err != nil {
+		panic(err)
+	}
+	return &requestBody{content: data, contentType: "application/json"}
+}
+
+func formBody(values url.Values) *requestBody {
+	return &requestBody{content: []byte(values.Encode()), contentType: "application/x-www-form-urlencoded"}
+}
+
+// multipartBody 文件字段 field 的内容为 files（文件名 → 内容），fields 为普通字段
+func multipartBody(field string, files map[string][]byte, fields map[string]string) *requestBody {
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+	for k, v := range fields {
+		mw.WriteField(k, v)
+	}
+	for name, data := range files {
+		fw, err := mw.CreateFormFile(field, name)
+		if err != nil {
+			panic(err)
+		}
+		fw.Write(data)
+	}
+	mw.Close()
+	return &requestBody{content: buf.Bytes(), contentType: mw.FormDataContentType()}
+}
+
+func (e *testEnv) request(ctx context.Context, method, path string, body *requestBody) *httptest.ResponseRecorder {
+	var rd io.Reader
+	if body != nil {
+		rd = bytes.NewReader(body.content)
+	}
+	req := httptest.NewRequest(method, e.expand(path), rd).WithContext(ctx)
+	if body != nil {
+		req.Header.Set("Content-Type", body.contentType)
+		for k, v := range body.headers {
+			req.Header.Set(k, e.expand(v))
+		}
+	}
+	w := httptest.NewRecorder()
+	e.router.ServeHTTP(w, req)
+	return w
+}
+
+func (e *testEnv) do(method, path string, body *requestBody) (int, string) {
+	w := e.request(context.Background(), method, path, body)
+	return w.Code, w.Body.String()
+}
+
+func jsonField(t *testing.T, body string, path ...string) interface{} {
+	t.Helper()
+	var v interface{}
+	if err := json.Unmarshal([]byte(body), &v); err != nil {
+		t.Fatalf("invalid JSON %q: %v", body, err)
+	}
+	for _, p := range path {
+		m, ok := v.(map[string]interface{})
+		if !ok {
+			return nil
+		}
+		v = m[p]
+	}
+	return v
+}
+
+// routeCase 一个路由请求及期望的状态码
+type routeCase struct {
+	name   string
+	method string
+	path   string // 可以包含 {image}、{album} 等占位符
+	body   func(e *testEnv) *requestBody
+	// noTagger 不配置 LLM 服务
+	noTagger bool
+	// setup 在请求之前执行
+	setup func(e *testEnv)
+	// stream 为 true 时请求在短时间后取消（事件流不会自己结束）
+	stream bool
+	want   int
+	check  func(t *testing.T, e *testEnv, body string)
+}
+
+func staticBody(b *requestBody) func(e *testEnv) *requestBody {
+	return func(*testEnv) *requestBody { return b }
+}
+
+// uploadChunk 上传分片上传会话的唯一分片
+func uploadChunk(e *testEnv) {
+	code, body := e.do(http.MethodPut, "/api/v1/uploads/{upload}/chunks/0", chunkBody(e))
+	if code != http.StatusOK {
+		e.t.Fatalf("upload chunk: %d %s", code, body)
+	}
+}
+
+func chunkBody(e *testEnv) *requestBody {
+	data := []byte(e.ids["upload_data"])
+	return &requestBody{content: data, contentType: "application/octet-stream", headers: map[string]string{"X-Chunk-SHA256": sha256Hex(data)}}
+}
+
+// replaceFixture 替换测试图片的文件，产生版本 1 的历史记录
+func replaceFixture(e *testEnv) {
+	code, body := e.do(http.MethodPut, "/api/v1/images/{image}/file", multipartBody("file", map[string][]byte{"new.png": testPNG(2)}, nil))
+	if code != http.StatusOK {
+		e.t.Fatalf("replace file: %d %s", code, body)
+	}
+}
+
+var routeCases = []routeCase{
+	// 公开分享页面
+	{name: "share page", method: "GET", path: "/s/{share}", want: 200},
+	{name: "share page missing", method: "GET", path: "/s/missing-share-token", want: 404},
+	{name: "share page locked", method: "GET", path: "/s/{locked}", want: 200, check: func(t *testing.T, e *testEnv, body string) {
+		if !strings.Contains(body, `type="password"`) {
+			t.Errorf("locked share should render the password form")
+		}
+	}},
+	{name: "unlock share", method: "POST", path: "/s/{locked}", body: staticBody(formBody(url.Values{"password": {"secret"}})), want: 303},
+	{name: "unlock share wrong password", method: "POST", path: "/s/{locked}", body: staticBody(formBody(url.Values{"password": {"nope"}})), want: 401},
+	{name: "unlock share missing", method: "POST", path: "/s/missing-share-token", want: 404},
+	{name: "shared image", method: "GET", path: "/s/{share}/images/{image}", want: 200, check: func(t *testing.T, e *testEnv, body string) {
+		if want, _ := e.storage.Object("img_fixture.png"); body != string(want) {
+			t.Errorf("shared image content does not match the stored file")
+		}
+	}},
+	{name: "shared image not in share", method: "GET", path: "/s/{share}/images/img_other", want: 404},
+	{name: "shared image locked", method: "GET", path: "/s/{locked}/images/{image}", want: 401},
+
+	// 上传
+	{name: "upload", method: "POST", path: "/api/v1/images/upload", body: staticBody(multipartBody("file", map[string][]byte{"a.png": testPNG(3)}, map[string]string{"description": "uploaded"})), want: 201},
+	{name: "upload without file", method: "POST", path: "/api/v1/images/upload", body: staticBody(multipartBody("other", nil, map[string]string{"description": "x"})), want: 400},
+	{name: "upload from url", method: "POST", path: "/api/v1/images/upload-url", body: func(e *testEnv) *requestBody {
+		return jsonBody(map[string]string{"url": e.ids["remote"]})
+	}, want: 201},
+	{name: "upload from url not found", method: "POST", path: "/api/v1/images/upload-url", body: func(e *testEnv) *requestBody {
+		return jsonBody(map[string]string{"url": e.remote.URL + "/missing.png"})
+	}, want: 502},
+	{name: "batch upload", method: "POST", path: "/api/v1/images/batch-upload", body: staticBody(multipartBody("files", map[string][]byte{"b.png": testPNG(4), "c.png": testPNG(6)}, nil)), want: 200},
+	{name: "batch upload auto tag", method: "POST", path: "/api/v1/images/batch-upload", body: staticBody(multipartBody("files", map[string][]byte{"b.png": testPNG(4)}, map[string]string{"auto_tag": "true"})), want: 200},
+	{name: "batch upload auto tag without llm", method: "POST", path: "/api/v1/images/batch-upload", noTagger: true, body: staticBody(multipartBody("files", map[string][]byte{"b.png": testPNG(4)}, map[string]string{"auto_tag": "true"})), want: 503},
+
+	// 分片上传
+	{name: "create upload", method: "POST", path: "/api/v1/uploads", body: staticBody(jsonBody(map[string]interface{}{"filename": "big.png", "size": 1024})), want: 201},
+	{name: "get upload", method: "GET", path: "/api/v1/uploads/{upload}", want: 200},
+	{name: "get upload missing", method: "GET", path: "/api/v1/uploads/upl_missing", want: 404},
+	{name: "upload chunk", method: "PUT", path: "/api/v1/uploads/{upload}/chunks/0", body: chunkBody, want: 200},
+	{name: "upload chunk missing session", method: "PUT", path: "/api/v1/uploads/upl_missing/chunks/0", body: chunkBody, want: 404},
+	{name: "complete upload", method: "POST", path: "/api/v1/uploads/{upload}/complete", setup: uploadChunk, want: 201},
+	{name: "complete upload missing", method: "POST", path: "/api/v1/uploads/upl_missing/complete", want: 404},
+	{name: "abort upload", method: "DELETE", path: "/api/v1/uploads/{upload}", want: 200},
+	{name: "abort upload missing", method: "DELETE", path: "/api/v1/uploads/upl_missing", want: 404},
+
+	// 图片
+	{name: "batch delete", method: "POST", path: "/api/v1/images/batch-delete", body: staticBody(jsonBody(map[string][]string{"image_ids": {"img_fixture", "img_missing"}})), want: 200},
+	{name: "list images", method: "GET", path: "/api/v1/images", want: 200, check: func(t *testing.T, e *testEnv, body string) {
+		if total := jsonField(t, body, "data", "total"); total != float64(1) {
+			t.Errorf("total = %v, want 1", total)
+		}
+	}},
+	{name: "list images invalid cursor", method: "GET", path: "/api/v1/images?cursor=bogus", want: 400},
+	{name: "list images tag cursor", method: "GET", path: "/api/v1/images?cursor={tag_cursor}", want: 400},
+	{name: "list images invalid filter", method: "GET", path: "/api/v1/images?min_width=-1", want: 400, check: func(t *testing.T, e *testEnv, body string) {
+		if msg := jsonField(t, body, "message"); msg != "invalid min_width parameter" {
+			t.Errorf("message = %v", msg)
+		}
+	}},
+	{name: "list images invalid date", method: "GET", path: "/api/v1/images?uploaded_after=yesterday", want: 400},
+	{name: "list duplicates", method: "GET", path: "/api/v1/images/duplicates", want: 200},
+	{name: "image detail", method: "GET", path: "/api/v1/images/{image}", want: 200},
+	{name: "image detail missing", method: "GET", path: "/api/v1/images/img_missing", want: 404},
+	{name: "update description", method: "PUT", path: "/api/v1/images/{image}", body: staticBody(jsonBody(map[string]string{"description": "updated"})), want: 200},
+	{name: "update description missing", method: "PUT", path: "/api/v1/images/img_missing", body: staticBody(jsonBody(map[string]string{"description": "updated"})), want: 404},
+	{name: "delete image", method: "DELETE", path: "/api/v1/images/{image}", want: 200, check: func(t *testing.T, e *testEnv, body string) {
+		if _, ok := e.storage.Object("img_fixture.png"); ok {
+			t.Errorf("deleted image file should be removed from storage")
+		}
+	}},
+	{name: "delete image missing", method: "DELETE", path: "/api/v1/images/img_missing", want: 404},
+	{name: "similar images", method: "GET", path: "/api/v1/images/{image}/similar", want: 200},
+	{name: "similar images missing", method: "GET", path: "/api/v1/images/img_missing/similar", want: 404},
+	{name: "replace file", method: "PUT", path: "/api/v1/images/{image}/file", body: staticBody(multipartBody("file", map[string][]byte{"new.png": testPNG(2)}, nil)), want: 200},
+	{name: "replace file missing", method: "PUT", path: "/api/v1/images/img_missing/file", body: staticBody(multipartBody("file", map[string][]byte{"new.png": testPNG(2)}, nil)), want: 404},
+	{name: "list versions", method: "GET", path: "/api/v1/images/{image}/versions", setup: replaceFixture, want: 200},
+	{name: "list versions missing", method: "GET", path: "/api/v1/images/img_missing/versions", want: 404},
+	{name: "rollback", method: "POST", path: "/api/v1/images/{image}/versions/1/rollback", setup: replaceFixture, want: 200},
+	{name: "rollback missing version", method: "POST", path: "/api/v1/images/{image}/versions/7/rollback", want: 404},
+	{name: "rollback missing image", method: "POST", path: "/api/v1/images/img_missing/versions/1/rollback", want: 404},
+
+	// 标签
+	{name: "update tags", method: "PUT", path: "/api/v1/images/{image}/tags", body: staticBody(jsonBody(map[string][]string{"tags": {"sea", "sun"}})), want: 200},
+	{name: "update tags missing", method: "PUT", path: "/api/v1/images/img_missing/tags", body: staticBody(jsonBody(map[string][]string{"tags": {"sea"}})), want: 404},
+	{name: "generate tags", method: "POST", path: "/api/v1/images/{image}/tags/generate", body: staticBody(jsonBody(map[string]string{})), want: 200, check: func(t *testing.T, e *testEnv, body string) {
+		if calls := e.tagger.Calls(); len(calls) != 1 {
+			t.Errorf("tag generator called %d times, want 1", len(calls))
+		}
+	}},
+	{name: "generate tags llm error", method: "POST", path: "/api/v1/images/{image}/tags/generate", body: staticBody(jsonBody(map[string]string{})), setup: func(e *testEnv) {
+		e.tagger.Err = errors.New("model overloaded")
+	}, want: 503},
+	{name: "generate tags missing", method: "POST", path: "/api/v1/images/img_missing/tags/generate", body: staticBody(jsonBody(map[string]string{})), want: 404},
+	{name: "generate tags without llm", method: "POST", path: "/api/v1/images/{image}/tags/generate", noTagger: true, body: staticBody(jsonBody(map[string]string{})), want: 503},
+	{name: "list tags", method: "GET", path: "/api/v1/tags", want: 200},
+	{name: "list tags cursor", method: "GET", path: "/api/v1/tags?cursor={tag_cursor}", want: 200},
+	{name: "list tags picture cursor", method: "GET", path: "/api/v1/tags?cursor={picture_cursor}", want: 400},
+
+	// 搜索
+	{name: "search exact", method: "GET", path: "/api/v1/search/exact?tags=sky,blue", want: 200, check: func(t *testing.T, e *testEnv, body string) {
+		if total := jsonField(t, body, "data", "total"); total != float64(1) {
+			t.Errorf("total = %v, want 1", total)
+		}
+	}},
+	{name: "search exact without tags", method: "GET", path: "/api/v1/search/exact", want: 400},
+	{name: "search relevance", method: "GET", path: "/api/v1/search/relevance?tags=sky,sea", want: 200},
+	{name: "search text", method: "GET", path: "/api/v1/search/text?q=SK%20blu", want: 200, check: func(t *testing.T, e *testEnv, body string) {
+		if total := jsonField(t, body, "data", "total"); total != float64(1) {
+			t.Errorf("total = %v, want 1", total)
+		}
+	}},
+	{name: "search text without query", method: "GET", path: "/api/v1/search/text?q=%20", want: 400},
+
+	// 导出
+	{name: "export", method: "GET", path: "/api/v1/export?tags=sky", want: 200},
+
+	// 相册
+	{name: "create album", method: "POST", path: "/api/v1/albums", body: staticBody(jsonBody(map[string]string{"name": "New"})), want: 201},
+	{name: "create album without name", method: "POST", path: "/api/v1/albums", body: staticBody(jsonBody(map[string]string{})), want: 400},
+	{name: "list albums", method: "GET", path: "/api/v1/albums", want: 200},
+	{name: "album detail", method: "GET", path: "/api/v1/albums/{album}", want: 200},
+	{name: "album detail missing", method: "GET", path: "/api/v1/albums/alb_missing", want: 404},
+	{name: "update album", method: "PUT", path: "/api/v1/albums/{album}", body: staticBody(jsonBody(map[string]string{"name": "Renamed"})), want: 200},
+	{name: "update album missing", method: "PUT", path: "/api/v1/albums/alb_missing", body: staticBody(jsonBody(map[string]string{"name": "Renamed"})), want: 404},
+	{name: "delete album", method: "DELETE", path: "/api/v1/albums/{album}", want: 200},
+	{name: "delete album missing", method: "DELETE", path: "/api/v1/albums/alb_missing", want: 404},
+	{name: "add album images", method: "POST", path: "/api/v1/albums/{album}/images", body: staticBody(jsonBody(map[string][]string{"image_ids": {"img_fixture"}})), want: 200},
+	{name: "add album images missing album", method: "POST", path: "/api/v1/albums/alb_missing/images", body: staticBody(jsonBody(map[string][]string{"image_ids": {"img_fixture"}})), want: 404},
+	{name: "remove album images", method: "POST", path: "/api/v1/albums/{album}/images/batch-remove", body: staticBody(jsonBody(map[string][]string{"image_ids": {"img_fixture"}})), want: 200},
+	{name: "remove album images missing album", method: "POST", path: "/api/v1/albums/alb_missing/images/batch-remove", body: staticBody(jsonBody(map[string][]string{"image_ids": {"img_fixture"}})), want: 404},
+	{name: "reorder album images", method: "PUT", path: "/api/v1/albums/{album}/images/order", body: staticBody(jsonBody(map[string][]string{"image_ids": {"img_fixture"}})), want: 200},
+	{name: "reorder album images missing album", method: "PUT", path: "/api/v1/albums/alb_missing/images/order", body: staticBody(jsonBody(map[string][]string{"image_ids": {"img_fixture"}})), want: 404},
+
+	// 分享链接
+	{name: "create share", method: "POST", path: "/api/v1/shares", body: staticBody(jsonBody(map[string]string{"target_type": "image", "target_id": "img_fixture"})), want: 201},
+	{name: "create share missing target", method: "POST", path: "/api/v1/shares", body: staticBody(jsonBody(map[string]string{"target_type": "album", "target_id": "alb_missing"})), want: 404},
+	{name: "list shares", method: "GET", path: "/api/v1/shares", want: 200},
+	{name: "share detail", method: "GET", path: "/api/v1/shares/{share}", want: 200},
+	{name: "share detail missing", method: "GET", path: "/api/v1/shares/missing-share-token", want: 404},
+	{name: "revoke share", method: "POST", path: "/api/v1/shares/{share}/revoke", want: 200},
+	{name: "revoke share missing", method: "POST", path: "/api/v1/shares/missing-share-token/revoke", want: 404},
+
+	// 审计日志和事件流
+	{name: "audit log", method: "GET", path: "/api/v1/audit?action=image.", setup: replaceFixture, want: 200, check: func(t *testing.T, e *testEnv, body string) {
+		if total := jsonField(t, body, "data", "total"); total != float64(1) {
+			t.Errorf("total = %v, want 1", total)
+		}
+	}},
+	{name: "events", method: "GET", path: "/api/v1/events?types=image.", stream: true, want: 200},
+	{name: "events invalid type", method: "GET", path: "/api/v1/events?types=bogus", want: 400},
+
+	// Webhook
+	{name: "create webhook", method: "POST", path: "/api/v1/webhooks", body: staticBody(jsonBody(map[string]interface{}{"url": "https://hooks.example.com/new", "events": []string{"image."}})), want: 201},
+	{name: "create webhook invalid url", method: "POST", path: "/api/v1/webhooks", body: staticBody(jsonBody(map[string]string{"url": "ftp://example.com"})), want: 400},
+	{name: "list webhooks", method: "GET", path: "/api/v1/webhooks", want: 200},
+	{name: "webhook detail", method: "GET", path: "/api/v1/webhooks/{webhook}", want: 200},
+	{name: "webhook detail missing", method: "GET", path: "/api/v1/webhooks/whk_missing", want: 404},
+	{name: "update webhook", method: "PUT", path: "/api/v1/webhooks/{webhook}", body: staticBody(jsonBody(map[string]bool{"active": false})), want: 200},
+	{name: "update webhook missing", method: "PUT", path: "/api/v1/webhooks/whk_missing", body: staticBody(jsonBody(map[string]bool{"active": false})), want: 404},
+	{name: "delete webhook", method: "DELETE", path: "/api/v1/webhooks/{webhook}", want: 200},
+	{name: "delete webhook missing", method: "DELETE", path: "/api/v1/webhooks/whk_missing", want: 404},
+	{name: "ping webhook", method: "POST", path: "/api/v1/webhooks/{webhook}/ping", want: 202},
+	{name: "ping webhook missing", method: "POST", path: "/api/v1/webhooks/whk_missing/ping", want: 404},
+	{name: "webhook deliveries", method: "GET", path: "/api/v1/webhooks/{webhook}/deliveries", want: 200},
+	{name: "webhook deliveries missing", method: "GET", path: "/api/v1/webhooks/whk_missing/deliveries", want: 404},
+	{name: "redeliver", method: "POST", path: "/api/v1/webhooks/{webhook}/deliveries/{delivery}/redeliver", want: 202},
+	{name: "redeliver missing delivery", method: "POST", path: "/api/v1/webhooks/{webhook}/deliveries/999/redeliver", want: 404},
+}
+
+func TestRoutes(t *testing.T) {
+	for _, tc := range routeCases {
+		tc := tc
+		t.Run(tc.name, func(t *testing.T) {
+			e := newTestEnv(t, !tc.noTagger)
+			if tc.setup != nil {
+				tc.setup(e)
+			}
+			var body *requestBody
+			if tc.body != nil {
+				body = tc.body(e)
+			}
+
+			ctx := context.Background()
+			if tc.stream {
+				var cancel context.CancelFunc
+				ctx, cancel = context.WithTimeout(ctx, 50*time.Millisecond)
+				defer cancel()
+			}
+			w := e.request(ctx, tc.method, tc.path, body)
+			if w.Code != tc.want {
+				t.Fatalf("%s %s = %d, want %d: %s", tc.method, e.expand(tc.path), w.Code, tc.want, w.Body.String())
+			}
+			if tc.check != nil {
+				tc.check(t, e, w.Body.String())
+			}
+		})
+	}
+}
+
+// TestRoutesCovered 每个注册的路由都至少有一个成功的请求用例
+func TestRoutesCovered(t *testing.T) {
+	covered := make(map[string]bool)
+	router := gin.New()
+	NewHandler(fakes.NewStore(), fakes.NewStorage(), nil).RegisterRoutes(router)
+	for _, route := range router.Routes() {
+		covered[route.Method+" "+route.Path] = false
+	}
+
+	for _, tc := range routeCases {
+		if tc.want >= 400 {
+			continue
+		}
+		path, _, _ := strings.Cut(tc.path, "?")
+		for _, route := range router.Routes() {
+			if route.Method == tc.method && routeMatches(route.Path, path) {
+				covered[route.Method+" "+route.Path] = true
+			}
+		}
+	}
+	for route, ok := range covered {
+		if !ok {
+			t.Errorf("route %s has no successful test case", route)
+		}
+	}
+}
+
+// routeMatches 路由模板（/images/:image_id）是否匹配用例路径（/images/{image}）
+func routeMatches(template, path string) bool {
+	tparts := strings.Split(template, "/")
+	pparts := strings.Split(path, "/")
+	if len(tparts) != len(pparts) {
+		return false
+	}
+	for i := range tparts {
+		if strings.HasPrefix(tparts[i], ":") {
+			continue
+		}
+		if tparts[i] != pparts[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// TestStoreErrors 数据库故障时返回 500
+func TestStoreErrors(t *testing.T) {
+	e := newTestEnv(t, true)
+	e.store.Err = errors.New("database is locked")
+	for _, path := range []string{"/api/v1/images", "/api/v1/images/{image}", "/api/v1/tags", "/api/v1/albums", "/api/v1/shares", "/api/v1/audit", "/api/v1/webhooks"} {
+		if code, body := e.do(http.MethodGet, path, nil); code != http.StatusInternalServerError {
+			t.Errorf("GET %s = %d, want 500: %s", path, code, body)
+		}
+	}
+}
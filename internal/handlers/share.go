@@ -0,0 +1,620 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"database/sql"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vaaandark/PixelHub/internal/database"
+	"golang.org/x/crypto/bcrypt"
+)
+
+const (
+	// defaultShareTTL 分享链接默认有效期
+	defaultShareTTL = 7 * 24 * time.Hour
+	// maxShareTTL 分享链接最长有效期
+	maxShareTTL = 365 * 24 * time.Hour
+	// maxSharedImages 标签分享页面最多展示的图片数量
+	maxSharedImages = 200
+
+	// sharePasswordWindow 统计分享密码错误次数的时间窗口
+	sharePasswordWindow = 15 * time.Minute
+	// maxSharePasswordFailuresPerIP 同一 IP 在窗口内对同一链接最多输错密码的次数
+	maxSharePasswordFailuresPerIP = 5
+	// maxSharePasswordFailures 窗口内所有 IP 对同一链接最多输错密码的次数，防止分散 IP 暴力破解
+	maxSharePasswordFailures = 50
+)
+
+// failureLimiter 按 key 统计固定时间窗口内的失败次数（进程内）
+type failureLimiter struct {
+	mu      sync.Mutex
+	window  time.Duration
+	entries map[string]*failureWindow
+}
+
+type failureWindow struct {
+	count int
+	reset time.Time
+}
+
+func newFailureLimiter(window time.Duration) *failureLimiter {
+	return &failureLimiter{window: window, entries: make(map[string]*failureWindow)}
+}
+
+// blocked key 在当前窗口内的失败次数已达到 limit 时返回 true 和窗口剩余时间
+func (l *failureLimiter) blocked(key string, limit int, now time.Time) (bool, time.Duration) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	e, ok := l.entries[key]
+	if !ok || !now.Before(e.reset) {
+		return false, 0
+	}
+	return e.count >= limit, e.reset.Sub(now)
+}
+
+// fail 记录一次失败
+func (l *failureLimiter) fail(key string, now time.Time) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if len(l.entries) >= 4096 {
+		// 清理已过期的窗口，避免大量不同 key 占用内存
+		for k, e := range l.entries {
+			if !now.Before(e.reset) {
+				delete(l.entries, k)
+			}
+		}
+	}
+	e, ok := l.entries[key]
+	if !ok || !now.Before(e.reset) {
+		e = &failureWindow{reset: now.Add(l.window)}
+		l.entries[key] = e
+	}
+	e.count++
+}
+
+// reset 清除 key 的失败记录
+func (l *failureLimiter) reset(key string) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	delete(l.entries, key)
+}
+
+// generateShareToken 生成不可猜测的分享 token
+func generateShareToken() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// shareURL 根据请求推断分享链接的完整地址
+func shareURL(c *gin.Context, token string) string {
+	scheme := "http"
+	if c.Request.TLS != nil {
+		scheme = "https"
+	}
+	if proto := c.GetHeader("X-Forwarded-Proto"); proto != "" {
+		scheme = proto
+	}
+	return scheme + "://" + c.Request.Host + "/s/" + token
+}
+
+// CreateShareLink 创建分享链接
+func (h *Handler) CreateShareLink(c *gin.Context) {
+	var req struct {
+		TargetType string   `json:"target_type" binding:"required"` // image / album / tags
+		TargetID   string   `json:"target_id"`                      // 图片 ID 或相册 ID
+		Tags       []string `json:"tags"`                           // target_type 为 tags 时使用
+		ExpiresIn  int      `json:"expires_in"`                     // 有效期（秒），默认 7 天
+		Password   string   `json:"password"`                       // 访问密码（可选）
+	}
+
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "Invalid request",
+		})
+		return
+	}
+
+	ttl := defaultShareTTL
+	if req.ExpiresIn != 0 {
+		ttl = time.Duration(req.ExpiresIn) * time.Second
+		if ttl <= 0 || ttl > maxShareTTL {
+			c.JSON(http.StatusBadRequest, Response{
+				Code:    400,
+				Message: "expires_in must be between 1 second and 365 days",
+			})
+			return
+		}
+	}
+
+	// 校验分享目标
+	targetID := req.TargetID
+	var err error
+	switch req.TargetType {
+	case database.ShareTargetImage:
+		_, err = h.store.GetPicture(targetID)
+	case database.ShareTargetAlbum:
+		_, err = h.store.GetAlbum(targetID)
+	case database.ShareTargetTags:
+		var tags []string
+		for _, tag := range req.Tags {
+			if tag = strings.TrimSpace(tag); tag != "" {
+				tags = append(tags, tag)
+			}
+		}
+		if len(tags) == 0 {
+			c.JSON(http.StatusBadRequest, Response{
+				Code:    400,
+				Message: "Tags are required for tag shares",
+			})
+			return
+		}
+		targetID = strings.Join(tags, ",")
+	default:
+		c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "target_type must be one of image, album, tags",
+		})
+		return
+	}
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, Response{
+				Code:    404,
+				Message: "Share target not found",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: "Failed to get share target",
+		})
+		return
+	}
+
+	token, err := generateShareToken()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: "Failed to generate share token",
+		})
+		return
+	}
+
+	share := &database.ShareLink{
+		Token:      token,
+		TargetType: req.TargetType,
+		TargetID:   targetID,
+		ExpiresAt:  time.Now().Add(ttl).UTC().Truncate(time.Second),
+	}
+	if req.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(req.Password), bcrypt.DefaultCost)
+		if err != nil {
+			c.JSON(http.StatusInternalServerError, Response{
+				Code:    500,
+				Message: "Failed to hash password",
+			})
+			return
+		}
+		share.PasswordHash = string(hash)
+		share.HasPassword = true
+	}
+
+	if err := h.store.CreateShareLink(share); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: fmt.Sprintf("Failed to create share link: %v", err),
+		})
+		return
+	}
+
+	created, err := h.store.GetShareLink(token)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: "Failed to get share link",
+		})
+		return
+	}
+	h.audit(c, auditShareCreate, "share", token, nil, created)
+
+	c.JSON(http.StatusCreated, Response{
+		Code:    201,
+		Message: "Share link created successfully",
+		Data: map[string]interface{}{
+			"share": created,
+			"url":   shareURL(c, token),
+		},
+	})
+}
+
+// ListShareLinks 列出分享链接
+func (h *Handler) ListShareLinks(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	links, total, err := h.store.ListShareLinks(page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: "Failed to list share links",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{
+		Code:    200,
+		Message: "Success",
+		Data: map[string]interface{}{
+			"total":        total,
+			"current_page": page,
+			"shares":       links,
+		},
+	})
+}
+
+// GetShareLinkDetail 获取分享链接详情
+func (h *Handler) GetShareLinkDetail(c *gin.Context) {
+	share, err := h.store.GetShareLink(c.Param("token"))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, Response{
+				Code:    404,
+				Message: "Share link not found",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: "Failed to get share link",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{
+		Code:    200,
+		Message: "Success",
+		Data: map[string]interface{}{
+			"share": share,
+			"url":   shareURL(c, share.Token),
+		},
+	})
+}
+
+// RevokeShareLink 撤销分享链接
+func (h *Handler) RevokeShareLink(c *gin.Context) {
+	token := c.Param("token")
+
+	share, err := h.store.GetShareLink(token)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, Response{
+				Code:    404,
+				Message: "Share link not found",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: "Failed to get share link",
+		})
+		return
+	}
+
+	if err := h.store.RevokeShareLink(token); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: "Failed to revoke share link",
+		})
+		return
+	}
+	h.audit(c, auditShareRevoke, "share", token, map[string]interface{}{"revoked": share.Revoked},
+		map[string]interface{}{"revoked": true})
+
+	c.JSON(http.StatusOK, Response{
+		Code:    200,
+		Message: "Share link revoked successfully",
+	})
+}
+
+// ---- 公开访问（/s/:token） ----
+
+var sharePageTemplate = template.Must(template.New("share").Parse(`<!DOCTYPE html>
+<html lang="zh-CN">
+<head>
+<meta charset="UTF-8">
+<meta name="viewport" content="width=device-width, initial-scale=1.0">
+<meta name="robots" content="noindex">
+<title>{{.Title}} - PixelHub</title>
+<style>
+body { margin: 0; font-family: -apple-system, BlinkMacSystemFont, "Segoe UI", sans-serif; background: #f8fafc; color: #1e293b; }
+main { max-width: 1100px; margin: 0 auto; padding: 2rem 1rem; }
+h1 { font-size: 1.5rem; margin: 0 0 1.5rem; }
+.grid { display: grid; grid-template-columns: repeat(auto-fill, minmax(240px, 1fr)); gap: 1rem; }
+.single img { max-width: 100%; }
+figure { margin: 0; background: #fff; border-radius: 8px; overflow: hidden; box-shadow: 0 1px 3px rgba(0,0,0,.1); }
+figure img { display: block; width: 100%; }
+figcaption { padding: .5rem .75rem; font-size: .875rem; color: #64748b; }
+form { display: flex; gap: .5rem; max-width: 360px; }
+input { flex: 1; padding: .5rem; border: 1px solid #cbd5e1; border-radius: 6px; }
+button { padding: .5rem 1rem; border: 0; border-radius: 6px; background: #6366f1; color: #fff; cursor: pointer; }
+.error { color: #ef4444; }
+</style>
+</head>
+<body>
+<main>
+<h1>{{.Title}}</h1>
+{{if .Message}}<p class="{{if .IsError}}error{{end}}">{{.Message}}</p>{{end}}
+{{if .NeedPassword}}
+<form method="post">
+<input type="password" name="password" placeholder="访问密码" autofocus required>
+<button type="submit">查看</button>
+</form>
+{{else if .Images}}
+<div class="{{if eq (len .Images) 1}}single{{else}}grid{{end}}">
+{{range .Images}}<figure><a href="{{.Src}}" target="_blank"><img src="{{.Src}}" alt="{{.Description}}" loading="lazy"></a>{{if .Description}}<figcaption>{{.Description}}</figcaption>{{end}}</figure>
+{{end}}
+</div>
+{{end}}
+</main>
+</body>
+</html>`))
+
+type sharePageImage struct {
+	Src         string
+	Description string
+}
+
+type sharePageData struct {
+	Title        string
+	Message      string
+	IsError      bool
+	NeedPassword bool
+	Images       []sharePageImage
+}
+
+func renderSharePage(c *gin.Context, status int, data sharePageData) {
+	c.Header("Content-Type", "text/html; charset=utf-8")
+	c.Header("Cache-Control", "no-store")
+	c.Status(status)
+	if err := sharePageTemplate.Execute(c.Writer, data); err != nil {
+		log.Printf("Warning: Failed to render share page: %v", err)
+	}
+}
+
+// shareCookieName 每个分享链接独立的密码验证 cookie
+func shareCookieName(token string) string {
+	return "pixelhub_share_" + token[:8]
+}
+
+// shareCookieValue 密码验证通过后的 cookie 值，由服务端保存的密码哈希派生，客户端无法伪造
+func shareCookieValue(share *database.ShareLink) string {
+	sum := sha256.Sum256([]byte(share.Token + ":" + share.PasswordHash))
+	return hex.EncodeToString(sum[:])
+}
+
+// loadActiveShare 获取有效的分享链接，无效时渲染错误页面并返回 nil
+func (h *Handler) loadActiveShare(c *gin.Context) *database.ShareLink {
+	share, err := h.store.GetShareLink(c.Param("token"))
+	if err != nil {
+		if err == sql.ErrNoRows {
+			renderSharePage(c, http.StatusNotFound, sharePageData{Title: "链接不存在", Message: "分享链接不存在或已被撤销。", IsError: true})
+			return nil
+		}
+		renderSharePage(c, http.StatusInternalServerError, sharePageData{Title: "出错了", Message: "获取分享链接失败，请稍后重试。", IsError: true})
+		return nil
+	}
+	if share.Revoked {
+		renderSharePage(c, http.StatusNotFound, sharePageData{Title: "链接不存在", Message: "分享链接不存在或已被撤销。", IsError: true})
+		return nil
+	}
+	if share.Expired(time.Now()) {
+		renderSharePage(c, http.StatusGone, sharePageData{Title: "链接已过期", Message: "分享链接已过期。", IsError: true})
+		return nil
+	}
+	return share
+}
+
+// shareUnlocked 无密码或已通过密码验证
+func shareUnlocked(c *gin.Context, share *database.ShareLink) bool {
+	if !share.HasPassword {
+		return true
+	}
+	cookie, err := c.Cookie(shareCookieName(share.Token))
+	if err != nil {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(cookie), []byte(shareCookieValue(share))) == 1
+}
+
+// sharedPictures 分享目标包含的图片
+func (h *Handler) sharedPictures(share *database.ShareLink) ([]database.PictureWithTags, string, error) {
+	switch share.TargetType {
+	case database.ShareTargetImage:
+		pic, err := h.store.GetPicture(share.TargetID)
+		if err == sql.ErrNoRows {
+			return nil, "分享的图片", nil
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		return []database.PictureWithTags{{Picture: *pic}}, "分享的图片", nil
+	case database.ShareTargetAlbum:
+		album, err := h.store.GetAlbum(share.TargetID)
+		if err == sql.ErrNoRows {
+			return nil, "分享的相册", nil
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		items, err := h.store.ListAlbumItems(album.ID)
+		if err != nil {
+			return nil, "", err
+		}
+		pics := make([]database.PictureWithTags, len(items))
+		for i, item := range items {
+			pics[i] = item.PictureWithTags
+		}
+		return pics, album.Name, nil
+	case database.ShareTargetTags:
+		tags := strings.Split(share.TargetID, ",")
+		pics, _, err := h.store.SearchExact(tags, database.PictureFilter{}, 1, maxSharedImages, nil)
+		if err != nil {
+			return nil, "", err
+		}
+		return pics, "标签：" + strings.Join(tags, "、"), nil
+	}
+	return nil, "", fmt.Errorf("unknown share target type: %s", share.TargetType)
+}
+
+// ServeShare 分享页面（公开访问）
+func (h *Handler) ServeShare(c *gin.Context) {
+	share := h.loadActiveShare(c)
+	if share == nil {
+		return
+	}
+
+	if !shareUnlocked(c, share) {
+		renderSharePage(c, http.StatusOK, sharePageData{Title: "需要密码", Message: "此分享链接需要密码才能查看。", NeedPassword: true})
+		return
+	}
+
+	pics, title, err := h.sharedPictures(share)
+	if err != nil {
+		renderSharePage(c, http.StatusInternalServerError, sharePageData{Title: "出错了", Message: "加载图片失败，请稍后重试。", IsError: true})
+		return
+	}
+
+	if err := h.store.IncrementShareViews(share.Token); err != nil {
+		log.Printf("Warning: Failed to increment share view count: %v", err)
+	}
+
+	data := sharePageData{Title: title}
+	for _, pic := range pics {
+		data.Images = append(data.Images, sharePageImage{
+			Src:         "/s/" + share.Token + "/images/" + pic.ID,
+			Description: pic.Description,
+		})
+	}
+	if len(data.Images) == 0 {
+		data.Message = "这里还没有图片。"
+	}
+	renderSharePage(c, http.StatusOK, data)
+}
+
+// UnlockShare 提交分享密码（公开访问）
+func (h *Handler) UnlockShare(c *gin.Context) {
+	share := h.loadActiveShare(c)
+	if share == nil {
+		return
+	}
+
+	if share.HasPassword {
+		// 按链接 + IP 和按链接分别限制密码错误次数
+		now := time.Now()
+		ipKey := share.Token + "|" + c.ClientIP()
+		blockedIP, waitIP := h.sharePasswords.blocked(ipKey, maxSharePasswordFailuresPerIP, now)
+		blockedAll, waitAll := h.sharePasswords.blocked(share.Token, maxSharePasswordFailures, now)
+		if blockedIP || blockedAll {
+			wait := waitIP
+			if blockedAll && waitAll > wait {
+				wait = waitAll
+			}
+			c.Header("Retry-After", strconv.Itoa(int(wait.Seconds())+1))
+			renderSharePage(c, http.StatusTooManyRequests, sharePageData{Title: "需要密码", Message: "密码错误次数过多，请稍后再试。", IsError: true})
+			return
+		}
+
+		password := c.PostForm("password")
+		if bcrypt.CompareHashAndPassword([]byte(share.PasswordHash), []byte(password)) != nil {
+			h.sharePasswords.fail(ipKey, now)
+			h.sharePasswords.fail(share.Token, now)
+			renderSharePage(c, http.StatusUnauthorized, sharePageData{Title: "需要密码", Message: "密码错误，请重试。", IsError: true, NeedPassword: true})
+			return
+		}
+		h.sharePasswords.reset(ipKey)
+		maxAge := int(time.Until(share.ExpiresAt).Seconds())
+		c.SetSameSite(http.SameSiteLaxMode)
+		c.SetCookie(shareCookieName(share.Token), shareCookieValue(share), maxAge, "/s/"+share.Token, "", c.Request.TLS != nil, true)
+	}
+
+	c.Redirect(http.StatusSeeOther, "/s/"+share.Token)
+}
+
+// ServeSharedImage 通过分享链接代理图片内容（公开访问），不暴露原始存储地址
+func (h *Handler) ServeSharedImage(c *gin.Context) {
+	share := h.loadActiveShare(c)
+	if share == nil {
+		return
+	}
+	if !shareUnlocked(c, share) {
+		c.Status(http.StatusUnauthorized)
+		return
+	}
+
+	pics, _, err := h.sharedPictures(share)
+	if err != nil {
+		c.Status(http.StatusInternalServerError)
+		return
+	}
+
+	imageID := c.Param("image_id")
+	var target *database.PictureWithTags
+	for i := range pics {
+		if pics[i].ID == imageID {
+			target = &pics[i]
+			break
+		}
+	}
+	if target == nil {
+		c.Status(http.StatusNotFound)
+		return
+	}
+
+	h.proxyImage(c, &target.Picture)
+}
+
+// proxyImage 从存储读取图片并转发给客户端
+func (h *Handler) proxyImage(c *gin.Context, pic *database.Picture) {
+	rc, err := h.storage.Get(pic.StorageKey)
+	if err != nil {
+		log.Printf("Warning: Failed to read %s for share: %v", pic.StorageKey, err)
+		c.Status(http.StatusBadGateway)
+		return
+	}
+	defer rc.Close()
+
+	contentType := pic.MIMEType
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	c.Header("Content-Type", contentType)
+	c.Header("Cache-Control", "private, max-age=300")
+	c.Status(http.StatusOK)
+	if _, err := io.Copy(c.Writer, rc); err != nil {
+		log.Printf("Warning: Failed to proxy image: %v", err)
+	}
+}
@@ -0,0 +1,228 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vaaandark/PixelHub/internal/config"
+	"github.com/vaaandark/PixelHub/internal/database"
+	"github.com/vaaandark/PixelHub/internal/fakes"
+)
+
+// shareTestEnv 使用真实 SQLite 库的分享链接测试环境，图片内容保存在内存存储中
+type shareTestEnv struct {
+	t      *testing.T
+	db     database.Store
+	router *gin.Engine
+	image  []byte
+}
+
+func newShareTestEnv(t *testing.T) *shareTestEnv {
+	t.Helper()
+	gin.SetMode(gin.TestMode)
+	db, err := database.InitDB(&config.DatabaseConfig{Path: filepath.Join(t.TempDir(), "pixelhub.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	e := &shareTestEnv{t: t, db: db, image: []byte("\x89PNG\r\n\x1a\nshared image")}
+	storage := fakes.NewStorage()
+	if _, _, err := storage.Upload("img_1.png", bytes.NewReader(e.image), int64(len(e.image)), "image/png"); err != nil {
+		t.Fatal(err)
+	}
+	if err := db.CreatePicture(&database.Picture{ID: "img_1", StorageKey: "img_1.png", Hash: "h1", Description: "shared", MIMEType: "image/png"}); err != nil {
+		t.Fatal(err)
+	}
+
+	h := NewHandler(db, storage, nil)
+	e.router = gin.New()
+	e.router.GET("/s/:token", h.ServeShare)
+	e.router.POST("/s/:token", h.UnlockShare)
+	e.router.GET("/s/:token/images/:image_id", h.ServeSharedImage)
+	e.router.POST("/api/v1/shares", h.CreateShareLink)
+	e.router.GET("/api/v1/shares/:token", h.GetShareLinkDetail)
+	e.router.POST("/api/v1/shares/:token/revoke", h.RevokeShareLink)
+	return e
+}
+
+// do 发送请求；remoteAddr 为空时使用 httptest 的默认地址
+func (e *shareTestEnv) do(method, path, contentType, body, remoteAddr string, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if remoteAddr != "" {
+		req.RemoteAddr = remoteAddr
+	}
+	for _, c := range cookies {
+		req.AddCookie(c)
+	}
+	w := httptest.NewRecorder()
+	e.router.ServeHTTP(w, req)
+	return w
+}
+
+// createShare 通过 API 创建分享链接，返回 token
+func (e *shareTestEnv) createShare(req map[string]interface{}) string {
+	e.t.Helper()
+	body, _ := json.Marshal(req)
+	w := e.do(http.MethodPost, "/api/v1/shares", "application/json", string(body), "")
+	if w.Code != http.StatusCreated {
+		e.t.Fatalf("create share = %d %s", w.Code, w.Body.String())
+	}
+	var resp struct {
+		Data struct {
+			Share database.ShareLink `json:"share"`
+			URL   string             `json:"url"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &resp); err != nil {
+		e.t.Fatal(err)
+	}
+	if !strings.HasSuffix(resp.Data.URL, "/s/"+resp.Data.Share.Token) {
+		e.t.Errorf("share url = %q", resp.Data.URL)
+	}
+	return resp.Data.Share.Token
+}
+
+func TestShareLinkLifecycle(t *testing.T) {
+	e := newShareTestEnv(t)
+	token := e.createShare(map[string]interface{}{"target_type": "image", "target_id": "img_1"})
+
+	if w := e.do(http.MethodGet, "/s/"+token, "", "", ""); w.Code != http.StatusOK || !strings.Contains(w.Body.String(), "/s/"+token+"/images/img_1") {
+		t.Fatalf("share page = %d %s", w.Code, w.Body.String())
+	}
+	w := e.do(http.MethodGet, "/s/"+token+"/images/img_1", "", "", "")
+	if w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), e.image) || w.Header().Get("Content-Type") != "image/png" {
+		t.Errorf("shared image = %d %q", w.Code, w.Body.String())
+	}
+	// 只能访问分享目标中的图片
+	if w := e.do(http.MethodGet, "/s/"+token+"/images/img_other", "", "", ""); w.Code != http.StatusNotFound {
+		t.Errorf("image outside the share = %d, want 404", w.Code)
+	}
+	if share, err := e.db.GetShareLink(token); err != nil || share.ViewCount != 1 {
+		t.Errorf("share = %+v, %v, want 1 view", share, err)
+	}
+
+	if w := e.do(http.MethodPost, "/api/v1/shares/"+token+"/revoke", "", "", ""); w.Code != http.StatusOK {
+		t.Fatalf("revoke = %d %s", w.Code, w.Body.String())
+	}
+	if w := e.do(http.MethodGet, "/s/"+token, "", "", ""); w.Code != http.StatusNotFound {
+		t.Errorf("revoked share page = %d, want 404", w.Code)
+	}
+	if w := e.do(http.MethodGet, "/s/"+token+"/images/img_1", "", "", ""); w.Code != http.StatusNotFound {
+		t.Errorf("revoked share image = %d, want 404", w.Code)
+	}
+
+	expired := &database.ShareLink{Token: "expired-share-token", TargetType: database.ShareTargetImage, TargetID: "img_1", ExpiresAt: time.Now().Add(-time.Minute)}
+	if err := e.db.CreateShareLink(expired); err != nil {
+		t.Fatal(err)
+	}
+	if w := e.do(http.MethodGet, "/s/"+expired.Token, "", "", ""); w.Code != http.StatusGone {
+		t.Errorf("expired share page = %d, want 410", w.Code)
+	}
+	if w := e.do(http.MethodGet, "/s/no-such-share-token", "", "", ""); w.Code != http.StatusNotFound {
+		t.Errorf("unknown share page = %d, want 404", w.Code)
+	}
+}
+
+func TestCreateShareLinkValidation(t *testing.T) {
+	e := newShareTestEnv(t)
+	for _, tc := range []struct {
+		body string
+		want int
+	}{
+		{`{"target_type": "image", "target_id": "img_missing"}`, http.StatusNotFound},
+		{`{"target_type": "album", "target_id": "alb_missing"}`, http.StatusNotFound},
+		{`{"target_type": "tags", "tags": [" "]}`, http.StatusBadRequest},
+		{`{"target_type": "user", "target_id": "img_1"}`, http.StatusBadRequest},
+		{`{"target_type": "image", "target_id": "img_1", "expires_in": -1}`, http.StatusBadRequest},
+		{`{"target_type": "image", "target_id": "img_1", "expires_in": 31622400}`, http.StatusBadRequest},
+		{`{"target_type": "tags", "tags": ["sky", " sea "]}`, http.StatusCreated},
+	} {
+		if w := e.do(http.MethodPost, "/api/v1/shares", "application/json", tc.body, ""); w.Code != tc.want {
+			t.Errorf("create share %s = %d %s, want %d", tc.body, w.Code, w.Body.String(), tc.want)
+		}
+	}
+}
+
+func TestSharePassword(t *testing.T) {
+	e := newShareTestEnv(t)
+	token := e.createShare(map[string]interface{}{"target_type": "image", "target_id": "img_1", "password": "secret"})
+	form := "application/x-www-form-urlencoded"
+	const attacker, visitor = "198.51.100.7:1234", "203.0.113.9:1234"
+
+	// 解锁前只显示密码表单，图片不可访问
+	if w := e.do(http.MethodGet, "/s/"+token, "", "", ""); w.Code != http.StatusOK || strings.Contains(w.Body.String(), "/images/img_1") {
+		t.Errorf("locked share page = %d %s", w.Code, w.Body.String())
+	}
+	if w := e.do(http.MethodGet, "/s/"+token+"/images/img_1", "", "", ""); w.Code != http.StatusUnauthorized {
+		t.Errorf("locked share image = %d, want 401", w.Code)
+	}
+
+	// 同一 IP 输错 5 次后被限制，正确的密码也返回 429
+	wrong := url.Values{"password": {"guess"}}.Encode()
+	for i := 0; i < maxSharePasswordFailuresPerIP; i++ {
+		if w := e.do(http.MethodPost, "/s/"+token, form, wrong, attacker); w.Code != http.StatusUnauthorized {
+			t.Fatalf("wrong password %d = %d, want 401", i, w.Code)
+		}
+	}
+	right := url.Values{"password": {"secret"}}.Encode()
+	w := e.do(http.MethodPost, "/s/"+token, form, right, attacker)
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Retry-After") == "" {
+		t.Errorf("password after too many failures = %d (Retry-After %q), want 429", w.Code, w.Header().Get("Retry-After"))
+	}
+
+	// 其他 IP 不受影响，解锁后凭 cookie 访问
+	w = e.do(http.MethodPost, "/s/"+token, form, right, visitor)
+	if w.Code != http.StatusSeeOther {
+		t.Fatalf("unlock = %d %s, want 303", w.Code, w.Body.String())
+	}
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || !cookies[0].HttpOnly {
+		t.Fatalf("unlock cookies = %+v", cookies)
+	}
+	if w := e.do(http.MethodGet, "/s/"+token+"/images/img_1", "", "", visitor, cookies...); w.Code != http.StatusOK || !bytes.Equal(w.Body.Bytes(), e.image) {
+		t.Errorf("unlocked share image = %d", w.Code)
+	}
+	// 伪造的 cookie 无效
+	forged := &http.Cookie{Name: cookies[0].Name, Value: strings.Repeat("0", len(cookies[0].Value))}
+	if w := e.do(http.MethodGet, "/s/"+token+"/images/img_1", "", "", visitor, forged); w.Code != http.StatusUnauthorized {
+		t.Errorf("forged cookie = %d, want 401", w.Code)
+	}
+}
+
+func TestFailureLimiterWindow(t *testing.T) {
+	l := newFailureLimiter(time.Minute)
+	now := time.Now()
+	for i := 0; i < 3; i++ {
+		l.fail("k", now)
+	}
+	if blocked, wait := l.blocked("k", 3, now.Add(10*time.Second)); !blocked || wait != 50*time.Second {
+		t.Errorf("blocked = %v, %v, want true, 50s", blocked, wait)
+	}
+	if blocked, _ := l.blocked("k", 4, now); blocked {
+		t.Error("blocked below the limit")
+	}
+	// 窗口结束后重新计数
+	if blocked, _ := l.blocked("k", 3, now.Add(time.Minute)); blocked {
+		t.Error("still blocked after the window")
+	}
+	l.fail("k", now.Add(time.Minute))
+	if blocked, _ := l.blocked("k", 2, now.Add(time.Minute)); blocked {
+		t.Error("failures from the previous window were kept")
+	}
+	l.reset("k")
+	if blocked, _ := l.blocked("k", 1, now.Add(time.Minute)); blocked {
+		t.Error("blocked after reset")
+	}
+}
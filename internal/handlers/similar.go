@@ -0,0 +1,340 @@
+package handlers
+
+import (
+	"context"
+	"database/sql"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"sort"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vaaandark/PixelHub/internal/database"
+	"github.com/vaaandark/PixelHub/internal/imagehash"
+	"github.com/vaaandark/PixelHub/internal/imagemeta"
+)
+
+const (
+	// defaultSimilarDistance 相似查询默认的最大汉明距离
+	defaultSimilarDistance = 10
+	// defaultDuplicateDistance 近重复报告默认的最大汉明距离
+	defaultDuplicateDistance = 5
+)
+
+// SimilarImage 相似图片结果
+type SimilarImage struct {
+	database.PictureWithTags
+	Distance int `json:"distance"`
+}
+
+// parseMaxDistance 解析 max_distance 参数（0-64）
+func parseMaxDistance(c *gin.Context, def int) int {
+	d, err := strconv.Atoi(c.DefaultQuery("max_distance", strconv.Itoa(def)))
+	if err != nil || d < 0 || d > 64 {
+		return def
+	}
+	return d
+}
+
+// loadHashes 读取所有图片的感知哈希
+func (h *Handler) loadHashes() ([]database.PictureHash, []imagehash.Hash, error) {
+	rows, err := h.store.ListPictureHashes()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	entries := make([]database.PictureHash, 0, len(rows))
+	hashes := make([]imagehash.Hash, 0, len(rows))
+	for _, row := range rows {
+		hash, err := imagehash.Parse(row.PHash)
+		if err != nil {
+			continue
+		}
+		entries = append(entries, row)
+		hashes = append(hashes, hash)
+	}
+	return entries, hashes, nil
+}
+
+// FindSimilarImages 查找与指定图片相似的图片
+func (h *Handler) FindSimilarImages(c *gin.Context) {
+	imageID := c.Param("image_id")
+	maxDistance := parseMaxDistance(c, defaultSimilarDistance)
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+
+	pic, err := h.store.GetPicture(imageID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, Response{
+				Code:    404,
+				Message: "Image not found",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: "Failed to get image",
+		})
+		return
+	}
+
+	target, err := imagehash.Parse(pic.PHash)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "Perceptual hash not available for this image",
+		})
+		return
+	}
+
+	entries, hashes, err := h.loadHashes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: "Failed to load perceptual hashes",
+		})
+		return
+	}
+
+	// 单次查询直接线性扫描即可
+	var matches []imagehash.Match
+	for i, hash := range hashes {
+		if entries[i].ID == imageID {
+			continue
+		}
+		if d := imagehash.Distance(target, hash); d <= maxDistance {
+			matches = append(matches, imagehash.Match{ID: entries[i].ID, Hash: hash, Distance: d})
+		}
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		if matches[i].Distance != matches[j].Distance {
+			return matches[i].Distance < matches[j].Distance
+		}
+		return matches[i].ID < matches[j].ID
+	})
+	total := len(matches)
+	if len(matches) > limit {
+		matches = matches[:limit]
+	}
+
+	ids := make([]string, len(matches))
+	for i, m := range matches {
+		ids[i] = m.ID
+	}
+	pics, err := h.store.GetPicturesByIDs(ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: "Failed to get similar images",
+		})
+		return
+	}
+	h.resolvePictureURLs(pics)
+	byID := make(map[string]database.PictureWithTags, len(pics))
+	for _, p := range pics {
+		byID[p.ID] = p
+	}
+
+	results := make([]SimilarImage, 0, len(matches))
+	for _, m := range matches {
+		if p, ok := byID[m.ID]; ok {
+			results = append(results, SimilarImage{PictureWithTags: p, Distance: m.Distance})
+		}
+	}
+
+	c.JSON(http.StatusOK, Response{
+		Code:    200,
+		Message: "Success",
+		Data: map[string]interface{}{
+			"image_id":     imageID,
+			"max_distance": maxDistance,
+			"total":        total,
+			"results":      results,
+		},
+	})
+}
+
+// ListDuplicateImages 列出整个图库中的近重复图片分组
+func (h *Handler) ListDuplicateImages(c *gin.Context) {
+	maxDistance := parseMaxDistance(c, defaultDuplicateDistance)
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "50"))
+	if limit < 1 || limit > 100 {
+		limit = 50
+	}
+
+	entries, hashes, err := h.loadHashes()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: "Failed to load perceptual hashes",
+		})
+		return
+	}
+
+	// 用 BK 树查找相似对，并查集合并成组
+	tree := imagehash.NewBKTree()
+	index := make(map[string]int, len(entries))
+	for i, e := range entries {
+		tree.Insert(e.ID, hashes[i])
+		index[e.ID] = i
+	}
+
+	parent := make([]int, len(entries))
+	for i := range parent {
+		parent[i] = i
+	}
+	var find func(int) int
+	find = func(x int) int {
+		for parent[x] != x {
+			parent[x] = parent[parent[x]]
+			x = parent[x]
+		}
+		return x
+	}
+	for i, hash := range hashes {
+		for _, m := range tree.Search(hash, maxDistance) {
+			j := index[m.ID]
+			if ri, rj := find(i), find(j); ri != rj {
+				parent[ri] = rj
+			}
+		}
+	}
+
+	groupsByRoot := make(map[int][]string)
+	for i, e := range entries {
+		root := find(i)
+		groupsByRoot[root] = append(groupsByRoot[root], e.ID)
+	}
+	var groups [][]string
+	for _, ids := range groupsByRoot {
+		if len(ids) > 1 {
+			sort.Strings(ids)
+			groups = append(groups, ids)
+		}
+	}
+	// 大的分组优先
+	sort.Slice(groups, func(i, j int) bool {
+		if len(groups[i]) != len(groups[j]) {
+			return len(groups[i]) > len(groups[j])
+		}
+		return groups[i][0] < groups[j][0]
+	})
+	totalGroups := len(groups)
+	if len(groups) > limit {
+		groups = groups[:limit]
+	}
+
+	var ids []string
+	for _, g := range groups {
+		ids = append(ids, g...)
+	}
+	pics, err := h.store.GetPicturesByIDs(ids)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: "Failed to get duplicate images",
+		})
+		return
+	}
+	h.resolvePictureURLs(pics)
+	byID := make(map[string]database.PictureWithTags, len(pics))
+	for _, p := range pics {
+		byID[p.ID] = p
+	}
+
+	resultGroups := make([][]database.PictureWithTags, 0, len(groups))
+	for _, g := range groups {
+		images := make([]database.PictureWithTags, 0, len(g))
+		for _, id := range g {
+			if p, ok := byID[id]; ok {
+				images = append(images, p)
+			}
+		}
+		resultGroups = append(resultGroups, images)
+	}
+
+	c.JSON(http.StatusOK, Response{
+		Code:    200,
+		Message: "Success",
+		Data: map[string]interface{}{
+			"max_distance": maxDistance,
+			"total_groups": totalGroups,
+			"groups":       resultGroups,
+		},
+	})
+}
+
+// BackfillImageMetadata 为历史图片和上传时因像素数过大跳过的图片补算感知哈希、尺寸和 MIME 类型（在后台逐张运行）
+// 后台任务的像素数上限高于上传时，仍超过上限的图片（如解压炸弹）把 phash 记为空字符串，不再重试
+func (h *Handler) BackfillImageMetadata(ctx context.Context) {
+	pics, err := h.store.ListPicturesMissingMetadata()
+	if err != nil {
+		log.Printf("Warning: Failed to list images for metadata backfill: %v", err)
+		return
+	}
+	if len(pics) == 0 {
+		return
+	}
+
+	log.Printf("Backfilling metadata for %d images", len(pics))
+	done := 0
+	for _, pic := range pics {
+		if ctx.Err() != nil {
+			return
+		}
+
+		// 直接从存储读取，不依赖访问地址（本地存储的地址是相对路径，且后台任务启动时服务可能尚未监听）
+		meta, err := h.readImageMetadata(pic.StorageKey, h.backfillPixels)
+		if err != nil {
+			// 读取失败保留 NULL，下次启动时重试
+			log.Printf("Warning: Failed to read image %s for metadata backfill: %v", pic.ID, err)
+			continue
+		}
+		if meta.PHashSkipped {
+			log.Printf("Warning: Skipping perceptual hash for %s: %dx%d exceeds %d pixels", pic.ID, meta.Width, meta.Height, h.backfillPixels)
+		}
+
+		pic.PHash = meta.PHash
+		pic.Width = meta.Width
+		pic.Height = meta.Height
+		pic.MIMEType = meta.MIMEType
+		if err := h.store.UpdatePictureMetadata(&pic); err != nil {
+			log.Printf("Warning: Failed to save metadata for %s: %v", pic.ID, err)
+			continue
+		}
+		done++
+	}
+	log.Printf("Metadata backfill completed: %d/%d", done, len(pics))
+}
+
+// readImageMetadata 从存储读取图片内容并提取元数据，宽×高超过 maxPixels 的图片不计算感知哈希
+func (h *Handler) readImageMetadata(storageKey string, maxPixels int) (imagemeta.Metadata, error) {
+	rc, err := h.storage.Get(storageKey)
+	if err != nil {
+		return imagemeta.Metadata{}, err
+	}
+	defer rc.Close()
+
+	// 本地存储返回的文件可以 Seek，其他存储先写入临时文件，不把整个文件读入内存
+	if rs, ok := rc.(io.ReadSeeker); ok {
+		return imagemeta.ExtractLimit(rs, maxPixels), nil
+	}
+	tmp, err := os.CreateTemp("", "pixelhub-backfill-*")
+	if err != nil {
+		return imagemeta.Metadata{}, err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+	if _, err := io.Copy(tmp, rc); err != nil {
+		return imagemeta.Metadata{}, err
+	}
+	if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+		return imagemeta.Metadata{}, err
+	}
+	return imagemeta.ExtractLimit(tmp, maxPixels), nil
+}
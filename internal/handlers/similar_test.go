@@ -0,0 +1,98 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"encoding/binary"
+	"hash/crc32"
+	"image"
+	"image/png"
+	"testing"
+
+	"github.com/vaaandark/PixelHub/internal/config"
+	"github.com/vaaandark/PixelHub/internal/database"
+	"github.com/vaaandark/PixelHub/internal/fakes"
+	"github.com/vaaandark/PixelHub/internal/imagemeta"
+	"github.com/vaaandark/PixelHub/internal/storage"
+)
+
+// 本地存储的访问地址是相对路径，补算元数据必须直接从存储读取
+func TestBackfillImageMetadataLocalStorage(t *testing.T) {
+	local, err := storage.NewLocalProvider(&config.LocalConfig{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := fakes.NewStore()
+	h := NewHandler(store, local, nil)
+
+	content := testPNG(3)
+	key, url, err := local.Upload("img_old.png", bytes.NewReader(content), int64(len(content)), "image/png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url != "/files/img_old.png" {
+		t.Fatalf("url = %q, want a relative /files URL", url)
+	}
+	must(t, store.CreatePicture(&database.Picture{ID: "img_old", StorageKey: key, Hash: sha256Hex(content)}))
+	must(t, store.CreatePicture(&database.Picture{ID: "img_missing", StorageKey: "img_missing.png", Hash: "x"}))
+
+	h.BackfillImageMetadata(context.Background())
+
+	pic, err := store.GetPicture("img_old")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := imagemeta.Extract(content)
+	if pic.PHash != want.PHash || pic.Width != 32 || pic.Height != 24 || pic.MIMEType != "image/png" {
+		t.Errorf("metadata = %q %dx%d %q, want %q 32x24 image/png", pic.PHash, pic.Width, pic.Height, pic.MIMEType, want.PHash)
+	}
+
+	// 文件缺失的图片保持未提取状态，下次启动时重试
+	missing, err := store.ListPicturesMissingMetadata()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(missing) != 1 || missing[0].ID != "img_missing" {
+		t.Errorf("missing metadata = %+v, want only img_missing", missing)
+	}
+}
+
+// pngBomb 文件很小但声明了 width×height 像素的 PNG（解码时会分配整张图片的内存）
+func pngBomb(t *testing.T, width, height uint32) []byte {
+	t.Helper()
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, 1, 1))); err != nil {
+		t.Fatal(err)
+	}
+	data := buf.Bytes()
+	// IHDR 紧跟在 8 字节签名之后：长度(4) 类型(4) 宽(4) 高(4) ...，CRC 覆盖类型和数据
+	binary.BigEndian.PutUint32(data[16:], width)
+	binary.BigEndian.PutUint32(data[20:], height)
+	binary.BigEndian.PutUint32(data[29:], crc32.ChecksumIEEE(data[12:29]))
+	return data
+}
+
+// 超过补算像素上限的图片不解码，phash 记为空字符串，之后不再重试
+func TestBackfillImageMetadataSkipsOversizedImage(t *testing.T) {
+	e := newTestEnv(t, false)
+	pic, err := e.h.saveImage("bomb.png", pngBomb(t, 50000, 50000), "", "", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !pic.PHashDeferred {
+		t.Fatal("upload of an oversized image computed the perceptual hash")
+	}
+
+	e.h.BackfillImageMetadata(context.Background())
+	got, err := e.store.GetPicture(pic.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got.PHash != "" || got.PHashDeferred || got.Width != 50000 || got.MIMEType != "image/png" {
+		t.Errorf("metadata = %q deferred=%v %dx%d %q, want skipped phash for a 50000x50000 image/png", got.PHash, got.PHashDeferred, got.Width, got.Height, got.MIMEType)
+	}
+	missing, err := e.store.ListPicturesMissingMetadata()
+	if err != nil || len(missing) != 0 {
+		t.Errorf("missing metadata after backfill = %+v, %v; the oversized image must not be retried", missing, err)
+	}
+}
@@ -0,0 +1,116 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vaaandark/PixelHub/internal/config"
+	"github.com/vaaandark/PixelHub/internal/database"
+	"github.com/vaaandark/PixelHub/internal/fakes"
+)
+
+// TestConcurrentUploadsAndListings 在真实的 SQLite 库上并发上传、改标签和列表查询，
+// 检查读写分离的连接池下没有 SQLITE_BUSY 等错误（配合 go test -race 运行）
+func TestConcurrentUploadsAndListings(t *testing.T) {
+	const (
+		writers   = 8
+		perWriter = 10
+		readers   = 8
+	)
+	if testing.Short() {
+		t.Skip("skipping stress test in short mode")
+	}
+
+	store, err := database.InitDB(&config.DatabaseConfig{Path: filepath.Join(t.TempDir(), "stress.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+	h := NewHandler(store, fakes.NewStorage(), nil)
+	router := gin.New()
+	h.RegisterRoutes(router)
+	e := &testEnv{t: t, router: router}
+
+	var (
+		wg     sync.WaitGroup
+		mu     sync.Mutex
+		errs   []string
+		done   = make(chan struct{})
+		report = func(format string, args ...interface{}) {
+			mu.Lock()
+			errs = append(errs, fmt.Sprintf(format, args...))
+			mu.Unlock()
+		}
+	)
+
+	var writersWG sync.WaitGroup
+	for w := 0; w < writers; w++ {
+		writersWG.Add(1)
+		go func(w int) {
+			defer writersWG.Done()
+			for i := 0; i < perWriter; i++ {
+				seed := 10 + w*perWriter + i
+				body := multipartBody("file", map[string][]byte{fmt.Sprintf("stress-%d.png", seed): testPNG(seed)}, map[string]string{"description": "stress"})
+				rec := e.request(context.Background(), http.MethodPost, "/api/v1/images/upload", body)
+				if rec.Code != http.StatusCreated {
+					report("upload %d: %d %s", seed, rec.Code, rec.Body.String())
+					continue
+				}
+				var resp struct {
+					Data struct {
+						ImageID string `json:"image_id"`
+					} `json:"data"`
+				}
+				if err := json.Unmarshal(rec.Body.Bytes(), &resp); err != nil {
+					report("upload %d: %v", seed, err)
+					continue
+				}
+				tags := jsonBody(map[string]interface{}{"tags": []string{"stress", fmt.Sprintf("writer-%d", seed%writers)}})
+				if rec := e.request(context.Background(), http.MethodPut, "/api/v1/images/"+resp.Data.ImageID+"/tags", tags); rec.Code != http.StatusOK {
+					report("tags %s: %d %s", resp.Data.ImageID, rec.Code, rec.Body.String())
+				}
+			}
+		}(w)
+	}
+
+	paths := []string{"/api/v1/images?limit=20", "/api/v1/tags", "/api/v1/search/exact?tags=stress", "/api/v1/search/text?q=stress"}
+	for r := 0; r < readers; r++ {
+		wg.Add(1)
+		go func(r int) {
+			defer wg.Done()
+			for i := 0; ; i++ {
+				select {
+				case <-done:
+					return
+				default:
+				}
+				path := paths[(r+i)%len(paths)]
+				if rec := e.request(context.Background(), http.MethodGet, path, nil); rec.Code != http.StatusOK {
+					report("GET %s: %d %s", path, rec.Code, rec.Body.String())
+				}
+			}
+		}(r)
+	}
+
+	writersWG.Wait()
+	close(done)
+	wg.Wait()
+
+	if len(errs) > 0 {
+		t.Fatalf("%d failed requests, first: %s", len(errs), strings.Join(errs[:min(len(errs), 5)], "\n"))
+	}
+	_, total, err := store.ListPictures(database.PictureFilter{}, 1, 1, "date_desc", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if total != writers*perWriter {
+		t.Errorf("total = %d, want %d", total, writers*perWriter)
+	}
+}
@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"bytes"
+	"net/http"
+	"net/url"
+	"testing"
+
+	"github.com/vaaandark/PixelHub/internal/config"
+)
+
+func rawBody(content []byte, filename, description string) *requestBody {
+	headers := map[string]string{"X-Filename": url.PathEscape(filename)}
+	if description != "" {
+		headers["X-Description"] = url.PathEscape(description)
+	}
+	return &requestBody{content: content, contentType: "application/octet-stream", headers: headers}
+}
+
+func TestUploadRawImage(t *testing.T) {
+	e := newTestEnv(t, false)
+	data := testPNG(6)
+
+	code, body := e.do(http.MethodPost, "/api/v1/images/upload", rawBody(data, "截图 1.png", "粘贴的图片"))
+	if code != http.StatusCreated {
+		t.Fatalf("raw upload = %d %s", code, body)
+	}
+	if name := jsonField(t, body, "data", "filename"); name != "截图 1.png" {
+		t.Errorf("filename = %v", name)
+	}
+	pic, err := e.store.GetPicture(jsonField(t, body, "data", "image_id").(string))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// application/octet-stream 按内容识别类型
+	if pic.Description != "粘贴的图片" || pic.MIMEType != "image/png" || pic.Hash != sha256Hex(data) {
+		t.Errorf("picture = %+v", pic)
+	}
+	if stored, _ := e.storage.Object(pic.StorageKey); !bytes.Equal(stored, data) {
+		t.Error("stored object differs from the request body")
+	}
+
+	if code, body := e.do(http.MethodPost, "/api/v1/images/upload", &requestBody{content: data, contentType: "image/png"}); code != http.StatusBadRequest {
+		t.Errorf("raw upload without X-Filename = %d %s, want 400", code, body)
+	}
+	if code, body := e.do(http.MethodPost, "/api/v1/images/upload", rawBody(nil, "empty.png", "")); code != http.StatusBadRequest {
+		t.Errorf("empty raw upload = %d %s, want 400", code, body)
+	}
+}
+
+func TestUploadRawImageTooLarge(t *testing.T) {
+	e := newTestEnv(t, false)
+	must(t, e.h.ConfigureUpload(config.UploadConfig{ChunkDir: t.TempDir(), RawMaxSize: 1024}))
+	before := len(e.storage.Keys())
+
+	code, body := e.do(http.MethodPost, "/api/v1/images/upload", rawBody(make([]byte, 1025), "big.png", ""))
+	if code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("oversized raw upload = %d %s, want 413", code, body)
+	}
+	if keys := e.storage.Keys(); len(keys) != before {
+		t.Errorf("storage objects = %v, want nothing stored", keys)
+	}
+	if code, body := e.do(http.MethodPost, "/api/v1/images/upload", rawBody(testPNG(2), "small.png", "")); code != http.StatusCreated {
+		t.Errorf("raw upload under the limit = %d %s, want 201", code, body)
+	}
+}
@@ -0,0 +1,109 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+
+	"github.com/vaaandark/PixelHub/internal/database"
+	"github.com/vaaandark/PixelHub/internal/storage"
+)
+
+const (
+	// defaultSignedURLTTL 签名 URL 默认有效期
+	defaultSignedURLTTL = time.Hour
+	// maxInlineImageSize 以 data URL 形式发送给 LLM 的图片大小上限
+	maxInlineImageSize = 10 << 20
+)
+
+// errImageTooLargeForLLM 图片没有可供 LLM 服务访问的绝对地址，且超过 data URL 的大小上限
+var errImageTooLargeForLLM = fmt.Errorf("image has no absolute URL and exceeds %d MiB, too large to send to the LLM service inline", maxInlineImageSize>>20)
+
+// EnableSignedURLs 启用私有存储模式，响应中的图片 URL 替换为有效期为 ttl 的签名 URL
+// 存储提供商必须实现 storage.URLSigner，启动时先签名一次，缺少密钥或 ttl 超出限制时直接返回错误
+func (h *Handler) EnableSignedURLs(ttl time.Duration) error {
+	signer, ok := h.storage.(storage.URLSigner)
+	if !ok {
+		return errors.New("storage provider does not support signed URLs")
+	}
+	if ttl <= 0 {
+		ttl = defaultSignedURLTTL
+	}
+	if _, err := signer.SignedURL("probe", ttl); err != nil {
+		return fmt.Errorf("storage provider cannot sign URLs: %w", err)
+	}
+	h.urlSigner = signer
+	h.signedURLTTL = ttl
+	return nil
+}
+
+// storageURL 返回存储 key 的访问地址（私有存储时为签名 URL）
+func (h *Handler) storageURL(storageKey string) string {
+	if h.urlSigner != nil {
+		signed, err := h.urlSigner.SignedURL(storageKey, h.signedURLTTL)
+		if err == nil {
+			return signed
+		}
+		log.Printf("Warning: Failed to sign URL for %s: %v", storageKey, err)
+	}
+	return h.storage.GetURL(storageKey)
+}
+
+// resolveURL 根据数据库中保存的 url 和 storage_key 计算访问地址
+// url 非空表示显式保存的绝对地址（无法由 storage_key 推导的旧数据），原样返回
+func (h *Handler) resolveURL(storageKey, url string) string {
+	if url != "" || storageKey == "" {
+		return url
+	}
+	return h.storageURL(storageKey)
+}
+
+// pictureURL 返回图片的访问地址
+func (h *Handler) pictureURL(pic *database.Picture) string {
+	return h.resolveURL(pic.StorageKey, pic.URL)
+}
+
+// resolvePictureURLs 为一组图片填充访问地址
+func (h *Handler) resolvePictureURLs(pics []database.PictureWithTags) {
+	for i := range pics {
+		pics[i].URL = h.pictureURL(&pics[i].Picture)
+	}
+}
+
+// resolveAlbumCover 为相册封面填充访问地址
+func (h *Handler) resolveAlbumCover(album *database.Album) {
+	album.CoverURL = h.resolveURL(album.CoverStorageKey, album.CoverURL)
+}
+
+// llmImageURL 返回交给 LLM 服务的图片地址
+// 访问地址是绝对 URL 时直接使用；否则（如本地存储的 /files 相对路径）LLM 服务无法下载，从存储读取内容编码为 data URL
+func (h *Handler) llmImageURL(pic *database.Picture) (string, error) {
+	imageURL := h.pictureURL(pic)
+	if u, err := url.Parse(imageURL); err == nil && (u.Scheme == "http" || u.Scheme == "https") && u.Host != "" {
+		return imageURL, nil
+	}
+
+	rc, err := h.storage.Get(pic.StorageKey)
+	if err != nil {
+		return "", fmt.Errorf("failed to read image: %w", err)
+	}
+	defer rc.Close()
+	content, err := io.ReadAll(io.LimitReader(rc, maxInlineImageSize+1))
+	if err != nil {
+		return "", fmt.Errorf("failed to read image: %w", err)
+	}
+	if len(content) > maxInlineImageSize {
+		return "", errImageTooLargeForLLM
+	}
+
+	mimeType := pic.MIMEType
+	if mimeType == "" {
+		mimeType = http.DetectContentType(content)
+	}
+	return "data:" + mimeType + ";base64," + base64.StdEncoding.EncodeToString(content), nil
+}
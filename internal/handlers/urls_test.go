@@ -0,0 +1,245 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vaaandark/PixelHub/internal/config"
+	"github.com/vaaandark/PixelHub/internal/database"
+	"github.com/vaaandark/PixelHub/internal/fakes"
+	"github.com/vaaandark/PixelHub/internal/storage"
+)
+
+// publicProvider 不支持签名 URL 的存储
+type publicProvider struct{}
+
+func (publicProvider) Upload(filename string, content io.Reader, size int64, contentType string) (string, string, error) {
+	return filename, "https://cdn.example.com/" + filename, nil
+}
+
+func (publicProvider) Get(storageKey string) (io.ReadCloser, error) { return nil, os.ErrNotExist }
+
+func (publicProvider) Delete(storageKey string) error { return nil }
+
+func (publicProvider) GetURL(storageKey string) string {
+	return "https://cdn.example.com/" + storageKey
+}
+
+// signingProvider 生成形如 https://private.example.com/<key>?ttl=<ttl> 的签名 URL
+type signingProvider struct {
+	publicProvider
+	fail bool
+	ttls []time.Duration
+}
+
+func (p *signingProvider) SignedURL(storageKey string, ttl time.Duration) (string, error) {
+	if p.fail {
+		return "", errors.New("signing failed")
+	}
+	p.ttls = append(p.ttls, ttl)
+	return fmt.Sprintf("https://private.example.com/%s?ttl=%s", storageKey, ttl), nil
+}
+
+func TestEnableSignedURLs(t *testing.T) {
+	h := NewHandler(nil, publicProvider{}, nil)
+	if err := h.EnableSignedURLs(time.Minute); err == nil {
+		t.Error("EnableSignedURLs on a provider without signing succeeded")
+	}
+
+	signer := &signingProvider{}
+	h = NewHandler(nil, signer, nil)
+	if err := h.EnableSignedURLs(0); err != nil {
+		t.Fatal(err)
+	}
+	pic := &database.Picture{StorageKey: "a.png"}
+	if got, want := h.pictureURL(pic), "https://private.example.com/a.png?ttl=1h0m0s"; got != want {
+		t.Errorf("pictureURL with default TTL = %q, want %q", got, want)
+	}
+
+	// 签名失败时回退到存储的公开地址
+	signer.fail = true
+	if got, want := h.pictureURL(pic), "https://cdn.example.com/a.png"; got != want {
+		t.Errorf("pictureURL after signing error = %q, want %q", got, want)
+	}
+}
+
+// 访问地址由 storage_key 推导；启用私有存储后，详情、列表和相册封面都返回签名 URL
+// 显式保存了 url 的旧数据原样返回
+func TestSignedURLResponses(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	db, err := database.InitDB(&config.DatabaseConfig{Path: filepath.Join(t.TempDir(), "pixelhub.db")})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	for _, id := range []string{"img_1", "img_2"} {
+		if err := db.CreatePicture(&database.Picture{ID: id, StorageKey: id + ".png", Hash: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	const legacyURL = "https://legacy.example.com/old/img_3.png"
+	if err := db.CreatePicture(&database.Picture{ID: "img_3", URL: legacyURL, StorageKey: "img_3.png", Hash: "img_3"}); err != nil {
+		t.Fatal(err)
+	}
+	album := &database.Album{ID: "album_1", Name: "trip", CoverImageID: "img_2"}
+	if err := db.CreateAlbum(album); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := db.AddAlbumItems(album.ID, []string{"img_1", "img_2"}, -1); err != nil {
+		t.Fatal(err)
+	}
+
+	get := func(router *gin.Engine, path string, data interface{}) {
+		t.Helper()
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, httptest.NewRequest(http.MethodGet, path, nil))
+		if w.Code != http.StatusOK {
+			t.Fatalf("GET %s = %d %s", path, w.Code, w.Body.String())
+		}
+		if err := json.Unmarshal(w.Body.Bytes(), &Response{Data: data}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	newRouter := func(signed bool) *gin.Engine {
+		h := NewHandler(db, &signingProvider{}, nil)
+		if signed {
+			if err := h.EnableSignedURLs(10 * time.Minute); err != nil {
+				t.Fatal(err)
+			}
+		}
+		router := gin.New()
+		router.GET("/api/v1/images", h.ListImages)
+		router.GET("/api/v1/images/:image_id", h.GetImageDetail)
+		router.GET("/api/v1/albums/:album_id", h.GetAlbumDetail)
+		return router
+	}
+
+	for _, tc := range []struct {
+		name   string
+		signed bool
+		prefix string
+		suffix string
+	}{
+		{"public", false, "https://cdn.example.com/", ""},
+		{"signed", true, "https://private.example.com/", "?ttl=10m0s"},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			router := newRouter(tc.signed)
+			url := func(id string) string {
+				if id == "img_3" {
+					return legacyURL
+				}
+				return tc.prefix + id + ".png" + tc.suffix
+			}
+
+			var detail struct {
+				URL string `json:"url"`
+			}
+			get(router, "/api/v1/images/img_1", &detail)
+			if detail.URL != url("img_1") {
+				t.Errorf("detail url = %q, want %q", detail.URL, url("img_1"))
+			}
+
+			var list struct {
+				Images []struct {
+					ID  string `json:"id"`
+					URL string `json:"url"`
+				} `json:"images"`
+			}
+			get(router, "/api/v1/images", &list)
+			if len(list.Images) != 3 {
+				t.Fatalf("list returned %d images, want 3", len(list.Images))
+			}
+			for _, img := range list.Images {
+				if img.URL != url(img.ID) {
+					t.Errorf("list url of %s = %q, want %q", img.ID, img.URL, url(img.ID))
+				}
+			}
+
+			var detailAlbum struct {
+				Album struct {
+					CoverURL string `json:"cover_url"`
+				} `json:"album"`
+				Images []struct {
+					ID  string `json:"id"`
+					URL string `json:"url"`
+				} `json:"images"`
+			}
+			get(router, "/api/v1/albums/album_1", &detailAlbum)
+			if detailAlbum.Album.CoverURL != url("img_2") {
+				t.Errorf("album cover = %q, want %q", detailAlbum.Album.CoverURL, url("img_2"))
+			}
+			for _, img := range detailAlbum.Images {
+				if img.URL != url(img.ID) {
+					t.Errorf("album item url of %s = %q, want %q", img.ID, img.URL, url(img.ID))
+				}
+			}
+		})
+	}
+}
+
+// 本地存储的相对地址 LLM 服务无法下载，改为发送 data URL；过大的图片明确拒绝
+func TestGenerateImageTagsLocalStorage(t *testing.T) {
+	local, err := storage.NewLocalProvider(&config.LocalConfig{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	store := fakes.NewStore()
+	tagger := &fakes.TagGenerator{}
+	h := NewHandler(store, local, tagger)
+	router := gin.New()
+	h.RegisterRoutes(router)
+
+	content := testPNG(5)
+	key, _, err := local.Upload("img_local.png", bytes.NewReader(content), int64(len(content)), "image/png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	must(t, store.CreatePicture(&database.Picture{ID: "img_local", StorageKey: key, Hash: sha256Hex(content), MIMEType: "image/png"}))
+
+	large := make([]byte, maxInlineImageSize+1)
+	key, _, err = local.Upload("img_large.png", bytes.NewReader(large), int64(len(large)), "image/png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	must(t, store.CreatePicture(&database.Picture{ID: "img_large", StorageKey: key, Hash: sha256Hex(large), MIMEType: "image/png"}))
+
+	generate := func(id string) *httptest.ResponseRecorder {
+		w := httptest.NewRecorder()
+		req := httptest.NewRequest("POST", "/api/v1/images/"+id+"/tags/generate", strings.NewReader("{}"))
+		req.Header.Set("Content-Type", "application/json")
+		router.ServeHTTP(w, req)
+		return w
+	}
+
+	if w := generate("img_local"); w.Code != http.StatusOK {
+		t.Fatalf("generate = %d %s", w.Code, w.Body.String())
+	}
+	calls := tagger.Calls()
+	want := "data:image/png;base64," + base64.StdEncoding.EncodeToString(content)
+	if len(calls) != 1 {
+		t.Fatalf("tag generator called %d times, want 1", len(calls))
+	}
+	if calls[0].ImageURL != want {
+		t.Errorf("image URL = %.40q..., want the data URL of the image", calls[0].ImageURL)
+	}
+
+	if w := generate("img_large"); w.Code != http.StatusUnprocessableEntity {
+		t.Errorf("generate large = %d %s, want 422", w.Code, w.Body.String())
+	}
+	if n := len(tagger.Calls()); n != 1 {
+		t.Errorf("tag generator called %d times, want 1", n)
+	}
+}
@@ -0,0 +1,407 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/vaaandark/PixelHub/internal/database"
+	"github.com/vaaandark/PixelHub/internal/imagemeta"
+)
+
+// replaceFileError 替换文件失败，status 为返回给客户端的状态码
+type replaceFileError struct {
+	status  int
+	message string
+}
+
+func (e *replaceFileError) Error() string { return e.message }
+
+// archiveKey 历史版本文件的存储 key，例如 img_xxx.v2.3f9a1c0e.png
+// nonce 保证每次归档都写入新的对象，不会覆盖其他请求（包括其他实例）已经提交的历史版本
+func archiveKey(pictureID string, version int, nonce, ext string) string {
+	return fmt.Sprintf("%s.v%d.%s%s", pictureID, version, nonce, ext)
+}
+
+// storageNonce 生成存储 key 中使用的随机后缀
+func storageNonce() string {
+	return strings.ReplaceAll(uuid.New().String(), "-", "")[:8]
+}
+
+// replaceFile 用新内容替换图片的当前文件，当前文件另存为历史版本，返回替换前后的图片
+// 扩展名不变时新文件写回原来的存储 key，访问地址保持不变；标签、描述等元数据不受影响
+func (h *Handler) replaceFile(pictureID string, filename string, content []byte, contentType string) (*database.Picture, *database.Picture, error) {
+	h.replaceMu.Lock()
+	if h.replacing[pictureID] {
+		h.replaceMu.Unlock()
+		return nil, nil, &replaceFileError{http.StatusConflict, "Image file is being replaced by another request"}
+	}
+	h.replacing[pictureID] = true
+	h.replaceMu.Unlock()
+	defer func() {
+		h.replaceMu.Lock()
+		delete(h.replacing, pictureID)
+		h.replaceMu.Unlock()
+	}()
+
+	// 持有锁之后重新读取，之前读到的版本可能已被替换
+	pic, err := h.store.GetPicture(pictureID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			return nil, nil, &replaceFileError{http.StatusNotFound, "Image not found"}
+		}
+		return nil, nil, fmt.Errorf("failed to get image: %v", err)
+	}
+	if pic.StorageKey == "" {
+		return nil, nil, &replaceFileError{http.StatusConflict, "Image file is not managed by the storage provider"}
+	}
+
+	hasher := sha256.New()
+	hasher.Write(content)
+	hash := hex.EncodeToString(hasher.Sum(nil))
+	if hash == pic.Hash {
+		return nil, nil, &replaceFileError{http.StatusConflict, "File is identical to the current version"}
+	}
+
+	// 先把当前文件复制为历史版本
+	src, err := h.storage.Get(pic.StorageKey)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read current file: %v", err)
+	}
+	previous, err := io.ReadAll(src)
+	src.Close()
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to read current file: %v", err)
+	}
+	oldExt := filepath.Ext(pic.StorageKey)
+	oldType := pic.MIMEType
+	if oldType == "" {
+		oldType = "application/octet-stream"
+	}
+	archivedKey, _, err := h.storage.Upload(archiveKey(pic.ID, pic.Version, storageNonce(), oldExt), bytes.NewReader(previous), int64(len(previous)), oldType)
+	if err != nil {
+		return nil, nil, fmt.Errorf("failed to archive current file: %v", err)
+	}
+
+	meta := imagemeta.ExtractLimit(bytes.NewReader(content), h.hashMaxPixels)
+	if contentType == "" {
+		contentType = meta.MIMEType
+	}
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+
+	// 扩展名变化时写入新的 key（带随机后缀，不会覆盖已有对象），数据库更新成功后再删除旧文件
+	newExt := filepath.Ext(filename)
+	liveKey := pic.StorageKey
+	if !strings.EqualFold(newExt, oldExt) {
+		liveKey = pic.ID + "." + storageNonce() + newExt
+	}
+	liveKey, _, err = h.storage.Upload(liveKey, bytes.NewReader(content), int64(len(content)), contentType)
+	if err != nil {
+		h.deleteCreatedObject(archivedKey)
+		return nil, nil, fmt.Errorf("failed to upload to storage: %v", err)
+	}
+	overwritten := liveKey == pic.StorageKey
+
+	now := time.Now()
+	archived := &database.PictureVersion{
+		PictureID:  pic.ID,
+		Version:    pic.Version,
+		StorageKey: archivedKey,
+		Hash:       pic.Hash,
+		PHash:      pic.PHash,
+		Width:      pic.Width,
+		Height:     pic.Height,
+		MIMEType:   pic.MIMEType,
+		CreatedAt:  pic.RevisedAt,
+		ArchivedAt: now,
+	}
+	next := *pic
+	next.StorageKey = liveKey
+	next.URL = ""
+	next.Hash = hash
+	next.PHash = meta.PHash
+	next.PHashDeferred = meta.PHashSkipped
+	next.Width = meta.Width
+	next.Height = meta.Height
+	next.MIMEType = meta.MIMEType
+	next.Version = pic.Version + 1
+	next.RevisedAt = now
+
+	if err := h.store.ReplacePictureFile(archived, &next); err != nil {
+		// 只清理本次请求新建的对象；历史版本和新 key 都是本次写入的，已提交的记录不会指向它们
+		h.deleteCreatedObject(archivedKey)
+		conflict := errors.Is(err, database.ErrVersionConflict)
+		switch {
+		case !overwritten:
+			h.deleteCreatedObject(liveKey)
+		case conflict:
+			// 其他实例已经提交了新版本，它写入的内容可能在本次覆盖之后，不能再用旧内容覆盖
+			log.Printf("Warning: Replace of %s lost a concurrent update; %s may not match the committed version", pic.ID, liveKey)
+		default:
+			if _, _, restoreErr := h.storage.Upload(pic.StorageKey, bytes.NewReader(previous), int64(len(previous)), oldType); restoreErr != nil {
+				log.Printf("Warning: Failed to restore file %s after failed replace: %v", pic.StorageKey, restoreErr)
+			}
+		}
+		if conflict {
+			return nil, nil, &replaceFileError{http.StatusConflict, "Image was modified concurrently, please retry"}
+		}
+		return nil, nil, fmt.Errorf("failed to save to database: %v", err)
+	}
+
+	if !overwritten {
+		if err := h.storage.Delete(pic.StorageKey); err != nil {
+			log.Printf("Warning: Failed to delete replaced file %s: %v", pic.StorageKey, err)
+		}
+	}
+	return pic, &next, nil
+}
+
+// deleteCreatedObject 删除本次请求写入但没有被数据库引用的对象
+func (h *Handler) deleteCreatedObject(storageKey string) {
+	if err := h.storage.Delete(storageKey); err != nil {
+		log.Printf("Warning: Failed to delete orphaned file %s: %v", storageKey, err)
+	}
+}
+
+// deleteVersionFiles 删除图片所有历史版本的文件（删除图片时调用，记录保留在数据库中）
+func (h *Handler) deleteVersionFiles(pictureID string) {
+	versions, err := h.store.ListPictureVersions(pictureID)
+	if err != nil {
+		log.Printf("Warning: Failed to list versions of %s: %v", pictureID, err)
+		return
+	}
+	for _, v := range versions {
+		if err := h.storage.Delete(v.StorageKey); err != nil {
+			log.Printf("Warning: Failed to delete version file %s: %v", v.StorageKey, err)
+		}
+	}
+}
+
+// writeReplaceResult 返回替换后的图片信息
+func (h *Handler) writeReplaceResult(c *gin.Context, pic *database.Picture, err error) {
+	if err != nil {
+		var replaceErr *replaceFileError
+		if errors.As(err, &replaceErr) {
+			c.JSON(replaceErr.status, Response{
+				Code:    replaceErr.status,
+				Message: replaceErr.message,
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: err.Error(),
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{
+		Code:    200,
+		Message: "File replaced successfully",
+		Data: map[string]interface{}{
+			"image_id":   pic.ID,
+			"url":        h.pictureURL(pic),
+			"hash":       pic.Hash,
+			"version":    pic.Version,
+			"revised_at": pic.RevisedAt,
+			"width":      pic.Width,
+			"height":     pic.Height,
+			"mime_type":  pic.MIMEType,
+		},
+	})
+}
+
+// getPictureOrAbort 获取图片，不存在或出错时写入响应并返回 nil
+func (h *Handler) getPictureOrAbort(c *gin.Context, imageID string) *database.Picture {
+	pic, err := h.store.GetPicture(imageID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, Response{
+				Code:    404,
+				Message: "Image not found",
+			})
+			return nil
+		}
+		c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: "Failed to get image",
+		})
+		return nil
+	}
+	return pic
+}
+
+// ReplaceImageFile 上传图片的新版本，旧文件保留为历史版本
+// PUT /api/v1/images/:image_id/file
+func (h *Handler) ReplaceImageFile(c *gin.Context) {
+	pic := h.getPictureOrAbort(c, c.Param("image_id"))
+	if pic == nil {
+		return
+	}
+
+	file, err := c.FormFile("file")
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "No file uploaded",
+		})
+		return
+	}
+	src, err := file.Open()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: "Failed to open file",
+		})
+		return
+	}
+	content, err := io.ReadAll(src)
+	src.Close()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: "Failed to read file",
+		})
+		return
+	}
+
+	previous, updated, err := h.replaceFile(pic.ID, file.Filename, content, file.Header.Get("Content-Type"))
+	if err == nil {
+		h.audit(c, auditImageReplace, "image", pic.ID, imageAuditState(previous, nil), imageAuditState(updated, nil))
+	}
+	h.writeReplaceResult(c, updated, err)
+}
+
+// ListImageVersions 列出图片的当前版本和历史版本（从新到旧）
+// GET /api/v1/images/:image_id/versions
+func (h *Handler) ListImageVersions(c *gin.Context) {
+	pic := h.getPictureOrAbort(c, c.Param("image_id"))
+	if pic == nil {
+		return
+	}
+
+	history, err := h.store.ListPictureVersions(pic.ID)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: "Failed to list versions",
+		})
+		return
+	}
+
+	versions := make([]map[string]interface{}, 0, len(history)+1)
+	versions = append(versions, map[string]interface{}{
+		"version":    pic.Version,
+		"current":    true,
+		"url":        h.pictureURL(pic),
+		"hash":       pic.Hash,
+		"width":      pic.Width,
+		"height":     pic.Height,
+		"mime_type":  pic.MIMEType,
+		"created_at": pic.RevisedAt,
+	})
+	for _, v := range history {
+		versions = append(versions, map[string]interface{}{
+			"version":     v.Version,
+			"current":     false,
+			"url":         h.storageURL(v.StorageKey),
+			"hash":        v.Hash,
+			"width":       v.Width,
+			"height":      v.Height,
+			"mime_type":   v.MIMEType,
+			"created_at":  v.CreatedAt,
+			"archived_at": v.ArchivedAt,
+		})
+	}
+
+	c.JSON(http.StatusOK, Response{
+		Code:    200,
+		Message: "Success",
+		Data: map[string]interface{}{
+			"image_id":        pic.ID,
+			"current_version": pic.Version,
+			"versions":        versions,
+		},
+	})
+}
+
+// RollbackImageVersion 回滚到历史版本：把该版本的文件作为新版本重新发布，历史记录不会丢失
+// POST /api/v1/images/:image_id/versions/:version/rollback
+func (h *Handler) RollbackImageVersion(c *gin.Context) {
+	version, err := strconv.Atoi(c.Param("version"))
+	if err != nil || version < 1 {
+		c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "Invalid version",
+		})
+		return
+	}
+
+	pic := h.getPictureOrAbort(c, c.Param("image_id"))
+	if pic == nil {
+		return
+	}
+	if version == pic.Version {
+		c.JSON(http.StatusConflict, Response{
+			Code:    409,
+			Message: "Version is already current",
+		})
+		return
+	}
+
+	target, err := h.store.GetPictureVersion(pic.ID, version)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, Response{
+				Code:    404,
+				Message: "Version not found",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: "Failed to get version",
+		})
+		return
+	}
+
+	src, err := h.storage.Get(target.StorageKey)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: fmt.Sprintf("Failed to read version file: %v", err),
+		})
+		return
+	}
+	content, err := io.ReadAll(src)
+	src.Close()
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: fmt.Sprintf("Failed to read version file: %v", err),
+		})
+		return
+	}
+
+	previous, updated, err := h.replaceFile(pic.ID, target.StorageKey, content, target.MIMEType)
+	if err == nil {
+		after := imageAuditState(updated, nil)
+		after["rollback_to"] = version
+		h.audit(c, auditImageRollback, "image", pic.ID, imageAuditState(previous, nil), after)
+	}
+	h.writeReplaceResult(c, updated, err)
+}
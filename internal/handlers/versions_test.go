@@ -0,0 +1,159 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/vaaandark/PixelHub/internal/database"
+	"github.com/vaaandark/PixelHub/internal/fakes"
+	"github.com/vaaandark/PixelHub/internal/imagemeta"
+)
+
+// conflictStore 模拟另一个实例在本次替换期间提交了新版本
+type conflictStore struct {
+	*fakes.Store
+	before func()
+}
+
+func (s *conflictStore) ReplacePictureFile(archived *database.PictureVersion, next *database.Picture) error {
+	if s.before != nil {
+		before := s.before
+		s.before = nil
+		before()
+	}
+	return s.Store.ReplacePictureFile(archived, next)
+}
+
+func TestReplaceFileArchivesToUniqueKeys(t *testing.T) {
+	e := newTestEnv(t, false)
+	for seed := 2; seed <= 3; seed++ {
+		code, body := e.do(http.MethodPut, "/api/v1/images/{image}/file", multipartBody("file", map[string][]byte{"new.png": testPNG(seed)}, nil))
+		if code != http.StatusOK {
+			t.Fatalf("replace %d: %d %s", seed, code, body)
+		}
+	}
+
+	versions, err := e.store.ListPictureVersions("img_fixture")
+	if err != nil || len(versions) != 2 {
+		t.Fatalf("versions = %v, %v", versions, err)
+	}
+	if versions[0].StorageKey == versions[1].StorageKey {
+		t.Fatalf("versions share storage key %s", versions[0].StorageKey)
+	}
+	for _, v := range versions {
+		data, ok := e.storage.Object(v.StorageKey)
+		if !ok || sha256Hex(data) != v.Hash {
+			t.Errorf("version %d object %s missing or does not match its hash", v.Version, v.StorageKey)
+		}
+	}
+}
+
+func TestReplaceFileConflictKeepsCommittedVersions(t *testing.T) {
+	e := newTestEnv(t, false)
+	cs := &conflictStore{Store: e.store}
+	e.h.store = cs
+
+	// 另一个实例在本次请求上传之后、提交之前完成了一次替换
+	cs.before = func() {
+		pic, err := e.store.GetPicture("img_fixture")
+		if err != nil {
+			t.Fatal(err)
+		}
+		other := testPNG(7)
+		key, _, _ := e.storage.Upload("img_fixture.v1.other.png", bytes.NewReader(other), int64(len(other)), "image/png")
+		next := *pic
+		next.Hash = sha256Hex(other)
+		next.Version = 2
+		archived := &database.PictureVersion{PictureID: pic.ID, Version: 1, StorageKey: key, Hash: pic.Hash}
+		if err := e.store.ReplacePictureFile(archived, &next); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	code, body := e.do(http.MethodPut, "/api/v1/images/{image}/file", multipartBody("file", map[string][]byte{"new.jpg": testPNG(2)}, nil))
+	if code != http.StatusConflict {
+		t.Fatalf("replace = %d, want 409: %s", code, body)
+	}
+
+	// 本次请求写入的历史副本和新存储键都被删除，其他请求提交的对象保留
+	want := "img_fixture.png,img_fixture.v1.other.png"
+	if keys := strings.Join(e.storage.Keys(), ","); keys != want {
+		t.Errorf("storage keys = %s, want %s", keys, want)
+	}
+	v, err := e.store.GetPictureVersion("img_fixture", 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := e.storage.Object(v.StorageKey); !ok {
+		t.Errorf("committed version object %s was deleted", v.StorageKey)
+	}
+}
+
+func TestExportIncludesVersions(t *testing.T) {
+	e := newTestEnv(t, false)
+	replaceFixture(e)
+
+	code, body := e.do(http.MethodGet, "/api/v1/export", nil)
+	if code != http.StatusOK {
+		t.Fatalf("export = %d", code)
+	}
+	zr, err := zip.NewReader(strings.NewReader(body), int64(len(body)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	files := make(map[string]*zip.File)
+	for _, f := range zr.File {
+		files[f.Name] = f
+	}
+	for _, name := range []string{"images/img_fixture.png", "images/img_fixture.v1.png", "manifest.json"} {
+		if files[name] == nil {
+			t.Errorf("archive has no %s", name)
+		}
+	}
+
+	rc, err := files["manifest.json"].Open()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer rc.Close()
+	var manifest struct {
+		Images []exportRecord `json:"images"`
+	}
+	if err := json.NewDecoder(rc).Decode(&manifest); err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Images) != 1 || len(manifest.Images[0].Versions) != 1 || manifest.Images[0].Versions[0].File != "images/img_fixture.v1.png" {
+		t.Errorf("manifest images = %+v", manifest.Images)
+	}
+}
+
+// 替换文件和上传一样受像素数上限约束，过大的图片留给后台补算感知哈希
+func TestReplaceFileDefersLargeImageHash(t *testing.T) {
+	e := newTestEnv(t, false)
+	e.h.hashMaxPixels = 100
+
+	code, body := e.do(http.MethodPut, "/api/v1/images/{image}/file", multipartBody("file", map[string][]byte{"new.png": testPNG(2)}, nil))
+	if code != http.StatusOK {
+		t.Fatalf("replace = %d %s", code, body)
+	}
+	pic, err := e.store.GetPicture("img_fixture")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pic.PHash != "" || !pic.PHashDeferred || pic.Width != 32 || pic.Height != 24 {
+		t.Errorf("picture = %q deferred=%v %dx%d, want a deferred hash for a 32x24 image", pic.PHash, pic.PHashDeferred, pic.Width, pic.Height)
+	}
+
+	e.h.BackfillImageMetadata(context.Background())
+	if pic, err = e.store.GetPicture("img_fixture"); err != nil {
+		t.Fatal(err)
+	}
+	if want := imagemeta.Extract(testPNG(2)).PHash; pic.PHash != want || pic.PHashDeferred {
+		t.Errorf("phash after backfill = %q deferred=%v, want %q", pic.PHash, pic.PHashDeferred, want)
+	}
+}
@@ -0,0 +1,682 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+	"github.com/vaaandark/PixelHub/internal/config"
+	"github.com/vaaandark/PixelHub/internal/database"
+)
+
+// Webhook 投递的默认配置
+const (
+	defaultWebhookMaxAttempts    = 8
+	defaultWebhookTimeout        = 10 * time.Second
+	defaultDeliveryRetentionDays = 30
+
+	// 重试间隔从 webhookRetryBase 开始每次翻倍，最长 webhookRetryMax
+	webhookRetryBase = 30 * time.Second
+	webhookRetryMax  = time.Hour
+	// webhookPollInterval 没有新事件时检查到期重试的间隔
+	webhookPollInterval = 5 * time.Second
+	// webhookBatchSize 每轮最多并发投递的数量
+	webhookBatchSize = 20
+	// webhookLease 领取后的租约，实例在投递过程中退出时，租约到期后由其他实例重新投递
+	webhookLease = 2 * time.Minute
+	// maxWebhookErrorLength 投递记录中保存的错误信息长度上限
+	maxWebhookErrorLength = 500
+)
+
+// webhookPingEvent 测试事件，只发送给被测试的订阅
+const webhookPingEvent = "ping"
+
+// webhookDispatcher 投递 Webhook 事件：事件先写入 webhook_deliveries，再由后台任务发送和重试
+type webhookDispatcher struct {
+	client      *http.Client
+	maxAttempts int
+	retention   time.Duration
+	// wake 有新事件时唤醒后台任务
+	wake chan struct{}
+}
+
+func newWebhookDispatcher(cfg config.WebhookConfig) (*webhookDispatcher, error) {
+	timeout := time.Duration(cfg.Timeout) * time.Second
+	if timeout <= 0 {
+		timeout = defaultWebhookTimeout
+	}
+	guard, err := newAddressGuard(cfg.AllowHosts)
+	if err != nil {
+		return nil, fmt.Errorf("webhook allow_hosts: %w", err)
+	}
+	d := &webhookDispatcher{
+		client: &http.Client{
+			Transport: guard.transport(timeout),
+			Timeout:   timeout,
+			// 不跟随重定向，3xx 视为投递失败
+			CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse },
+		},
+		maxAttempts: cfg.MaxAttempts,
+		retention:   time.Duration(cfg.DeliveryRetention) * 24 * time.Hour,
+		wake:        make(chan struct{}, 1),
+	}
+	if d.maxAttempts <= 0 {
+		d.maxAttempts = defaultWebhookMaxAttempts
+	}
+	if d.retention <= 0 {
+		d.retention = defaultDeliveryRetentionDays * 24 * time.Hour
+	}
+	return d, nil
+}
+
+// ConfigureWebhooks 应用 [webhook] 配置（重试次数、超时、内网允许列表和投递记录保留时间）
+func (h *Handler) ConfigureWebhooks(cfg config.WebhookConfig) error {
+	dispatcher, err := newWebhookDispatcher(cfg)
+	if err != nil {
+		return err
+	}
+	h.webhooks = dispatcher
+	return nil
+}
+
+// notify 唤醒后台投递任务（不阻塞）
+func (d *webhookDispatcher) notify() {
+	select {
+	case d.wake <- struct{}{}:
+	default:
+	}
+}
+
+// retryDelay 第 attempts 次失败后的重试间隔
+func retryDelay(attempts int) time.Duration {
+	delay := webhookRetryBase
+	for i := 1; i < attempts && delay < webhookRetryMax; i++ {
+		delay *= 2
+	}
+	if delay > webhookRetryMax {
+		delay = webhookRetryMax
+	}
+	return delay
+}
+
+// signWebhook 签名为 HMAC-SHA256(secret, "<timestamp>.<body>") 的十六进制
+func signWebhook(secret string, timestamp int64, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	fmt.Fprintf(mac, "%d.", timestamp)
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// enqueueWebhookEvent 为匹配的启用订阅添加投递；only 非空时只投递给该订阅（测试事件）
+func (h *Handler) enqueueWebhookEvent(event *libraryEvent, only *database.Webhook) error {
+	var targets []database.Webhook
+	if only != nil {
+		targets = []database.Webhook{*only}
+	} else {
+		hooks, err := h.store.ListWebhooks(true)
+		if err != nil {
+			return err
+		}
+		for _, hook := range hooks {
+			if hook.Matches(event.Type) {
+				targets = append(targets, hook)
+			}
+		}
+	}
+	if len(targets) == 0 {
+		return nil
+	}
+
+	payload, err := json.Marshal(event)
+	if err != nil {
+		return err
+	}
+	deliveries := make([]database.WebhookDelivery, len(targets))
+	for i, hook := range targets {
+		deliveries[i] = database.WebhookDelivery{
+			WebhookID:     hook.ID,
+			EventID:       event.ID,
+			EventType:     event.Type,
+			Payload:       payload,
+			NextAttemptAt: event.CreatedAt,
+			CreatedAt:     event.CreatedAt,
+		}
+	}
+	if err := h.store.CreateWebhookDeliveries(deliveries); err != nil {
+		return err
+	}
+	h.webhooks.notify()
+	return nil
+}
+
+// RunWebhookDeliveries 投递到期的 Webhook 事件，失败的按指数退避重试，次数用完后进入死信队列（在后台运行）
+func (h *Handler) RunWebhookDeliveries(ctx context.Context) {
+	ticker := time.NewTicker(webhookPollInterval)
+	defer ticker.Stop()
+	lastCleanup := time.Time{}
+	for {
+		if time.Since(lastCleanup) > time.Hour {
+			if n, err := h.store.DeleteFinishedWebhookDeliveries(time.Now().Add(-h.webhooks.retention)); err != nil {
+				log.Printf("Warning: Failed to clean up webhook deliveries: %v", err)
+			} else if n > 0 {
+				log.Printf("Removed %d finished webhook deliveries", n)
+			}
+			lastCleanup = time.Now()
+		}
+
+		claimed, err := h.store.ClaimWebhookDeliveries(time.Now(), webhookLease, webhookBatchSize)
+		if err != nil {
+			log.Printf("Warning: Failed to claim webhook deliveries: %v", err)
+		}
+		var wg sync.WaitGroup
+		for i := range claimed {
+			wg.Add(1)
+			go func(d *database.WebhookDelivery) {
+				defer wg.Done()
+				h.deliverWebhook(ctx, d)
+			}(&claimed[i])
+		}
+		wg.Wait()
+
+		// 一轮领满时可能还有到期的投递，立即继续
+		if len(claimed) == webhookBatchSize {
+			continue
+		}
+		select {
+		case <-h.webhooks.wake:
+		case <-ticker.C:
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// deliverWebhook 发送一次投递并保存结果
+func (h *Handler) deliverWebhook(ctx context.Context, d *database.WebhookDelivery) {
+	hook, err := h.store.GetWebhook(d.WebhookID)
+	if err == sql.ErrNoRows {
+		return // 订阅已删除，投递记录随之删除
+	}
+	if err != nil {
+		log.Printf("Warning: Failed to load webhook %s: %v", d.WebhookID, err)
+		return // 租约到期后重试
+	}
+
+	d.Attempts++
+	now := time.Now()
+	if !hook.Active {
+		d.LastStatusCode, d.LastError = 0, "Webhook is disabled"
+		d.Attempts = h.webhooks.maxAttempts
+	} else {
+		d.LastStatusCode, d.LastError = h.sendWebhook(ctx, hook, d)
+		now = time.Now()
+	}
+
+	switch {
+	case d.LastError == "":
+		d.Status = database.DeliverySucceeded
+		d.FinishedAt = &now
+	case d.Attempts >= h.webhooks.maxAttempts:
+		d.Status = database.DeliveryDead
+		d.FinishedAt = &now
+		log.Printf("Webhook delivery %d to %s moved to dead letter queue after %d attempts: %s",
+			d.ID, hook.URL, d.Attempts, d.LastError)
+	default:
+		d.Status = database.DeliveryPending
+		d.NextAttemptAt = now.Add(retryDelay(d.Attempts))
+	}
+	if err := h.store.UpdateWebhookDelivery(d); err != nil {
+		log.Printf("Warning: Failed to save webhook delivery %d: %v", d.ID, err)
+	}
+}
+
+// sendWebhook 发送 POST 请求，返回状态码和错误信息（成功时为空）
+func (h *Handler) sendWebhook(ctx context.Context, hook *database.Webhook, d *database.WebhookDelivery) (int, string) {
+	timestamp := time.Now().Unix()
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, hook.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return 0, truncateError(err.Error())
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "PixelHub-Webhook")
+	req.Header.Set("X-PixelHub-Event", d.EventType)
+	req.Header.Set("X-PixelHub-Delivery", strconv.FormatInt(d.ID, 10))
+	req.Header.Set("X-PixelHub-Timestamp", strconv.FormatInt(timestamp, 10))
+	req.Header.Set("X-PixelHub-Signature", "sha256="+signWebhook(hook.Secret, timestamp, d.Payload))
+
+	resp, err := h.webhooks.client.Do(req)
+	if err != nil {
+		return 0, truncateError(err.Error())
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Sprintf("Receiver returned status %d", resp.StatusCode)
+	}
+	return resp.StatusCode, ""
+}
+
+func truncateError(msg string) string {
+	if len(msg) > maxWebhookErrorLength {
+		return msg[:maxWebhookErrorLength]
+	}
+	return msg
+}
+
+// validateWebhookURL 只允许 http/https 绝对地址（内网地址在投递时由 addressGuard 拒绝）
+func validateWebhookURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return errors.New("url must be an absolute http or https URL")
+	}
+	return nil
+}
+
+// normalizeEventPatterns 校验订阅的事件，空列表表示所有事件
+func normalizeEventPatterns(events []string) ([]string, error) {
+	var result []string
+	seen := make(map[string]bool)
+	for _, e := range events {
+		e = strings.TrimSpace(e)
+		if e == "" || seen[e] {
+			continue
+		}
+		if e != "*" && !strings.HasSuffix(e, ".") && !libraryEventTypes[e] {
+			return nil, fmt.Errorf("unknown event %q", e)
+		}
+		seen[e] = true
+		result = append(result, e)
+	}
+	if len(result) == 0 {
+		result = []string{"*"}
+	}
+	return result, nil
+}
+
+// generateWebhookSecret 随机生成签名密钥
+func generateWebhookSecret() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+	return "whsec_" + hex.EncodeToString(b), nil
+}
+
+// getWebhookOrAbort 获取订阅，不存在或出错时写入响应并返回 nil
+func (h *Handler) getWebhookOrAbort(c *gin.Context, id string) *database.Webhook {
+	hook, err := h.store.GetWebhook(id)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, Response{
+				Code:    404,
+				Message: "Webhook not found",
+			})
+			return nil
+		}
+		c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: "Failed to get webhook",
+		})
+		return nil
+	}
+	return hook
+}
+
+// CreateWebhook 创建 Webhook 订阅，响应中包含签名密钥（之后不再返回）
+// POST /api/v1/webhooks
+func (h *Handler) CreateWebhook(c *gin.Context) {
+	var req struct {
+		URL         string   `json:"url" binding:"required"`
+		Secret      string   `json:"secret"`
+		Events      []string `json:"events"`
+		Description string   `json:"description"`
+		Active      *bool    `json:"active"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "Invalid request",
+		})
+		return
+	}
+	if err := validateWebhookURL(req.URL); err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: fmt.Sprintf("Invalid webhook: %v", err),
+		})
+		return
+	}
+	events, err := normalizeEventPatterns(req.Events)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: fmt.Sprintf("Invalid webhook: %v", err),
+		})
+		return
+	}
+	if req.Secret == "" {
+		if req.Secret, err = generateWebhookSecret(); err != nil {
+			c.JSON(http.StatusInternalServerError, Response{
+				Code:    500,
+				Message: "Failed to generate secret",
+			})
+			return
+		}
+	}
+
+	hook := &database.Webhook{
+		ID:          "whk_" + uuid.New().String(),
+		URL:         req.URL,
+		Secret:      req.Secret,
+		Events:      events,
+		Description: req.Description,
+		Active:      req.Active == nil || *req.Active,
+	}
+	if err := h.store.CreateWebhook(hook); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: fmt.Sprintf("Failed to create webhook: %v", err),
+		})
+		return
+	}
+	h.audit(c, auditWebhookCreate, "webhook", hook.ID, nil, hook)
+
+	c.JSON(http.StatusCreated, Response{
+		Code:    201,
+		Message: "Webhook created successfully",
+		Data: map[string]interface{}{
+			"webhook": hook,
+			"secret":  hook.Secret,
+		},
+	})
+}
+
+// ListWebhooks 列出所有 Webhook 订阅
+// GET /api/v1/webhooks
+func (h *Handler) ListWebhooks(c *gin.Context) {
+	hooks, err := h.store.ListWebhooks(false)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: "Failed to list webhooks",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{
+		Code:    200,
+		Message: "Success",
+		Data: map[string]interface{}{
+			"total":    len(hooks),
+			"webhooks": hooks,
+		},
+	})
+}
+
+// GetWebhookDetail 获取 Webhook 订阅
+// GET /api/v1/webhooks/:webhook_id
+func (h *Handler) GetWebhookDetail(c *gin.Context) {
+	hook := h.getWebhookOrAbort(c, c.Param("webhook_id"))
+	if hook == nil {
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{
+		Code:    200,
+		Message: "Success",
+		Data:    hook,
+	})
+}
+
+// UpdateWebhook 更新订阅的地址、密钥、事件、描述或启用状态（只更新请求中出现的字段）
+// PUT /api/v1/webhooks/:webhook_id
+func (h *Handler) UpdateWebhook(c *gin.Context) {
+	var req struct {
+		URL         *string  `json:"url"`
+		Secret      *string  `json:"secret"`
+		Events      []string `json:"events"`
+		Description *string  `json:"description"`
+		Active      *bool    `json:"active"`
+	}
+	if err := c.ShouldBindJSON(&req); err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "Invalid request",
+		})
+		return
+	}
+
+	hook := h.getWebhookOrAbort(c, c.Param("webhook_id"))
+	if hook == nil {
+		return
+	}
+	before := *hook
+
+	if req.URL != nil {
+		if err := validateWebhookURL(*req.URL); err != nil {
+			c.JSON(http.StatusBadRequest, Response{
+				Code:    400,
+				Message: fmt.Sprintf("Invalid webhook: %v", err),
+			})
+			return
+		}
+		hook.URL = *req.URL
+	}
+	if req.Secret != nil {
+		if *req.Secret == "" {
+			c.JSON(http.StatusBadRequest, Response{
+				Code:    400,
+				Message: "Secret cannot be empty",
+			})
+			return
+		}
+		hook.Secret = *req.Secret
+	}
+	if req.Events != nil {
+		events, err := normalizeEventPatterns(req.Events)
+		if err != nil {
+			c.JSON(http.StatusBadRequest, Response{
+				Code:    400,
+				Message: fmt.Sprintf("Invalid webhook: %v", err),
+			})
+			return
+		}
+		hook.Events = events
+	}
+	if req.Description != nil {
+		hook.Description = *req.Description
+	}
+	if req.Active != nil {
+		hook.Active = *req.Active
+	}
+
+	if err := h.store.UpdateWebhook(hook); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: fmt.Sprintf("Failed to update webhook: %v", err),
+		})
+		return
+	}
+	h.audit(c, auditWebhookUpdate, "webhook", hook.ID, &before, hook)
+
+	c.JSON(http.StatusOK, Response{
+		Code:    200,
+		Message: "Webhook updated successfully",
+		Data:    hook,
+	})
+}
+
+// DeleteWebhook 删除订阅及其投递记录
+// DELETE /api/v1/webhooks/:webhook_id
+func (h *Handler) DeleteWebhook(c *gin.Context) {
+	hook := h.getWebhookOrAbort(c, c.Param("webhook_id"))
+	if hook == nil {
+		return
+	}
+
+	if err := h.store.DeleteWebhook(hook.ID); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: "Failed to delete webhook",
+		})
+		return
+	}
+	h.audit(c, auditWebhookDelete, "webhook", hook.ID, hook, nil)
+
+	c.JSON(http.StatusOK, Response{
+		Code:    200,
+		Message: "Webhook deleted successfully",
+	})
+}
+
+// PingWebhook 向订阅发送一个 ping 测试事件
+// POST /api/v1/webhooks/:webhook_id/ping
+func (h *Handler) PingWebhook(c *gin.Context) {
+	hook := h.getWebhookOrAbort(c, c.Param("webhook_id"))
+	if hook == nil {
+		return
+	}
+
+	event := &libraryEvent{
+		ID:        "evt_" + uuid.New().String(),
+		Type:      webhookPingEvent,
+		CreatedAt: time.Now().UTC().Truncate(time.Second),
+		Actor:     auditActor(c),
+	}
+	if err := h.enqueueWebhookEvent(event, hook); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: fmt.Sprintf("Failed to queue ping: %v", err),
+		})
+		return
+	}
+
+	c.JSON(http.StatusAccepted, Response{
+		Code:    202,
+		Message: "Ping queued",
+		Data: map[string]interface{}{
+			"event_id": event.ID,
+		},
+	})
+}
+
+// ListWebhookDeliveries 列出订阅的投递记录（最新优先），status=dead 即死信队列
+// GET /api/v1/webhooks/:webhook_id/deliveries?status=&page=&limit=
+func (h *Handler) ListWebhookDeliveries(c *gin.Context) {
+	page, _ := strconv.Atoi(c.DefaultQuery("page", "1"))
+	limit, _ := strconv.Atoi(c.DefaultQuery("limit", "20"))
+
+	if page < 1 {
+		page = 1
+	}
+	if limit < 1 || limit > 100 {
+		limit = 20
+	}
+	status := c.Query("status")
+	switch status {
+	case "", database.DeliveryPending, database.DeliverySucceeded, database.DeliveryDead:
+	default:
+		c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "Invalid status, expected pending, succeeded or dead",
+		})
+		return
+	}
+
+	hook := h.getWebhookOrAbort(c, c.Param("webhook_id"))
+	if hook == nil {
+		return
+	}
+
+	deliveries, total, err := h.store.ListWebhookDeliveries(hook.ID, status, page, limit)
+	if err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: "Failed to list deliveries",
+		})
+		return
+	}
+
+	c.JSON(http.StatusOK, Response{
+		Code:    200,
+		Message: "Success",
+		Data: map[string]interface{}{
+			"total":        total,
+			"current_page": page,
+			"deliveries":   deliveries,
+		},
+	})
+}
+
+// RedeliverWebhook 把投递重新放回队列（尝试次数清零），用于处理死信队列
+// POST /api/v1/webhooks/:webhook_id/deliveries/:delivery_id/redeliver
+func (h *Handler) RedeliverWebhook(c *gin.Context) {
+	deliveryID, err := strconv.ParseInt(c.Param("delivery_id"), 10, 64)
+	if err != nil {
+		c.JSON(http.StatusBadRequest, Response{
+			Code:    400,
+			Message: "Invalid delivery ID",
+		})
+		return
+	}
+
+	hook := h.getWebhookOrAbort(c, c.Param("webhook_id"))
+	if hook == nil {
+		return
+	}
+
+	d, err := h.store.GetWebhookDelivery(hook.ID, deliveryID)
+	if err != nil {
+		if err == sql.ErrNoRows {
+			c.JSON(http.StatusNotFound, Response{
+				Code:    404,
+				Message: "Delivery not found",
+			})
+			return
+		}
+		c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: "Failed to get delivery",
+		})
+		return
+	}
+	if d.Status == database.DeliveryPending {
+		c.JSON(http.StatusConflict, Response{
+			Code:    409,
+			Message: "Delivery is still pending",
+		})
+		return
+	}
+
+	if err := h.store.RetryWebhookDelivery(hook.ID, d.ID, time.Now()); err != nil {
+		c.JSON(http.StatusInternalServerError, Response{
+			Code:    500,
+			Message: "Failed to requeue delivery",
+		})
+		return
+	}
+	h.webhooks.notify()
+
+	c.JSON(http.StatusAccepted, Response{
+		Code:    202,
+		Message: "Delivery queued",
+	})
+}
@@ -0,0 +1,253 @@
+package handlers
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"github.com/vaaandark/PixelHub/internal/config"
+	"github.com/vaaandark/PixelHub/internal/database"
+	"github.com/vaaandark/PixelHub/internal/fakes"
+)
+
+// webhookReceiver 记录收到的投递，依次返回 statuses 中的状态码（用完后返回最后一个）
+type webhookReceiver struct {
+	mu       sync.Mutex
+	statuses []int
+	requests []receivedWebhook
+}
+
+type receivedWebhook struct {
+	header http.Header
+	body   []byte
+}
+
+func (r *webhookReceiver) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	body, _ := io.ReadAll(req.Body)
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.requests = append(r.requests, receivedWebhook{header: req.Header.Clone(), body: body})
+	status := r.statuses[min(len(r.requests), len(r.statuses))-1]
+	w.WriteHeader(status)
+}
+
+func (r *webhookReceiver) received() []receivedWebhook {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]receivedWebhook(nil), r.requests...)
+}
+
+// newWebhookTestEnv 不带测试数据的环境，投递允许发送到本机的接收端
+func newWebhookTestEnv(t *testing.T, maxAttempts int) *testEnv {
+	t.Helper()
+	e := &testEnv{t: t, store: fakes.NewStore(), storage: fakes.NewStorage(), ids: make(map[string]string)}
+	e.h = NewHandler(e.store, e.storage, nil)
+	if err := e.h.ConfigureWebhooks(config.WebhookConfig{AllowHosts: []string{"127.0.0.1"}, MaxAttempts: maxAttempts}); err != nil {
+		t.Fatal(err)
+	}
+	e.router = gin.New()
+	e.h.RegisterRoutes(e.router)
+	return e
+}
+
+// createWebhook 通过 API 创建订阅并返回 ID
+func (e *testEnv) createWebhook(body map[string]interface{}) string {
+	e.t.Helper()
+	code, resp := e.do("POST", "/api/v1/webhooks", jsonBody(body))
+	if code != http.StatusCreated {
+		e.t.Fatalf("create webhook = %d %s", code, resp)
+	}
+	var created struct {
+		Data struct {
+			Webhook database.Webhook `json:"webhook"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal([]byte(resp), &created); err != nil {
+		e.t.Fatal(err)
+	}
+	return created.Data.Webhook.ID
+}
+
+// deliverDue 领取 now 时到期的投递并逐个发送，返回发送的数量
+func (e *testEnv) deliverDue(now time.Time) int {
+	e.t.Helper()
+	claimed, err := e.store.ClaimWebhookDeliveries(now, webhookLease, webhookBatchSize)
+	if err != nil {
+		e.t.Fatal(err)
+	}
+	for i := range claimed {
+		e.h.deliverWebhook(context.Background(), &claimed[i])
+	}
+	return len(claimed)
+}
+
+func TestWebhookDeliverySignature(t *testing.T) {
+	e := newWebhookTestEnv(t, 3)
+	receiver := &webhookReceiver{statuses: []int{http.StatusOK}}
+	srv := httptest.NewServer(receiver)
+	defer srv.Close()
+
+	const secret = "whsec_test"
+	hookID := e.createWebhook(map[string]interface{}{"url": srv.URL + "/hook", "secret": secret, "events": []string{"album."}})
+	if code, resp := e.do("POST", "/api/v1/albums", jsonBody(map[string]string{"name": "Trip"})); code != http.StatusCreated {
+		t.Fatalf("create album = %d %s", code, resp)
+	}
+
+	if n := e.deliverDue(time.Now()); n != 1 {
+		t.Fatalf("delivered %d, want 1", n)
+	}
+	got := receiver.received()
+	if len(got) != 1 {
+		t.Fatalf("receiver got %d requests", len(got))
+	}
+	req := got[0]
+	if req.header.Get("X-PixelHub-Event") != auditAlbumCreate {
+		t.Errorf("event header = %q", req.header.Get("X-PixelHub-Event"))
+	}
+
+	// 接收端按文档校验：HMAC-SHA256(secret, "<timestamp>.<body>")
+	timestamp, err := strconv.ParseInt(req.header.Get("X-PixelHub-Timestamp"), 10, 64)
+	if err != nil {
+		t.Fatalf("timestamp header: %v", err)
+	}
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(strconv.FormatInt(timestamp, 10) + "."))
+	mac.Write(req.body)
+	want := "sha256=" + hex.EncodeToString(mac.Sum(nil))
+	if sig := req.header.Get("X-PixelHub-Signature"); !hmac.Equal([]byte(sig), []byte(want)) {
+		t.Errorf("signature = %q, want %q", sig, want)
+	}
+	var event libraryEvent
+	if err := json.Unmarshal(req.body, &event); err != nil || event.Type != auditAlbumCreate || event.TargetType != "album" {
+		t.Errorf("payload = %s (%v)", req.body, err)
+	}
+
+	deliveries, _, err := e.store.ListWebhookDeliveries(hookID, "", 1, 10)
+	if err != nil || len(deliveries) != 1 {
+		t.Fatalf("deliveries = %v, %v", deliveries, err)
+	}
+	if d := deliveries[0]; d.Status != database.DeliverySucceeded || d.Attempts != 1 || d.LastStatusCode != http.StatusOK {
+		t.Errorf("delivery = %+v", d)
+	}
+}
+
+func TestWebhookRetryAndDeadLetter(t *testing.T) {
+	e := newWebhookTestEnv(t, 3)
+	receiver := &webhookReceiver{statuses: []int{http.StatusInternalServerError}}
+	srv := httptest.NewServer(receiver)
+	defer srv.Close()
+
+	hookID := e.createWebhook(map[string]interface{}{"url": srv.URL, "events": []string{"album."}})
+	e.ids["webhook"] = hookID
+	if code, resp := e.do("POST", "/api/v1/webhooks/{webhook}/ping", nil); code != http.StatusAccepted {
+		t.Fatalf("ping = %d %s", code, resp)
+	}
+	delivery := func() database.WebhookDelivery {
+		t.Helper()
+		deliveries, _, err := e.store.ListWebhookDeliveries(hookID, "", 1, 10)
+		if err != nil || len(deliveries) != 1 {
+			t.Fatalf("deliveries = %v, %v", deliveries, err)
+		}
+		return deliveries[0]
+	}
+
+	// 每次失败后按 webhookRetryBase 翻倍退避，到期前不会重新投递
+	next := time.Now()
+	for attempt := 1; attempt < 3; attempt++ {
+		sent := time.Now()
+		if n := e.deliverDue(next); n != 1 {
+			t.Fatalf("attempt %d: delivered %d, want 1", attempt, n)
+		}
+		d := delivery()
+		if d.Status != database.DeliveryPending || d.Attempts != attempt || d.LastStatusCode != http.StatusInternalServerError {
+			t.Fatalf("attempt %d: delivery = %+v", attempt, d)
+		}
+		delay := retryDelay(attempt)
+		if wait := d.NextAttemptAt.Sub(sent); wait < delay-2*time.Second || wait > delay+2*time.Second {
+			t.Errorf("attempt %d: next attempt in %s, want about %s", attempt, wait, delay)
+		}
+		if n := e.deliverDue(d.NextAttemptAt.Add(-delay / 2)); n != 0 {
+			t.Errorf("attempt %d: delivered %d before the backoff expired", attempt, n)
+		}
+		next = d.NextAttemptAt
+	}
+
+	// 第 3 次失败后进入死信队列，不再投递
+	if n := e.deliverDue(next); n != 1 {
+		t.Fatalf("final attempt: delivered %d, want 1", n)
+	}
+	if d := delivery(); d.Status != database.DeliveryDead || d.Attempts != 3 || d.FinishedAt == nil {
+		t.Errorf("delivery after max attempts = %+v", d)
+	}
+	if n := e.deliverDue(next.Add(webhookRetryMax)); n != 0 {
+		t.Errorf("dead delivery was sent again")
+	}
+	if got := len(receiver.received()); got != 3 {
+		t.Errorf("receiver got %d requests, want 3", got)
+	}
+	if code, resp := e.do("GET", "/api/v1/webhooks/{webhook}/deliveries?status=dead", nil); code != http.StatusOK || !strings.Contains(resp, `"total":1`) {
+		t.Errorf("dead letter queue = %d %s", code, resp)
+	}
+
+	// 重新投递后清零尝试次数，接收端恢复后投递成功
+	receiver.mu.Lock()
+	receiver.statuses = []int{http.StatusNoContent}
+	receiver.requests = nil
+	receiver.mu.Unlock()
+	e.ids["delivery"] = strconv.FormatInt(delivery().ID, 10)
+	if code, resp := e.do("POST", "/api/v1/webhooks/{webhook}/deliveries/{delivery}/redeliver", nil); code != http.StatusAccepted {
+		t.Fatalf("redeliver = %d %s", code, resp)
+	}
+	if n := e.deliverDue(time.Now()); n != 1 {
+		t.Fatalf("redelivered %d, want 1", n)
+	}
+	if d := delivery(); d.Status != database.DeliverySucceeded || d.Attempts != 1 {
+		t.Errorf("delivery after redeliver = %+v", d)
+	}
+}
+
+func TestWebhookChangesAreAudited(t *testing.T) {
+	e := newWebhookTestEnv(t, 3)
+	hookID := e.createWebhook(map[string]interface{}{"url": "https://hooks.example.com/a", "secret": "whsec_hidden", "events": []string{"album."}})
+	e.ids["webhook"] = hookID
+	if code, resp := e.do("PUT", "/api/v1/webhooks/{webhook}", jsonBody(map[string]interface{}{"url": "https://hooks.example.com/b"})); code != http.StatusOK {
+		t.Fatalf("update = %d %s", code, resp)
+	}
+	if code, resp := e.do("DELETE", "/api/v1/webhooks/{webhook}", nil); code != http.StatusOK {
+		t.Fatalf("delete = %d %s", code, resp)
+	}
+
+	entries, _, err := e.store.ListAuditEntries(database.AuditFilter{TargetType: "webhook"}, 1, 10)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var actions []string
+	for _, entry := range entries {
+		actions = append(actions, entry.Action)
+		if entry.TargetID != hookID {
+			t.Errorf("%s target = %q", entry.Action, entry.TargetID)
+		}
+		if strings.Contains(string(entry.Before)+string(entry.After), "whsec_hidden") {
+			t.Errorf("%s records the secret", entry.Action)
+		}
+		if entry.Action == auditWebhookUpdate && (!strings.Contains(string(entry.Before), "/a") || !strings.Contains(string(entry.After), "/b")) {
+			t.Errorf("update before/after = %s / %s", entry.Before, entry.After)
+		}
+	}
+	// 审计日志从新到旧
+	want := []string{auditWebhookDelete, auditWebhookUpdate, auditWebhookCreate}
+	if len(actions) != len(want) || actions[0] != want[0] || actions[1] != want[1] || actions[2] != want[2] {
+		t.Errorf("audit actions = %v, want %v", actions, want)
+	}
+}
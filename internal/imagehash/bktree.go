@@ -0,0 +1,81 @@
+package imagehash
+
+// Match 相似查询的命中结果
+type Match struct {
+	ID       string
+	Hash     Hash
+	Distance int
+}
+
+// BKTree 按汉明距离组织的 BK 树，用于在大量哈希中快速查找相似项
+type BKTree struct {
+	root *bkNode
+	size int
+}
+
+type bkNode struct {
+	id       string
+	hash     Hash
+	children map[int]*bkNode
+}
+
+// NewBKTree 创建空的 BK 树
+func NewBKTree() *BKTree {
+	return &BKTree{}
+}
+
+// Len 返回树中的元素数量
+func (t *BKTree) Len() int {
+	return t.size
+}
+
+// Insert 插入一个哈希
+func (t *BKTree) Insert(id string, hash Hash) {
+	t.size++
+	node := &bkNode{id: id, hash: hash}
+	if t.root == nil {
+		t.root = node
+		return
+	}
+
+	cur := t.root
+	for {
+		d := Distance(cur.hash, hash)
+		if cur.children == nil {
+			cur.children = make(map[int]*bkNode)
+		}
+		child, ok := cur.children[d]
+		if !ok {
+			cur.children[d] = node
+			return
+		}
+		cur = child
+	}
+}
+
+// Search 返回与 hash 距离不超过 maxDistance 的所有元素
+func (t *BKTree) Search(hash Hash, maxDistance int) []Match {
+	if t.root == nil {
+		return nil
+	}
+
+	var matches []Match
+	stack := []*bkNode{t.root}
+	for len(stack) > 0 {
+		node := stack[len(stack)-1]
+		stack = stack[:len(stack)-1]
+
+		d := Distance(node.hash, hash)
+		if d <= maxDistance {
+			matches = append(matches, Match{ID: node.id, Hash: node.hash, Distance: d})
+		}
+
+		// 三角不等式：只有距离在 [d-max, d+max] 内的子树可能命中
+		for cd, child := range node.children {
+			if cd >= d-maxDistance && cd <= d+maxDistance {
+				stack = append(stack, child)
+			}
+		}
+	}
+	return matches
+}
@@ -0,0 +1,103 @@
+package imagehash
+
+import (
+	"fmt"
+	"math/bits"
+	"math/rand"
+	"sort"
+	"testing"
+)
+
+// flip 翻转 h 的低 n 位，得到距离恰好为 n 的哈希
+func flip(h Hash, n int) Hash {
+	if n == 64 {
+		return ^h
+	}
+	return h ^ Hash(uint64(1)<<n-1)
+}
+
+func matchIDs(matches []Match) []string {
+	ids := make([]string, len(matches))
+	for i, m := range matches {
+		ids[i] = m.ID
+	}
+	sort.Strings(ids)
+	return ids
+}
+
+func TestBKTreeSearchMatchesLinearScan(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	query := Hash(rng.Uint64())
+
+	tree := NewBKTree()
+	hashes := make(map[string]Hash)
+	add := func(id string, h Hash) {
+		tree.Insert(id, h)
+		hashes[id] = h
+	}
+	// 与查询距离恰好为 0-64 的哈希，覆盖每个阈值的边界
+	for n := 0; n <= 64; n++ {
+		add(fmt.Sprintf("exact_%02d", n), flip(query, n))
+	}
+	// 重复的哈希
+	add("dup", query)
+	for i := 0; i < 500; i++ {
+		add(fmt.Sprintf("rand_%03d", i), Hash(rng.Uint64()))
+	}
+	// 随机哈希附近的近邻，让子树中出现多层节点
+	for i := 0; i < 200; i++ {
+		h := Hash(rng.Uint64())
+		add(fmt.Sprintf("near_%03d", i), h^Hash(1)<<rng.Intn(64))
+	}
+	if tree.Len() != len(hashes) {
+		t.Fatalf("Len = %d, want %d", tree.Len(), len(hashes))
+	}
+
+	for _, q := range []Hash{query, hashes["rand_000"], Hash(rng.Uint64())} {
+		for _, maxDistance := range []int{0, 1, 2, 5, 10, 31, 32, 33, 63, 64} {
+			var want []string
+			for id, h := range hashes {
+				if bits.OnesCount64(uint64(q^h)) <= maxDistance {
+					want = append(want, id)
+				}
+			}
+			sort.Strings(want)
+
+			matches := tree.Search(q, maxDistance)
+			for _, m := range matches {
+				if m.Hash != hashes[m.ID] || m.Distance != Distance(q, m.Hash) {
+					t.Errorf("match %+v does not match the inserted hash", m)
+				}
+			}
+			if got := matchIDs(matches); fmt.Sprint(got) != fmt.Sprint(want) {
+				t.Errorf("Search(%v, %d) = %d matches, linear scan = %d", q, maxDistance, len(got), len(want))
+			}
+		}
+	}
+}
+
+func TestBKTreeSearchBoundary(t *testing.T) {
+	query := Hash(0x0123456789abcdef)
+	tree := NewBKTree()
+	for n := 0; n <= 64; n++ {
+		tree.Insert(fmt.Sprintf("d%02d", n), flip(query, n))
+	}
+	for maxDistance := 0; maxDistance <= 64; maxDistance++ {
+		matches := tree.Search(query, maxDistance)
+		if len(matches) != maxDistance+1 {
+			t.Errorf("Search(max=%d) = %d matches, want %d", maxDistance, len(matches), maxDistance+1)
+		}
+		for _, m := range matches {
+			if m.Distance > maxDistance {
+				t.Errorf("Search(max=%d) returned %s at distance %d", maxDistance, m.ID, m.Distance)
+			}
+		}
+	}
+}
+
+func TestBKTreeEmpty(t *testing.T) {
+	tree := NewBKTree()
+	if tree.Len() != 0 || tree.Search(0, 64) != nil {
+		t.Error("empty tree returned matches")
+	}
+}
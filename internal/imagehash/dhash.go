@@ -0,0 +1,115 @@
+package imagehash
+
+import (
+	"fmt"
+	"image"
+	_ "image/gif"
+	_ "image/jpeg"
+	_ "image/png"
+	"io"
+	"math/bits"
+	"strconv"
+)
+
+// 差值哈希（dHash）使用 9x8 的灰度缩略图，比较水平相邻像素的亮度得到 64 位指纹。
+// 缩放、重新编码、轻微调色后的同一张图片，其指纹的汉明距离通常很小。
+const (
+	hashWidth  = 9
+	hashHeight = 8
+
+	// maxSamples 每个采样块在单个方向上的最大采样点数，避免大图逐像素计算
+	maxSamples = 16
+)
+
+// Hash 64 位感知哈希
+type Hash uint64
+
+// Compute 解码图片并计算感知哈希
+// 仅支持标准库可解码的格式（JPEG、PNG、GIF），其他格式返回错误
+func Compute(r io.Reader) (Hash, error) {
+	img, _, err := image.Decode(r)
+	if err != nil {
+		return 0, fmt.Errorf("failed to decode image: %w", err)
+	}
+	return DHash(img), nil
+}
+
+// DHash 计算图片的差值哈希
+func DHash(img image.Image) Hash {
+	b := img.Bounds()
+	w, h := b.Dx(), b.Dy()
+	if w == 0 || h == 0 {
+		return 0
+	}
+
+	// 按块取平均亮度，缩小到 9x8
+	var gray [hashHeight][hashWidth]float64
+	for y := 0; y < hashHeight; y++ {
+		y0 := b.Min.Y + y*h/hashHeight
+		y1 := b.Min.Y + (y+1)*h/hashHeight
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < hashWidth; x++ {
+			x0 := b.Min.X + x*w/hashWidth
+			x1 := b.Min.X + (x+1)*w/hashWidth
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+			gray[y][x] = blockLuminance(img, x0, y0, x1, y1)
+		}
+	}
+
+	var hash Hash
+	for y := 0; y < hashHeight; y++ {
+		for x := 0; x < hashWidth-1; x++ {
+			hash <<= 1
+			if gray[y][x] < gray[y][x+1] {
+				hash |= 1
+			}
+		}
+	}
+	return hash
+}
+
+// blockLuminance 计算矩形区域的平均亮度（大区域按步长采样）
+func blockLuminance(img image.Image, x0, y0, x1, y1 int) float64 {
+	stepX := (x1 - x0) / maxSamples
+	if stepX < 1 {
+		stepX = 1
+	}
+	stepY := (y1 - y0) / maxSamples
+	if stepY < 1 {
+		stepY = 1
+	}
+
+	var sum float64
+	var n int
+	for y := y0; y < y1; y += stepY {
+		for x := x0; x < x1; x += stepX {
+			r, g, b, _ := img.At(x, y).RGBA()
+			sum += 0.299*float64(r) + 0.587*float64(g) + 0.114*float64(b)
+			n++
+		}
+	}
+	return sum / float64(n)
+}
+
+// Distance 计算两个哈希的汉明距离（0-64）
+func Distance(a, b Hash) int {
+	return bits.OnesCount64(uint64(a ^ b))
+}
+
+// String 返回 16 位十六进制表示，用于数据库存储
+func (h Hash) String() string {
+	return fmt.Sprintf("%016x", uint64(h))
+}
+
+// Parse 解析十六进制表示的哈希
+func Parse(s string) (Hash, error) {
+	v, err := strconv.ParseUint(s, 16, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid perceptual hash %q: %w", s, err)
+	}
+	return Hash(v), nil
+}
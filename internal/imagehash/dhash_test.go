@@ -0,0 +1,124 @@
+package imagehash
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"testing"
+)
+
+// gradient 从左到右、从上到下渐变的灰度图，shift 整体调亮
+func gradient(w, h int, shift uint8) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			v := (x*200/w + y*40/h) + int(shift)
+			if v > 255 {
+				v = 255
+			}
+			img.SetGray(x, y, color.Gray{Y: uint8(v)})
+		}
+	}
+	return img
+}
+
+// stripes 竖条纹图片，与渐变图的结构完全不同
+func stripes(w, h int) *image.Gray {
+	img := image.NewGray(image.Rect(0, 0, w, h))
+	for y := 0; y < h; y++ {
+		for x := 0; x < w; x++ {
+			if (x*hashWidth/w+y*hashHeight/h)%2 == 0 {
+				img.SetGray(x, y, color.Gray{Y: 230})
+			}
+		}
+	}
+	return img
+}
+
+func TestDHash(t *testing.T) {
+	base := DHash(gradient(180, 120, 0))
+	tests := []struct {
+		name    string
+		img     image.Image
+		maxDist int
+		minDist int
+	}{
+		{name: "identical", img: gradient(180, 120, 0), maxDist: 0},
+		{name: "brighter", img: gradient(180, 120, 20), maxDist: 5},
+		{name: "resized", img: gradient(90, 60, 0), maxDist: 5},
+		{name: "unrelated", img: stripes(180, 120), maxDist: 64, minDist: 20},
+	}
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			d := Distance(base, DHash(tc.img))
+			if d > tc.maxDist || d < tc.minDist {
+				t.Errorf("distance = %d, want %d-%d", d, tc.minDist, tc.maxDist)
+			}
+		})
+	}
+
+	if got := DHash(image.NewGray(image.Rect(0, 0, 0, 0))); got != 0 {
+		t.Errorf("empty image hash = %v, want 0", got)
+	}
+	// 尺寸小于 9x8 的图片也能计算
+	DHash(gradient(2, 2, 0))
+}
+
+func TestCompute(t *testing.T) {
+	img := gradient(64, 48, 0)
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	got, err := Compute(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := DHash(img); got != want {
+		t.Errorf("Compute = %v, want %v", got, want)
+	}
+	if _, err := Compute(bytes.NewReader([]byte("not an image"))); err == nil {
+		t.Error("Compute accepted non-image data")
+	}
+}
+
+func TestDistance(t *testing.T) {
+	tests := []struct {
+		a, b Hash
+		want int
+	}{
+		{0, 0, 0},
+		{0, 1, 1},
+		{0xff, 0x0f, 4},
+		{0, ^Hash(0), 64},
+		{0x8000000000000001, 0x0000000000000001, 1},
+	}
+	for _, tc := range tests {
+		if got := Distance(tc.a, tc.b); got != tc.want {
+			t.Errorf("Distance(%v, %v) = %d, want %d", tc.a, tc.b, got, tc.want)
+		}
+		if got := Distance(tc.b, tc.a); got != tc.want {
+			t.Errorf("Distance(%v, %v) = %d, want %d", tc.b, tc.a, got, tc.want)
+		}
+	}
+}
+
+func TestParse(t *testing.T) {
+	for _, h := range []Hash{0, 1, 0x00ff00ff00ff00ff, ^Hash(0)} {
+		s := h.String()
+		if len(s) != 16 {
+			t.Errorf("String(%d) = %q, want 16 hex digits", uint64(h), s)
+		}
+		got, err := Parse(s)
+		if err != nil || got != h {
+			t.Errorf("Parse(%q) = %v, %v, want %v", s, got, err, h)
+		}
+	}
+
+	for _, s := range []string{"", "xyz", "0x1234", "-1", "1ffffffffffffffff", "00ff 00ff"} {
+		if _, err := Parse(s); err == nil {
+			t.Errorf("Parse(%q) succeeded, want error", s)
+		}
+	}
+}
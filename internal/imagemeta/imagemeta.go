@@ -0,0 +1,63 @@
+package imagemeta
+
+import (
+	"bytes"
+	"image"
+	"io"
+	"net/http"
+
+	"github.com/vaaandark/PixelHub/internal/imagehash"
+)
+
+// Metadata 从图片内容中提取的元数据
+type Metadata struct {
+	MIMEType string // 根据内容嗅探的 MIME 类型
+	Width    int    // 宽度（像素），无法解码时为 0
+	Height   int    // 高度（像素），无法解码时为 0
+	PHash    string // 感知哈希（十六进制），无法解码时为空
+	// PHashSkipped 像素数超过上限，没有解码整张图片计算感知哈希
+	PHashSkipped bool
+}
+
+// Extract 提取图片元数据
+// 仅支持标准库可解码的格式（JPEG、PNG、GIF）计算尺寸和感知哈希，其他格式只返回 MIME 类型
+func Extract(content []byte) Metadata {
+	return ExtractFrom(bytes.NewReader(content))
+}
+
+// ExtractFrom 与 Extract 相同，从头读取 content（可能多次 Seek），不把整个文件读入内存
+func ExtractFrom(content io.ReadSeeker) Metadata {
+	return ExtractLimit(content, 0)
+}
+
+// ExtractLimit 与 ExtractFrom 相同，但宽×高超过 maxPixels（大于 0 时）的图片不计算感知哈希：
+// 计算感知哈希要解码整张图片（每像素约 4 字节），只读取头部的尺寸
+func ExtractLimit(content io.ReadSeeker, maxPixels int) Metadata {
+	var meta Metadata
+
+	// DetectContentType 最多只看前 512 字节
+	head := make([]byte, 512)
+	n, _ := io.ReadFull(content, head)
+	meta.MIMEType = http.DetectContentType(head[:n])
+
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return meta
+	}
+	if cfg, _, err := image.DecodeConfig(content); err == nil {
+		meta.Width = cfg.Width
+		meta.Height = cfg.Height
+	}
+	if maxPixels > 0 && int64(meta.Width)*int64(meta.Height) > int64(maxPixels) {
+		meta.PHashSkipped = true
+		return meta
+	}
+
+	if _, err := content.Seek(0, io.SeekStart); err != nil {
+		return meta
+	}
+	if hash, err := imagehash.Compute(content); err == nil {
+		meta.PHash = hash.String()
+	}
+
+	return meta
+}
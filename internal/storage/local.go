@@ -0,0 +1,187 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vaaandark/PixelHub/internal/config"
+)
+
+const (
+	defaultLocalDir     = "./data/images"
+	defaultLocalBaseURL = "/files"
+)
+
+// LocalProvider 把文件保存在本地目录中，由服务自身通过 BaseURL 对应的路径提供访问
+// 配置 SigningKey 后实现 URLSigner：签名 URL 带 expires 和 signature 参数，ServeFile 拒绝没有有效签名的请求
+type LocalProvider struct {
+	dir        string
+	baseURL    string
+	signingKey []byte
+	now        func() time.Time
+}
+
+func NewLocalProvider(cfg *config.LocalConfig) (*LocalProvider, error) {
+	dir := cfg.Dir
+	if dir == "" {
+		dir = defaultLocalDir
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, fmt.Errorf("failed to create storage directory: %w", err)
+	}
+	baseURL := strings.TrimSuffix(cfg.BaseURL, "/")
+	if baseURL == "" {
+		baseURL = defaultLocalBaseURL
+	}
+	if _, err := url.Parse(baseURL); err != nil {
+		return nil, fmt.Errorf("invalid local base URL: %w", err)
+	}
+	return &LocalProvider{dir: dir, baseURL: baseURL, signingKey: []byte(cfg.SigningKey), now: time.Now}, nil
+}
+
+// path 返回 key 对应的文件路径，拒绝绝对路径和跳出存储目录的 key
+func (p *LocalProvider) path(storageKey string) (string, error) {
+	name := filepath.FromSlash(storageKey)
+	if storageKey == "" || !filepath.IsLocal(name) {
+		return "", fmt.Errorf("invalid storage key: %q", storageKey)
+	}
+	return filepath.Join(p.dir, name), nil
+}
+
+func (p *LocalProvider) Upload(filename string, content io.Reader, size int64, contentType string) (string, string, error) {
+	path, err := p.path(filename)
+	if err != nil {
+		return "", "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return "", "", err
+	}
+
+	// 先写临时文件再重命名，读取方不会看到写了一半的文件
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".upload-*")
+	if err != nil {
+		return "", "", err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, content); err != nil {
+		tmp.Close()
+		return "", "", fmt.Errorf("failed to write file: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return "", "", err
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		return "", "", err
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return "", "", err
+	}
+	return filename, p.GetURL(filename), nil
+}
+
+// Get 读取文件，文件不存在时返回的错误包装 os.ErrNotExist
+func (p *LocalProvider) Get(storageKey string) (io.ReadCloser, error) {
+	path, err := p.path(storageKey)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+// Delete 删除文件，文件不存在时视为成功
+func (p *LocalProvider) Delete(storageKey string) error {
+	path, err := p.path(storageKey)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return nil
+}
+
+func (p *LocalProvider) GetURL(storageKey string) string {
+	return p.baseURL + "/" + escapeKey(storageKey)
+}
+
+// SignedURL 生成在 ttl 内有效的访问 URL，签名为 HMAC-SHA256(signing_key, "<key>\n<expires>")
+func (p *LocalProvider) SignedURL(storageKey string, ttl time.Duration) (string, error) {
+	if len(p.signingKey) == 0 {
+		return "", errors.New("local storage signing_key is not configured")
+	}
+	expires := p.now().Add(ttl).Unix()
+	return p.GetURL(storageKey) + "?expires=" + strconv.FormatInt(expires, 10) + "&signature=" + p.sign(storageKey, expires), nil
+}
+
+// Signed 是否配置了签名密钥（访问文件需要签名）
+func (p *LocalProvider) Signed() bool {
+	return len(p.signingKey) > 0
+}
+
+func (p *LocalProvider) sign(storageKey string, expires int64) string {
+	mac := hmac.New(sha256.New, p.signingKey)
+	fmt.Fprintf(mac, "%s\n%d", storageKey, expires)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// verify 检查请求中的签名是否有效且未过期
+func (p *LocalProvider) verify(r *http.Request, storageKey string) bool {
+	query := r.URL.Query()
+	expires, err := strconv.ParseInt(query.Get("expires"), 10, 64)
+	if err != nil || p.now().Unix() > expires {
+		return false
+	}
+	return hmac.Equal([]byte(query.Get("signature")), []byte(p.sign(storageKey, expires)))
+}
+
+// RoutePath 返回需要注册文件访问路由的路径（BaseURL 的路径部分）
+func (p *LocalProvider) RoutePath() string {
+	u, _ := url.Parse(p.baseURL)
+	return strings.TrimSuffix(u.Path, "/")
+}
+
+// ServeFile 响应 RoutePath 下的文件请求，storageKey 为去掉路由前缀后的路径
+// 配置了签名密钥时，签名无效或已过期的请求返回 403
+func (p *LocalProvider) ServeFile(w http.ResponseWriter, r *http.Request, storageKey string) {
+	path, err := p.path(storageKey)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	if p.Signed() && !p.verify(r, storageKey) {
+		http.Error(w, "invalid or expired signature", http.StatusForbidden)
+		return
+	}
+	f, err := os.Open(path)
+	if err != nil {
+		http.NotFound(w, r)
+		return
+	}
+	defer f.Close()
+	info, err := f.Stat()
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeContent(w, r, info.Name(), info.ModTime(), f)
+}
+
+// escapeKey 按路径段转义 key，保留分隔符 /
+func escapeKey(storageKey string) string {
+	segments := strings.Split(storageKey, "/")
+	for i, s := range segments {
+		segments[i] = url.PathEscape(s)
+	}
+	return strings.Join(segments, "/")
+}
@@ -0,0 +1,120 @@
+package storage
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/vaaandark/PixelHub/internal/config"
+)
+
+func TestLocalProvider(t *testing.T) {
+	p, err := NewLocalProvider(&config.LocalConfig{Dir: t.TempDir(), BaseURL: "https://img.example.com/files/"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.RoutePath() != "/files" {
+		t.Errorf("RoutePath = %q", p.RoutePath())
+	}
+
+	key, url, err := p.Upload("2025/a b.png", strings.NewReader("image data"), 10, "image/png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if key != "2025/a b.png" || url != "https://img.example.com/files/2025/a%20b.png" {
+		t.Errorf("Upload = %q, %q", key, url)
+	}
+
+	rc, err := p.Get(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(rc)
+	rc.Close()
+	if string(data) != "image data" {
+		t.Errorf("Get = %q", data)
+	}
+
+	w := httptest.NewRecorder()
+	p.ServeFile(w, httptest.NewRequest(http.MethodGet, "/files/2025/a%20b.png", nil), key)
+	if w.Code != http.StatusOK || w.Body.String() != "image data" {
+		t.Errorf("ServeFile = %d %q", w.Code, w.Body.String())
+	}
+
+	for _, bad := range []string{"../escape.png", "/etc/passwd", ""} {
+		if _, _, err := p.Upload(bad, strings.NewReader("x"), 1, "image/png"); err == nil {
+			t.Errorf("Upload(%q) succeeded", bad)
+		}
+		w := httptest.NewRecorder()
+		p.ServeFile(w, httptest.NewRequest(http.MethodGet, "/files/x", nil), bad)
+		if w.Code != http.StatusNotFound {
+			t.Errorf("ServeFile(%q) = %d, want 404", bad, w.Code)
+		}
+	}
+
+	if err := p.Delete(key); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := p.Get(key); !errors.Is(err, os.ErrNotExist) {
+		t.Errorf("Get after delete err = %v, want os.ErrNotExist", err)
+	}
+	if err := p.Delete(key); err != nil {
+		t.Errorf("Delete missing = %v", err)
+	}
+}
+
+func TestLocalSignedURL(t *testing.T) {
+	unsigned, err := NewLocalProvider(&config.LocalConfig{Dir: t.TempDir()})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := unsigned.SignedURL("a.png", time.Hour); err == nil {
+		t.Error("SignedURL without signing_key succeeded")
+	}
+
+	p, err := NewLocalProvider(&config.LocalConfig{Dir: t.TempDir(), SigningKey: "secret"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Unix(1700000000, 0)
+	p.now = func() time.Time { return now }
+	if _, _, err := p.Upload("2025/a b.png", strings.NewReader("image data"), 10, "image/png"); err != nil {
+		t.Fatal(err)
+	}
+
+	signed, err := p.SignedURL("2025/a b.png", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !strings.HasPrefix(signed, "/files/2025/a%20b.png?expires=1700000060&signature=") {
+		t.Fatalf("SignedURL = %q", signed)
+	}
+	serve := func(target string) int {
+		w := httptest.NewRecorder()
+		p.ServeFile(w, httptest.NewRequest(http.MethodGet, target, nil), "2025/a b.png")
+		return w.Code
+	}
+	if code := serve(signed); code != http.StatusOK {
+		t.Errorf("signed request = %d", code)
+	}
+	if code := serve("/files/2025/a%20b.png"); code != http.StatusForbidden {
+		t.Errorf("unsigned request = %d, want 403", code)
+	}
+	if code := serve(strings.Replace(signed, "expires=1700000060", "expires=1700009999", 1)); code != http.StatusForbidden {
+		t.Errorf("request with extended expiry = %d, want 403", code)
+	}
+	other, _ := p.SignedURL("2025/other.png", time.Minute)
+	if code := serve("/files/2025/a%20b.png?" + other[strings.Index(other, "?")+1:]); code != http.StatusForbidden {
+		t.Errorf("signature for another key = %d, want 403", code)
+	}
+
+	now = now.Add(2 * time.Minute)
+	if code := serve(signed); code != http.StatusForbidden {
+		t.Errorf("expired request = %d, want 403", code)
+	}
+}
@@ -0,0 +1,243 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/vaaandark/PixelHub/internal/config"
+)
+
+const (
+	defaultS3Region = "us-east-1"
+	amzTimeFormat   = "20060102T150405Z"
+	// emptyPayloadHash 空请求体的 SHA-256
+	emptyPayloadHash = "e3b0c44298fc1c149afbf4c8996fb92427ae41e4649b934ca495991b7852b855"
+	// maxPresignTTL SigV4 预签名 URL 的最长有效期
+	maxPresignTTL = 7 * 24 * time.Hour
+)
+
+// S3Provider 兼容 S3 API 的对象存储（AWS S3、MinIO 等），请求使用 SigV4 签名
+type S3Provider struct {
+	config   *config.S3Config
+	region   string
+	endpoint *url.URL
+	client   *http.Client
+	now      func() time.Time
+}
+
+func NewS3Provider(cfg *config.S3Config) (*S3Provider, error) {
+	if cfg.Bucket == "" {
+		return nil, errors.New("s3 bucket is required")
+	}
+	region := cfg.Region
+	if region == "" {
+		region = defaultS3Region
+	}
+	endpoint := cfg.Endpoint
+	if endpoint == "" {
+		endpoint = "https://s3." + region + ".amazonaws.com"
+	}
+	u, err := url.Parse(strings.TrimSuffix(endpoint, "/"))
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid s3 endpoint: %q", endpoint)
+	}
+
+	return &S3Provider{
+		config:   cfg,
+		region:   region,
+		endpoint: u,
+		client:   &http.Client{},
+		now:      time.Now,
+	}, nil
+}
+
+// objectLocation 返回对象的主机名和转义后的路径（虚拟主机风格或路径风格）
+func (p *S3Provider) objectLocation(storageKey string) (host, path string) {
+	key := "/" + awsURIEncode(storageKey, false)
+	if p.config.PathStyle {
+		return p.endpoint.Host, p.endpoint.Path + "/" + awsURIEncode(p.config.Bucket, true) + key
+	}
+	return p.config.Bucket + "." + p.endpoint.Host, p.endpoint.Path + key
+}
+
+func (p *S3Provider) Upload(filename string, content io.Reader, size int64, contentType string) (string, string, error) {
+	// PUT 需要请求体哈希（签名的一部分），即使 size 已知也要先写入临时文件
+	tmp, err := os.CreateTemp("", "pixelhub-s3-*")
+	if err != nil {
+		return "", "", err
+	}
+	defer os.Remove(tmp.Name())
+	defer tmp.Close()
+
+	hasher := sha256.New()
+	written, err := io.Copy(io.MultiWriter(tmp, hasher), content)
+	if err != nil {
+		return "", "", fmt.Errorf("failed to read upload content: %w", err)
+	}
+
+	resp, err := p.do(http.MethodPut, filename, io.NewSectionReader(tmp, 0, written), written, hex.EncodeToString(hasher.Sum(nil)), contentType)
+	if err != nil {
+		return "", "", err
+	}
+	resp.Body.Close()
+	return filename, p.GetURL(filename), nil
+}
+
+// Get 读取对象，对象不存在时返回的错误包装 os.ErrNotExist
+func (p *S3Provider) Get(storageKey string) (io.ReadCloser, error) {
+	resp, err := p.do(http.MethodGet, storageKey, nil, 0, emptyPayloadHash, "")
+	if err != nil {
+		return nil, err
+	}
+	return resp.Body, nil
+}
+
+// Delete 删除对象，S3 对不存在的对象同样返回成功
+func (p *S3Provider) Delete(storageKey string) error {
+	resp, err := p.do(http.MethodDelete, storageKey, nil, 0, emptyPayloadHash, "")
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	if resp != nil {
+		resp.Body.Close()
+	}
+	return nil
+}
+
+func (p *S3Provider) GetURL(storageKey string) string {
+	if p.config.PublicURL != "" {
+		return strings.TrimSuffix(p.config.PublicURL, "/") + "/" + awsURIEncode(storageKey, false)
+	}
+	host, path := p.objectLocation(storageKey)
+	return p.endpoint.Scheme + "://" + host + path
+}
+
+// SignedURL 生成 SigV4 预签名的下载 URL（私有存储桶使用），不经过 PublicURL
+func (p *S3Provider) SignedURL(storageKey string, ttl time.Duration) (string, error) {
+	if ttl <= 0 || ttl > maxPresignTTL {
+		return "", fmt.Errorf("s3 presigned URL ttl must be between 1s and %s", maxPresignTTL)
+	}
+	now := p.now().UTC()
+	host, path := p.objectLocation(storageKey)
+	scope := p.credentialScope(now)
+
+	query := map[string]string{
+		"X-Amz-Algorithm":     "AWS4-HMAC-SHA256",
+		"X-Amz-Credential":    p.config.AccessKeyID + "/" + scope,
+		"X-Amz-Date":          now.Format(amzTimeFormat),
+		"X-Amz-Expires":       strconv.Itoa(int(ttl / time.Second)),
+		"X-Amz-SignedHeaders": "host",
+	}
+	canonicalQuery := canonicalQueryString(query)
+	canonicalRequest := strings.Join([]string{
+		http.MethodGet, path, canonicalQuery, "host:" + host + "\n", "host", "UNSIGNED-PAYLOAD",
+	}, "\n")
+
+	signature := p.signature(now, scope, canonicalRequest)
+	return p.endpoint.Scheme + "://" + host + path + "?" + canonicalQuery + "&X-Amz-Signature=" + signature, nil
+}
+
+// do 发送签名后的请求，非 2xx 响应转换为错误（404 包装 os.ErrNotExist）
+func (p *S3Provider) do(method, storageKey string, body io.Reader, size int64, payloadHash, contentType string) (*http.Response, error) {
+	host, path := p.objectLocation(storageKey)
+	req, err := http.NewRequest(method, p.endpoint.Scheme+"://"+host+path, body)
+	if err != nil {
+		return nil, err
+	}
+	req.ContentLength = size
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+
+	now := p.now().UTC()
+	amzDate := now.Format(amzTimeFormat)
+	req.Header.Set("X-Amz-Date", amzDate)
+	req.Header.Set("X-Amz-Content-Sha256", payloadHash)
+	const signedHeaders = "host;x-amz-content-sha256;x-amz-date"
+	canonicalRequest := strings.Join([]string{
+		method, path, "",
+		"host:" + host + "\nx-amz-content-sha256:" + payloadHash + "\nx-amz-date:" + amzDate + "\n",
+		signedHeaders, payloadHash,
+	}, "\n")
+	scope := p.credentialScope(now)
+	req.Header.Set("Authorization", fmt.Sprintf("AWS4-HMAC-SHA256 Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		p.config.AccessKeyID, scope, signedHeaders, p.signature(now, scope, canonicalRequest)))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("s3 %s %s: %w", method, storageKey, err)
+	}
+	if resp.StatusCode >= 200 && resp.StatusCode < 300 {
+		return resp, nil
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode == http.StatusNotFound {
+		return nil, fmt.Errorf("s3 object %s: %w", storageKey, os.ErrNotExist)
+	}
+	msg, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+	return nil, fmt.Errorf("s3 %s %s: status %d: %s", method, storageKey, resp.StatusCode, strings.TrimSpace(string(msg)))
+}
+
+func (p *S3Provider) credentialScope(now time.Time) string {
+	return now.Format("20060102") + "/" + p.region + "/s3/aws4_request"
+}
+
+// signature 计算 SigV4 签名
+func (p *S3Provider) signature(now time.Time, scope, canonicalRequest string) string {
+	sum := sha256.Sum256([]byte(canonicalRequest))
+	stringToSign := "AWS4-HMAC-SHA256\n" + now.Format(amzTimeFormat) + "\n" + scope + "\n" + hex.EncodeToString(sum[:])
+
+	key := hmacSHA256([]byte("AWS4"+p.config.SecretAccessKey), now.Format("20060102"))
+	key = hmacSHA256(key, p.region)
+	key = hmacSHA256(key, "s3")
+	key = hmacSHA256(key, "aws4_request")
+	return hex.EncodeToString(hmacSHA256(key, stringToSign))
+}
+
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// canonicalQueryString 按参数名排序并按 SigV4 规则转义
+func canonicalQueryString(params map[string]string) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+	pairs := make([]string, len(keys))
+	for i, k := range keys {
+		pairs[i] = awsURIEncode(k, true) + "=" + awsURIEncode(params[k], true)
+	}
+	return strings.Join(pairs, "&")
+}
+
+// awsURIEncode 按 SigV4 规则转义：只保留 A-Z a-z 0-9 - _ . ~，encodeSlash 为 false 时保留 /
+func awsURIEncode(s string, encodeSlash bool) string {
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case 'A' <= c && c <= 'Z', 'a' <= c && c <= 'z', '0' <= c && c <= '9', c == '-', c == '_', c == '.', c == '~':
+			b.WriteByte(c)
+		case c == '/' && !encodeSlash:
+			b.WriteByte(c)
+		default:
+			fmt.Fprintf(&b, "%%%02X", c)
+		}
+	}
+	return b.String()
+}
@@ -3,6 +3,7 @@ package storage
 import (
 	"fmt"
 	"io"
+	"time"
 
 	"github.com/vaaandark/PixelHub/internal/config"
 )
@@ -10,7 +11,11 @@ import (
 // Provider 定义存储提供商接口
 type Provider interface {
 	// Upload 上传文件，返回存储 key 和访问 URL
-	Upload(filename string, content io.Reader, contentType string) (storageKey string, url string, err error)
+	// size 为内容长度（字节），未知时传 -1
+	Upload(filename string, content io.Reader, size int64, contentType string) (storageKey string, url string, err error)
+
+	// Get 读取文件内容，调用方负责关闭
+	Get(storageKey string) (io.ReadCloser, error)
 
 	// Delete 删除文件
 	Delete(storageKey string) error
@@ -19,12 +24,27 @@ type Provider interface {
 	GetURL(storageKey string) string
 }
 
+// URLSigner 可选能力：为私有存储中的文件生成有时效的签名 URL
+type URLSigner interface {
+	// SignedURL 生成在 ttl 内有效的访问 URL
+	SignedURL(storageKey string, ttl time.Duration) (string, error)
+}
+
 // NewProvider 根据配置创建存储提供商
 func NewProvider(cfg *config.Config) (Provider, error) {
-	switch cfg.Storage.Provider {
+	return NewProviderByName(cfg, cfg.Storage.Provider)
+}
+
+// NewProviderByName 使用 [storage] 下对应小节的配置创建指定的存储提供商（存储迁移时同时打开新旧两个存储）
+func NewProviderByName(cfg *config.Config, name string) (Provider, error) {
+	switch name {
 	case "tencent-cos":
 		return NewTencentCOSProvider(&cfg.Storage.TencentCOS)
+	case "local":
+		return NewLocalProvider(&cfg.Storage.Local)
+	case "s3":
+		return NewS3Provider(&cfg.Storage.S3)
 	default:
-		return nil, fmt.Errorf("unsupported storage provider: %s", cfg.Storage.Provider)
+		return nil, fmt.Errorf("unsupported storage provider: %s", name)
 	}
 }
@@ -6,7 +6,9 @@ import (
 	"io"
 	"net/http"
 	"net/url"
+	"os"
 	"path"
+	"time"
 
 	"github.com/tencentyun/cos-go-sdk-v5"
 	"github.com/vaaandark/PixelHub/internal/config"
@@ -37,13 +39,32 @@ func NewTencentCOSProvider(cfg *config.TencentCOSConfig) (*TencentCOSProvider, e
 	}, nil
 }
 
-func (p *TencentCOSProvider) Upload(filename string, content io.Reader, contentType string) (string, string, error) {
+func (p *TencentCOSProvider) Upload(filename string, content io.Reader, size int64, contentType string) (string, string, error) {
 	// 使用原始文件名作为 storage key
 	storageKey := filename
 
+	// SDK 只能从 bytes.Buffer、bytes.Reader、strings.Reader 和 os.File 推断长度，
+	// 其他 Reader 必须显式设置 Content-Length，否则以 chunked 方式上传且无法重试
+	if size < 0 {
+		tmp, err := os.CreateTemp("", "pixelhub-cos-*")
+		if err != nil {
+			return "", "", err
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+		if size, err = io.Copy(tmp, content); err != nil {
+			return "", "", fmt.Errorf("failed to read upload content: %w", err)
+		}
+		if _, err := tmp.Seek(0, io.SeekStart); err != nil {
+			return "", "", err
+		}
+		content = tmp
+	}
+
 	opt := &cos.ObjectPutOptions{
 		ObjectPutHeaderOptions: &cos.ObjectPutHeaderOptions{
-			ContentType: contentType,
+			ContentType:   contentType,
+			ContentLength: size,
 		},
 	}
 
@@ -56,6 +77,14 @@ func (p *TencentCOSProvider) Upload(filename string, content io.Reader, contentT
 	return storageKey, url, nil
 }
 
+func (p *TencentCOSProvider) Get(storageKey string) (io.ReadCloser, error) {
+	resp, err := p.client.Object.Get(context.Background(), storageKey, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get from COS: %w", err)
+	}
+	return resp.Body, nil
+}
+
 func (p *TencentCOSProvider) Delete(storageKey string) error {
 	_, err := p.client.Object.Delete(context.Background(), storageKey)
 	if err != nil {
@@ -73,6 +102,17 @@ func (p *TencentCOSProvider) GetURL(storageKey string) string {
 	return p.config.BucketURL + "/" + storageKey
 }
 
+// SignedURL 生成预签名的下载 URL（私有读存储桶使用）
+// 签名绑定存储桶域名，因此不经过 CDN
+func (p *TencentCOSProvider) SignedURL(storageKey string, ttl time.Duration) (string, error) {
+	u, err := p.client.Object.GetPresignedURL(context.Background(), http.MethodGet, storageKey,
+		p.config.SecretID, p.config.SecretKey, ttl, nil)
+	if err != nil {
+		return "", fmt.Errorf("failed to presign COS URL: %w", err)
+	}
+	return u.String(), nil
+}
+
 // GenerateStorageKey 生成存储 key（可以加上时间戳、UUID 等）
 func GenerateStorageKey(originalFilename string) string {
 	// 简单实现：保留文件扩展名
@@ -17,7 +17,8 @@ def get_pixelhub_client() -> httpx.Client:
             timeout=30.0,
             headers={
                 "Content-Type": "application/json",
-                "User-Agent": "PixelHub-MCP-Server/0.1.0"
+                "User-Agent": "PixelHub-MCP-Server/0.1.0",
+                "X-Actor": "mcp"
             }
         )
     
@@ -31,7 +32,8 @@ async def get_async_pixelhub_client() -> httpx.AsyncClient:
         timeout=30.0,
         headers={
             "Content-Type": "application/json",
-            "User-Agent": "PixelHub-MCP-Server/0.1.0"
+            "User-Agent": "PixelHub-MCP-Server/0.1.0",
+            "X-Actor": "mcp"
         }
     )
 
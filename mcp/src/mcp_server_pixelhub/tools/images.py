@@ -117,3 +117,48 @@ async def search_images_by_tags(
         
     except Exception as e:
         return handle_error("search_images_by_tags", e)
+
+
+@mcp.tool(
+    name="upload_image_from_url",
+    description="Upload an image to PixelHub from a public http(s) URL. The server downloads the image itself, so only the URL is needed. Returns the new image ID and its PixelHub URL.",
+)
+async def upload_image_from_url(
+    url: str = Field(
+        description="Public http or https URL of the image (JPEG, PNG, GIF, WebP or BMP)",
+    ),
+    description: str = Field(
+        default="",
+        description="Optional description of the image",
+    ),
+) -> list[types.TextContent | types.ImageContent | types.EmbeddedResource]:
+    """
+    Upload an image by URL.
+
+    The PixelHub server fetches the image, so private network addresses, non-image
+    content and oversized files are rejected by the server.
+    """
+    try:
+        if not url:
+            return [types.TextContent(type="text", text="Error: url is required")]
+
+        response = make_request("POST", "/images/upload-url", {
+            "url": url,
+            "description": description,
+        })
+
+        if not response or response.get("code") != 201:
+            return handle_error("upload_image_from_url")
+
+        data = response.get("data", {})
+        result_text = "Image uploaded successfully.\n\n"
+        result_text += f"Image ID: {data.get('image_id', 'Unknown')}\n"
+        result_text += f"URL: {data.get('url', '')}\n"
+        result_text += f"Source URL: {data.get('source_url', url)}\n"
+        if data.get("description"):
+            result_text += f"Description: {data.get('description')}\n"
+
+        return [types.TextContent(type="text", text=result_text)]
+
+    except Exception as e:
+        return handle_error("upload_image_from_url", e)
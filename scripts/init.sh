@@ -41,7 +41,7 @@ mkdir -p data
 echo ""
 echo "🔨 编译项目..."
 mkdir -p bin
-go build -o bin/pixelhub cmd/server/main.go
+go build -o bin/pixelhub ./cmd/server
 
 echo ""
 echo "✅ 初始化完成！"
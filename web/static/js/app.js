@@ -4,7 +4,10 @@ const API_BASE = '/api/v1';
 let currentPage = 1;
 let currentImageId = null;
 let tagsPage = 1;
+let tagsCursor = ''; // 标签列表下一页游标
 let galleryPage = 1;
+let galleryCursors = ['']; // 图库每一页的起始游标（下标为页码 - 1）
+let galleryNextCursor = '';
 let gallerySort = 'date_desc';
 let totalImages = 0;
 let currentTags = []; // 当前编辑的标签列表
@@ -16,7 +19,6 @@ let allImageIds = []; // 所有图片的 ID 列表（用于全选）
 // DOM 元素
 const uploadArea = document.getElementById('uploadArea');
 const fileInput = document.getElementById('fileInput');
-const uploadResult = document.getElementById('uploadResult');
 const searchInput = document.getElementById('searchInput');
 const searchBtn = document.getElementById('searchBtn');
 const searchResults = document.getElementById('searchResults');
@@ -32,6 +34,7 @@ document.addEventListener('DOMContentLoaded', () => {
     initGallery();
     loadTags();
     initModal();
+    initLiveUpdates();
 });
 
 // 上传功能
@@ -47,10 +50,11 @@ function initUpload() {
         uploadArea.classList.remove('dragging');
     });
     
-    uploadArea.addEventListener('drop', (e) => {
+    uploadArea.addEventListener('drop', async (e) => {
         e.preventDefault();
         uploadArea.classList.remove('dragging');
-        const files = Array.from(e.dataTransfer.files).filter(f => f.type.startsWith('image/'));
+        // 拖入的文件夹需要通过 webkitGetAsEntry 递归读取
+        const files = await collectDroppedFiles(e.dataTransfer);
         if (files.length > 0) {
             handleFiles(files);
         }
@@ -62,99 +66,244 @@ function initUpload() {
             handleFiles(files);
         }
     });
+    
+    // 粘贴截图或复制的图片文件（输入框中的普通文本粘贴不受影响）
+    document.addEventListener('paste', (e) => {
+        const files = Array.from(e.clipboardData ? e.clipboardData.items : [])
+            .filter(item => item.kind === 'file' && item.type.startsWith('image/'))
+            .map(item => item.getAsFile())
+            .filter(file => file)
+            .map(renamePastedFile);
+        if (files.length > 0) {
+            e.preventDefault();
+            handleFiles(files);
+        }
+    });
 }
 
-// 处理文件上传（单个或多个）
-function handleFiles(files) {
-    if (files.length === 1) {
-        uploadSingleFile(files[0]);
-    } else {
-        uploadMultipleFiles(files);
+// 截图粘贴时浏览器给出的文件名通常都是 image.png，改为带时间戳的名字
+function renamePastedFile(file, index) {
+    if (file.name && file.name !== 'image.png') {
+        return file;
     }
+    const ext = (file.type.split('/')[1] || 'png').replace('jpeg', 'jpg');
+    const stamp = new Date().toISOString().replace(/[-:]/g, '').replace('T', '-').slice(0, 15);
+    return new File([file], `paste-${stamp}${index ? '-' + index : ''}.${ext}`, { type: file.type });
 }
 
-// 单文件上传
-async function uploadSingleFile(file) {
-    const formData = new FormData();
-    formData.append('file', file);
-    
-    // 添加描述（如果有）
-    const description = document.getElementById('uploadDescription').value.trim();
-    if (description) {
-        formData.append('description', description);
+// 读取拖入的文件和文件夹（递归），只保留图片
+async function collectDroppedFiles(dataTransfer) {
+    const entries = Array.from(dataTransfer.items || [])
+        .map(item => item.webkitGetAsEntry ? item.webkitGetAsEntry() : null)
+        .filter(entry => entry);
+    
+    // 不支持 webkitGetAsEntry 的浏览器只能拿到顶层文件
+    if (entries.length === 0) {
+        return Array.from(dataTransfer.files).filter(isImageFile);
     }
     
-    try {
-        uploadResult.classList.remove('hidden', 'error');
-        uploadResult.textContent = '上传中...';
+    const files = [];
+    const walk = async (entry) => {
+        if (entry.isFile) {
+            const file = await new Promise((resolve, reject) => entry.file(resolve, reject));
+            if (isImageFile(file)) {
+                files.push(file);
+            }
+        } else if (entry.isDirectory) {
+            const reader = entry.createReader();
+            // readEntries 每次只返回一部分，需要读到返回空数组为止
+            let batch;
+            do {
+                batch = await new Promise((resolve, reject) => reader.readEntries(resolve, reject));
+                for (const child of batch) {
+                    if (!child.name.startsWith('.')) {
+                        await walk(child);
+                    }
+                }
+            } while (batch.length > 0);
+        }
+    };
+    for (const entry of entries) {
+        await walk(entry);
+    }
+    return files;
+}
+
+function isImageFile(file) {
+    return file.type.startsWith('image/') || /\.(jpe?g|png|gif|webp|bmp|tiff?)$/i.test(file.name);
+}
+
+// 处理文件上传（单个或多个）：每个文件单独上传并显示进度，完成后请求 AI 标签建议
+async function handleFiles(files) {
+    // 描述只用于单图上传
+    const description = files.length === 1 ? document.getElementById('uploadDescription').value.trim() : '';
+    
+    const queue = document.getElementById('uploadQueue');
+    queue.classList.remove('hidden');
+    queue.innerHTML = `
+        <div class="upload-queue-summary" id="uploadQueueSummary">正在上传 ${files.length} 张图片...</div>
+        ${files.map((file, i) => `
+            <div class="upload-item" id="uploadItem_${i}">
+                <div class="upload-item-header">
+                    <span class="upload-item-name">${escapeHtml(file.webkitRelativePath || file.name)}</span>
+                    <span class="upload-item-status" id="uploadStatus_${i}">等待中</span>
+                </div>
+                <div class="upload-progress"><div class="upload-progress-bar" id="uploadProgress_${i}"></div></div>
+                <div class="upload-suggestions hidden" id="uploadSuggestions_${i}"></div>
+            </div>
+        `).join('')}
+    `;
+    
+    const tasks = files.map((file, i) => async () => {
+        const status = document.getElementById(`uploadStatus_${i}`);
+        const bar = document.getElementById(`uploadProgress_${i}`);
+        try {
+            const result = await uploadFileWithProgress(file, description, (percent) => {
+                bar.style.width = `${percent}%`;
+                status.textContent = percent < 100 ? `${percent}%` : '处理中...';
+            });
+            bar.style.width = '100%';
+            bar.classList.add('done');
+            status.innerHTML = `✅ <a href="#" onclick="showImageDetail('${result.image_id}'); return false;">查看</a>`;
+            suggestTags(result, i);
+            return result;
+        } catch (error) {
+            bar.classList.add('failed');
+            status.textContent = `✗ ${error.message}`;
+            throw error;
+        }
+    });
+    
+    const results = await runWithConcurrency(tasks, 3);
+    const uploaded = results.filter(r => r.success).map(r => r.result);
+    const failed = results.length - uploaded.length;
+    
+    document.getElementById('uploadQueueSummary').innerHTML = `
+        <p>上传完成：成功 ${uploaded.length} 张${failed > 0 ? `，失败 ${failed} 张` : ''}</p>
+        ${uploaded.length > 0 ? `<button onclick="showBatchEdit(${JSON.stringify(uploaded).replace(/"/g, '&quot;')})" class="btn btn-secondary btn-sm">修改描述或添加标签</button>` : ''}
+    `;
+    
+    fileInput.value = '';
+    document.getElementById('uploadDescription').value = '';
+    
+    // 刷新图片列表
+    if (uploaded.length > 0) {
+        loadGallery();
+    }
+}
+
+// 以原始请求体上传单个文件（XHR 才能获得上传进度），文件名和描述通过请求头传递
+function uploadFileWithProgress(file, description, onProgress) {
+    return new Promise((resolve, reject) => {
+        const xhr = new XMLHttpRequest();
+        xhr.open('POST', `${API_BASE}/images/upload`);
+        xhr.setRequestHeader('Content-Type', file.type || 'application/octet-stream');
+        xhr.setRequestHeader('X-Filename', encodeURIComponent(file.name));
+        if (description) {
+            xhr.setRequestHeader('X-Description', encodeURIComponent(description));
+        }
         
-        const response = await fetch(`${API_BASE}/images/upload`, {
+        xhr.upload.onprogress = (e) => {
+            if (e.lengthComputable) {
+                onProgress(Math.round(e.loaded / e.total * 100));
+            }
+        };
+        xhr.onload = () => {
+            let data;
+            try {
+                data = JSON.parse(xhr.responseText);
+            } catch (e) {
+                reject(new Error(`HTTP ${xhr.status}`));
+                return;
+            }
+            if (data.code === 201) {
+                resolve(data.data);
+            } else {
+                reject(new Error(data.message || `HTTP ${xhr.status}`));
+            }
+        };
+        xhr.onerror = () => reject(new Error('网络错误'));
+        xhr.send(file);
+    });
+}
+
+// 上传完成后请求 AI 生成描述和标签建议，点击标签单独采用，也可以全部采用
+async function suggestTags(image, index) {
+    const container = document.getElementById(`uploadSuggestions_${index}`);
+    container.classList.remove('hidden');
+    container.innerHTML = '<span class="suggestion-loading">⏳ AI 正在生成标签建议...</span>';
+    
+    try {
+        const response = await fetch(`${API_BASE}/images/${image.image_id}/tags/generate`, {
             method: 'POST',
-            body: formData
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({})
         });
-        
         const data = await response.json();
         
-        if (data.code === 201) {
-            uploadResult.innerHTML = `
-                <p>✅ 上传成功！</p>
-                <p><strong>图片 ID:</strong> ${data.data.image_id}</p>
-                <p><strong>URL:</strong> <a href="${data.data.url}" target="_blank">${data.data.url}</a></p>
-                ${data.data.description ? `<p><strong>描述:</strong> ${data.data.description}</p>` : ''}
-                <button onclick="showImageDetail('${data.data.image_id}')" class="btn btn-secondary" style="margin-top: 0.5rem;">修改描述或添加标签</button>
-            `;
-            fileInput.value = '';
-            document.getElementById('uploadDescription').value = '';
-            // 刷新图片列表
-            loadGallery();
-        } else {
-            throw new Error(data.message);
+        // 未配置 LLM 时不显示建议
+        if (data.code === 503 && data.message === 'LLM service not configured') {
+            container.classList.add('hidden');
+            return;
+        }
+        if (data.code !== 200) {
+            throw new Error(data.message || '生成失败');
         }
+        
+        const tags = data.data.generated_tags || [];
+        const suggestedDescription = data.data.generated_description || '';
+        image.suggestedTags = tags;
+        image.suggestedDescription = suggestedDescription;
+        
+        container.innerHTML = `
+            <div class="suggestion-tags">
+                ${tags.map(tag => `<span class="suggestion-tag" title="点击添加" onclick="applySuggestedTags('${image.image_id}', [this.textContent], this)">${escapeHtml(tag)}</span>`).join('')}
+            </div>
+            ${suggestedDescription ? `<p class="suggestion-description">${escapeHtml(suggestedDescription)}</p>` : ''}
+            <button class="btn btn-success btn-sm" id="applyAll_${index}">全部采用</button>
+        `;
+        document.getElementById(`applyAll_${index}`).onclick = async (e) => {
+            const btn = e.target;
+            btn.disabled = true;
+            // 没有手动填写描述时一并采用生成的描述
+            if (!image.description && suggestedDescription) {
+                await fetch(`${API_BASE}/images/${image.image_id}`, {
+                    method: 'PUT',
+                    headers: { 'Content-Type': 'application/json' },
+                    body: JSON.stringify({ description: suggestedDescription })
+                });
+            }
+            if (tags.length > 0) {
+                await applySuggestedTags(image.image_id, tags, null);
+            }
+            container.querySelectorAll('.suggestion-tag').forEach(el => el.classList.add('applied'));
+            btn.textContent = '✓ 已采用';
+        };
     } catch (error) {
-        uploadResult.classList.add('error');
-        uploadResult.textContent = `上传失败: ${error.message}`;
+        container.innerHTML = `<span class="suggestion-error">✗ 标签建议失败: ${escapeHtml(error.message)}</span>`;
     }
 }
 
-// 批量上传
-async function uploadMultipleFiles(files) {
-    const formData = new FormData();
-    files.forEach(file => {
-        formData.append('files', file);
-    });
-    
+// 把建议的标签追加到图片上
+async function applySuggestedTags(imageId, tags, element) {
+    if (element && element.classList.contains('applied')) {
+        return;
+    }
     try {
-        uploadResult.classList.remove('hidden', 'error');
-        uploadResult.textContent = `正在上传 ${files.length} 张图片...`;
-        
-        const response = await fetch(`${API_BASE}/images/batch-upload`, {
-            method: 'POST',
-            body: formData
+        const response = await fetch(`${API_BASE}/images/${imageId}/tags`, {
+            method: 'PUT',
+            headers: { 'Content-Type': 'application/json' },
+            body: JSON.stringify({ tags, mode: 'append' })
         });
-        
-        const data = await response.json();
-        
-        if (data.code === 200) {
-            const { total, success, failed, results } = data.data;
-            
-            uploadResult.innerHTML = `
-                <p>✅ 批量上传完成！</p>
-                <p>总计: ${total} 张，成功: ${success} 张，失败: ${failed} 张</p>
-                ${failed > 0 ? `<p class="error">失败的文件：${results.filter(r => r.status === 'failed').map(r => r.filename).join(', ')}</p>` : ''}
-                <button onclick="showBatchEdit(${JSON.stringify(results.filter(r => r.status === 'success')).replace(/"/g, '&quot;')})" class="btn btn-primary" style="margin-top: 0.5rem;">修改描述或添加标签</button>
-            `;
-            
-            fileInput.value = '';
-            document.getElementById('uploadDescription').value = '';
-            
-            // 刷新图片列表
-            loadGallery();
-        } else {
-            throw new Error(data.message);
+        if (!response.ok) {
+            throw new Error('标签更新失败');
+        }
+        if (element) {
+            element.classList.add('applied');
         }
+        loadTags();
     } catch (error) {
-        uploadResult.classList.add('error');
-        uploadResult.textContent = `批量上传失败: ${error.message}`;
+        alert(error.message);
     }
 }
 
@@ -218,6 +367,7 @@ function initGallery() {
     sortSelect.addEventListener('change', (e) => {
         gallerySort = e.target.value;
         galleryPage = 1;
+        galleryCursors = [''];
         loadGallery();
     });
     
@@ -229,8 +379,8 @@ function initGallery() {
     });
     
     nextPageBtn.addEventListener('click', () => {
-        const maxPage = Math.ceil(totalImages / 20);
-        if (galleryPage < maxPage) {
+        if (galleryNextCursor) {
+            galleryCursors[galleryPage] = galleryNextCursor;
             galleryPage++;
             loadGallery();
         }
@@ -253,13 +403,16 @@ async function loadGallery() {
     galleryGrid.innerHTML = '<p style="text-align:center;color:#64748b;">加载中...</p>';
     
     try {
+        // 使用游标分页，翻页期间有新图片上传也不会出现重复
+        const cursor = galleryCursors[galleryPage - 1] || '';
         const response = await fetch(
-            `${API_BASE}/images?page=${galleryPage}&limit=20&sort=${gallerySort}`
+            `${API_BASE}/images?limit=20&sort=${gallerySort}&cursor=${encodeURIComponent(cursor)}`
         );
         const data = await response.json();
         
         if (data.code === 200) {
             totalImages = data.data.total;
+            galleryNextCursor = data.data.next_cursor || '';
             document.getElementById('totalImages').textContent = totalImages;
             document.getElementById('pageInfo').textContent = `第 ${galleryPage} 页`;
             
@@ -267,7 +420,7 @@ async function loadGallery() {
             const prevBtn = document.getElementById('prevPageBtn');
             const nextBtn = document.getElementById('nextPageBtn');
             prevBtn.disabled = galleryPage === 1;
-            nextBtn.disabled = galleryPage >= Math.ceil(totalImages / 20);
+            nextBtn.disabled = !galleryNextCursor;
             
             // 显示图片
             if (data.data.images && data.data.images.length > 0) {
@@ -330,7 +483,8 @@ function formatDate(dateStr) {
 // 标签功能
 async function loadTags() {
     try {
-        const response = await fetch(`${API_BASE}/tags?page=${tagsPage}&limit=50`);
+        const cursor = tagsPage === 1 ? '' : tagsCursor;
+        const response = await fetch(`${API_BASE}/tags?limit=50&cursor=${encodeURIComponent(cursor)}`);
         const data = await response.json();
         
         if (data.code === 200 && data.data.tags) {
@@ -348,7 +502,8 @@ async function loadTags() {
             }
             
             // 如果还有更多标签，显示加载更多按钮
-            if (tagsPage * 50 < data.data.total) {
+            tagsCursor = data.data.next_cursor || '';
+            if (tagsCursor) {
                 loadMoreTags.style.display = 'block';
             } else {
                 loadMoreTags.style.display = 'none';
@@ -364,6 +519,32 @@ loadMoreTags.addEventListener('click', () => {
     loadTags();
 });
 
+// 实时更新：通过事件流获知其他人（或 MCP）的上传、删除和标签修改，刷新图库第一页和标签列表
+function initLiveUpdates() {
+    if (!window.EventSource) return;
+
+    let refreshTimer = null;
+    const scheduleRefresh = () => {
+        // 短时间内的多个事件（例如批量上传）合并为一次刷新
+        clearTimeout(refreshTimer);
+        refreshTimer = setTimeout(() => {
+            // 翻页或批量选择时不刷新，避免打断当前操作
+            if (galleryPage === 1 && !batchSelectMode) {
+                loadGallery();
+            }
+            if (tagsPage === 1) {
+                loadTags();
+            }
+        }, 1000);
+    };
+
+    // 断线后浏览器自动重连并通过 Last-Event-ID 续传
+    const source = new EventSource(`${API_BASE}/events?types=image.`);
+    source.onmessage = scheduleRefresh;
+    // 错过的事件已无法续传，重新加载
+    source.addEventListener('resync', scheduleRefresh);
+}
+
 function searchByTag(tag) {
     searchInput.value = tag;
     performSearch();
@@ -1150,7 +1331,7 @@ async function toggleSelectAllImages() {
             let total = 0;
             
             // 先获取第一页，获取 total
-            const firstResponse = await fetch(`${API_BASE}/images?page=${page}&limit=${limit}`);
+            const firstResponse = await fetch(`${API_BASE}/images?limit=${limit}`);
             const firstData = await firstResponse.json();
             
             if (firstData.code !== 200 || !firstData.data.images) {
@@ -1162,18 +1343,22 @@ async function toggleSelectAllImages() {
             allImageIds = firstData.data.images.map(img => img.id);
             console.log(`[全选] 第1页：获取 ${firstData.data.images.length} 个 ID，总数 ${total}`);
             
-            // 计算总页数，继续获取剩余页
+            // 沿着游标继续获取剩余页
             const totalPages = Math.ceil(total / limit);
-            for (page = 2; page <= totalPages; page++) {
+            let cursor = firstData.data.next_cursor;
+            while (cursor) {
+                page++;
                 btn.textContent = `加载中 (${page}/${totalPages})`;
-                const response = await fetch(`${API_BASE}/images?page=${page}&limit=${limit}`);
+                const response = await fetch(`${API_BASE}/images?limit=${limit}&cursor=${encodeURIComponent(cursor)}`);
                 const data = await response.json();
                 
-                if (data.code === 200 && data.data.images) {
-                    const pageIds = data.data.images.map(img => img.id);
-                    allImageIds = allImageIds.concat(pageIds);
-                    console.log(`[全选] 第${page}页：获取 ${pageIds.length} 个 ID，累计 ${allImageIds.length} 个`);
+                if (data.code !== 200 || !data.data.images) {
+                    break;
                 }
+                const pageIds = data.data.images.map(img => img.id);
+                allImageIds = allImageIds.concat(pageIds);
+                console.log(`[全选] 第${page}页：获取 ${pageIds.length} 个 ID，累计 ${allImageIds.length} 个`);
+                cursor = data.data.next_cursor;
             }
             
             console.log(`[全选] 加载完成，共 ${allImageIds.length} 个图片 ID`);